@@ -0,0 +1,552 @@
+// Package agentsdk implements the LoopStacks bidding protocol for agents
+// written in Go (`language: go`). An agent registers itself, listens for
+// loop announcements matching its capabilities, bids on them and, once
+// selected, executes the loop and submits its result.
+//
+// Of the operator, the SDK only depends on its protocol messages. Package
+// transport connects agents to the coordination backend of their realm.
+package agentsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+const (
+	// DefaultHeartbeatInterval is how often the registration is refreshed
+	DefaultHeartbeatInterval = 30 * time.Second
+	// DefaultMaxConcurrency bounds the loops an agent executes at once
+	DefaultMaxConcurrency = 4
+
+	announcementCacheTTL = time.Hour
+)
+
+// Task is handed to the Handler when the agent has been selected for a loop
+type Task struct {
+	LoopID       string
+	LoopStack    string
+	Realm        string
+	Capabilities []string
+	Input        json.RawMessage
+	// Steps are the outputs of the workflow steps completed before this
+	// one, by step name
+	Steps map[string]json.RawMessage
+	// Settings are the agent's settings when the task started
+	Settings Settings
+}
+
+// Handler executes loops the agent was selected for. The returned value is
+// marshalled to JSON and validated against the output schema. The context
+// carries a logger tagged with the loop id, see logr.FromContextOrDiscard;
+// the operator uses the tag to find an execution's agent logs.
+type Handler interface {
+	Execute(ctx context.Context, task Task) (interface{}, error)
+}
+
+// HandlerFunc adapts a function to the Handler interface
+type HandlerFunc func(ctx context.Context, task Task) (interface{}, error)
+
+// Execute implements Handler
+func (f HandlerFunc) Execute(ctx context.Context, task Task) (interface{}, error) {
+	return f(ctx, task)
+}
+
+// Bidder can be implemented by a Handler to decide whether, and with what
+// confidence, to bid on an announced loop. Returning a nil BidDecision skips
+// the loop. Handlers without a Bidder bid on every matching loop with a
+// confidence of 1.
+type Bidder interface {
+	Bid(ctx context.Context, announcement protocol.LoopAnnouncement) (*BidDecision, error)
+}
+
+// BidDecision is a Bidder's answer to an announcement
+type BidDecision struct {
+	Confidence float64
+}
+
+// Config configures an Agent
+type Config struct {
+	// AgentID uniquely identifies this agent process, usually the pod name
+	AgentID string
+	// Agent is the name of the Agent resource this process implements
+	Agent string
+	// AgentInstance is the name of the AgentInstance that deployed this process
+	AgentInstance string
+	// Pod is the name of the pod this process runs in. The operator matches
+	// it against the AgentInstance's pods to detect agents that never
+	// registered.
+	Pod string
+	// Revision is the AgentInstance revision the pod was deployed from.
+	// Rollouts route loops to agents by revision.
+	Revision string
+	// Realm restricts the agent to loops announced in this realm
+	Realm string
+	// Capabilities the agent bids with
+	Capabilities []string
+	// InputSchema and OutputSchema are the Agent's JSON schemas
+	InputSchema  []byte
+	OutputSchema []byte
+	// ConfigDir holds the AgentInstance's config and secrets, see Settings
+	ConfigDir string
+	// ConfigReloadInterval is how often ConfigDir is checked for changes
+	ConfigReloadInterval time.Duration
+
+	// Backend transports the bidding protocol. Run closes it on return.
+	Backend Backend
+
+	HeartbeatInterval time.Duration
+	MaxConcurrency    int
+
+	Log logr.Logger
+}
+
+// Agent is a running participant in the bidding protocol
+type Agent struct {
+	cfg     Config
+	handler Handler
+	log     logr.Logger
+
+	input  *validator
+	output *validator
+
+	backend Backend
+
+	mu            sync.Mutex
+	announcements map[string]cachedAnnouncement
+	settings      Settings
+
+	slots chan struct{}
+	// wg counts in-flight executions, and active, guarded by mu, reports
+	// them in heartbeats. draining, guarded by mu, stops new ones from being
+	// added once Run has started waiting for them.
+	wg       sync.WaitGroup
+	active   int32
+	draining bool
+}
+
+type cachedAnnouncement struct {
+	announcement protocol.LoopAnnouncement
+	expires      time.Time
+}
+
+// New validates cfg and creates an Agent
+func New(cfg Config, handler Handler) (*Agent, error) {
+	if cfg.AgentID == "" {
+		return nil, errors.New("agent id is required")
+	}
+	if len(cfg.Capabilities) == 0 {
+		return nil, errors.New("at least one capability is required")
+	}
+	if handler == nil {
+		return nil, errors.New("handler is required")
+	}
+	if cfg.Backend == nil {
+		return nil, errors.New("backend is required")
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if cfg.MaxConcurrency <= 0 {
+		cfg.MaxConcurrency = DefaultMaxConcurrency
+	}
+	if cfg.ConfigReloadInterval <= 0 {
+		cfg.ConfigReloadInterval = DefaultConfigReloadInterval
+	}
+	if cfg.Log.GetSink() == nil {
+		cfg.Log = logr.Discard()
+	}
+
+	input, err := compile(cfg.InputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("input schema: %w", err)
+	}
+	output, err := compile(cfg.OutputSchema)
+	if err != nil {
+		return nil, fmt.Errorf("output schema: %w", err)
+	}
+	settings, err := LoadSettings(cfg.ConfigDir)
+	if err != nil {
+		return nil, fmt.Errorf("settings: %w", err)
+	}
+
+	return &Agent{
+		cfg:           cfg,
+		handler:       handler,
+		log:           cfg.Log.WithValues("agentId", cfg.AgentID),
+		input:         input,
+		output:        output,
+		backend:       cfg.Backend,
+		announcements: make(map[string]cachedAnnouncement),
+		settings:      settings,
+		slots:         make(chan struct{}, cfg.MaxConcurrency),
+	}, nil
+}
+
+// Run registers the agent and takes part in bidding until ctx is cancelled
+// or a subscription fails. In-flight executions are allowed to finish and
+// the agent deregisters before Run returns.
+func (a *Agent) Run(ctx context.Context) error {
+	defer a.backend.Close()
+
+	registeredAt := time.Now()
+	if err := a.heartbeat(ctx, registeredAt); err != nil {
+		return fmt.Errorf("failed to register agent: %w", err)
+	}
+	a.log.Info("Agent registered", "capabilities", a.cfg.Capabilities)
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var subs sync.WaitGroup
+	errs := make(chan error, 2)
+	subs.Add(2)
+	go func() {
+		defer subs.Done()
+		errs <- a.backend.SubscribeAnnouncements(subCtx, a.cfg.AgentID, a.onAnnouncement)
+	}()
+	go func() {
+		defer subs.Done()
+		errs <- a.backend.SubscribeSelections(subCtx, a.cfg.AgentID, a.onSelection)
+	}()
+	if a.cfg.ConfigDir != "" {
+		go a.watchSettings(subCtx)
+	}
+
+	ticker := time.NewTicker(a.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			cancel()
+			subs.Wait()
+			a.drain(registeredAt)
+			a.deregister()
+			return nil
+		case <-ticker.C:
+			if err := a.heartbeat(ctx, registeredAt); err != nil {
+				a.log.Error(err, "Failed to send heartbeat")
+			}
+		case err := <-errs:
+			if ctx.Err() != nil {
+				continue
+			}
+			cancel()
+			subs.Wait()
+			a.drain(registeredAt)
+			a.deregister()
+			if err == nil {
+				err = errors.New("subscription closed")
+			}
+			return fmt.Errorf("subscription failed: %w", err)
+		}
+	}
+}
+
+// drain stops new executions from starting and waits for in-flight ones
+// to finish. Heartbeats go on meanwhile, reporting the agent draining and
+// the loops it is still executing.
+func (a *Agent) drain(registeredAt time.Time) {
+	a.mu.Lock()
+	a.draining = true
+	a.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(a.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), a.cfg.HeartbeatInterval)
+		if err := a.heartbeat(ctx, registeredAt); err != nil {
+			a.log.Error(err, "Failed to send heartbeat while draining")
+		}
+		cancel()
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// onAnnouncement bids on an announced loop. Bidding failures are logged
+// rather than returned so one bad loop does not stop the subscription.
+func (a *Agent) onAnnouncement(ctx context.Context, announcement *protocol.LoopAnnouncement) error {
+	if err := a.handleAnnouncement(ctx, *announcement); err != nil {
+		a.log.Error(err, "Failed to bid", "loopId", announcement.LoopID)
+	}
+	return nil
+}
+
+func (a *Agent) onSelection(ctx context.Context, selection *protocol.Selection) error {
+	a.handleSelection(ctx, *selection)
+	return nil
+}
+
+func (a *Agent) handleAnnouncement(ctx context.Context, announcement protocol.LoopAnnouncement) error {
+	if a.cfg.Realm != "" && announcement.Realm != "" && announcement.Realm != a.cfg.Realm {
+		return nil
+	}
+
+	matched := intersect(a.cfg.Capabilities, announcement.Capabilities)
+	if len(matched) == 0 {
+		return nil
+	}
+
+	ctx, span := tracer().Start(extract(ctx, announcement.TraceContext), "agent.bid", trace.WithAttributes(
+		attribute.String("loopstacks.loop_id", announcement.LoopID),
+		attribute.String("loopstacks.agent_id", a.cfg.AgentID),
+	))
+	confidence, err := a.bid(ctx, announcement, matched)
+	if err == nil {
+		span.SetAttributes(attribute.Bool("loopstacks.bid", confidence > 0), attribute.Float64("loopstacks.confidence", confidence))
+	}
+	end(span, err)
+	return err
+}
+
+// bid decides whether to bid on an announcement and submits the bid,
+// returning its confidence or 0 when the agent did not bid
+func (a *Agent) bid(ctx context.Context, announcement protocol.LoopAnnouncement, matched []string) (float64, error) {
+	// Never bid on input we would reject at execution time
+	if len(announcement.Input) > 0 {
+		if err := a.input.validate(announcement.Input); err != nil {
+			a.log.V(1).Info("Skipping loop with input not matching schema", "loopId", announcement.LoopID, "reason", err.Error())
+			return 0, nil
+		}
+	}
+
+	confidence := 1.0
+	if bidder, ok := a.handler.(Bidder); ok {
+		decision, err := bidder.Bid(ctx, announcement)
+		if err != nil {
+			return 0, err
+		}
+		if decision == nil {
+			return 0, nil
+		}
+		confidence = decision.Confidence
+	}
+
+	a.remember(announcement)
+
+	bid := protocol.Bid{
+		LoopID:       announcement.LoopID,
+		AgentID:      a.cfg.AgentID,
+		Timestamp:    time.Now().UnixMilli(),
+		Confidence:   confidence,
+		Capabilities: matched,
+	}
+	inject(ctx, &bid.TraceContext)
+	if err := a.backend.Bid(ctx, &bid); err != nil {
+		return 0, err
+	}
+
+	a.log.Info("Submitted bid", "loopId", announcement.LoopID, "confidence", confidence)
+	return confidence, nil
+}
+
+func (a *Agent) handleSelection(ctx context.Context, selection protocol.Selection) {
+	select {
+	case a.slots <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+
+	a.mu.Lock()
+	if a.draining {
+		a.mu.Unlock()
+		<-a.slots
+		return
+	}
+	a.wg.Add(1)
+	a.active++
+	a.mu.Unlock()
+
+	go func() {
+		defer a.wg.Done()
+		defer func() {
+			a.mu.Lock()
+			a.active--
+			a.mu.Unlock()
+		}()
+		defer func() { <-a.slots }()
+
+		log := a.log.WithValues("loopId", selection.LoopID)
+		log.Info("Selected for loop")
+
+		// Loops run to completion and their results are submitted even if
+		// the agent is shutting down, within its pod's termination grace
+		// period
+		ctx, span := tracer().Start(extract(context.WithoutCancel(ctx), selection.TraceContext), "agent.execute", trace.WithAttributes(
+			attribute.String("loopstacks.loop_id", selection.LoopID),
+			attribute.String("loopstacks.agent_id", a.cfg.AgentID),
+		))
+
+		result := a.execute(logr.NewContext(ctx, log), selection.LoopID)
+		var resultErr error
+		if result.Error != "" {
+			resultErr = errors.New(result.Error)
+		}
+		end(span, resultErr)
+		inject(ctx, &result.TraceContext)
+		if err := a.submitResult(ctx, selection.LoopID, result); err != nil {
+			log.Error(err, "Failed to submit result")
+			return
+		}
+		if result.Error != "" {
+			log.Info("Loop execution failed", "error", result.Error)
+			return
+		}
+		log.Info("Submitted result")
+	}()
+}
+
+func (a *Agent) execute(ctx context.Context, loopID string) protocol.Result {
+	result := protocol.Result{LoopID: loopID, AgentID: a.cfg.AgentID}
+
+	announcement, err := a.lookup(ctx, loopID)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to load loop: %v", err)
+		return result
+	}
+
+	if len(announcement.Input) == 0 {
+		announcement.Input = json.RawMessage("null")
+	}
+	if err := a.input.validate(announcement.Input); err != nil {
+		result.Error = fmt.Sprintf("input does not match schema: %v", err)
+		return result
+	}
+
+	output, err := a.handler.Execute(ctx, Task{
+		LoopID:       announcement.LoopID,
+		LoopStack:    announcement.LoopStack,
+		Realm:        announcement.Realm,
+		Capabilities: intersect(a.cfg.Capabilities, announcement.Capabilities),
+		Input:        announcement.Input,
+		Steps:        announcement.Steps,
+		Settings:     a.Settings(),
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	data, err := json.Marshal(output)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to marshal output: %v", err)
+		return result
+	}
+	if err := a.output.validate(data); err != nil {
+		result.Error = fmt.Sprintf("output does not match schema: %v", err)
+		return result
+	}
+
+	result.Result = data
+	return result
+}
+
+func (a *Agent) submitResult(ctx context.Context, loopID string, result protocol.Result) error {
+	result.Timestamp = time.Now().UnixMilli()
+	return a.backend.SubmitResult(ctx, &result)
+}
+
+func (a *Agent) heartbeat(ctx context.Context, registeredAt time.Time) error {
+	a.mu.Lock()
+	active, draining := a.active, a.draining
+	a.mu.Unlock()
+
+	registration := protocol.Heartbeat{
+		AgentID:       a.cfg.AgentID,
+		Agent:         a.cfg.Agent,
+		AgentInstance: a.cfg.AgentInstance,
+		Pod:           a.cfg.Pod,
+		Revision:      a.cfg.Revision,
+		Realm:         a.cfg.Realm,
+		Capabilities:  a.cfg.Capabilities,
+		RegisteredAt:  registeredAt.UnixMilli(),
+		LastHeartbeat: time.Now().UnixMilli(),
+		ActiveLoops:   active,
+		Draining:      draining,
+	}
+	return a.backend.Heartbeat(ctx, &registration)
+}
+
+func (a *Agent) deregister() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.backend.Deregister(ctx, a.cfg.AgentID); err != nil {
+		a.log.Error(err, "Failed to deregister agent")
+		return
+	}
+	a.log.Info("Agent deregistered")
+}
+
+func (a *Agent) remember(announcement protocol.LoopAnnouncement) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	for id, cached := range a.announcements {
+		if now.After(cached.expires) {
+			delete(a.announcements, id)
+		}
+	}
+	a.announcements[announcement.LoopID] = cachedAnnouncement{
+		announcement: announcement,
+		expires:      now.Add(announcementCacheTTL),
+	}
+}
+
+// lookup returns the announcement for a loop, falling back to the backend
+// when the agent did not see the announcement itself
+func (a *Agent) lookup(ctx context.Context, loopID string) (protocol.LoopAnnouncement, error) {
+	a.mu.Lock()
+	cached, ok := a.announcements[loopID]
+	if ok {
+		delete(a.announcements, loopID)
+	}
+	a.mu.Unlock()
+	if ok {
+		return cached.announcement, nil
+	}
+
+	announcement, err := a.backend.Announcement(ctx, loopID)
+	if err != nil {
+		return protocol.LoopAnnouncement{}, err
+	}
+	return *announcement, nil
+}
+
+func intersect(have, want []string) []string {
+	var matched []string
+	for _, w := range want {
+		for _, h := range have {
+			if h == w {
+				matched = append(matched, w)
+				break
+			}
+		}
+	}
+	return matched
+}
@@ -0,0 +1,301 @@
+package agentsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/memory"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+const agentID = "writer-0"
+
+// bidder bids with a fixed confidence on loops of the support LoopStack
+type bidder struct {
+	HandlerFunc
+	confidence float64
+}
+
+func (b bidder) Bid(ctx context.Context, announcement protocol.LoopAnnouncement) (*BidDecision, error) {
+	if announcement.LoopStack != "support" {
+		return nil, nil
+	}
+	return &BidDecision{Confidence: b.confidence}, nil
+}
+
+// run runs an agent on backend until the returned function stops it, or
+// the test ends, and returns Run's error
+func run(t *testing.T, backend *memory.Backend, cfg Config, handler Handler) (stop func() error) {
+	t.Helper()
+	cfg.AgentID = agentID
+	cfg.Capabilities = []string{"reply"}
+	cfg.Backend = backend
+	agent, err := New(cfg, handler)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// The consumers are created before the agent runs, so it receives
+	// every loop announced once it is registered
+	stopped, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = backend.SubscribeAnnouncements(stopped, agentID, nil)
+	_ = backend.SubscribeSelections(stopped, agentID, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Run(ctx) }()
+	t.Cleanup(cancel)
+	waitFor(t, "registration", func() bool { return len(agents(t, backend)) == 1 })
+
+	return func() error {
+		cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run() did not return")
+			return nil
+		}
+	}
+}
+
+func agents(t *testing.T, backend *memory.Backend) []protocol.Heartbeat {
+	t.Helper()
+	agents, err := backend.Agents(context.Background())
+	if err != nil {
+		t.Fatalf("Agents() error = %v", err)
+	}
+	return agents
+}
+
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func announce(t *testing.T, backend *memory.Backend, announcement *protocol.LoopAnnouncement) {
+	t.Helper()
+	if err := backend.Announce(context.Background(), announcement); err != nil {
+		t.Fatalf("Announce() error = %v", err)
+	}
+}
+
+// next returns the next message subscribe delivers
+func next[T any](t *testing.T, subscribe func(context.Context, func(context.Context, T) error) error) T {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var msg T
+	received := false
+	err := subscribe(ctx, func(ctx context.Context, m T) error {
+		msg, received = m, true
+		cancel()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("subscription error = %v", err)
+	}
+	if !received {
+		t.Fatal("timed out waiting for message")
+	}
+	return msg
+}
+
+func TestBid(t *testing.T) {
+	backend := memory.New(0)
+	run(t, backend, Config{InputSchema: []byte(`{"type":"object","required":["customer"]}`)}, bidder{confidence: 0.4})
+
+	// Only the last loop matches the agent's capabilities, input schema and
+	// Bidder
+	announce(t, backend, &protocol.LoopAnnouncement{LoopID: "loop-1", LoopStack: "support", Capabilities: []string{"translate"}})
+	announce(t, backend, &protocol.LoopAnnouncement{LoopID: "loop-2", LoopStack: "support", Capabilities: []string{"reply"}, Input: json.RawMessage(`{}`)})
+	announce(t, backend, &protocol.LoopAnnouncement{LoopID: "loop-3", LoopStack: "billing", Capabilities: []string{"reply"}})
+	announce(t, backend, &protocol.LoopAnnouncement{LoopID: "loop-4", LoopStack: "support", Capabilities: []string{"reply", "translate"}, Input: json.RawMessage(`{"customer":"c-42"}`)})
+
+	bid := next(t, func(ctx context.Context, h func(context.Context, *protocol.Bid) error) error {
+		return backend.SubscribeBids(ctx, "loop-4", h)
+	})
+	if bid.AgentID != agentID || bid.Confidence != 0.4 || len(bid.Capabilities) != 1 || bid.Capabilities[0] != "reply" {
+		t.Errorf("bid = %+v, want a bid of %s with confidence 0.4 for reply", bid, agentID)
+	}
+	for _, loopID := range []string{"loop-1", "loop-2", "loop-3"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		backend.SubscribeBids(ctx, loopID, func(ctx context.Context, bid *protocol.Bid) error {
+			t.Errorf("bid on %s = %+v, want none", loopID, bid)
+			return nil
+		})
+		cancel()
+	}
+}
+
+func TestExecute(t *testing.T) {
+	backend := memory.New(0)
+	tasks := make(chan Task, 1)
+	run(t, backend, Config{OutputSchema: []byte(`{"type":"object","required":["reply"]}`)}, HandlerFunc(func(ctx context.Context, task Task) (interface{}, error) {
+		tasks <- task
+		var input struct {
+			Customer string `json:"customer"`
+		}
+		if err := json.Unmarshal(task.Input, &input); err != nil {
+			return nil, err
+		}
+		if input.Customer == "" {
+			return map[string]string{}, nil
+		}
+		return map[string]string{"reply": "hello " + input.Customer}, nil
+	}))
+
+	tests := []struct {
+		name       string
+		input      string
+		wantResult string
+		wantError  bool
+	}{
+		{name: "output", input: `{"customer":"c-42"}`, wantResult: `{"reply":"hello c-42"}`},
+		{name: "output not matching schema", input: `{}`, wantError: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loopID := fmt.Sprintf("loop-%d", i+1)
+			announce(t, backend, &protocol.LoopAnnouncement{
+				LoopID:       loopID,
+				LoopStack:    "support",
+				Capabilities: []string{"reply"},
+				Input:        json.RawMessage(tt.input),
+				Steps:        map[string]json.RawMessage{"classify": json.RawMessage(`{"intent":"greeting"}`)},
+			})
+			next(t, func(ctx context.Context, h func(context.Context, *protocol.Bid) error) error {
+				return backend.SubscribeBids(ctx, loopID, h)
+			})
+			if err := backend.Select(context.Background(), &protocol.Selection{LoopID: loopID, AgentID: agentID}); err != nil {
+				t.Fatalf("Select() error = %v", err)
+			}
+
+			result := next(t, func(ctx context.Context, h func(context.Context, *protocol.Result) error) error {
+				return backend.SubscribeResults(ctx, loopID, h)
+			})
+			if tt.wantError {
+				if result.Error == "" || result.Result != nil {
+					t.Errorf("result = %+v, want an error", result)
+				}
+			} else if result.Error != "" || string(result.Result) != tt.wantResult {
+				t.Errorf("result = %s (%s), want %s", result.Result, result.Error, tt.wantResult)
+			}
+
+			task := <-tasks
+			if task.LoopID != loopID || task.LoopStack != "support" || string(task.Steps["classify"]) != `{"intent":"greeting"}` {
+				t.Errorf("task = %+v", task)
+			}
+		})
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	backend := memory.New(0)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	stop := run(t, backend, Config{HeartbeatInterval: 10 * time.Millisecond}, HandlerFunc(func(ctx context.Context, task Task) (interface{}, error) {
+		close(started)
+		<-release
+		return map[string]string{"reply": "done"}, nil
+	}))
+
+	announce(t, backend, &protocol.LoopAnnouncement{LoopID: "loop-1", Capabilities: []string{"reply"}})
+	if err := backend.Select(context.Background(), &protocol.Selection{LoopID: "loop-1", AgentID: agentID}); err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- stop() }()
+
+	// The agent keeps its registration while it finishes the loop, reporting
+	// it draining
+	waitFor(t, "draining heartbeat", func() bool {
+		agents := agents(t, backend)
+		return len(agents) == 1 && agents[0].Draining && agents[0].ActiveLoops == 1
+	})
+	select {
+	case err := <-stopped:
+		t.Fatalf("Run() = %v before the loop finished", err)
+	default:
+	}
+
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	result := next(t, func(ctx context.Context, h func(context.Context, *protocol.Result) error) error {
+		return backend.SubscribeResults(ctx, "loop-1", h)
+	})
+	if string(result.Result) != `{"reply":"done"}` {
+		t.Errorf("result = %s (%s), want the loop's output", result.Result, result.Error)
+	}
+	if agents := agents(t, backend); len(agents) != 0 {
+		t.Errorf("Agents() after shutdown = %v, want none", agents)
+	}
+}
+
+// failingBackend fails the selections subscription once the agent is
+// registered
+type failingBackend struct {
+	*memory.Backend
+}
+
+var errSubscription = errors.New("connection lost")
+
+func (b failingBackend) SubscribeSelections(ctx context.Context, agentID string, handler func(context.Context, *protocol.Selection) error) error {
+	return errSubscription
+}
+
+func TestRunDeregistersOnSubscriptionError(t *testing.T) {
+	backend := memory.New(0)
+	agent, err := New(Config{
+		AgentID:      agentID,
+		Capabilities: []string{"reply"},
+		Backend:      failingBackend{backend},
+	}, HandlerFunc(func(ctx context.Context, task Task) (interface{}, error) { return nil, nil }))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := agent.Run(context.Background()); !errors.Is(err, errSubscription) {
+		t.Errorf("Run() error = %v, want the subscription's error", err)
+	}
+	if agents := agents(t, backend); len(agents) != 0 {
+		t.Errorf("Agents() after a failed subscription = %v, want none", agents)
+	}
+}
+
+func TestNew(t *testing.T) {
+	handler := HandlerFunc(func(ctx context.Context, task Task) (interface{}, error) { return nil, nil })
+	tests := []struct {
+		name    string
+		cfg     Config
+		handler Handler
+	}{
+		{name: "no agent id", cfg: Config{Capabilities: []string{"reply"}, Backend: memory.New(0)}, handler: handler},
+		{name: "no capabilities", cfg: Config{AgentID: agentID, Backend: memory.New(0)}, handler: handler},
+		{name: "no handler", cfg: Config{AgentID: agentID, Capabilities: []string{"reply"}, Backend: memory.New(0)}},
+		{name: "no backend", cfg: Config{AgentID: agentID, Capabilities: []string{"reply"}}, handler: handler},
+		{name: "invalid schema", cfg: Config{AgentID: agentID, Capabilities: []string{"reply"}, Backend: memory.New(0), InputSchema: []byte(`{`)}, handler: handler},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg, tt.handler); err == nil {
+				t.Error("New() error = nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package agentsdk
+
+import (
+	"context"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// Backend is the side of the coordination backend an agent uses. Every
+// coordination.Backend of the operator implements it, see package
+// transport to connect to the realm's.
+type Backend interface {
+	// Announcement looks up a previously announced loop
+	Announcement(ctx context.Context, loopID string) (*protocol.LoopAnnouncement, error)
+	// SubscribeAnnouncements delivers announcements to a durable consumer
+	// until ctx is done or handler fails. A handler error leaves the
+	// announcement to be delivered again.
+	SubscribeAnnouncements(ctx context.Context, consumer string, handler func(context.Context, *protocol.LoopAnnouncement) error) error
+	// Bid submits a bid for a loop
+	Bid(ctx context.Context, bid *protocol.Bid) error
+	// SubscribeSelections delivers the selections of an agent durably
+	SubscribeSelections(ctx context.Context, agentID string, handler func(context.Context, *protocol.Selection) error) error
+	// SubmitResult records the agent's result for a loop
+	SubmitResult(ctx context.Context, result *protocol.Result) error
+	// Heartbeat registers the agent or refreshes its registration
+	Heartbeat(ctx context.Context, heartbeat *protocol.Heartbeat) error
+	// Deregister removes the agent's registration and its consumers
+	Deregister(ctx context.Context, agentID string) error
+	// Close releases the backend's connections
+	Close() error
+}
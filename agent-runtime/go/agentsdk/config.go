@@ -0,0 +1,57 @@
+package agentsdk
+
+import (
+	"os"
+	"strings"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// Environment variables read by ConfigFromEnv. The operator sets them on
+// agent pods.
+const (
+	EnvAgentID      = protocol.EnvAgentID
+	EnvAgent        = protocol.EnvAgent
+	EnvInstance     = protocol.EnvInstance
+	EnvPod          = protocol.EnvPod
+	EnvRevision     = protocol.EnvRevision
+	EnvRealm        = protocol.EnvRealm
+	EnvCapabilities = protocol.EnvCapabilities
+	EnvInputSchema  = protocol.EnvInputSchema
+	EnvOutputSchema = protocol.EnvOutputSchema
+	EnvConfigDir    = protocol.EnvConfigDir
+)
+
+// ConfigFromEnv builds a Config from the environment. The agent id and pod
+// fall back to the hostname, which is the pod name inside Kubernetes. The
+// backend is left to the caller, see package transport.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		AgentID:       os.Getenv(EnvAgentID),
+		Agent:         os.Getenv(EnvAgent),
+		AgentInstance: os.Getenv(EnvInstance),
+		Pod:           os.Getenv(EnvPod),
+		Revision:      os.Getenv(EnvRevision),
+		Realm:         os.Getenv(EnvRealm),
+		InputSchema:   []byte(os.Getenv(EnvInputSchema)),
+		OutputSchema:  []byte(os.Getenv(EnvOutputSchema)),
+		ConfigDir:     os.Getenv(EnvConfigDir),
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		if cfg.AgentID == "" {
+			cfg.AgentID = hostname
+		}
+		if cfg.Pod == "" {
+			cfg.Pod = hostname
+		}
+	}
+
+	for _, capability := range strings.Split(os.Getenv(EnvCapabilities), ",") {
+		if capability = strings.TrimSpace(capability); capability != "" {
+			cfg.Capabilities = append(cfg.Capabilities, capability)
+		}
+	}
+
+	return cfg
+}
@@ -0,0 +1,47 @@
+package agentsdk
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// validator validates JSON documents against an Agent's schema. A nil
+// validator accepts everything.
+type validator struct {
+	schema *jsonschema.Schema
+}
+
+// compile compiles a JSON schema document. An empty document yields a nil
+// validator.
+func compile(raw []byte) (*validator, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, nil
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema document: %w", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("schema.json", doc); err != nil {
+		return nil, fmt.Errorf("invalid schema document: %w", err)
+	}
+	sch, err := compiler.Compile("schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &validator{schema: sch}, nil
+}
+
+func (v *validator) validate(raw []byte) error {
+	if v == nil {
+		return nil
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("invalid JSON document: %w", err)
+	}
+	return v.schema.Validate(doc)
+}
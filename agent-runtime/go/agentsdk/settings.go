@@ -0,0 +1,130 @@
+package agentsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// Layout of Config.ConfigDir, as mounted by the operator
+const (
+	// ConfigFile holds AgentInstanceSpec.Config
+	ConfigFile = protocol.ConfigFile
+	// SecretsDir holds AgentInstanceSpec.ConfigSecrets, one file each
+	SecretsDir = protocol.SecretsDir
+)
+
+// DefaultConfigReloadInterval is how often the settings are checked for
+// changes. The kubelet itself takes up to a minute to update them.
+const DefaultConfigReloadInterval = 10 * time.Second
+
+// Settings are the config and secrets of the agent's AgentInstance
+type Settings struct {
+	Config json.RawMessage
+	// Secrets by the name they are mounted as
+	Secrets map[string]string
+}
+
+// Reloader can be implemented by a Handler to apply changed settings in
+// place, such as reconnecting a client with a rotated API key. Tasks see
+// the current settings either way.
+type Reloader interface {
+	Reload(ctx context.Context, settings Settings) error
+}
+
+// LoadSettings reads the settings mounted in dir. Missing files are empty
+// settings.
+func LoadSettings(dir string) (Settings, error) {
+	var settings Settings
+	if dir == "" {
+		return settings, nil
+	}
+
+	config, err := os.ReadFile(filepath.Join(dir, ConfigFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return settings, err
+	case len(bytes.TrimSpace(config)) > 0:
+		if !json.Valid(config) {
+			return settings, fmt.Errorf("%s is not valid JSON", ConfigFile)
+		}
+		settings.Config = config
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, SecretsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	settings.Secrets = make(map[string]string, len(entries))
+	for _, entry := range entries {
+		// The kubelet swaps updates in through hidden entries
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		value, err := os.ReadFile(filepath.Join(dir, SecretsDir, entry.Name()))
+		if err != nil {
+			return settings, err
+		}
+		settings.Secrets[entry.Name()] = string(value)
+	}
+	return settings, nil
+}
+
+func (s Settings) equal(other Settings) bool {
+	return bytes.Equal(s.Config, other.Config) && maps.Equal(s.Secrets, other.Secrets)
+}
+
+// Settings returns the agent's current settings
+func (a *Agent) Settings() Settings {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.settings
+}
+
+// watchSettings reloads the settings whenever they change until ctx is
+// done. Settings that fail to load are logged and the previous ones kept.
+func (a *Agent) watchSettings(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.ConfigReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		settings, err := LoadSettings(a.cfg.ConfigDir)
+		if err != nil {
+			a.log.Error(err, "Failed to reload settings")
+			continue
+		}
+		if settings.equal(a.Settings()) {
+			continue
+		}
+
+		a.mu.Lock()
+		a.settings = settings
+		a.mu.Unlock()
+		a.log.Info("Settings changed")
+
+		if reloader, ok := a.handler.(Reloader); ok {
+			if err := reloader.Reload(ctx, settings); err != nil {
+				a.log.Error(err, "Failed to reload settings")
+			}
+		}
+	}
+}
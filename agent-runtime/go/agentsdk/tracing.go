@@ -0,0 +1,71 @@
+package agentsdk
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+const instrumentationName = "github.com/loopstacks/loopstacks-platform/agent-runtime/go/agentsdk"
+
+// propagator reads and writes the trace context of loop messages, like the
+// operator's, regardless of the global propagator
+var propagator = propagation.TraceContext{}
+
+// tracer follows the global tracer provider. Agents export their spans by
+// installing one, for example with the OTLP exporter.
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// inject writes the span context of ctx to the trace context of a message
+func inject(ctx context.Context, tc *protocol.TraceContext) {
+	propagator.Inject(ctx, carrier{tc})
+}
+
+// extract returns ctx with the remote span context of a message
+func extract(ctx context.Context, tc protocol.TraceContext) context.Context {
+	return propagator.Extract(ctx, carrier{&tc})
+}
+
+// end ends a span, marking it failed when err is not nil
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// carrier adapts a TraceContext to propagation.TextMapCarrier
+type carrier struct {
+	tc *protocol.TraceContext
+}
+
+func (c carrier) Get(key string) string {
+	switch key {
+	case "traceparent":
+		return c.tc.Traceparent
+	case "tracestate":
+		return c.tc.Tracestate
+	}
+	return ""
+}
+
+func (c carrier) Set(key, value string) {
+	switch key {
+	case "traceparent":
+		c.tc.Traceparent = value
+	case "tracestate":
+		c.tc.Tracestate = value
+	}
+}
+
+func (c carrier) Keys() []string {
+	return []string{"traceparent", "tracestate"}
+}
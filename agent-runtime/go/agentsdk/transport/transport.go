@@ -0,0 +1,57 @@
+// Package transport connects Go agents to the coordination backend of
+// their realm, as configured by the operator on agent pods
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/loopstacks/loopstacks-platform/agent-runtime/go/agentsdk"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/memory"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/nats"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/redis"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// Coordination backends, as selected by RealmResources.CoordinationBackend
+const (
+	Redis  = "redis"
+	NATS   = "nats"
+	Memory = "memory"
+)
+
+// Options selects and locates a backend
+type Options struct {
+	// Backend is redis, nats or memory. Empty selects redis.
+	Backend string
+
+	RedisURL string
+
+	NATSURL    string
+	NATSStream string
+}
+
+// OptionsFromEnv reads the options the operator sets on agent pods
+func OptionsFromEnv() Options {
+	return Options{
+		Backend:    os.Getenv(protocol.EnvBackend),
+		RedisURL:   os.Getenv(protocol.EnvRedisURL),
+		NATSURL:    os.Getenv(protocol.EnvNATSURL),
+		NATSStream: os.Getenv(protocol.EnvNATSStream),
+	}
+}
+
+// Open connects to the selected backend
+func Open(ctx context.Context, opts Options) (agentsdk.Backend, error) {
+	switch opts.Backend {
+	case NATS:
+		return nats.New(ctx, nats.Options{URL: opts.NATSURL, Stream: opts.NATSStream})
+	case Memory:
+		return memory.New(0), nil
+	case "", Redis:
+		return redis.New(redis.Options{URL: opts.RedisURL})
+	default:
+		return nil, fmt.Errorf("unknown coordination backend %q, expected %s or %s", opts.Backend, Redis, NATS)
+	}
+}
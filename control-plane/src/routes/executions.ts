@@ -13,6 +13,17 @@ router.post('/', asyncHandler(async (req, res) => {
   const { loopstack, input, realm, config } = req.body;
   const namespace = req.query.namespace as string || 'default';
 
+  // Executions of audited realms must leave an audit trail, which only the
+  // operator's executions API records
+  const realmName = realm || 'default-realm';
+  const realmDef = await kubernetesService.getRealm(realmName, namespace);
+  if (realmDef.spec?.governance?.loopAuditingEnabled) {
+    return res.status(409).json({
+      success: false,
+      error: `Realm ${realmName} audits its loops; start executions through the operator's executions API`,
+    });
+  }
+
   // Generate execution ID
   const executionId = uuidv4();
 
@@ -26,7 +37,7 @@ router.post('/', asyncHandler(async (req, res) => {
     executionId,
     loopstack,
     input,
-    realm: realm || 'default-realm',
+    realm: realmName,
     config: config || {},
     status: 'pending',
     phases: {
@@ -62,6 +62,13 @@ export class RedisService {
       const key = `loop:${loopId}`;
       await this.client.set(key, JSON.stringify(loopData), { EX: 3600 }); // 1 hour TTL
       await this.client.publish('loop:announcements', JSON.stringify({ loopId, ...loopData }));
+      // Streams are read by agents using the operator's coordination backend
+      await this.client.xAdd(
+        'stream:loop:announcements',
+        '*',
+        { data: JSON.stringify({ loopId, ...loopData }) },
+        { TRIM: { strategy: 'MAXLEN', strategyModifier: '~', threshold: 10000 } }
+      );
       logger.info(`Announced loop ${loopId}`);
     } catch (error) {
       logger.error(`Failed to announce loop ${loopId}:`, error);
@@ -105,6 +112,12 @@ export class RedisService {
       // Notify selected agents
       for (const agentId of selectedAgentIds) {
         await this.client.publish(`agent:${agentId}:selected`, JSON.stringify({ loopId }));
+        await this.client.xAdd(
+          `stream:agent:${agentId}:selections`,
+          '*',
+          { data: JSON.stringify({ loopId, agentId }) },
+          { TRIM: { strategy: 'MAXLEN', strategyModifier: '~', threshold: 10000 } }
+        );
       }
 
       logger.info(`Selected agents for loop ${loopId}:`, selectedAgentIds);
@@ -161,6 +174,7 @@ export class RedisService {
         lastHeartbeat: Date.now()
       };
       await this.client.set(key, JSON.stringify(agentData), { EX: 300 }); // 5 minutes TTL
+      await this.client.zAdd('agents', { score: Date.now(), value: agentId });
       logger.info(`Registered agent ${agentId}`);
     } catch (error) {
       logger.error(`Failed to register agent ${agentId}:`, error);
@@ -176,6 +190,7 @@ export class RedisService {
         const parsed = JSON.parse(agentData);
         parsed.lastHeartbeat = Date.now();
         await this.client.set(key, JSON.stringify(parsed), { EX: 300 }); // 5 minutes TTL
+        await this.client.zAdd('agents', { score: Date.now(), value: agentId });
       }
     } catch (error) {
       logger.error(`Failed to update heartbeat for agent ${agentId}:`, error);
@@ -185,12 +200,18 @@ export class RedisService {
 
   async getActiveAgents(): Promise<any[]> {
     try {
-      const keys = await this.client.keys('agent:*');
+      // The agents sorted set indexes registrations by last heartbeat
+      await this.client.zRemRangeByScore('agents', '-inf', `(${Date.now() - 300 * 1000}`);
+      const agentIds = await this.client.zRange('agents', 0, -1);
+      if (agentIds.length === 0) {
+        return [];
+      }
+      const records = await this.client.mGet(agentIds.map((agentId) => `agent:${agentId}`));
       const agents = [];
-      for (const key of keys) {
-        const agentData = await this.client.get(key);
+      for (let i = 0; i < agentIds.length; i++) {
+        const agentData = records[i];
         if (agentData) {
-          agents.push(JSON.parse(agentData));
+          agents.push({ agentId: agentIds[i], ...JSON.parse(agentData) });
         }
       }
       return agents;
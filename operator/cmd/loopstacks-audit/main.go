@@ -0,0 +1,133 @@
+// Command loopstacks-audit exports and verifies loop execution audit trails.
+//
+//	loopstacks-audit export -dir DIR -execution ID [-o FILE]
+//	loopstacks-audit verify [FILE...]
+//	loopstacks-audit verify -dir DIR
+//
+// verify reads standard input when no file is given and fails if any
+// trail's hash chain is broken or a trail lacks its completed event. With
+// -dir it checks an audit directory against its ledger and prints the
+// hash of the last ledger entry, which anchors the trails recorded so far
+// when kept outside the directory.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/audit"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "export":
+		export(os.Args[2:])
+	case "verify":
+		verify(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: loopstacks-audit export -dir DIR -execution ID [-o FILE]")
+	fmt.Fprintln(os.Stderr, "       loopstacks-audit verify [FILE...]")
+	fmt.Fprintln(os.Stderr, "       loopstacks-audit verify -dir DIR")
+	os.Exit(2)
+}
+
+func export(args []string) {
+	var (
+		dir         string
+		executionID string
+		output      string
+	)
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&dir, "dir", "", "Audit trail directory")
+	flags.StringVar(&executionID, "execution", "", "Execution to export")
+	flags.StringVar(&output, "o", "", "File to write the trail to. Writes to stdout when empty.")
+	flags.Parse(args)
+
+	if dir == "" || executionID == "" {
+		usage()
+	}
+
+	store := &audit.FileStore{Dir: dir}
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create %s: %v\n", output, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := audit.Export(context.Background(), store, executionID, w); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to export execution %s: %v\n", executionID, err)
+		os.Exit(1)
+	}
+}
+
+func verify(args []string) {
+	var dir string
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.StringVar(&dir, "dir", "", "Audit trail directory to verify against its ledger")
+	flags.Parse(args)
+
+	if dir != "" {
+		if flags.NArg() > 0 {
+			usage()
+		}
+		trails, head, err := audit.VerifyDir(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", dir, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: %d completed trails verified, ledger head %s\n", dir, trails, head)
+		return
+	}
+
+	if flags.NArg() == 0 {
+		count, err := audit.Verify(os.Stdin)
+		if !report("stdin", count, err) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	failed := false
+	for _, path := range flags.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open %s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		count, err := audit.Verify(f)
+		f.Close()
+		if !report(path, count, err) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func report(name string, count int, err error) bool {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return false
+	}
+	fmt.Printf("%s: %d events verified\n", name, count)
+	return true
+}
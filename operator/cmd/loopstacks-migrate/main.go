@@ -0,0 +1,136 @@
+// Command loopstacks-migrate rewrites every stored LoopStacks object in the
+// storage version of its CRD, then records that version as the only one
+// objects are stored in.
+//
+//	loopstacks-migrate [-kubeconfig PATH] [-dry-run]
+//
+// Run it after switching the storage version of the CRDs in
+// deploy/base, such as from v1 to v2. Once it completes, the previous
+// version may stop being served and later be removed from the CRDs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// crds are the CustomResourceDefinitions of the LoopStacks API
+var crds = []string{
+	"agents.loopstacks.io",
+	"realms.loopstacks.io",
+	"agentinstances.loopstacks.io",
+	"loopstacks.loopstacks.io",
+}
+
+var crdKind = schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}
+
+func main() {
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dry-run", false, "Only report the objects that would be rewritten")
+	flag.Parse()
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	c, err := client.New(cfg, client.Options{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create client: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	for _, name := range crds {
+		if err := migrate(ctx, c, name, dryRun); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate %s: %v\n", name, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// migrate rewrites the objects of a CRD in its storage version and prunes
+// the CRD's stored versions
+func migrate(ctx context.Context, c client.Client, name string, dryRun bool) error {
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(crdKind)
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, crd); err != nil {
+		return err
+	}
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	storage, err := storageVersion(crd)
+	if err != nil {
+		return err
+	}
+	stored, _, _ := unstructured.NestedStringSlice(crd.Object, "status", "storedVersions")
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(schema.GroupVersionKind{Group: group, Version: storage, Kind: kind + "List"})
+	if err := c.List(ctx, list); err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Printf("%s: would rewrite %d objects in %s, stored in %v\n", name, len(list.Items), storage, stored)
+		return nil
+	}
+
+	for i := range list.Items {
+		if err := rewrite(ctx, c, &list.Items[i]); err != nil {
+			return fmt.Errorf("%s/%s: %w", list.Items[i].GetNamespace(), list.Items[i].GetName(), err)
+		}
+	}
+
+	if err := unstructured.SetNestedStringSlice(crd.Object, []string{storage}, "status", "storedVersions"); err != nil {
+		return err
+	}
+	if err := c.Status().Update(ctx, crd); err != nil {
+		return fmt.Errorf("failed to update stored versions: %w", err)
+	}
+	fmt.Printf("%s: rewrote %d objects in %s, previously stored in %v\n", name, len(list.Items), storage, stored)
+	return nil
+}
+
+// storageVersion returns the version a CRD stores objects in
+func storageVersion(crd *unstructured.Unstructured) (string, error) {
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, version := range versions {
+		version, ok := version.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if storage, _, _ := unstructured.NestedBool(version, "storage"); storage {
+			name, _, _ := unstructured.NestedString(version, "name")
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no storage version")
+}
+
+// rewrite updates an object without changes, which the API server stores
+// in the current storage version. Objects deleted meanwhile are skipped.
+func rewrite(ctx context.Context, c client.Client, obj *unstructured.Unstructured) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := c.Update(ctx, obj)
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+		if getErr := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); getErr != nil {
+			return getErr
+		}
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+// Command loopstacks-shadow lists the recorded runs of a shadow
+// AgentInstance from the execution history, newest first, as JSON lines.
+//
+//	loopstacks-shadow -driver sqlite|postgres -dsn DSN -namespace NS -instance NAME [-since DURATION] [-disagreed] [-limit N]
+//
+// Each run carries the step's output as expected, the shadow agent's
+// result and, for runs that did not agree, the paths where they differ.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history/postgres"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history/sqlite"
+)
+
+func main() {
+	var (
+		driver    string
+		dsn       string
+		namespace string
+		instance  string
+		since     time.Duration
+		disagreed bool
+		limit     int
+	)
+	flag.StringVar(&driver, "driver", "sqlite", "Execution history store: sqlite or postgres")
+	flag.StringVar(&dsn, "dsn", "loopstacks-history.db", "Execution history database: a file path for sqlite, a connection URL for postgres")
+	flag.StringVar(&namespace, "namespace", "default", "Namespace of the AgentInstance")
+	flag.StringVar(&instance, "instance", "", "Shadow AgentInstance to list runs of")
+	flag.DurationVar(&since, "since", 0, "Only list runs completed within this duration. Lists all runs when zero.")
+	flag.BoolVar(&disagreed, "disagreed", false, "Only list runs that did not agree with the step's output")
+	flag.IntVar(&limit, "limit", 100, "Maximum number of runs to list")
+	flag.Parse()
+
+	if instance == "" {
+		fmt.Fprintln(os.Stderr, "usage: loopstacks-shadow -driver sqlite|postgres -dsn DSN -namespace NS -instance NAME [-since DURATION] [-disagreed] [-limit N]")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	var (
+		store *history.SQLStore
+		err   error
+	)
+	switch driver {
+	case "sqlite":
+		store, err = sqlite.Open(ctx, dsn)
+	case "postgres":
+		store, err = postgres.Open(ctx, dsn)
+	default:
+		err = fmt.Errorf("unknown history driver %q", driver)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open execution history: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	query := history.ShadowQuery{
+		Namespace:     namespace,
+		AgentInstance: instance,
+		Disagreed:     disagreed,
+		Limit:         limit,
+	}
+	if since > 0 {
+		query.Since = time.Now().Add(-since)
+	}
+	runs, err := store.ListShadowRuns(ctx, query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list shadow runs: %v\n", err)
+		os.Exit(1)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, run := range runs {
+		if err := encoder.Encode(run); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write shadow run: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
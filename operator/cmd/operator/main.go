@@ -1,21 +1,41 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/agentlogs"
 	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	loopstacksv2 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v2"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/audit"
 	"github.com/loopstacks/loopstacks-platform/operator/pkg/controllers"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/engine"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/federation"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history/postgres"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history/sqlite"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/liveness"
+	loopstacksmetrics "github.com/loopstacks/loopstacks-platform/operator/pkg/metrics"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/rollout"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/shadow"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/sharing"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/tracing"
 )
 
 var (
@@ -30,6 +50,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(loopstacksv1.AddToScheme(scheme))
+	utilruntime.Must(loopstacksv2.AddToScheme(scheme))
 }
 
 func main() {
@@ -41,6 +62,18 @@ func main() {
 		webhookPort         int
 		webhookCertDir      string
 		syncPeriod          time.Duration
+		historyDriver       string
+		historyDSN          string
+		agentLogsSink       string
+		agentLogsDir        string
+		agentLogsStore      agentlogs.ObjectStoreOptions
+		federationAddr      string
+		federationCertDir   string
+		otlpEndpoint        string
+		otlpInsecure        bool
+		executionsAddr      string
+		executionsCertDir   string
+		auditDir            string
 	)
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
@@ -52,6 +85,22 @@ func main() {
 	flag.IntVar(&webhookPort, "webhook-port", 9443, "The port for the webhook server")
 	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs", "The directory for webhook certificates")
 	flag.DurationVar(&syncPeriod, "sync-period", 10*time.Hour, "The minimum frequency at which watched resources are reconciled")
+	flag.StringVar(&historyDriver, "history-driver", "", "Execution history store: sqlite or postgres. History is not kept when empty")
+	flag.StringVar(&historyDSN, "history-dsn", "", "Execution history database: a file path for sqlite, a connection URL for postgres")
+	flag.StringVar(&agentLogsSink, "agent-logs-sink", "", "Agent log sink: file or s3. Agent logs are not collected when empty")
+	flag.StringVar(&agentLogsDir, "agent-logs-dir", "agent-logs", "Directory of the file agent log sink, usually a mounted volume")
+	flag.StringVar(&agentLogsStore.Endpoint, "agent-logs-s3-endpoint", "", "Host and port of the S3-compatible API of the s3 agent log sink")
+	flag.StringVar(&agentLogsStore.Bucket, "agent-logs-s3-bucket", "", "Bucket of the s3 agent log sink")
+	flag.StringVar(&agentLogsStore.Prefix, "agent-logs-s3-prefix", "", "Key prefix of the s3 agent log sink")
+	flag.StringVar(&agentLogsStore.Region, "agent-logs-s3-region", "", "Region of the s3 agent log sink")
+	flag.BoolVar(&agentLogsStore.Insecure, "agent-logs-s3-insecure", false, "Connect to the s3 agent log sink over plain HTTP")
+	flag.StringVar(&federationAddr, "federation-bind-address", ":9444", "The address the federation API binds to.")
+	flag.StringVar(&federationCertDir, "federation-cert-dir", "", "Directory with tls.crt, tls.key and ca.crt for mutual TLS with federation peers. Federation is disabled when empty")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "Host and port of the OTLP gRPC collector receiving traces. Falls back to OTEL_EXPORTER_OTLP_ENDPOINT; traces are not exported when neither is set")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "Connect to the OTLP collector without TLS")
+	flag.StringVar(&executionsAddr, "executions-bind-address", ":9445", "The address the executions API binds to.")
+	flag.StringVar(&executionsCertDir, "executions-cert-dir", "", "Directory with tls.crt and tls.key serving the executions API over TLS. It is served over plain HTTP when empty")
+	flag.StringVar(&auditDir, "audit-dir", "", "Directory of the audit trails of realms with loopAuditingEnabled, usually a mounted volume. Executions are not audited when empty")
 
 	opts := zap.Options{
 		Development: devMode,
@@ -68,6 +117,23 @@ func main() {
 		"devMode", devMode,
 	)
 
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		ServiceName: "loopstacks-operator",
+		Endpoint:    otlpEndpoint,
+		Insecure:    otlpInsecure,
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			setupLog.Error(err, "unable to flush traces")
+		}
+	}()
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: server.Options{
@@ -77,6 +143,8 @@ func main() {
 			Port:    webhookPort,
 			CertDir: webhookCertDir,
 		}),
+		Cache:                  controllers.CacheOptions(),
+		Client:                 controllers.ClientOptions(),
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "loopstacks-operator",
@@ -86,47 +154,186 @@ func main() {
 		os.Exit(1)
 	}
 
+	ctrlmetrics.Registry.MustRegister(&loopstacksmetrics.StateCollector{Reader: mgr.GetCache()})
+
+	if err := controllers.SetupIndexes(context.Background(), mgr); err != nil {
+		setupLog.Error(err, "unable to set up cache indexes")
+		os.Exit(1)
+	}
+
 	// Setup controllers
 	if err = (&controllers.AgentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Agent"),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Log:      ctrl.Log.WithName("controllers").WithName("Agent"),
+		Recorder: mgr.GetEventRecorderFor("agent-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Agent")
 		os.Exit(1)
 	}
 
+	registry := liveness.NewRegistry()
+	defer registry.Close()
+
+	var federationClient *federation.Client
+	if federationCertDir != "" {
+		serverTLS, clientTLS, err := federation.LoadTLS(federationCertDir)
+		if err != nil {
+			setupLog.Error(err, "unable to load federation certificates", "dir", federationCertDir)
+			os.Exit(1)
+		}
+		federationClient = federation.NewClient(clientTLS)
+
+		if err := mgr.Add(&federation.Server{
+			Addr:     federationAddr,
+			TLS:      serverTLS,
+			Client:   mgr.GetClient(),
+			Backends: registry,
+			Log:      ctrl.Log.WithName("federation"),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up federation API")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.RealmReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Realm"),
+		Client:     mgr.GetClient(),
+		Scheme:     mgr.GetScheme(),
+		Log:        ctrl.Log.WithName("controllers").WithName("Realm"),
+		Recorder:   mgr.GetEventRecorderFor("realm-controller"),
+		Federation: federationClient,
+		Registry:   registry,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Realm")
 		os.Exit(1)
 	}
 
+	var historyStore history.Store
+	if historyDriver != "" {
+		historyStore, err = openHistory(historyDriver, historyDSN)
+		if err != nil {
+			setupLog.Error(err, "unable to open execution history", "driver", historyDriver)
+			os.Exit(1)
+		}
+		defer historyStore.Close()
+
+		if err := mgr.Add(&history.Reaper{
+			Client: mgr.GetClient(),
+			Store:  historyStore,
+			Log:    ctrl.Log.WithName("history"),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up execution history reaper")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.AgentInstanceReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Log:    ctrl.Log.WithName("controllers").WithName("AgentInstance"),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Log:      ctrl.Log.WithName("controllers").WithName("AgentInstance"),
+		Recorder: mgr.GetEventRecorderFor("agentinstance-controller"),
+		Registry: registry,
+		History:  historyStore,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AgentInstance")
 		os.Exit(1)
 	}
 
 	if err = (&controllers.LoopStackReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Log:    ctrl.Log.WithName("controllers").WithName("LoopStack"),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Log:      ctrl.Log.WithName("controllers").WithName("LoopStack"),
+		Recorder: mgr.GetEventRecorderFor("loopstack-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LoopStack")
 		os.Exit(1)
 	}
 
-	// Setup webhooks if not in dev mode
-	// TODO: Implement webhooks when needed
+	executionEngine := engine.Engine{
+		History:    historyStore,
+		Federation: federationClient,
+		Sharing:    &sharing.Resolver{Client: mgr.GetClient(), Backends: registry},
+		Rollouts:   &rollout.Router{Client: mgr.GetClient()},
+		Log:        ctrl.Log.WithName("engine"),
+	}
+	if historyStore != nil {
+		executionEngine.Shadows = &shadow.Evaluator{Client: mgr.GetClient(), Store: historyStore}
+	}
+	if auditDir != "" {
+		auditStore, err := audit.NewFileStore(auditDir)
+		if err != nil {
+			setupLog.Error(err, "unable to open audit trails", "dir", auditDir)
+			os.Exit(1)
+		}
+		executionEngine.Audit = auditStore
+	}
+
+	var executionsTLS *tls.Config
+	if executionsCertDir != "" {
+		executionsTLS, err = loadServingTLS(executionsCertDir)
+		if err != nil {
+			setupLog.Error(err, "unable to load executions API certificate", "dir", executionsCertDir)
+			os.Exit(1)
+		}
+	}
+	if err := mgr.Add(&engine.Server{
+		Addr:     executionsAddr,
+		TLS:      executionsTLS,
+		Client:   mgr.GetClient(),
+		Backends: registry,
+		Auth:     &engine.KubernetesAuth{Client: mgr.GetClient()},
+		Engine:   executionEngine,
+		// Approval ConfigMaps are not cached by the manager
+		Approvals: &engine.ApprovalStore{Client: mgr.GetClient(), Reader: mgr.GetAPIReader()},
+		Log:       ctrl.Log.WithName("executions"),
+	}); err != nil {
+		setupLog.Error(err, "unable to set up executions API")
+		os.Exit(1)
+	}
+
+	if agentLogsSink != "" {
+		sink, err := openAgentLogs(agentLogsSink, agentLogsDir, agentLogsStore)
+		if err != nil {
+			setupLog.Error(err, "unable to open agent log sink", "sink", agentLogsSink)
+			os.Exit(1)
+		}
+		defer sink.Close()
+
+		clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			setupLog.Error(err, "unable to create Kubernetes client")
+			os.Exit(1)
+		}
+
+		if err := mgr.Add(&agentlogs.Collector{
+			Client: mgr.GetClient(),
+			Pods:   clientset.CoreV1(),
+			Sink:   sink,
+			Log:    ctrl.Log.WithName("agentlogs"),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up agent log collector")
+			os.Exit(1)
+		}
+		if err := mgr.Add(&agentlogs.Reaper{
+			Client: mgr.GetClient(),
+			Sink:   sink,
+			Log:    ctrl.Log.WithName("agentlogs"),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up agent log reaper")
+			os.Exit(1)
+		}
+	}
+
+	// Serve the conversion webhook between API versions. In dev mode the
+	// operator runs outside the cluster, where the API server cannot call
+	// it, so only v1 is usable.
 	if !devMode {
-		setupLog.Info("Webhook setup skipped in production mode - not implemented yet")
+		for _, obj := range []runtime.Object{&loopstacksv1.Agent{}, &loopstacksv1.Realm{}, &loopstacksv1.AgentInstance{}, &loopstacksv1.LoopStack{}} {
+			if err := ctrl.NewWebhookManagedBy(mgr).For(obj).Complete(); err != nil {
+				setupLog.Error(err, "unable to create conversion webhook", "type", fmt.Sprintf("%T", obj))
+				os.Exit(1)
+			}
+		}
 	}
 
 	// Add health and readiness checks
@@ -144,4 +351,44 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
+
+func openHistory(driver, dsn string) (history.Store, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch driver {
+	case "sqlite":
+		if dsn == "" {
+			dsn = "loopstacks-history.db"
+		}
+		return sqlite.Open(ctx, dsn)
+	case "postgres":
+		return postgres.Open(ctx, dsn)
+	default:
+		return nil, fmt.Errorf("unknown history driver %q", driver)
+	}
+}
+
+// loadServingTLS loads the tls.crt and tls.key of dir
+func loadServingTLS(dir string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}, nil
+}
+
+func openAgentLogs(sink, dir string, store agentlogs.ObjectStoreOptions) (agentlogs.Sink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	switch sink {
+	case "file":
+		return agentlogs.NewFileSink(dir)
+	case "s3":
+		return agentlogs.NewObjectStoreSink(ctx, store)
+	default:
+		return nil, fmt.Errorf("unknown agent log sink %q", sink)
+	}
+}
@@ -0,0 +1,52 @@
+// Command protocol-schema writes the JSON Schema of the loop coordination
+// protocol, or with -check verifies that a previously generated file is
+// current.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+func main() {
+	var (
+		output string
+		check  bool
+	)
+	flag.StringVar(&output, "o", "", "File to write the schema to. Writes to stdout when empty.")
+	flag.BoolVar(&check, "check", false, "Fail if the file given with -o is not up to date")
+	flag.Parse()
+
+	schema, err := protocol.JSONSchema()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to generate schema: %v\n", err)
+		os.Exit(1)
+	}
+
+	if output == "" {
+		os.Stdout.Write(schema)
+		return
+	}
+
+	if check {
+		current, err := os.ReadFile(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", output, err)
+			os.Exit(1)
+		}
+		if !bytes.Equal(current, schema) {
+			fmt.Fprintf(os.Stderr, "%s is out of date, run go generate ./pkg/protocol\n", output)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := os.WriteFile(output, schema, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", output, err)
+		os.Exit(1)
+	}
+}
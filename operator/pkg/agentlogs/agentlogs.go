@@ -0,0 +1,64 @@
+// Package agentlogs keeps the logs of agent pods beyond the life of the
+// pods. For realms with an AgentLogs retention, the operator follows the
+// containers of every AgentInstance pod, tags each line with its realm,
+// AgentInstance, pod and the loop it was logged for, writes the lines to a
+// Sink and prunes them once they are older than the retention.
+package agentlogs
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"time"
+)
+
+// Source identifies the container a log line was collected from
+type Source struct {
+	Namespace     string `json:"namespace"`
+	Realm         string `json:"realm"`
+	AgentInstance string `json:"agentInstance"`
+	Pod           string `json:"pod"`
+	Container     string `json:"container"`
+}
+
+// Entry is one collected log line
+type Entry struct {
+	Source
+	Time time.Time `json:"time"`
+	// LoopID is the loop the line was logged for, when the agent logged one
+	LoopID string `json:"loopId,omitempty"`
+	Line   string `json:"line"`
+}
+
+// Sink stores collected logs
+type Sink interface {
+	// Write stores entries collected from source, in order
+	Write(ctx context.Context, source Source, entries []Entry) error
+	// Prune deletes the logs of a realm last written before the cutoff and
+	// returns the number of files or objects deleted
+	Prune(ctx context.Context, namespace, realm string, before time.Time) (int, error)
+	Close() error
+}
+
+// loopIDPattern matches the loopId field of JSON, console and logfmt
+// structured logs, as written by the agent SDK
+var loopIDPattern = regexp.MustCompile(`"?\bloopId"?\s*[:=]\s*"?([A-Za-z0-9._:-]+)`)
+
+// LoopID returns the loop id logged in line, if any
+func LoopID(line string) string {
+	match := loopIDPattern.FindStringSubmatch(line)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// realmPrefix is the path under which sinks keep a realm's logs
+func realmPrefix(namespace, realm string) string {
+	return path.Join(namespace, realm)
+}
+
+// sourcePrefix is the path under which sinks keep a container's logs
+func sourcePrefix(source Source) string {
+	return path.Join(realmPrefix(source.Namespace, source.Realm), source.AgentInstance, source.Pod, source.Container)
+}
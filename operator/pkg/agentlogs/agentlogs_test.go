@@ -0,0 +1,28 @@
+package agentlogs
+
+import "testing"
+
+func TestLoopID(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{name: "json", line: `{"level":"info","msg":"Executing loop","loopId":"exec-1","agentId":"writer-0"}`, want: "exec-1"},
+		{name: "json with spaces", line: `{"msg": "Executing loop", "loopId": "support-7f3c.step:2"}`, want: "support-7f3c.step:2"},
+		{name: "console", line: "2026-10-18T12:00:00.000Z\tINFO\tExecuting loop\t{\"loopId\": \"exec-1\"}", want: "exec-1"},
+		{name: "logfmt", line: `time=2026-10-18T12:00:00Z level=info msg="Executing loop" loopId=exec-1 agentId=writer-0`, want: "exec-1"},
+		{name: "logfmt quoted", line: `level=info msg="Executing loop" loopId="exec-1"`, want: "exec-1"},
+		{name: "no loop", line: `{"level":"info","msg":"Heartbeat sent"}`},
+		{name: "loopId in the message", line: `level=warn msg="selection without loopId ignored"`},
+		{name: "other key", line: `{"parentloopId":"exec-0"}`},
+		{name: "plain text", line: "Starting agent writer-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LoopID(tt.line); got != tt.want {
+				t.Errorf("LoopID(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
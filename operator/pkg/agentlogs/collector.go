@@ -0,0 +1,275 @@
+package agentlogs
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/liveness"
+)
+
+// Collector defaults
+const (
+	DefaultSyncInterval  = 30 * time.Second
+	DefaultFlushInterval = 10 * time.Second
+	// maxBatch is the number of lines that triggers a flush
+	maxBatch = 1000
+	// maxBuffered is the number of lines kept for a container while its
+	// sink is failing. Older lines are dropped beyond it.
+	maxBuffered = 50000
+)
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups=loopstacks.io,resources=agentinstances;realms,verbs=get;list;watch
+
+// Collector follows the containers of AgentInstance pods whose realm sets
+// AgentLogs and writes their lines to Sink. It runs as a manager Runnable
+// on the leader only.
+//
+// Lines are collected from where the previous stream of the container
+// stopped. After an operator restart containers are collected from their
+// start again, so a sink may receive some lines twice.
+type Collector struct {
+	Client client.Client
+	// Pods streams container logs, usually a clientset's CoreV1()
+	Pods          corev1client.PodsGetter
+	Sink          Sink
+	SyncInterval  time.Duration
+	FlushInterval time.Duration
+	Log           logr.Logger
+
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	streams map[string]context.CancelFunc
+	cursors map[string]time.Time
+}
+
+// Start implements manager.Runnable
+func (c *Collector) Start(ctx context.Context) error {
+	interval := c.SyncInterval
+	if interval <= 0 {
+		interval = DefaultSyncInterval
+	}
+
+	c.mu.Lock()
+	c.streams = make(map[string]context.CancelFunc)
+	c.cursors = make(map[string]time.Time)
+	c.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.Sync(ctx)
+		select {
+		case <-ctx.Done():
+			c.wg.Wait()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (c *Collector) NeedLeaderElection() bool {
+	return true
+}
+
+// Sync starts following the running containers of collected realms and
+// stops following the others
+func (c *Collector) Sync(ctx context.Context) {
+	var realms loopstacksv1.RealmList
+	if err := c.Client.List(ctx, &realms); err != nil {
+		c.Log.Error(err, "Failed to list Realms")
+		return
+	}
+	collected := make(map[string]bool)
+	for _, realm := range realms.Items {
+		if realm.Spec.Governance.RetentionPolicy.AgentLogs != "" {
+			collected[realm.Namespace+"/"+realm.Name] = true
+		}
+	}
+
+	var instances loopstacksv1.AgentInstanceList
+	if err := c.Client.List(ctx, &instances); err != nil {
+		c.Log.Error(err, "Failed to list AgentInstances")
+		return
+	}
+
+	wanted := make(map[string]Source)
+	for _, instance := range instances.Items {
+		if !collected[instance.Namespace+"/"+instance.Spec.Realm] {
+			continue
+		}
+
+		var pods corev1.PodList
+		if err := c.Client.List(ctx, &pods, client.InNamespace(instance.Namespace), client.MatchingLabels{liveness.InstanceLabel: instance.Name}); err != nil {
+			c.Log.Error(err, "Failed to list pods", "agentInstance", instance.Name, "namespace", instance.Namespace)
+			continue
+		}
+		for _, pod := range pods.Items {
+			for _, status := range pod.Status.ContainerStatuses {
+				if status.State.Running == nil {
+					continue
+				}
+				source := Source{
+					Namespace:     instance.Namespace,
+					Realm:         instance.Spec.Realm,
+					AgentInstance: instance.Name,
+					Pod:           pod.Name,
+					Container:     status.Name,
+				}
+				wanted[sourceKey(source)] = source
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, cancel := range c.streams {
+		if _, ok := wanted[key]; !ok {
+			cancel()
+			delete(c.streams, key)
+		}
+	}
+	for key := range c.cursors {
+		if _, ok := wanted[key]; !ok {
+			if _, following := c.streams[key]; !following {
+				delete(c.cursors, key)
+			}
+		}
+	}
+	for key, source := range wanted {
+		if _, ok := c.streams[key]; ok {
+			continue
+		}
+		streamCtx, cancel := context.WithCancel(ctx)
+		since := c.cursors[key]
+		c.streams[key] = cancel
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.follow(streamCtx, source, since)
+			c.mu.Lock()
+			if c.streams[key] != nil && streamCtx.Err() == nil {
+				delete(c.streams, key)
+			}
+			c.mu.Unlock()
+			cancel()
+		}()
+	}
+}
+
+// follow streams one container's logs until the container stops or ctx is
+// cancelled, flushing them to the sink in batches
+func (c *Collector) follow(ctx context.Context, source Source, since time.Time) {
+	log := c.Log.WithValues("namespace", source.Namespace, "pod", source.Pod, "container", source.Container)
+
+	opts := &corev1.PodLogOptions{Container: source.Container, Follow: true, Timestamps: true}
+	if !since.IsZero() {
+		// SinceTime has a precision of seconds; earlier lines are skipped below
+		opts.SinceTime = &metav1.Time{Time: since}
+	}
+	stream, err := c.Pods.Pods(source.Namespace).GetLogs(source.Pod, opts).Stream(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Error(err, "Failed to stream container logs")
+		}
+		return
+	}
+	defer stream.Close()
+
+	lines := make(chan Entry)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stream)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			entry, ok := parseLine(source, scanner.Text())
+			if !ok || !entry.Time.After(since) {
+				continue
+			}
+			select {
+			case lines <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	interval := c.FlushInterval
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []Entry
+	// failing defers retries of a failed write to the next tick
+	failing := false
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := c.Sink.Write(ctx, source, batch); err != nil {
+			log.Error(err, "Failed to write agent logs", "lines", len(batch))
+			if len(batch) > maxBuffered {
+				batch = batch[len(batch)-maxBuffered:]
+			}
+			failing = true
+			return
+		}
+		failing = false
+		c.mu.Lock()
+		c.cursors[sourceKey(source)] = batch[len(batch)-1].Time
+		c.mu.Unlock()
+		batch = nil
+	}
+	// Lines read before a shutdown are still written
+	defer func() { flush(context.WithoutCancel(ctx)) }()
+
+	for {
+		select {
+		case entry, ok := <-lines:
+			if !ok {
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= maxBatch && !failing {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// parseLine splits a line streamed with timestamps into an entry
+func parseLine(source Source, line string) (Entry, bool) {
+	timestamp, text, ok := strings.Cut(line, " ")
+	if !ok {
+		return Entry{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{Source: source, Time: t, LoopID: LoopID(text), Line: text}, true
+}
+
+func sourceKey(source Source) string {
+	return source.Namespace + "/" + source.Pod + "/" + source.Container
+}
@@ -0,0 +1,121 @@
+package agentlogs
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FileSink writes logs as JSON Lines under Dir, typically a mounted volume
+// in development clusters. Each container gets one file per hour:
+//
+//	<namespace>/<realm>/<agentInstance>/<pod>/<container>/<yyyy-mm-ddThh>.jsonl
+type FileSink struct {
+	Dir string
+}
+
+var _ Sink = &FileSink{}
+
+// NewFileSink creates dir if needed and returns a sink writing to it
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileSink{Dir: dir}, nil
+}
+
+// Write implements Sink
+func (s *FileSink) Write(ctx context.Context, source Source, entries []Entry) error {
+	dir := filepath.Join(s.Dir, filepath.FromSlash(sourcePrefix(source)))
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	// Entries are grouped by the hour they were logged in
+	for len(entries) > 0 {
+		hour := entries[0].Time.UTC().Format("2006-01-02T15")
+		n := 1
+		for n < len(entries) && entries[n].Time.UTC().Format("2006-01-02T15") == hour {
+			n++
+		}
+		if err := appendEntries(filepath.Join(dir, hour+".jsonl"), entries[:n]); err != nil {
+			return err
+		}
+		entries = entries[n:]
+	}
+	return nil
+}
+
+func appendEntries(path string, entries []Entry) error {
+	var data []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Prune implements Sink. Directories left empty are removed too.
+func (s *FileSink) Prune(ctx context.Context, namespace, realm string, before time.Time) (int, error) {
+	root := filepath.Join(s.Dir, filepath.FromSlash(realmPrefix(namespace, realm)))
+
+	deleted := 0
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(before) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+
+	// Deepest first, so parents emptied by removing children go too
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		os.Remove(dir)
+	}
+	return deleted, err
+}
+
+// Close implements Sink
+func (s *FileSink) Close() error {
+	return nil
+}
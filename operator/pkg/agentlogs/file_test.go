@@ -0,0 +1,78 @@
+package agentlogs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSinkPrune(t *testing.T) {
+	ctx := context.Background()
+	sink, err := NewFileSink(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	now := time.Now().UTC().Truncate(time.Hour)
+	write := func(source Source, at ...time.Time) {
+		t.Helper()
+		var entries []Entry
+		for _, logged := range at {
+			entries = append(entries, Entry{Source: source, Time: logged, Line: "Executing loop"})
+		}
+		if err := sink.Write(ctx, source, entries); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	// age sets the modification time of a container's log file
+	age := func(source Source, hour time.Time, modified time.Time) {
+		t.Helper()
+		path := filepath.Join(sink.Dir, filepath.FromSlash(sourcePrefix(source)), hour.Format("2006-01-02T15")+".jsonl")
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := Source{Namespace: "default", Realm: "us-realm", AgentInstance: "support-v1", Pod: "support-v1-0", Container: "agent"}
+	current := Source{Namespace: "default", Realm: "us-realm", AgentInstance: "support-v2", Pod: "support-v2-0", Container: "agent"}
+	otherRealm := Source{Namespace: "default", Realm: "eu-realm", AgentInstance: "support-v1", Pod: "support-v1-0", Container: "agent"}
+	write(old, now.Add(-50*time.Hour), now.Add(-49*time.Hour))
+	write(current, now.Add(-49*time.Hour), now)
+	write(otherRealm, now.Add(-50*time.Hour))
+	age(old, now.Add(-50*time.Hour), now.Add(-50*time.Hour))
+	age(old, now.Add(-49*time.Hour), now.Add(-49*time.Hour))
+	age(current, now.Add(-49*time.Hour), now.Add(-49*time.Hour))
+	age(otherRealm, now.Add(-50*time.Hour), now.Add(-50*time.Hour))
+
+	deleted, err := sink.Prune(ctx, "default", "us-realm", now.Add(-48*time.Hour))
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Prune() = %d, want the 3 files of us-realm older than the retention", deleted)
+	}
+
+	var files []string
+	filepath.WalkDir(sink.Dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(sink.Dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	want := []string{
+		"default/eu-realm/support-v1/support-v1-0/agent/" + now.Add(-50*time.Hour).Format("2006-01-02T15") + ".jsonl",
+		"default/us-realm/support-v2/support-v2-0/agent/" + now.Format("2006-01-02T15") + ".jsonl",
+	}
+	if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] {
+		t.Errorf("files after Prune() = %v, want %v", files, want)
+	}
+	if _, err := os.Stat(filepath.Join(sink.Dir, "default", "us-realm", "support-v1")); !os.IsNotExist(err) {
+		t.Errorf("directory of the pruned AgentInstance: Stat() error = %v, want it removed", err)
+	}
+
+	if deleted, err := sink.Prune(ctx, "default", "unknown", now); err != nil || deleted != 0 {
+		t.Errorf("Prune() of a realm without logs = %d, %v, want 0, nil", deleted, err)
+	}
+}
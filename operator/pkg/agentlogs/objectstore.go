@@ -0,0 +1,143 @@
+package agentlogs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ObjectStoreOptions locates the bucket of an ObjectStoreSink. Credentials
+// are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, MINIO_ROOT_USER
+// and MINIO_ROOT_PASSWORD, or the IAM role of the pod, in that order.
+type ObjectStoreOptions struct {
+	// Endpoint is the host and optional port of an S3-compatible API
+	Endpoint string
+	Bucket   string
+	// Prefix is prepended to the key of every object
+	Prefix   string
+	Region   string
+	Insecure bool
+}
+
+// ObjectStoreSink writes each flushed batch as one JSON Lines object:
+//
+//	<prefix>/<namespace>/<realm>/<agentInstance>/<pod>/<container>/<first>-<last>.jsonl
+//
+// where first and last are the times of the batch's entries.
+type ObjectStoreSink struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+var _ Sink = &ObjectStoreSink{}
+
+// NewObjectStoreSink connects to the object store and checks that the
+// bucket exists
+func NewObjectStoreSink(ctx context.Context, opts ObjectStoreOptions) (*ObjectStoreSink, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, fmt.Errorf("object store endpoint and bucket are required")
+	}
+
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.IAM{},
+		}),
+		Secure: !opts.Insecure,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", opts.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s does not exist", opts.Bucket)
+	}
+
+	return &ObjectStoreSink{client: client, bucket: opts.Bucket, prefix: strings.Trim(opts.Prefix, "/")}, nil
+}
+
+// Write implements Sink
+func (s *ObjectStoreSink) Write(ctx context.Context, source Source, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	name := fmt.Sprintf("%d-%d.jsonl", entries[0].Time.UnixNano(), entries[len(entries)-1].Time.UnixNano())
+	key := path.Join(s.prefix, sourcePrefix(source), name)
+	_, err := s.client.PutObject(ctx, s.bucket, key, &data, int64(data.Len()), minio.PutObjectOptions{
+		ContentType: "application/x-ndjson",
+	})
+	return err
+}
+
+// Prune implements Sink
+func (s *ObjectStoreSink) Prune(ctx context.Context, namespace, realm string, before time.Time) (int, error) {
+	prefix := path.Join(s.prefix, realmPrefix(namespace, realm)) + "/"
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var listErr error
+	expired := make(chan minio.ObjectInfo)
+	deleted := 0
+	go func() {
+		defer close(expired)
+		for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			if !object.LastModified.Before(before) {
+				continue
+			}
+			select {
+			case expired <- object:
+				deleted++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var removeErr error
+	failed := 0
+	for failure := range s.client.RemoveObjects(ctx, s.bucket, expired, minio.RemoveObjectsOptions{}) {
+		failed++
+		if removeErr == nil {
+			removeErr = fmt.Errorf("failed to delete %s: %w", failure.ObjectName, failure.Err)
+			cancel()
+		}
+	}
+	// The listing has finished once RemoveObjects has returned
+	if removeErr != nil {
+		return deleted - failed, removeErr
+	}
+	return deleted, listErr
+}
+
+// Close implements Sink
+func (s *ObjectStoreSink) Close() error {
+	return nil
+}
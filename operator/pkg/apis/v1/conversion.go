@@ -0,0 +1,16 @@
+package v1
+
+// v1 is the hub of the loopstacks.io API versions: every other version
+// converts to and from it, see sigs.k8s.io/controller-runtime/pkg/conversion.
+
+// Hub marks Agent as a conversion hub
+func (*Agent) Hub() {}
+
+// Hub marks AgentInstance as a conversion hub
+func (*AgentInstance) Hub() {}
+
+// Hub marks Realm as a conversion hub
+func (*Realm) Hub() {}
+
+// Hub marks LoopStack as a conversion hub
+func (*LoopStack) Hub() {}
@@ -0,0 +1,27 @@
+package v1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// GetLastUpdated returns when the status last changed
+func (s *AgentStatus) GetLastUpdated() metav1.Time { return s.LastUpdated }
+
+// SetLastUpdated records when the status last changed
+func (s *AgentStatus) SetLastUpdated(t metav1.Time) { s.LastUpdated = t }
+
+// GetLastUpdated returns when the status last changed
+func (s *AgentInstanceStatus) GetLastUpdated() metav1.Time { return s.LastUpdated }
+
+// SetLastUpdated records when the status last changed
+func (s *AgentInstanceStatus) SetLastUpdated(t metav1.Time) { s.LastUpdated = t }
+
+// GetLastUpdated returns when the status last changed
+func (s *RealmStatus) GetLastUpdated() metav1.Time { return s.LastUpdated }
+
+// SetLastUpdated records when the status last changed
+func (s *RealmStatus) SetLastUpdated(t metav1.Time) { s.LastUpdated = t }
+
+// GetLastUpdated returns when the status last changed
+func (s *LoopStackStatus) GetLastUpdated() metav1.Time { return s.LastUpdated }
+
+// SetLastUpdated records when the status last changed
+func (s *LoopStackStatus) SetLastUpdated(t metav1.Time) { s.LastUpdated = t }
@@ -1,8 +1,10 @@
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // Agent defines the specification for an AI agent
@@ -26,6 +28,10 @@ type AgentSpec struct {
 	Capabilities []string      `json:"capabilities"`
 	Schema       AgentSchema   `json:"schema"`
 	Metadata     AgentMetadata `json:"metadata,omitempty"`
+	// DeletionPolicy is what deleting the Agent does to its AgentInstances:
+	// Block (default) waits for them to be deleted, Cascade deletes them once
+	// their pods finish their loops, Orphan leaves them running
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
 }
 
 // AgentRuntime defines the runtime configuration for an agent
@@ -33,12 +39,27 @@ type AgentRuntime struct {
 	Image     string            `json:"image"`
 	Language  string            `json:"language"`
 	Resources map[string]string `json:"resources,omitempty"`
+	// SecretRefs expose Secret keys, such as model provider API keys, to
+	// the pods of every AgentInstance of the Agent
+	SecretRefs []SecretRef `json:"secretRefs,omitempty"`
+	// EnvFrom exposes every key of Secrets or ConfigMaps to the pods of
+	// every AgentInstance of the Agent
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+}
+
+// SecretRef exposes a Secret key to agent pods as an environment variable
+type SecretRef struct {
+	// Env names the environment variable
+	Env          string                   `json:"env"`
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
 }
 
 // AgentSchema defines the input/output schema for an agent
 type AgentSchema struct {
 	Input  runtime.RawExtension `json:"input"`
 	Output runtime.RawExtension `json:"output"`
+	// Config, when set, validates the Config of the Agent's AgentInstances
+	Config runtime.RawExtension `json:"config,omitempty"`
 }
 
 // AgentMetadata contains additional metadata about the agent
@@ -56,6 +77,10 @@ type AgentStatus struct {
 	Message     string      `json:"message,omitempty"`
 	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
 	Instances   int32       `json:"instances,omitempty"`
+	// ObservedGeneration is the generation the status was last computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions include Ready, see package conditions
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // AgentList contains a list of Agent
@@ -93,18 +118,57 @@ type RealmResources struct {
 	MaxConcurrentLoops  int32       `json:"maxConcurrentLoops,omitempty"`
 	StorageClass        string      `json:"storageClass,omitempty"`
 	RedisConfig         RedisConfig `json:"redisConfig,omitempty"`
+	// CoordinationBackend selects the transport of the bidding protocol,
+	// redis (default) or nats
+	CoordinationBackend string     `json:"coordinationBackend,omitempty"`
+	NATSConfig          NATSConfig `json:"natsConfig,omitempty"`
 }
 
 // RedisConfig defines Redis configuration for a realm
 type RedisConfig struct {
 	Replicas int32  `json:"replicas,omitempty"`
 	Memory   string `json:"memory,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// NATSConfig defines NATS JetStream configuration for a realm
+type NATSConfig struct {
+	URL      string `json:"url,omitempty"`
+	Stream   string `json:"stream,omitempty"`
+	Replicas int32  `json:"replicas,omitempty"`
 }
 
 // RealmNetworking defines networking configuration for a realm
 type RealmNetworking struct {
 	AllowCrossRealmCommunication bool     `json:"allowCrossRealmCommunication,omitempty"`
-	FederationEndpoints          []string `json:"federationEndpoints,omitempty"`
+	// FederationEndpoints are the federation API URLs of peer realms,
+	// https://<host>:<port>/realms/<namespace>/<realm>. Federated realms
+	// forward loops to them when fewer local agents than MinBids bid.
+	FederationEndpoints []string `json:"federationEndpoints,omitempty"`
+	// FederationPeers names the certificates of peers, besides those of the
+	// FederationEndpoints hosts, allowed to forward loops to this realm
+	FederationPeers []string `json:"federationPeers,omitempty"`
+	// Exports offers capabilities of this realm's agents to other realms.
+	// Sharing requires AllowCrossRealmCommunication on both realms.
+	Exports []CapabilityExport `json:"exports,omitempty"`
+	// Imports bids this realm's loops out to agents of other realms
+	Imports []CapabilityImport `json:"imports,omitempty"`
+}
+
+// CapabilityExport offers capabilities to other realms
+type CapabilityExport struct {
+	Capabilities []string `json:"capabilities"`
+	// Realms restricts the export to these realms, given as name in this
+	// realm's namespace or as namespace/name. Empty exports to every realm.
+	Realms []string `json:"realms,omitempty"`
+}
+
+// CapabilityImport uses capabilities exported by another realm
+type CapabilityImport struct {
+	// Realm is the exporting realm, as name in this realm's namespace or as
+	// namespace/name
+	Realm        string   `json:"realm"`
+	Capabilities []string `json:"capabilities"`
 }
 
 // RealmGovernance defines governance policies for a realm
@@ -128,6 +192,35 @@ type RealmStatus struct {
 	AgentInstances int32       `json:"agentInstances,omitempty"`
 	ActiveLoops    int32       `json:"activeLoops,omitempty"`
 	RedisStatus    string      `json:"redisStatus,omitempty"`
+	// Federation reports the health of each federation endpoint
+	Federation []FederationPeerStatus `json:"federation,omitempty"`
+	// Imports reports which imported capabilities are in effect
+	Imports            []EffectiveImport  `json:"imports,omitempty"`
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// EffectiveImport is the outcome of a CapabilityImport
+type EffectiveImport struct {
+	// Realm is the exporting realm as namespace/name
+	Realm string `json:"realm"`
+	// Capabilities are the imported capabilities the realm exports to this one
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Denied are the imported capabilities the realm does not export to
+	// this one
+	Denied  []string `json:"denied,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+// FederationPeerStatus is the last observed health of a federation endpoint
+type FederationPeerStatus struct {
+	Endpoint string `json:"endpoint"`
+	Healthy  bool   `json:"healthy"`
+	// Agents is the number of agents registered in the peer realm
+	Agents          int32        `json:"agents,omitempty"`
+	Message         string       `json:"message,omitempty"`
+	LastProbeTime   metav1.Time  `json:"lastProbeTime,omitempty"`
+	LastHealthyTime *metav1.Time `json:"lastHealthyTime,omitempty"`
 }
 
 // RealmList contains a list of Realm
@@ -156,9 +249,34 @@ type AgentInstanceSpec struct {
 	Realm       string                     `json:"realm"`
 	Replicas    int32                      `json:"replicas,omitempty"`
 	Resources   map[string]string          `json:"resources,omitempty"`
+	// Config is mounted into agent pods as JSON, see ConfigUpdate
 	Config      runtime.RawExtension       `json:"config,omitempty"`
+	// ConfigSecrets are mounted next to Config, so that API keys are not
+	// inlined in it
+	ConfigSecrets []AgentInstanceConfigSecret `json:"configSecrets,omitempty"`
+	// ConfigUpdate is Restart to roll out a new revision when Config or
+	// ConfigSecrets change, or HotReload to update the mounted files in
+	// place and let agents reload them
+	ConfigUpdate  string                     `json:"configUpdate,omitempty"`
+	// SecretRefs add to the Agent's, replacing those of the same Env
+	SecretRefs  []SecretRef                `json:"secretRefs,omitempty"`
+	// EnvFrom adds to the Agent's
+	EnvFrom     []corev1.EnvFromSource     `json:"envFrom,omitempty"`
 	Autoscaling AgentInstanceAutoscaling   `json:"autoscaling,omitempty"`
 	Placement   AgentInstancePlacement     `json:"placement,omitempty"`
+	// Rollout controls how pods of a new revision replace the running ones
+	Rollout     AgentInstanceRollout       `json:"rollout,omitempty"`
+	// Shadow agents run every loop they bid on next to the selected agents.
+	// Their results are compared with the step's output and recorded, but
+	// never aggregated.
+	Shadow      bool                       `json:"shadow,omitempty"`
+}
+
+// AgentInstanceConfigSecret mounts a Secret key into agent pods
+type AgentInstanceConfigSecret struct {
+	// Name of the file the key is mounted as in the secrets directory
+	Name         string                   `json:"name"`
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
 }
 
 // AgentInstanceAutoscaling defines autoscaling configuration
@@ -177,23 +295,110 @@ type AgentInstancePlacement struct {
 	Affinity     runtime.RawExtension        `json:"affinity,omitempty"`
 }
 
-// AgentInstanceStatus defines the observed state of AgentInstance
-type AgentInstanceStatus struct {
-	Phase           string                        `json:"phase,omitempty"`
-	Message         string                        `json:"message,omitempty"`
-	LastUpdated     metav1.Time                   `json:"lastUpdated,omitempty"`
-	ReadyReplicas   int32                         `json:"readyReplicas,omitempty"`
-	CurrentReplicas int32                         `json:"currentReplicas,omitempty"`
-	Conditions      []AgentInstanceCondition      `json:"conditions,omitempty"`
+// AgentInstanceRollout defines the rollout strategy of an AgentInstance.
+// A revision is rolled out whenever the pods it renders change, such as
+// when the Agent's runtime image changes.
+type AgentInstanceRollout struct {
+	// Strategy is RollingUpdate (default), BlueGreen or Canary
+	Strategy      string                     `json:"strategy,omitempty"`
+	RollingUpdate AgentInstanceRollingUpdate `json:"rollingUpdate,omitempty"`
+	BlueGreen     AgentInstanceBlueGreen     `json:"blueGreen,omitempty"`
+	Canary        AgentInstanceCanary        `json:"canary,omitempty"`
+}
+
+// AgentInstanceRollingUpdate replaces pods in place, both revisions
+// bidding while the update progresses
+type AgentInstanceRollingUpdate struct {
+	MaxSurge       *intstr.IntOrString `json:"maxSurge,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// AgentInstanceBlueGreen starts a full set of pods of the new revision
+// that receives no loops until it is promoted, then switches all loops to
+// it at once
+type AgentInstanceBlueGreen struct {
+	// AutoPromote switches as soon as the new pods are available instead of
+	// waiting for the loopstacks.io/promote annotation
+	AutoPromote bool `json:"autoPromote,omitempty"`
+}
+
+// AgentInstanceCanary routes a share of the loops to a few pods of the new
+// revision and promotes it once its executions stayed within thresholds
+// for Duration, or rolls it back as soon as they do not
+type AgentInstanceCanary struct {
+	// Replicas is the number of canary pods, 1 by default
+	Replicas int32 `json:"replicas,omitempty"`
+	// Weight is the percentage of loops routed to the canary, 10 by default
+	Weight int32 `json:"weight,omitempty"`
+	// Duration is how long the canary is analyzed, 10m by default
+	Duration string `json:"duration,omitempty"`
+	// MinExecutions is the number of canary executions required before
+	// thresholds apply and before promotion, 10 by default
+	MinExecutions int32 `json:"minExecutions,omitempty"`
+	// MaxFailureRate is the percentage of failed canary executions that
+	// triggers a rollback, 5 by default
+	MaxFailureRate int32 `json:"maxFailureRate,omitempty"`
+	// MaxLatency is the 95th percentile canary execution latency that
+	// triggers a rollback. Latency is not checked when empty.
+	MaxLatency string `json:"maxLatency,omitempty"`
 }
 
-// AgentInstanceCondition represents a condition of an AgentInstance
-type AgentInstanceCondition struct {
-	Type               string      `json:"type"`
-	Status             string      `json:"status"`
-	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
-	Reason             string      `json:"reason,omitempty"`
-	Message            string      `json:"message,omitempty"`
+// AgentInstanceStatus defines the observed state of AgentInstance
+type AgentInstanceStatus struct {
+	Phase              string                     `json:"phase,omitempty"`
+	Message            string                     `json:"message,omitempty"`
+	LastUpdated        metav1.Time                `json:"lastUpdated,omitempty"`
+	ReadyReplicas      int32                      `json:"readyReplicas,omitempty"`
+	CurrentReplicas    int32                      `json:"currentReplicas,omitempty"`
+	ActiveLoops        int32                      `json:"activeLoops,omitempty"`
+	ObservedGeneration int64                      `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition         `json:"conditions,omitempty"`
+	Rollout            AgentInstanceRolloutStatus `json:"rollout,omitempty"`
+	Shadow             *AgentInstanceShadowStatus `json:"shadow,omitempty"`
+}
+
+// AgentInstanceShadowStatus compares the results of a shadow AgentInstance
+// with the outputs of the steps it ran on since StartTime
+type AgentInstanceShadowStatus struct {
+	StartTime  *metav1.Time `json:"startTime,omitempty"`
+	Executions int32        `json:"executions,omitempty"`
+	// Failures counts executions without a result
+	Failures int32 `json:"failures,omitempty"`
+	// SchemaValidRate is the percentage of results valid against the
+	// Agent's output schema
+	SchemaValidRate int32 `json:"schemaValidRate,omitempty"`
+	// AgreementRate is the percentage of results equal to the step's
+	// output or to the result of one of its selected agents
+	AgreementRate int32 `json:"agreementRate,omitempty"`
+	// Latency is the 95th percentile execution latency
+	Latency string `json:"latency,omitempty"`
+}
+
+// AgentInstanceRolloutStatus reports the progress of a rollout. While
+// StableRevision and UpdateRevision differ under the BlueGreen or Canary
+// strategy, Weight percent of the loops are routed to UpdateRevision and
+// the rest to StableRevision.
+type AgentInstanceRolloutStatus struct {
+	StableRevision string `json:"stableRevision,omitempty"`
+	UpdateRevision string `json:"updateRevision,omitempty"`
+	// Phase is Progressing, Paused, Analyzing, Promoting, Completed or
+	// RolledBack
+	Phase     string       `json:"phase,omitempty"`
+	Weight    int32        `json:"weight,omitempty"`
+	Message   string       `json:"message,omitempty"`
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// Analysis holds the canary's execution stats
+	Analysis AgentInstanceRolloutAnalysis `json:"analysis,omitempty"`
+}
+
+// AgentInstanceRolloutAnalysis summarizes the executions of a canary since
+// it started receiving loops
+type AgentInstanceRolloutAnalysis struct {
+	StartTime  *metav1.Time `json:"startTime,omitempty"`
+	Executions int32        `json:"executions,omitempty"`
+	Failures   int32        `json:"failures,omitempty"`
+	// Latency is the 95th percentile execution latency
+	Latency string `json:"latency,omitempty"`
 }
 
 // AgentInstanceList contains a list of AgentInstance
@@ -221,6 +426,7 @@ type LoopStackSpec struct {
 	Description  string                `json:"description"`
 	Schema       LoopStackSchema       `json:"schema"`
 	Phases       LoopStackPhases       `json:"phases,omitempty"`
+	Steps        []LoopStackStep       `json:"steps,omitempty"`
 	Capabilities []string              `json:"capabilities"`
 	Metadata     LoopStackMetadata     `json:"metadata,omitempty"`
 }
@@ -278,6 +484,25 @@ type LoopStackOutputPhase struct {
 	AggregationStrategy  string `json:"aggregationStrategy,omitempty"`
 }
 
+// LoopStackStep defines a single step of the workflow. Steps run in order;
+// a step whose condition evaluates to false is skipped.
+type LoopStackStep struct {
+	Name          string                  `json:"name"`
+	Type          string                  `json:"type,omitempty"`
+	Capabilities  []string                `json:"capabilities,omitempty"`
+	Condition     string                  `json:"condition,omitempty"`
+	HumanApproval *LoopStackHumanApproval `json:"humanApproval,omitempty"`
+}
+
+// LoopStackHumanApproval defines a step that pauses the execution until a
+// person approves or rejects it
+type LoopStackHumanApproval struct {
+	Message        string   `json:"message,omitempty"`
+	Approvers      []string `json:"approvers,omitempty"`
+	Timeout        string   `json:"timeout,omitempty"`
+	DefaultOutcome string   `json:"defaultOutcome,omitempty"`
+}
+
 // LoopStackMetadata contains additional metadata about the workflow
 type LoopStackMetadata struct {
 	Version  string   `json:"version,omitempty"`
@@ -288,10 +513,12 @@ type LoopStackMetadata struct {
 
 // LoopStackStatus defines the observed state of LoopStack
 type LoopStackStatus struct {
-	Phase       string                    `json:"phase,omitempty"`
-	Message     string                    `json:"message,omitempty"`
-	LastUpdated metav1.Time               `json:"lastUpdated,omitempty"`
-	Executions  LoopStackExecutionStats   `json:"executions,omitempty"`
+	Phase              string                  `json:"phase,omitempty"`
+	Message            string                  `json:"message,omitempty"`
+	LastUpdated        metav1.Time             `json:"lastUpdated,omitempty"`
+	Executions         LoopStackExecutionStats `json:"executions,omitempty"`
+	ObservedGeneration int64                   `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition      `json:"conditions,omitempty"`
 }
 
 // LoopStackExecutionStats tracks execution statistics
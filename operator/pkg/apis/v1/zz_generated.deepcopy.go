@@ -21,7 +21,10 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -94,17 +97,47 @@ func (in *AgentInstanceAutoscaling) DeepCopy() *AgentInstanceAutoscaling {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *AgentInstanceCondition) DeepCopyInto(out *AgentInstanceCondition) {
+func (in *AgentInstanceBlueGreen) DeepCopyInto(out *AgentInstanceBlueGreen) {
 	*out = *in
-	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceCondition.
-func (in *AgentInstanceCondition) DeepCopy() *AgentInstanceCondition {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceBlueGreen.
+func (in *AgentInstanceBlueGreen) DeepCopy() *AgentInstanceBlueGreen {
 	if in == nil {
 		return nil
 	}
-	out := new(AgentInstanceCondition)
+	out := new(AgentInstanceBlueGreen)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentInstanceCanary) DeepCopyInto(out *AgentInstanceCanary) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceCanary.
+func (in *AgentInstanceCanary) DeepCopy() *AgentInstanceCanary {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentInstanceCanary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentInstanceConfigSecret) DeepCopyInto(out *AgentInstanceConfigSecret) {
+	*out = *in
+	in.SecretKeyRef.DeepCopyInto(&out.SecretKeyRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceConfigSecret.
+func (in *AgentInstanceConfigSecret) DeepCopy() *AgentInstanceConfigSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentInstanceConfigSecret)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -171,6 +204,107 @@ func (in *AgentInstancePlacement) DeepCopy() *AgentInstancePlacement {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentInstanceRollingUpdate) DeepCopyInto(out *AgentInstanceRollingUpdate) {
+	*out = *in
+	if in.MaxSurge != nil {
+		in, out := &in.MaxSurge, &out.MaxSurge
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceRollingUpdate.
+func (in *AgentInstanceRollingUpdate) DeepCopy() *AgentInstanceRollingUpdate {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentInstanceRollingUpdate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentInstanceRollout) DeepCopyInto(out *AgentInstanceRollout) {
+	*out = *in
+	in.RollingUpdate.DeepCopyInto(&out.RollingUpdate)
+	out.BlueGreen = in.BlueGreen
+	out.Canary = in.Canary
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceRollout.
+func (in *AgentInstanceRollout) DeepCopy() *AgentInstanceRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentInstanceRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentInstanceRolloutAnalysis) DeepCopyInto(out *AgentInstanceRolloutAnalysis) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceRolloutAnalysis.
+func (in *AgentInstanceRolloutAnalysis) DeepCopy() *AgentInstanceRolloutAnalysis {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentInstanceRolloutAnalysis)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentInstanceRolloutStatus) DeepCopyInto(out *AgentInstanceRolloutStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	in.Analysis.DeepCopyInto(&out.Analysis)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceRolloutStatus.
+func (in *AgentInstanceRolloutStatus) DeepCopy() *AgentInstanceRolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentInstanceRolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentInstanceShadowStatus) DeepCopyInto(out *AgentInstanceShadowStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceShadowStatus.
+func (in *AgentInstanceShadowStatus) DeepCopy() *AgentInstanceShadowStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentInstanceShadowStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AgentInstanceSpec) DeepCopyInto(out *AgentInstanceSpec) {
 	*out = *in
@@ -182,8 +316,30 @@ func (in *AgentInstanceSpec) DeepCopyInto(out *AgentInstanceSpec) {
 		}
 	}
 	in.Config.DeepCopyInto(&out.Config)
+	if in.ConfigSecrets != nil {
+		in, out := &in.ConfigSecrets, &out.ConfigSecrets
+		*out = make([]AgentInstanceConfigSecret, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SecretRefs != nil {
+		in, out := &in.SecretRefs, &out.SecretRefs
+		*out = make([]SecretRef, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]corev1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	out.Autoscaling = in.Autoscaling
 	in.Placement.DeepCopyInto(&out.Placement)
+	in.Rollout.DeepCopyInto(&out.Rollout)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceSpec.
@@ -202,11 +358,17 @@ func (in *AgentInstanceStatus) DeepCopyInto(out *AgentInstanceStatus) {
 	in.LastUpdated.DeepCopyInto(&out.LastUpdated)
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]AgentInstanceCondition, len(*in))
+		*out = make([]metav1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	in.Rollout.DeepCopyInto(&out.Rollout)
+	if in.Shadow != nil {
+		in, out := &in.Shadow, &out.Shadow
+		*out = new(AgentInstanceShadowStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentInstanceStatus.
@@ -281,6 +443,20 @@ func (in *AgentRuntime) DeepCopyInto(out *AgentRuntime) {
 			(*out)[key] = val
 		}
 	}
+	if in.SecretRefs != nil {
+		in, out := &in.SecretRefs, &out.SecretRefs
+		*out = make([]SecretRef, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]corev1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentRuntime.
@@ -298,6 +474,7 @@ func (in *AgentSchema) DeepCopyInto(out *AgentSchema) {
 	*out = *in
 	in.Input.DeepCopyInto(&out.Input)
 	in.Output.DeepCopyInto(&out.Output)
+	in.Config.DeepCopyInto(&out.Config)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentSchema.
@@ -337,6 +514,13 @@ func (in *AgentSpec) DeepCopy() *AgentSpec {
 func (in *AgentStatus) DeepCopyInto(out *AgentStatus) {
 	*out = *in
 	in.LastUpdated.DeepCopyInto(&out.LastUpdated)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentStatus.
@@ -349,6 +533,96 @@ func (in *AgentStatus) DeepCopy() *AgentStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapabilityExport) DeepCopyInto(out *CapabilityExport) {
+	*out = *in
+	if in.Capabilities != nil {
+		in, out := &in.Capabilities, &out.Capabilities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Realms != nil {
+		in, out := &in.Realms, &out.Realms
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapabilityExport.
+func (in *CapabilityExport) DeepCopy() *CapabilityExport {
+	if in == nil {
+		return nil
+	}
+	out := new(CapabilityExport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapabilityImport) DeepCopyInto(out *CapabilityImport) {
+	*out = *in
+	if in.Capabilities != nil {
+		in, out := &in.Capabilities, &out.Capabilities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapabilityImport.
+func (in *CapabilityImport) DeepCopy() *CapabilityImport {
+	if in == nil {
+		return nil
+	}
+	out := new(CapabilityImport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EffectiveImport) DeepCopyInto(out *EffectiveImport) {
+	*out = *in
+	if in.Capabilities != nil {
+		in, out := &in.Capabilities, &out.Capabilities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Denied != nil {
+		in, out := &in.Denied, &out.Denied
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EffectiveImport.
+func (in *EffectiveImport) DeepCopy() *EffectiveImport {
+	if in == nil {
+		return nil
+	}
+	out := new(EffectiveImport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FederationPeerStatus) DeepCopyInto(out *FederationPeerStatus) {
+	*out = *in
+	in.LastProbeTime.DeepCopyInto(&out.LastProbeTime)
+	if in.LastHealthyTime != nil {
+		in, out := &in.LastHealthyTime, &out.LastHealthyTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FederationPeerStatus.
+func (in *FederationPeerStatus) DeepCopy() *FederationPeerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FederationPeerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LoopStack) DeepCopyInto(out *LoopStack) {
 	*out = *in
@@ -437,6 +711,26 @@ func (in *LoopStackExecutionStats) DeepCopy() *LoopStackExecutionStats {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoopStackHumanApproval) DeepCopyInto(out *LoopStackHumanApproval) {
+	*out = *in
+	if in.Approvers != nil {
+		in, out := &in.Approvers, &out.Approvers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoopStackHumanApproval.
+func (in *LoopStackHumanApproval) DeepCopy() *LoopStackHumanApproval {
+	if in == nil {
+		return nil
+	}
+	out := new(LoopStackHumanApproval)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LoopStackIntakePhase) DeepCopyInto(out *LoopStackIntakePhase) {
 	*out = *in
@@ -541,7 +835,7 @@ func (in *LoopStackPhases) DeepCopyInto(out *LoopStackPhases) {
 	*out = *in
 	in.Intake.DeepCopyInto(&out.Intake)
 	out.Bidding = in.Bidding
-	in.Execution.DeepCopyInto(&out.Execution)
+	out.Execution = in.Execution
 	out.Output = in.Output
 }
 
@@ -577,6 +871,13 @@ func (in *LoopStackSpec) DeepCopyInto(out *LoopStackSpec) {
 	*out = *in
 	in.Schema.DeepCopyInto(&out.Schema)
 	in.Phases.DeepCopyInto(&out.Phases)
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]LoopStackStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Capabilities != nil {
 		in, out := &in.Capabilities, &out.Capabilities
 		*out = make([]string, len(*in))
@@ -600,6 +901,13 @@ func (in *LoopStackStatus) DeepCopyInto(out *LoopStackStatus) {
 	*out = *in
 	in.LastUpdated.DeepCopyInto(&out.LastUpdated)
 	out.Executions = in.Executions
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoopStackStatus.
@@ -612,6 +920,46 @@ func (in *LoopStackStatus) DeepCopy() *LoopStackStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoopStackStep) DeepCopyInto(out *LoopStackStep) {
+	*out = *in
+	if in.Capabilities != nil {
+		in, out := &in.Capabilities, &out.Capabilities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HumanApproval != nil {
+		in, out := &in.HumanApproval, &out.HumanApproval
+		*out = new(LoopStackHumanApproval)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoopStackStep.
+func (in *LoopStackStep) DeepCopy() *LoopStackStep {
+	if in == nil {
+		return nil
+	}
+	out := new(LoopStackStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NATSConfig) DeepCopyInto(out *NATSConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NATSConfig.
+func (in *NATSConfig) DeepCopy() *NATSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(NATSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Realm) DeepCopyInto(out *Realm) {
 	*out = *in
@@ -695,6 +1043,25 @@ func (in *RealmNetworking) DeepCopyInto(out *RealmNetworking) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.FederationPeers != nil {
+		in, out := &in.FederationPeers, &out.FederationPeers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exports != nil {
+		in, out := &in.Exports, &out.Exports
+		*out = make([]CapabilityExport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Imports != nil {
+		in, out := &in.Imports, &out.Imports
+		*out = make([]CapabilityImport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RealmNetworking.
@@ -711,6 +1078,7 @@ func (in *RealmNetworking) DeepCopy() *RealmNetworking {
 func (in *RealmResources) DeepCopyInto(out *RealmResources) {
 	*out = *in
 	out.RedisConfig = in.RedisConfig
+	out.NATSConfig = in.NATSConfig
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RealmResources.
@@ -741,9 +1109,9 @@ func (in *RealmRetentionPolicy) DeepCopy() *RealmRetentionPolicy {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RealmSpec) DeepCopyInto(out *RealmSpec) {
 	*out = *in
-	in.Resources.DeepCopyInto(&out.Resources)
+	out.Resources = in.Resources
 	in.Networking.DeepCopyInto(&out.Networking)
-	in.Governance.DeepCopyInto(&out.Governance)
+	out.Governance = in.Governance
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RealmSpec.
@@ -760,6 +1128,27 @@ func (in *RealmSpec) DeepCopy() *RealmSpec {
 func (in *RealmStatus) DeepCopyInto(out *RealmStatus) {
 	*out = *in
 	in.LastUpdated.DeepCopyInto(&out.LastUpdated)
+	if in.Federation != nil {
+		in, out := &in.Federation, &out.Federation
+		*out = make([]FederationPeerStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Imports != nil {
+		in, out := &in.Imports, &out.Imports
+		*out = make([]EffectiveImport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RealmStatus.
@@ -785,4 +1174,20 @@ func (in *RedisConfig) DeepCopy() *RedisConfig {
 	out := new(RedisConfig)
 	in.DeepCopyInto(out)
 	return out
-}
\ No newline at end of file
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecretRef) DeepCopyInto(out *SecretRef) {
+	*out = *in
+	in.SecretKeyRef.DeepCopyInto(&out.SecretKeyRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretRef.
+func (in *SecretRef) DeepCopy() *SecretRef {
+	if in == nil {
+		return nil
+	}
+	out := new(SecretRef)
+	in.DeepCopyInto(out)
+	return out
+}
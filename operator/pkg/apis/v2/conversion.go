@@ -0,0 +1,531 @@
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/duration"
+)
+
+// ConversionDataAnnotation keeps the fields of an object that the version
+// it was converted to cannot represent, so that converting it back
+// restores them
+const ConversionDataAnnotation = "loopstacks.io/conversion-data"
+
+// conversionData are the fields of an object that another version cannot
+// represent. On v1 objects these are v2 fields, on v2 objects v1 strings.
+type conversionData struct {
+	// Resources holds the limits, claims and requests of resources other
+	// than those of v1ResourceNames
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Placement holds the placement fields v1 lacks
+	Placement *placementData `json:"placement,omitempty"`
+	// Strings holds, by path, the v1 strings of typed fields that v2 does
+	// not encode as written, such as "30d" encoded as "720h0m0s", or that
+	// do not parse
+	Strings map[string]string `json:"strings,omitempty"`
+}
+
+type placementData struct {
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	PriorityClassName         string                            `json:"priorityClassName,omitempty"`
+}
+
+// v1ResourceNames maps the keys of v1 resource maps to resources
+var v1ResourceNames = map[string]corev1.ResourceName{
+	"cpu":     corev1.ResourceCPU,
+	"memory":  corev1.ResourceMemory,
+	"storage": corev1.ResourceEphemeralStorage,
+}
+
+// typedField is a v1 string field that v2 parses into a typed field
+type typedField struct {
+	// path holds the JSON field names; "*" matches every item of a list
+	path []string
+	// parse returns the v2 encoding of a v1 string
+	parse func(string) (string, error)
+}
+
+// Typed fields of each kind, besides those converted explicitly
+var (
+	realmFields = []typedField{
+		{path: []string{"spec", "resources", "redisConfig", "memory"}, parse: parseQuantity},
+		{path: []string{"spec", "governance", "retentionPolicy", "loopHistory"}, parse: parseDuration},
+		{path: []string{"spec", "governance", "retentionPolicy", "agentLogs"}, parse: parseDuration},
+	}
+	agentInstanceFields = []typedField{
+		{path: []string{"spec", "rollout", "canary", "duration"}, parse: parseDuration},
+		{path: []string{"spec", "rollout", "canary", "maxLatency"}, parse: parseDuration},
+		{path: []string{"status", "rollout", "analysis", "latency"}, parse: parseDuration},
+		{path: []string{"status", "shadow", "latency"}, parse: parseDuration},
+	}
+	loopStackFields = []typedField{
+		{path: []string{"spec", "phases", "intake", "timeout"}, parse: parseDuration},
+		{path: []string{"spec", "phases", "bidding", "timeout"}, parse: parseDuration},
+		{path: []string{"spec", "phases", "execution", "timeout"}, parse: parseDuration},
+		{path: []string{"spec", "phases", "output", "timeout"}, parse: parseDuration},
+		{path: []string{"spec", "steps", "*", "humanApproval", "timeout"}, parse: parseDuration},
+		{path: []string{"status", "executions", "averageDuration"}, parse: parseDuration},
+	}
+)
+
+// ConvertTo converts this Agent to the hub version
+func (src *Agent) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.Agent)
+	*dst = v1.Agent{TypeMeta: dst.TypeMeta}
+	source := src.DeepCopy()
+	source.TypeMeta = metav1.TypeMeta{}
+	stored, err := takeConversionData(&source.ObjectMeta)
+	if err != nil {
+		return err
+	}
+	resources := source.Spec.Runtime.Resources
+	source.Spec.Runtime.Resources = corev1.ResourceRequirements{}
+	if err := toV1Fields(source, dst, nil, stored.Strings); err != nil {
+		return err
+	}
+
+	var data conversionData
+	dst.Spec.Runtime.Resources, data.Resources = toResourceMap(resources, "spec.runtime.resources", stored.Strings)
+	return setConversionData(&dst.ObjectMeta, data)
+}
+
+// ConvertFrom converts the hub version to this Agent
+func (dst *Agent) ConvertFrom(srcRaw conversion.Hub) error {
+	source := srcRaw.(*v1.Agent).DeepCopy()
+	source.TypeMeta = metav1.TypeMeta{}
+	stored, err := takeConversionData(&source.ObjectMeta)
+	if err != nil {
+		return err
+	}
+	resources := source.Spec.Runtime.Resources
+	source.Spec.Runtime.Resources = nil
+	*dst = Agent{TypeMeta: dst.TypeMeta}
+	data := conversionData{Strings: map[string]string{}}
+	if err := toV2Fields(source, dst, nil, data.Strings); err != nil {
+		return err
+	}
+
+	dst.Spec.Runtime.Resources = fromResourceMap(resources, stored.Resources, "spec.runtime.resources", data.Strings)
+	return setConversionData(&dst.ObjectMeta, data)
+}
+
+// ConvertTo converts this Realm to the hub version
+func (src *Realm) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.Realm)
+	*dst = v1.Realm{TypeMeta: dst.TypeMeta}
+	source := src.DeepCopy()
+	source.TypeMeta = metav1.TypeMeta{}
+	stored, err := takeConversionData(&source.ObjectMeta)
+	if err != nil {
+		return err
+	}
+	if err := toV1Fields(source, dst, realmFields, stored.Strings); err != nil {
+		return err
+	}
+	return setConversionData(&dst.ObjectMeta, conversionData{})
+}
+
+// ConvertFrom converts the hub version to this Realm
+func (dst *Realm) ConvertFrom(srcRaw conversion.Hub) error {
+	source := srcRaw.(*v1.Realm).DeepCopy()
+	source.TypeMeta = metav1.TypeMeta{}
+	if _, err := takeConversionData(&source.ObjectMeta); err != nil {
+		return err
+	}
+	*dst = Realm{TypeMeta: dst.TypeMeta}
+	data := conversionData{Strings: map[string]string{}}
+	if err := toV2Fields(source, dst, realmFields, data.Strings); err != nil {
+		return err
+	}
+	return setConversionData(&dst.ObjectMeta, data)
+}
+
+// ConvertTo converts this AgentInstance to the hub version
+func (src *AgentInstance) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.AgentInstance)
+	*dst = v1.AgentInstance{TypeMeta: dst.TypeMeta}
+	source := src.DeepCopy()
+	source.TypeMeta = metav1.TypeMeta{}
+	stored, err := takeConversionData(&source.ObjectMeta)
+	if err != nil {
+		return err
+	}
+	resources, placement := source.Spec.Resources, source.Spec.Placement
+	source.Spec.Resources = corev1.ResourceRequirements{}
+	source.Spec.Placement = AgentInstancePlacement{}
+	if err := toV1Fields(source, dst, agentInstanceFields, stored.Strings); err != nil {
+		return err
+	}
+
+	var data conversionData
+	dst.Spec.Resources, data.Resources = toResourceMap(resources, "spec.resources", stored.Strings)
+	dst.Spec.Placement, data.Placement, err = toV1Placement(placement)
+	if err != nil {
+		return err
+	}
+	return setConversionData(&dst.ObjectMeta, data)
+}
+
+// ConvertFrom converts the hub version to this AgentInstance
+func (dst *AgentInstance) ConvertFrom(srcRaw conversion.Hub) error {
+	source := srcRaw.(*v1.AgentInstance).DeepCopy()
+	source.TypeMeta = metav1.TypeMeta{}
+	stored, err := takeConversionData(&source.ObjectMeta)
+	if err != nil {
+		return err
+	}
+	resources, placement := source.Spec.Resources, source.Spec.Placement
+	source.Spec.Resources = nil
+	source.Spec.Placement = v1.AgentInstancePlacement{}
+	*dst = AgentInstance{TypeMeta: dst.TypeMeta}
+	data := conversionData{Strings: map[string]string{}}
+	if err := toV2Fields(source, dst, agentInstanceFields, data.Strings); err != nil {
+		return err
+	}
+
+	dst.Spec.Resources = fromResourceMap(resources, stored.Resources, "spec.resources", data.Strings)
+	dst.Spec.Placement, err = fromV1Placement(placement, stored.Placement)
+	if err != nil {
+		return fmt.Errorf("agentinstance %s: %w", source.Name, err)
+	}
+	return setConversionData(&dst.ObjectMeta, data)
+}
+
+// ConvertTo converts this LoopStack to the hub version
+func (src *LoopStack) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.LoopStack)
+	*dst = v1.LoopStack{TypeMeta: dst.TypeMeta}
+	source := src.DeepCopy()
+	source.TypeMeta = metav1.TypeMeta{}
+	stored, err := takeConversionData(&source.ObjectMeta)
+	if err != nil {
+		return err
+	}
+	if err := toV1Fields(source, dst, loopStackFields, stored.Strings); err != nil {
+		return err
+	}
+	return setConversionData(&dst.ObjectMeta, conversionData{})
+}
+
+// ConvertFrom converts the hub version to this LoopStack
+func (dst *LoopStack) ConvertFrom(srcRaw conversion.Hub) error {
+	source := srcRaw.(*v1.LoopStack).DeepCopy()
+	source.TypeMeta = metav1.TypeMeta{}
+	if _, err := takeConversionData(&source.ObjectMeta); err != nil {
+		return err
+	}
+	*dst = LoopStack{TypeMeta: dst.TypeMeta}
+	data := conversionData{Strings: map[string]string{}}
+	if err := toV2Fields(source, dst, loopStackFields, data.Strings); err != nil {
+		return err
+	}
+	return setConversionData(&dst.ObjectMeta, data)
+}
+
+// toV2Fields copies a v1 object to v2, parsing its typed fields. It keeps
+// the strings v2 does not encode as written in strings; those that do not
+// parse are left unset.
+func toV2Fields(src, dst interface{}, fields []typedField, strings map[string]string) error {
+	return copyFields(src, dst, fields, func(field typedField, parent map[string]interface{}, key, path string) {
+		value, ok := parent[key].(string)
+		if !ok {
+			return
+		}
+		typed, err := field.parse(value)
+		if err != nil {
+			delete(parent, key)
+			strings[path] = value
+			return
+		}
+		if typed != value {
+			strings[path] = value
+		}
+		parent[key] = typed
+	})
+}
+
+// toV1Fields copies a v2 object to v1, restoring the strings toV2Fields
+// kept for the fields that kept their value
+func toV1Fields(src, dst interface{}, fields []typedField, strings map[string]string) error {
+	return copyFields(src, dst, fields, func(field typedField, parent map[string]interface{}, key, path string) {
+		original, ok := strings[path]
+		if !ok {
+			return
+		}
+		value, set := parent[key].(string)
+		typed, err := field.parse(original)
+		if (err != nil && !set) || (err == nil && set && typed == value) {
+			parent[key] = original
+		}
+	})
+}
+
+// restoreString returns the v1 string kept for the field at path when it
+// still encodes value, or value
+func restoreString(strings map[string]string, path, value string, parse func(string) (string, error)) string {
+	if original, ok := strings[path]; ok {
+		if typed, err := parse(original); err == nil && typed == value {
+			return original
+		}
+	}
+	return value
+}
+
+// copyFields copies the fields src and dst encode alike, which are all
+// fields but the TypeMeta and those the caller cleared in src, calling
+// convert for the typed fields in between
+func copyFields(src, dst interface{}, fields []typedField, convert func(field typedField, parent map[string]interface{}, key, path string)) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	if len(fields) > 0 {
+		var object map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return err
+		}
+		for _, field := range fields {
+			eachField(object, field.path, "", func(parent map[string]interface{}, key, path string) {
+				convert(field, parent, key, path)
+			})
+		}
+		if data, err = json.Marshal(object); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// eachField calls fn with the object holding the field at path and the
+// field's name and dotted path, whether the field is set or not
+func eachField(object map[string]interface{}, path []string, prefix string, fn func(parent map[string]interface{}, key, path string)) {
+	if len(path) == 1 {
+		fn(object, path[0], prefix+path[0])
+		return
+	}
+	switch next := object[path[0]].(type) {
+	case map[string]interface{}:
+		eachField(next, path[1:], prefix+path[0]+".", fn)
+	case []interface{}:
+		if path[1] != "*" || len(path) < 3 {
+			return
+		}
+		for i, item := range next {
+			if item, ok := item.(map[string]interface{}); ok {
+				eachField(item, path[2:], fmt.Sprintf("%s%s.%d.", prefix, path[0], i), fn)
+			}
+		}
+	}
+}
+
+// parseDuration encodes a v1 duration, see package duration, as
+// metav1.Duration does
+func parseDuration(value string) (string, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		if d, err = duration.Parse(value); err != nil {
+			return "", err
+		}
+	}
+	return d.String(), nil
+}
+
+// parseQuantity encodes a v1 quantity as resource.Quantity does
+func parseQuantity(value string) (string, error) {
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return "", err
+	}
+	return quantity.String(), nil
+}
+
+// toResourceMap splits resource requirements into the v1 map of requests
+// at path and the requirements the map cannot represent, nil when there
+// are none. It restores the v1 strings fromResourceMap kept.
+func toResourceMap(resources corev1.ResourceRequirements, path string, strings map[string]string) (map[string]string, *corev1.ResourceRequirements) {
+	var values map[string]string
+	rest := corev1.ResourceRequirements{Limits: resources.Limits, Claims: resources.Claims}
+	for name, quantity := range resources.Requests {
+		key, ok := v1Key(name)
+		if !ok {
+			if rest.Requests == nil {
+				rest.Requests = corev1.ResourceList{}
+			}
+			rest.Requests[name] = quantity
+			continue
+		}
+		if values == nil {
+			values = map[string]string{}
+		}
+		values[key] = restoreString(strings, path+"."+key, quantity.String(), parseQuantity)
+	}
+
+	// Restore the values v2 could not represent, unless v2 has since set
+	// the resource
+	prefix := path + "."
+	for fieldPath, original := range strings {
+		if len(fieldPath) <= len(prefix) || fieldPath[:len(prefix)] != prefix {
+			continue
+		}
+		key := fieldPath[len(prefix):]
+		if _, set := values[key]; set {
+			continue
+		}
+		if _, known := v1ResourceNames[key]; known {
+			if _, err := parseQuantity(original); err == nil {
+				continue
+			}
+		}
+		if values == nil {
+			values = map[string]string{}
+		}
+		values[key] = original
+	}
+
+	if len(rest.Requests) == 0 && len(rest.Limits) == 0 && len(rest.Claims) == 0 {
+		return values, nil
+	}
+	return values, &rest
+}
+
+// fromResourceMap parses the v1 map of requests at path, adding the
+// requirements the map could not represent. It keeps the values that do
+// not encode as written in strings, and those v2 cannot represent at all,
+// invalid quantities and unknown resources, in strings only.
+func fromResourceMap(values map[string]string, rest *corev1.ResourceRequirements, path string, strings map[string]string) corev1.ResourceRequirements {
+	var resources corev1.ResourceRequirements
+	if rest != nil {
+		resources = *rest.DeepCopy()
+	}
+	for key, value := range values {
+		name, ok := v1ResourceNames[key]
+		if !ok {
+			strings[path+"."+key] = value
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			strings[path+"."+key] = value
+			continue
+		}
+		if quantity.String() != value {
+			strings[path+"."+key] = value
+		}
+		if resources.Requests == nil {
+			resources.Requests = corev1.ResourceList{}
+		}
+		resources.Requests[name] = quantity
+	}
+	return resources
+}
+
+// toV1Placement encodes tolerations and affinity as the raw objects of v1
+// and splits off the fields v1 lacks, nil when they are unset
+func toV1Placement(placement AgentInstancePlacement) (v1.AgentInstancePlacement, *placementData, error) {
+	result := v1.AgentInstancePlacement{NodeSelector: placement.NodeSelector}
+	for _, toleration := range placement.Tolerations {
+		raw, err := json.Marshal(toleration)
+		if err != nil {
+			return result, nil, err
+		}
+		result.Tolerations = append(result.Tolerations, runtime.RawExtension{Raw: raw})
+	}
+	if placement.Affinity != nil {
+		raw, err := json.Marshal(placement.Affinity)
+		if err != nil {
+			return result, nil, err
+		}
+		result.Affinity = runtime.RawExtension{Raw: raw}
+	}
+
+	if len(placement.TopologySpreadConstraints) == 0 && placement.PriorityClassName == "" {
+		return result, nil, nil
+	}
+	return result, &placementData{
+		TopologySpreadConstraints: placement.TopologySpreadConstraints,
+		PriorityClassName:         placement.PriorityClassName,
+	}, nil
+}
+
+// fromV1Placement decodes the raw tolerations and affinity of v1, adding
+// the fields v1 lacks
+func fromV1Placement(placement v1.AgentInstancePlacement, rest *placementData) (AgentInstancePlacement, error) {
+	result := AgentInstancePlacement{NodeSelector: placement.NodeSelector}
+	for i, raw := range placement.Tolerations {
+		var toleration corev1.Toleration
+		if err := json.Unmarshal(raw.Raw, &toleration); err != nil {
+			return AgentInstancePlacement{}, fmt.Errorf("invalid toleration %d: %w", i, err)
+		}
+		result.Tolerations = append(result.Tolerations, toleration)
+	}
+	if len(placement.Affinity.Raw) > 0 {
+		result.Affinity = &corev1.Affinity{}
+		if err := json.Unmarshal(placement.Affinity.Raw, result.Affinity); err != nil {
+			return AgentInstancePlacement{}, fmt.Errorf("invalid affinity: %w", err)
+		}
+	}
+	if rest != nil {
+		result.TopologySpreadConstraints = rest.TopologySpreadConstraints
+		result.PriorityClassName = rest.PriorityClassName
+	}
+	return result, nil
+}
+
+func v1Key(name corev1.ResourceName) (string, bool) {
+	for key, n := range v1ResourceNames {
+		if n == name {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// setConversionData records data on an object, removing a stale record
+// when data is empty
+func setConversionData(meta *metav1.ObjectMeta, data conversionData) error {
+	if data.Resources == nil && data.Placement == nil && len(data.Strings) == 0 {
+		delete(meta.Annotations, ConversionDataAnnotation)
+		if len(meta.Annotations) == 0 {
+			meta.Annotations = nil
+		}
+		return nil
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[ConversionDataAnnotation] = string(encoded)
+	return nil
+}
+
+// takeConversionData reads and removes the data recorded on an object
+func takeConversionData(meta *metav1.ObjectMeta) (conversionData, error) {
+	var data conversionData
+	encoded, ok := meta.Annotations[ConversionDataAnnotation]
+	if !ok {
+		return data, nil
+	}
+	delete(meta.Annotations, ConversionDataAnnotation)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+	if err := json.Unmarshal([]byte(encoded), &data); err != nil {
+		return data, fmt.Errorf("invalid %s annotation: %w", ConversionDataAnnotation, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,307 @@
+package v2
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+)
+
+func meta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"team": "support"}}
+}
+
+func raw(v string) runtime.RawExtension {
+	return runtime.RawExtension{Raw: []byte(v)}
+}
+
+func minutes(n int) *metav1.Duration {
+	return &metav1.Duration{Duration: time.Duration(n) * time.Minute}
+}
+
+func quantity(v string) *resource.Quantity {
+	q := resource.MustParse(v)
+	return &q
+}
+
+func TestRoundTripFromV1(t *testing.T) {
+	tests := []struct {
+		name     string
+		hub      conversion.Hub
+		newSpoke func() conversion.Convertible
+		newHub   func() conversion.Hub
+	}{
+		{
+			name: "agent",
+			hub: &v1.Agent{
+				ObjectMeta: meta("summarizer"),
+				Spec: v1.AgentSpec{
+					Runtime: v1.AgentRuntime{
+						Image:    "summarizer:1",
+						Language: "python",
+						// 0.5 encodes as 500m, lots does not parse and gpu
+						// is not a v1 resource
+						Resources: map[string]string{"cpu": "0.5", "memory": "1Gi", "storage": "lots", "gpu": "1"},
+					},
+					Capabilities:   []string{"summarize"},
+					Schema:         v1.AgentSchema{Input: raw(`{"type":"object"}`), Output: raw(`{"type":"object"}`)},
+					DeletionPolicy: "Cascade",
+				},
+			},
+			newSpoke: func() conversion.Convertible { return &Agent{} },
+			newHub:   func() conversion.Hub { return &v1.Agent{} },
+		},
+		{
+			name: "agent instance",
+			hub: &v1.AgentInstance{
+				ObjectMeta: meta("summarizer-eu"),
+				Spec: v1.AgentInstanceSpec{
+					Agent:     "summarizer",
+					Realm:     "eu",
+					Replicas:  2,
+					Resources: map[string]string{"cpu": "500m", "memory": "a lot"},
+					Placement: v1.AgentInstancePlacement{
+						NodeSelector: map[string]string{"zone": "a"},
+						Tolerations:  []runtime.RawExtension{raw(`{"key":"gpu","operator":"Exists","effect":"NoSchedule"}`)},
+						Affinity:     raw(`{"nodeAffinity":{"requiredDuringSchedulingIgnoredDuringExecution":{"nodeSelectorTerms":[{"matchExpressions":[{"key":"pool","operator":"In","values":["agents"]}]}]}}}`),
+					},
+					Rollout: v1.AgentInstanceRollout{
+						Strategy: "Canary",
+						Canary:   v1.AgentInstanceCanary{Duration: "1d", MaxLatency: "soon"},
+					},
+				},
+			},
+			newSpoke: func() conversion.Convertible { return &AgentInstance{} },
+			newHub:   func() conversion.Hub { return &v1.AgentInstance{} },
+		},
+		{
+			name: "realm",
+			hub: &v1.Realm{
+				ObjectMeta: meta("eu"),
+				Spec: v1.RealmSpec{
+					Description: "EU agents",
+					Resources:   v1.RealmResources{RedisConfig: v1.RedisConfig{Memory: "1Gi"}},
+					Governance: v1.RealmGovernance{RetentionPolicy: v1.RealmRetentionPolicy{
+						LoopHistory: "30d",
+						AgentLogs:   "2w",
+					}},
+				},
+			},
+			newSpoke: func() conversion.Convertible { return &Realm{} },
+			newHub:   func() conversion.Hub { return &v1.Realm{} },
+		},
+		{
+			name: "realm with invalid quantity",
+			hub: &v1.Realm{
+				ObjectMeta: meta("us"),
+				Spec: v1.RealmSpec{
+					Resources: v1.RealmResources{RedisConfig: v1.RedisConfig{Memory: "plenty"}},
+				},
+			},
+			newSpoke: func() conversion.Convertible { return &Realm{} },
+			newHub:   func() conversion.Hub { return &v1.Realm{} },
+		},
+		{
+			name: "loopstack",
+			hub: &v1.LoopStack{
+				ObjectMeta: meta("triage"),
+				Spec: v1.LoopStackSpec{
+					Description:  "Triage",
+					Capabilities: []string{"summarize"},
+					Phases: v1.LoopStackPhases{
+						Intake:  v1.LoopStackIntakePhase{Timeout: "whenever"},
+						Bidding: v1.LoopStackBiddingPhase{Timeout: "30s", MinBids: 1},
+					},
+					Steps: []v1.LoopStackStep{
+						{Name: "draft", Type: "agent"},
+						{Name: "signoff", Type: "humanApproval", HumanApproval: &v1.LoopStackHumanApproval{
+							Approvers: []string{"alice"},
+							Timeout:   "1d",
+						}},
+					},
+				},
+				Status: v1.LoopStackStatus{Executions: v1.LoopStackExecutionStats{Total: 3, AverageDuration: "1.5s"}},
+			},
+			newSpoke: func() conversion.Convertible { return &LoopStack{} },
+			newHub:   func() conversion.Hub { return &v1.LoopStack{} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spoke := tt.newSpoke()
+			if err := spoke.ConvertFrom(tt.hub.DeepCopyObject().(conversion.Hub)); err != nil {
+				t.Fatalf("ConvertFrom() error = %v", err)
+			}
+			back := tt.newHub()
+			if err := spoke.ConvertTo(back); err != nil {
+				t.Fatalf("ConvertTo() error = %v", err)
+			}
+			if !equality.Semantic.DeepEqual(tt.hub, back) {
+				t.Errorf("v1 -> v2 -> v1 changed the object\nwant %s\ngot  %s", dump(t, tt.hub), dump(t, back))
+			}
+		})
+	}
+}
+
+func TestRoundTripFromV2(t *testing.T) {
+	tests := []struct {
+		name     string
+		spoke    conversion.Convertible
+		newSpoke func() conversion.Convertible
+		newHub   func() conversion.Hub
+	}{
+		{
+			name: "agent",
+			spoke: &Agent{
+				ObjectMeta: meta("summarizer"),
+				Spec: AgentSpec{
+					Runtime: AgentRuntime{
+						Image:    "summarizer:1",
+						Language: "python",
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("500m"),
+								corev1.ResourceMemory: resource.MustParse("1Gi"),
+								"nvidia.com/gpu":      resource.MustParse("1"),
+							},
+							Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+						},
+					},
+					Capabilities:   []string{"summarize"},
+					Schema:         AgentSchema{Input: raw(`{"type":"object"}`), Output: raw(`{"type":"object"}`)},
+					DeletionPolicy: AgentDeletionOrphan,
+				},
+			},
+			newSpoke: func() conversion.Convertible { return &Agent{} },
+			newHub:   func() conversion.Hub { return &v1.Agent{} },
+		},
+		{
+			name: "agent instance",
+			spoke: &AgentInstance{
+				ObjectMeta: meta("summarizer-eu"),
+				Spec: AgentInstanceSpec{
+					Agent:    "summarizer",
+					Realm:    "eu",
+					Replicas: 2,
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("250m")},
+					},
+					Placement: AgentInstancePlacement{
+						Tolerations: []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists}},
+						TopologySpreadConstraints: []corev1.TopologySpreadConstraint{{
+							MaxSkew:           1,
+							TopologyKey:       "topology.kubernetes.io/zone",
+							WhenUnsatisfiable: corev1.ScheduleAnyway,
+						}},
+						PriorityClassName: "agents",
+					},
+					Rollout: AgentInstanceRollout{
+						Strategy: "Canary",
+						Canary:   AgentInstanceCanary{Duration: minutes(10), MaxLatency: &metav1.Duration{Duration: 2 * time.Second}},
+					},
+				},
+			},
+			newSpoke: func() conversion.Convertible { return &AgentInstance{} },
+			newHub:   func() conversion.Hub { return &v1.AgentInstance{} },
+		},
+		{
+			name: "realm",
+			spoke: &Realm{
+				ObjectMeta: meta("eu"),
+				Spec: RealmSpec{
+					Description: "EU agents",
+					Resources:   RealmResources{RedisConfig: RedisConfig{Memory: quantity("512Mi")}},
+					Governance: RealmGovernance{RetentionPolicy: RealmRetentionPolicy{
+						LoopHistory: minutes(30 * 24 * 60),
+					}},
+				},
+			},
+			newSpoke: func() conversion.Convertible { return &Realm{} },
+			newHub:   func() conversion.Hub { return &v1.Realm{} },
+		},
+		{
+			name: "loopstack",
+			spoke: &LoopStack{
+				ObjectMeta: meta("triage"),
+				Spec: LoopStackSpec{
+					Description:  "Triage",
+					Capabilities: []string{"summarize"},
+					Phases:       LoopStackPhases{Bidding: LoopStackBiddingPhase{Timeout: &metav1.Duration{Duration: 30 * time.Second}}},
+					Steps: []LoopStackStep{
+						{Name: "draft"},
+						{Name: "signoff", Type: "humanApproval", HumanApproval: &LoopStackHumanApproval{Timeout: minutes(60)}},
+					},
+				},
+			},
+			newSpoke: func() conversion.Convertible { return &LoopStack{} },
+			newHub:   func() conversion.Hub { return &v1.LoopStack{} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := tt.newHub()
+			if err := tt.spoke.DeepCopyObject().(conversion.Convertible).ConvertTo(hub); err != nil {
+				t.Fatalf("ConvertTo() error = %v", err)
+			}
+			back := tt.newSpoke()
+			if err := back.ConvertFrom(hub); err != nil {
+				t.Fatalf("ConvertFrom() error = %v", err)
+			}
+			if !equality.Semantic.DeepEqual(tt.spoke, back) {
+				t.Errorf("v2 -> v1 -> v2 changed the object\nwant %s\ngot  %s", dump(t, tt.spoke), dump(t, back))
+			}
+		})
+	}
+}
+
+// TestConvertFromInvalidQuantity checks that v1 resources v2 cannot
+// represent do not fail reads, and are kept for the way back
+func TestConvertFromInvalidQuantity(t *testing.T) {
+	hub := &v1.Agent{
+		ObjectMeta: meta("summarizer"),
+		Spec: v1.AgentSpec{Runtime: v1.AgentRuntime{
+			Resources: map[string]string{"cpu": "fast", "memory": "1Gi"},
+		}},
+	}
+	agent := &Agent{}
+	if err := agent.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom() error = %v", err)
+	}
+	requests := agent.Spec.Runtime.Resources.Requests
+	if _, ok := requests[corev1.ResourceCPU]; ok {
+		t.Errorf("invalid cpu quantity was converted: %v", requests)
+	}
+	if memory := requests[corev1.ResourceMemory]; memory.String() != "1Gi" {
+		t.Errorf("memory = %s, want 1Gi", memory.String())
+	}
+	if _, ok := agent.Annotations[ConversionDataAnnotation]; !ok {
+		t.Errorf("invalid quantity not kept in the %s annotation", ConversionDataAnnotation)
+	}
+
+	// Setting the resource in v2 replaces the kept value
+	agent.Spec.Runtime.Resources.Requests[corev1.ResourceCPU] = resource.MustParse("1")
+	back := &v1.Agent{}
+	if err := agent.ConvertTo(back); err != nil {
+		t.Fatalf("ConvertTo() error = %v", err)
+	}
+	if cpu := back.Spec.Runtime.Resources["cpu"]; cpu != "1" {
+		t.Errorf("cpu = %q, want 1", cpu)
+	}
+}
+
+func dump(t *testing.T, obj interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
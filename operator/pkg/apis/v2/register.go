@@ -0,0 +1,30 @@
+// Package v2 contains API Schema definitions for the loopstacks.io v2 API
+// group. v2 replaces the loosely typed fields of v1: resource requirements,
+// placement, durations and strategies. v1 remains the hub and storage
+// version every version converts through, see conversion.go.
+// +kubebuilder:object:generate=true
+// +groupName=loopstacks.io
+package v2
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+const (
+	// GroupName is the group name used in this package
+	GroupName = "loopstacks.io"
+	// GroupVersion is the version used in this package
+	GroupVersion = "v2"
+)
+
+var (
+	// GroupVersionKind is the GroupVersionKind for this package
+	GroupVersionKind = schema.GroupVersion{Group: GroupName, Version: GroupVersion}
+
+	// SchemeBuilder is used to add go types to the GroupVersionKind scheme
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersionKind}
+
+	// AddToScheme adds the types in this group-version to the given scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
@@ -0,0 +1,662 @@
+package v2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Agent defines the specification for an AI agent
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced,shortName=ag
+// +kubebuilder:printcolumn:name="Language",type="string",JSONPath=".spec.runtime.language"
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type Agent struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AgentSpec   `json:"spec,omitempty"`
+	Status AgentStatus `json:"status,omitempty"`
+}
+
+// AgentSpec defines the desired state of Agent
+type AgentSpec struct {
+	Runtime      AgentRuntime  `json:"runtime"`
+	Capabilities []string      `json:"capabilities"`
+	Schema       AgentSchema   `json:"schema"`
+	Metadata     AgentMetadata `json:"metadata,omitempty"`
+	// DeletionPolicy is what deleting the Agent does to its AgentInstances
+	DeletionPolicy AgentDeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// AgentDeletionPolicy is what deleting an Agent does to its AgentInstances
+type AgentDeletionPolicy string
+
+// Policies of AgentSpec.DeletionPolicy
+const (
+	// AgentDeletionBlock keeps the Agent until its AgentInstances are deleted
+	AgentDeletionBlock AgentDeletionPolicy = "Block"
+	// AgentDeletionCascade deletes the AgentInstances, waiting for their
+	// pods to finish the loops they are executing
+	AgentDeletionCascade AgentDeletionPolicy = "Cascade"
+	// AgentDeletionOrphan deletes the Agent at once and leaves its
+	// AgentInstances running, reporting the Agent missing
+	AgentDeletionOrphan AgentDeletionPolicy = "Orphan"
+)
+
+// AgentRuntime defines the runtime configuration for an agent
+type AgentRuntime struct {
+	Image    string `json:"image"`
+	Language string `json:"language"`
+	// Resources are the defaults of the Agent's AgentInstances
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// SecretRefs expose Secret keys, such as model provider API keys, to
+	// the pods of every AgentInstance of the Agent
+	SecretRefs []SecretRef `json:"secretRefs,omitempty"`
+	// EnvFrom exposes every key of Secrets or ConfigMaps to the pods of
+	// every AgentInstance of the Agent
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+}
+
+// SecretRef exposes a Secret key to agent pods as an environment variable
+type SecretRef struct {
+	// Env names the environment variable
+	Env          string                   `json:"env"`
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
+}
+
+// AgentSchema defines the input/output schema for an agent
+type AgentSchema struct {
+	Input  runtime.RawExtension `json:"input"`
+	Output runtime.RawExtension `json:"output"`
+	// Config, when set, validates the Config of the Agent's AgentInstances
+	Config runtime.RawExtension `json:"config,omitempty"`
+}
+
+// AgentMetadata contains additional metadata about the agent
+type AgentMetadata struct {
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Author      string   `json:"author,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// AgentStatus defines the observed state of Agent
+type AgentStatus struct {
+	Phase       string      `json:"phase,omitempty"`
+	Message     string      `json:"message,omitempty"`
+	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
+	Instances   int32       `json:"instances,omitempty"`
+	// ObservedGeneration is the generation the status was last computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions include Ready, see package conditions
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// AgentList contains a list of Agent
+// +kubebuilder:object:root=true
+type AgentList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Agent `json:"items"`
+}
+
+// Realm defines an isolated environment for agent execution
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced,shortName=rlm
+type Realm struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RealmSpec   `json:"spec,omitempty"`
+	Status RealmStatus `json:"status,omitempty"`
+}
+
+// RealmSpec defines the desired state of Realm
+type RealmSpec struct {
+	Description string          `json:"description"`
+	Isolation   Isolation       `json:"isolation,omitempty"`
+	Resources   RealmResources  `json:"resources,omitempty"`
+	Networking  RealmNetworking `json:"networking,omitempty"`
+	Governance  RealmGovernance `json:"governance,omitempty"`
+}
+
+// Isolation is the level of isolation of a realm
+type Isolation string
+
+// Levels of RealmSpec.Isolation
+const (
+	IsolationNamespace Isolation = "namespace"
+	IsolationCluster   Isolation = "cluster"
+	IsolationFederated Isolation = "federated"
+)
+
+// RealmResources defines resource limits for a realm
+type RealmResources struct {
+	MaxAgentInstances  int32       `json:"maxAgentInstances,omitempty"`
+	MaxConcurrentLoops int32       `json:"maxConcurrentLoops,omitempty"`
+	StorageClass       string      `json:"storageClass,omitempty"`
+	RedisConfig        RedisConfig `json:"redisConfig,omitempty"`
+	// CoordinationBackend selects the transport of the bidding protocol,
+	// redis (default) or nats
+	CoordinationBackend CoordinationBackend `json:"coordinationBackend,omitempty"`
+	NATSConfig          NATSConfig          `json:"natsConfig,omitempty"`
+}
+
+// CoordinationBackend is a transport of the bidding protocol
+type CoordinationBackend string
+
+// Backends of RealmResources.CoordinationBackend
+const (
+	CoordinationRedis CoordinationBackend = "redis"
+	CoordinationNATS  CoordinationBackend = "nats"
+)
+
+// RedisConfig defines Redis configuration for a realm
+type RedisConfig struct {
+	Replicas int32              `json:"replicas,omitempty"`
+	Memory   *resource.Quantity `json:"memory,omitempty"`
+	URL      string             `json:"url,omitempty"`
+}
+
+// NATSConfig defines NATS JetStream configuration for a realm
+type NATSConfig struct {
+	URL      string `json:"url,omitempty"`
+	Stream   string `json:"stream,omitempty"`
+	Replicas int32  `json:"replicas,omitempty"`
+}
+
+// RealmNetworking defines networking configuration for a realm
+type RealmNetworking struct {
+	AllowCrossRealmCommunication bool `json:"allowCrossRealmCommunication,omitempty"`
+	// FederationEndpoints are the federation API URLs of peer realms,
+	// https://<host>:<port>/realms/<namespace>/<realm>. Federated realms
+	// forward loops to them when fewer local agents than MinBids bid.
+	FederationEndpoints []string `json:"federationEndpoints,omitempty"`
+	// FederationPeers names the certificates of peers, besides those of the
+	// FederationEndpoints hosts, allowed to forward loops to this realm
+	FederationPeers []string `json:"federationPeers,omitempty"`
+	// Exports offers capabilities of this realm's agents to other realms.
+	// Sharing requires AllowCrossRealmCommunication on both realms.
+	Exports []CapabilityExport `json:"exports,omitempty"`
+	// Imports bids this realm's loops out to agents of other realms
+	Imports []CapabilityImport `json:"imports,omitempty"`
+}
+
+// CapabilityExport offers capabilities to other realms
+type CapabilityExport struct {
+	Capabilities []string `json:"capabilities"`
+	// Realms restricts the export to these realms, given as name in this
+	// realm's namespace or as namespace/name. Empty exports to every realm.
+	Realms []string `json:"realms,omitempty"`
+}
+
+// CapabilityImport uses capabilities exported by another realm
+type CapabilityImport struct {
+	// Realm is the exporting realm, as name in this realm's namespace or as
+	// namespace/name
+	Realm        string   `json:"realm"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// RealmGovernance defines governance policies for a realm
+type RealmGovernance struct {
+	AgentApprovalRequired bool                 `json:"agentApprovalRequired,omitempty"`
+	LoopAuditingEnabled   bool                 `json:"loopAuditingEnabled,omitempty"`
+	RetentionPolicy       RealmRetentionPolicy `json:"retentionPolicy,omitempty"`
+}
+
+// RealmRetentionPolicy defines data retention policies
+type RealmRetentionPolicy struct {
+	LoopHistory *metav1.Duration `json:"loopHistory,omitempty"`
+	AgentLogs   *metav1.Duration `json:"agentLogs,omitempty"`
+}
+
+// RealmStatus defines the observed state of Realm
+type RealmStatus struct {
+	Phase          string      `json:"phase,omitempty"`
+	Message        string      `json:"message,omitempty"`
+	LastUpdated    metav1.Time `json:"lastUpdated,omitempty"`
+	AgentInstances int32       `json:"agentInstances,omitempty"`
+	ActiveLoops    int32       `json:"activeLoops,omitempty"`
+	RedisStatus    string      `json:"redisStatus,omitempty"`
+	// Federation reports the health of each federation endpoint
+	Federation []FederationPeerStatus `json:"federation,omitempty"`
+	// Imports reports which imported capabilities are in effect
+	Imports            []EffectiveImport  `json:"imports,omitempty"`
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// EffectiveImport is the outcome of a CapabilityImport
+type EffectiveImport struct {
+	// Realm is the exporting realm as namespace/name
+	Realm string `json:"realm"`
+	// Capabilities are the imported capabilities the realm exports to this one
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Denied are the imported capabilities the realm does not export to
+	// this one
+	Denied  []string `json:"denied,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+// FederationPeerStatus is the last observed health of a federation endpoint
+type FederationPeerStatus struct {
+	Endpoint string `json:"endpoint"`
+	Healthy  bool   `json:"healthy"`
+	// Agents is the number of agents registered in the peer realm
+	Agents          int32        `json:"agents,omitempty"`
+	Message         string       `json:"message,omitempty"`
+	LastProbeTime   metav1.Time  `json:"lastProbeTime,omitempty"`
+	LastHealthyTime *metav1.Time `json:"lastHealthyTime,omitempty"`
+}
+
+// RealmList contains a list of Realm
+// +kubebuilder:object:root=true
+type RealmList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Realm `json:"items"`
+}
+
+// AgentInstance is a deployment of an Agent in a Realm
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced,shortName=ai
+type AgentInstance struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AgentInstanceSpec   `json:"spec,omitempty"`
+	Status AgentInstanceStatus `json:"status,omitempty"`
+}
+
+// AgentInstanceSpec defines the desired state of AgentInstance
+type AgentInstanceSpec struct {
+	Agent    string `json:"agent"`
+	Realm    string `json:"realm"`
+	Replicas int32  `json:"replicas,omitempty"`
+	// Resources override the Agent's per resource, for requests and limits
+	// separately
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Config is mounted into agent pods as JSON, see ConfigUpdate
+	Config runtime.RawExtension `json:"config,omitempty"`
+	// ConfigSecrets are mounted next to Config, so that API keys are not
+	// inlined in it
+	ConfigSecrets []AgentInstanceConfigSecret `json:"configSecrets,omitempty"`
+	// ConfigUpdate is Restart to roll out a new revision when Config or
+	// ConfigSecrets change, or HotReload to update the mounted files in
+	// place and let agents reload them
+	ConfigUpdate ConfigUpdateStrategy `json:"configUpdate,omitempty"`
+	// SecretRefs add to the Agent's, replacing those of the same Env
+	SecretRefs []SecretRef `json:"secretRefs,omitempty"`
+	// EnvFrom adds to the Agent's
+	EnvFrom     []corev1.EnvFromSource   `json:"envFrom,omitempty"`
+	Autoscaling AgentInstanceAutoscaling `json:"autoscaling,omitempty"`
+	Placement   AgentInstancePlacement   `json:"placement,omitempty"`
+	// Rollout controls how pods of a new revision replace the running ones
+	Rollout AgentInstanceRollout `json:"rollout,omitempty"`
+	// Shadow agents run every loop they bid on next to the selected agents.
+	// Their results are compared with the step's output and recorded, but
+	// never aggregated.
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+// ConfigUpdateStrategy is how agent pods pick up config changes
+type ConfigUpdateStrategy string
+
+// Strategies of AgentInstanceSpec.ConfigUpdate
+const (
+	ConfigUpdateRestart   ConfigUpdateStrategy = "Restart"
+	ConfigUpdateHotReload ConfigUpdateStrategy = "HotReload"
+)
+
+// AgentInstanceConfigSecret mounts a Secret key into agent pods
+type AgentInstanceConfigSecret struct {
+	// Name of the file the key is mounted as in the secrets directory
+	Name         string                   `json:"name"`
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
+}
+
+// AgentInstanceAutoscaling defines autoscaling configuration
+type AgentInstanceAutoscaling struct {
+	Enabled                 bool  `json:"enabled,omitempty"`
+	MinReplicas             int32 `json:"minReplicas,omitempty"`
+	MaxReplicas             int32 `json:"maxReplicas,omitempty"`
+	TargetCPUUtilization    int32 `json:"targetCPUUtilization,omitempty"`
+	TargetMemoryUtilization int32 `json:"targetMemoryUtilization,omitempty"`
+}
+
+// AgentInstancePlacement defines placement constraints
+type AgentInstancePlacement struct {
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	Affinity     *corev1.Affinity    `json:"affinity,omitempty"`
+	// TopologySpreadConstraints spread agent pods across zones or nodes.
+	// Constraints without a label selector select the AgentInstance's pods.
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	PriorityClassName         string                            `json:"priorityClassName,omitempty"`
+}
+
+// AgentInstanceRollout defines the rollout strategy of an AgentInstance.
+// A revision is rolled out whenever the pods it renders change, such as
+// when the Agent's runtime image changes.
+type AgentInstanceRollout struct {
+	// Strategy is RollingUpdate (default), BlueGreen or Canary
+	Strategy      RolloutStrategy            `json:"strategy,omitempty"`
+	RollingUpdate AgentInstanceRollingUpdate `json:"rollingUpdate,omitempty"`
+	BlueGreen     AgentInstanceBlueGreen     `json:"blueGreen,omitempty"`
+	Canary        AgentInstanceCanary        `json:"canary,omitempty"`
+}
+
+// RolloutStrategy is how pods of a new revision replace the running ones
+type RolloutStrategy string
+
+// Strategies of AgentInstanceRollout.Strategy
+const (
+	RolloutRollingUpdate RolloutStrategy = "RollingUpdate"
+	RolloutBlueGreen     RolloutStrategy = "BlueGreen"
+	RolloutCanary        RolloutStrategy = "Canary"
+)
+
+// AgentInstanceRollingUpdate replaces pods in place, both revisions
+// bidding while the update progresses
+type AgentInstanceRollingUpdate struct {
+	MaxSurge       *intstr.IntOrString `json:"maxSurge,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// AgentInstanceBlueGreen starts a full set of pods of the new revision
+// that receives no loops until it is promoted, then switches all loops to
+// it at once
+type AgentInstanceBlueGreen struct {
+	// AutoPromote switches as soon as the new pods are available instead of
+	// waiting for the loopstacks.io/promote annotation
+	AutoPromote bool `json:"autoPromote,omitempty"`
+}
+
+// AgentInstanceCanary routes a share of the loops to a few pods of the new
+// revision and promotes it once its executions stayed within thresholds
+// for Duration, or rolls it back as soon as they do not
+type AgentInstanceCanary struct {
+	// Replicas is the number of canary pods, 1 by default
+	Replicas int32 `json:"replicas,omitempty"`
+	// Weight is the percentage of loops routed to the canary, 10 by default
+	Weight int32 `json:"weight,omitempty"`
+	// Duration is how long the canary is analyzed, 10m by default
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// MinExecutions is the number of canary executions required before
+	// thresholds apply and before promotion, 10 by default
+	MinExecutions int32 `json:"minExecutions,omitempty"`
+	// MaxFailureRate is the percentage of failed canary executions that
+	// triggers a rollback, 5 by default
+	MaxFailureRate int32 `json:"maxFailureRate,omitempty"`
+	// MaxLatency is the 95th percentile canary execution latency that
+	// triggers a rollback. Latency is not checked when unset.
+	MaxLatency *metav1.Duration `json:"maxLatency,omitempty"`
+}
+
+// AgentInstanceStatus defines the observed state of AgentInstance
+type AgentInstanceStatus struct {
+	Phase              string                     `json:"phase,omitempty"`
+	Message            string                     `json:"message,omitempty"`
+	LastUpdated        metav1.Time                `json:"lastUpdated,omitempty"`
+	ReadyReplicas      int32                      `json:"readyReplicas,omitempty"`
+	CurrentReplicas    int32                      `json:"currentReplicas,omitempty"`
+	ActiveLoops        int32                      `json:"activeLoops,omitempty"`
+	ObservedGeneration int64                      `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition         `json:"conditions,omitempty"`
+	Rollout            AgentInstanceRolloutStatus `json:"rollout,omitempty"`
+	Shadow             *AgentInstanceShadowStatus `json:"shadow,omitempty"`
+}
+
+// AgentInstanceShadowStatus compares the results of a shadow AgentInstance
+// with the outputs of the steps it ran on since StartTime
+type AgentInstanceShadowStatus struct {
+	StartTime  *metav1.Time `json:"startTime,omitempty"`
+	Executions int32        `json:"executions,omitempty"`
+	// Failures counts executions without a result
+	Failures int32 `json:"failures,omitempty"`
+	// SchemaValidRate is the percentage of results valid against the
+	// Agent's output schema
+	SchemaValidRate int32 `json:"schemaValidRate,omitempty"`
+	// AgreementRate is the percentage of results equal to the step's
+	// output or to the result of one of its selected agents
+	AgreementRate int32 `json:"agreementRate,omitempty"`
+	// Latency is the 95th percentile execution latency
+	Latency *metav1.Duration `json:"latency,omitempty"`
+}
+
+// AgentInstanceRolloutStatus reports the progress of a rollout. While
+// StableRevision and UpdateRevision differ under the BlueGreen or Canary
+// strategy, Weight percent of the loops are routed to UpdateRevision and
+// the rest to StableRevision.
+type AgentInstanceRolloutStatus struct {
+	StableRevision string `json:"stableRevision,omitempty"`
+	UpdateRevision string `json:"updateRevision,omitempty"`
+	// Phase is Progressing, Paused, Analyzing, Promoting, Completed or
+	// RolledBack
+	Phase     string       `json:"phase,omitempty"`
+	Weight    int32        `json:"weight,omitempty"`
+	Message   string       `json:"message,omitempty"`
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// Analysis holds the canary's execution stats
+	Analysis AgentInstanceRolloutAnalysis `json:"analysis,omitempty"`
+}
+
+// AgentInstanceRolloutAnalysis summarizes the executions of a canary since
+// it started receiving loops
+type AgentInstanceRolloutAnalysis struct {
+	StartTime  *metav1.Time `json:"startTime,omitempty"`
+	Executions int32        `json:"executions,omitempty"`
+	Failures   int32        `json:"failures,omitempty"`
+	// Latency is the 95th percentile execution latency
+	Latency *metav1.Duration `json:"latency,omitempty"`
+}
+
+// AgentInstanceList contains a list of AgentInstance
+// +kubebuilder:object:root=true
+type AgentInstanceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AgentInstance `json:"items"`
+}
+
+// LoopStack defines a workflow definition with phases
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced,shortName=ls
+type LoopStack struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LoopStackSpec   `json:"spec,omitempty"`
+	Status LoopStackStatus `json:"status,omitempty"`
+}
+
+// LoopStackSpec defines the desired state of LoopStack
+type LoopStackSpec struct {
+	Description  string            `json:"description"`
+	Schema       LoopStackSchema   `json:"schema"`
+	Phases       LoopStackPhases   `json:"phases,omitempty"`
+	Steps        []LoopStackStep   `json:"steps,omitempty"`
+	Capabilities []string          `json:"capabilities"`
+	Metadata     LoopStackMetadata `json:"metadata,omitempty"`
+}
+
+// LoopStackSchema defines input/output schema for the workflow
+type LoopStackSchema struct {
+	Input  runtime.RawExtension `json:"input"`
+	Output runtime.RawExtension `json:"output"`
+}
+
+// LoopStackPhases defines the workflow phases
+type LoopStackPhases struct {
+	Intake    LoopStackIntakePhase    `json:"intake,omitempty"`
+	Bidding   LoopStackBiddingPhase   `json:"bidding,omitempty"`
+	Execution LoopStackExecutionPhase `json:"execution,omitempty"`
+	Output    LoopStackOutputPhase    `json:"output,omitempty"`
+}
+
+// LoopStackIntakePhase defines the intake phase configuration
+type LoopStackIntakePhase struct {
+	Timeout    *metav1.Duration          `json:"timeout,omitempty"`
+	Validation LoopStackIntakeValidation `json:"validation,omitempty"`
+}
+
+// LoopStackIntakeValidation defines input validation rules
+type LoopStackIntakeValidation struct {
+	Required bool                 `json:"required,omitempty"`
+	Schema   runtime.RawExtension `json:"schema,omitempty"`
+}
+
+// LoopStackBiddingPhase defines the bidding phase configuration
+type LoopStackBiddingPhase struct {
+	Timeout           *metav1.Duration  `json:"timeout,omitempty"`
+	MinBids           int32             `json:"minBids,omitempty"`
+	MaxBids           int32             `json:"maxBids,omitempty"`
+	SelectionStrategy SelectionStrategy `json:"selectionStrategy,omitempty"`
+}
+
+// SelectionStrategy is how bids are ranked and selected
+type SelectionStrategy string
+
+// Strategies of LoopStackBiddingPhase.SelectionStrategy
+const (
+	SelectFirst  SelectionStrategy = "first"
+	SelectRandom SelectionStrategy = "random"
+	SelectBest   SelectionStrategy = "best"
+	SelectAll    SelectionStrategy = "all"
+)
+
+// LoopStackExecutionPhase defines the execution phase configuration
+type LoopStackExecutionPhase struct {
+	Timeout     *metav1.Duration              `json:"timeout,omitempty"`
+	Parallelism Parallelism                   `json:"parallelism,omitempty"`
+	RetryPolicy LoopStackExecutionRetryPolicy `json:"retryPolicy,omitempty"`
+}
+
+// Parallelism is how the selected agents of a step run
+type Parallelism string
+
+// Values of LoopStackExecutionPhase.Parallelism
+const (
+	ParallelismSequential Parallelism = "sequential"
+	ParallelismParallel   Parallelism = "parallel"
+	ParallelismAdaptive   Parallelism = "adaptive"
+)
+
+// LoopStackExecutionRetryPolicy defines retry behavior
+type LoopStackExecutionRetryPolicy struct {
+	MaxRetries      int32           `json:"maxRetries,omitempty"`
+	BackoffStrategy BackoffStrategy `json:"backoffStrategy,omitempty"`
+}
+
+// BackoffStrategy is how the delay between retries grows
+type BackoffStrategy string
+
+// Strategies of LoopStackExecutionRetryPolicy.BackoffStrategy
+const (
+	BackoffLinear      BackoffStrategy = "linear"
+	BackoffExponential BackoffStrategy = "exponential"
+)
+
+// LoopStackOutputPhase defines the output phase configuration
+type LoopStackOutputPhase struct {
+	Timeout             *metav1.Duration    `json:"timeout,omitempty"`
+	AggregationStrategy AggregationStrategy `json:"aggregationStrategy,omitempty"`
+}
+
+// AggregationStrategy is how the results of a step are combined
+type AggregationStrategy string
+
+// Strategies of LoopStackOutputPhase.AggregationStrategy
+const (
+	AggregateMerge     AggregationStrategy = "merge"
+	AggregateSelect    AggregationStrategy = "select"
+	AggregateConsensus AggregationStrategy = "consensus"
+)
+
+// LoopStackStep defines a single step of the workflow. Steps run in order;
+// a step whose condition evaluates to false is skipped.
+type LoopStackStep struct {
+	Name          string                  `json:"name"`
+	Type          StepType                `json:"type,omitempty"`
+	Capabilities  []string                `json:"capabilities,omitempty"`
+	Condition     string                  `json:"condition,omitempty"`
+	HumanApproval *LoopStackHumanApproval `json:"humanApproval,omitempty"`
+}
+
+// StepType is the kind of work a step does
+type StepType string
+
+// Types of LoopStackStep.Type
+const (
+	StepTypeAgent         StepType = "agent"
+	StepTypeHumanApproval StepType = "humanApproval"
+)
+
+// LoopStackHumanApproval defines a step that pauses the execution until a
+// person approves or rejects it
+type LoopStackHumanApproval struct {
+	Message        string           `json:"message,omitempty"`
+	Approvers      []string         `json:"approvers,omitempty"`
+	Timeout        *metav1.Duration `json:"timeout,omitempty"`
+	DefaultOutcome ApprovalOutcome  `json:"defaultOutcome,omitempty"`
+}
+
+// ApprovalOutcome is the decision on a human approval step
+type ApprovalOutcome string
+
+// Outcomes of LoopStackHumanApproval.DefaultOutcome
+const (
+	ApprovalApproved ApprovalOutcome = "approved"
+	ApprovalRejected ApprovalOutcome = "rejected"
+)
+
+// LoopStackMetadata contains additional metadata about the workflow
+type LoopStackMetadata struct {
+	Version  string   `json:"version,omitempty"`
+	Author   string   `json:"author,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Category string   `json:"category,omitempty"`
+}
+
+// LoopStackStatus defines the observed state of LoopStack
+type LoopStackStatus struct {
+	Phase              string                  `json:"phase,omitempty"`
+	Message            string                  `json:"message,omitempty"`
+	LastUpdated        metav1.Time             `json:"lastUpdated,omitempty"`
+	Executions         LoopStackExecutionStats `json:"executions,omitempty"`
+	ObservedGeneration int64                   `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition      `json:"conditions,omitempty"`
+}
+
+// LoopStackExecutionStats tracks execution statistics
+type LoopStackExecutionStats struct {
+	Total           int32            `json:"total,omitempty"`
+	Successful      int32            `json:"successful,omitempty"`
+	Failed          int32            `json:"failed,omitempty"`
+	AverageDuration *metav1.Duration `json:"averageDuration,omitempty"`
+}
+
+// LoopStackList contains a list of LoopStack
+// +kubebuilder:object:root=true
+type LoopStackList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LoopStack `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Agent{}, &AgentList{})
+	SchemeBuilder.Register(&Realm{}, &RealmList{})
+	SchemeBuilder.Register(&AgentInstance{}, &AgentInstanceList{})
+	SchemeBuilder.Register(&LoopStack{}, &LoopStackList{})
+}
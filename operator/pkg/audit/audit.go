@@ -0,0 +1,195 @@
+// Package audit keeps an append-only, hash-chained trail of the decisions
+// taken during a loop execution for realms with LoopAuditingEnabled: the
+// digest of the received input, every bid and the realms or federation
+// peers remote bids came from, the agent revisions loops were routed to
+// during rollouts, the selection and its strategy, each agent's raw output
+// and the aggregated result.
+//
+// Each event carries the SHA-256 hash of its own content and the hash of
+// the previous event of the same execution, so removing, reordering or
+// altering an exported event breaks the chain and is detected by Verify.
+// A trail ends with its completed event, so a trail cut short is detected
+// too, and the ledger of a store records every completed trail, so a trail
+// removed from the store is detected by VerifyDir.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Event types
+const (
+	EventInput       = "input"
+	EventAnnounced   = "announced"
+	EventImported    = "imported"
+	EventFederated   = "federated"
+	EventRouted      = "routed"
+	EventBids        = "bids"
+	EventSelection   = "selection"
+	EventResult      = "result"
+	EventAggregation = "aggregation"
+	EventCompleted   = "completed"
+)
+
+var (
+	// ErrBrokenChain is returned by Verify when a trail has been tampered with
+	ErrBrokenChain = errors.New("audit chain is broken")
+	// ErrIncomplete is returned by Verify when a trail does not end with its
+	// completed event
+	ErrIncomplete = errors.New("audit trail is incomplete")
+)
+
+// Event is one entry of an execution's audit trail
+type Event struct {
+	// Seq numbers the events of an execution from 1
+	Seq         int64           `json:"seq"`
+	ExecutionID string          `json:"executionId"`
+	Namespace   string          `json:"namespace,omitempty"`
+	Realm       string          `json:"realm,omitempty"`
+	LoopStack   string          `json:"loopstack,omitempty"`
+	Step        string          `json:"step,omitempty"`
+	Type        string          `json:"type"`
+	Time        time.Time       `json:"time"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	// PrevHash is the hash of the previous event, empty for the first
+	PrevHash string `json:"prevHash"`
+	// Hash covers every other field of the event
+	Hash string `json:"hash"`
+}
+
+// Digest computes the event's hash
+func (e Event) Digest() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Seal chains event to prev, which is nil for the first event, and sets
+// its hash
+func Seal(prev *Event, event Event) (Event, error) {
+	event.Seq = 1
+	event.PrevHash = ""
+	if prev != nil {
+		event.Seq = prev.Seq + 1
+		event.PrevHash = prev.Hash
+	}
+	event.Time = event.Time.UTC()
+
+	hash, err := event.Digest()
+	if err != nil {
+		return Event{}, err
+	}
+	event.Hash = hash
+	return event, nil
+}
+
+// Store persists audit events. Implementations seal events on append.
+type Store interface {
+	// Append seals event after the execution's last event and stores it
+	Append(ctx context.Context, event Event) (Event, error)
+	// Events returns an execution's trail in order
+	Events(ctx context.Context, executionID string) ([]Event, error)
+}
+
+// Export writes an execution's trail as JSON Lines
+func Export(ctx context.Context, store Store, executionID string, w io.Writer) error {
+	events, err := store.Events(ctx, executionID)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify checks a JSON Lines trail of one or more executions and returns
+// the number of events verified. Every execution's trail must end with its
+// completed event.
+func Verify(r io.Reader) (int, error) {
+	v := newVerifier()
+	count := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		count++
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return count, fmt.Errorf("line %d: %w", count, err)
+		}
+		if err := v.add(event); err != nil {
+			return count, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return count, err
+	}
+	return count, v.complete()
+}
+
+// verifier follows the hash chains of the executions of a trail
+type verifier struct {
+	last       map[string]*Event
+	executions []string
+}
+
+func newVerifier() *verifier {
+	return &verifier{last: make(map[string]*Event)}
+}
+
+// add checks that event follows the previous event of its execution
+func (v *verifier) add(event Event) error {
+	prev, ok := v.last[event.ExecutionID]
+	if !ok {
+		v.executions = append(v.executions, event.ExecutionID)
+	}
+	if prev != nil && prev.Type == EventCompleted {
+		return fmt.Errorf("%w: execution %s: event %d follows the completed event", ErrBrokenChain, event.ExecutionID, event.Seq)
+	}
+	expected, err := Seal(prev, event)
+	if err != nil {
+		return fmt.Errorf("execution %s: event %d: %w", event.ExecutionID, event.Seq, err)
+	}
+	switch {
+	case event.Seq != expected.Seq:
+		return fmt.Errorf("%w: execution %s: event %d follows event %d", ErrBrokenChain, event.ExecutionID, event.Seq, expected.Seq-1)
+	case event.PrevHash != expected.PrevHash:
+		return fmt.Errorf("%w: execution %s: event %d does not link to its predecessor", ErrBrokenChain, event.ExecutionID, event.Seq)
+	case event.Hash != expected.Hash:
+		return fmt.Errorf("%w: execution %s: event %d has been modified", ErrBrokenChain, event.ExecutionID, event.Seq)
+	}
+	v.last[event.ExecutionID] = &event
+	return nil
+}
+
+// complete checks that every execution's trail ended with its completed
+// event
+func (v *verifier) complete() error {
+	for _, executionID := range v.executions {
+		if event := v.last[executionID]; event.Type != EventCompleted {
+			return fmt.Errorf("%w: execution %s ends at event %d without its completed event", ErrIncomplete, executionID, event.Seq)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// record appends a trail of events of the given types to store
+func record(t *testing.T, store Store, executionID string, types ...string) {
+	t.Helper()
+	trail := &Trail{Store: store, ExecutionID: executionID, Namespace: "default", Realm: "realm", LoopStack: "triage"}
+	for i, eventType := range types {
+		if err := trail.Record(context.Background(), "classify", eventType, map[string]int{"n": i}); err != nil {
+			t.Fatalf("Record(%s) error = %v", eventType, err)
+		}
+	}
+}
+
+func exportLines(t *testing.T, store Store, executionID string) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Export(context.Background(), store, executionID, &buf); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func TestSeal(t *testing.T) {
+	first, err := Seal(nil, Event{ExecutionID: "exec-1", Type: EventInput, Seq: 7, PrevHash: "bogus"})
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if first.Seq != 1 || first.PrevHash != "" || first.Hash == "" {
+		t.Errorf("Seal(nil) = seq %d, prevHash %q, hash %q", first.Seq, first.PrevHash, first.Hash)
+	}
+	second, err := Seal(&first, Event{ExecutionID: "exec-1", Type: EventBids})
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if second.Seq != 2 || second.PrevHash != first.Hash {
+		t.Errorf("Seal(first) = seq %d, prevHash %q, want 2, %q", second.Seq, second.PrevHash, first.Hash)
+	}
+
+	// The hash covers the content and the link to the previous event
+	changed := second
+	changed.Data = json.RawMessage(`{"changed":true}`)
+	if hash, _ := changed.Digest(); hash == second.Hash {
+		t.Error("Digest() did not change with the data")
+	}
+	relinked := second
+	relinked.PrevHash = "other"
+	if hash, _ := relinked.Digest(); hash == second.Hash {
+		t.Error("Digest() did not change with the previous hash")
+	}
+}
+
+func TestFileStoreAppend(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	record(t, store, "exec-1", EventInput, EventBids)
+
+	// A store of a restarted process continues the trail on disk
+	restarted, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	record(t, restarted, "exec-1", EventSelection, EventCompleted)
+
+	events, err := restarted.Events(ctx, "exec-1")
+	if err != nil {
+		t.Fatalf("Events() error = %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("Events() = %d events, want 4", len(events))
+	}
+	for i, event := range events {
+		if event.Seq != int64(i+1) {
+			t.Errorf("event %d seq = %d", i, event.Seq)
+		}
+		if i > 0 && event.PrevHash != events[i-1].Hash {
+			t.Errorf("event %d does not link to event %d", event.Seq, events[i-1].Seq)
+		}
+	}
+
+	if _, err := store.Events(ctx, "exec-2"); err == nil {
+		t.Error("Events(unknown) error = nil")
+	}
+	for _, id := range []string{"", "..", "a/b"} {
+		if _, err := store.Append(ctx, Event{ExecutionID: id, Type: EventInput}); err == nil {
+			t.Errorf("Append(%q) error = nil", id)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	record(t, store, "exec-1", EventInput, EventBids, EventSelection, EventResult, EventCompleted)
+	lines := exportLines(t, store, "exec-1")
+
+	alter := func(lines []string) []string {
+		var event Event
+		if err := json.Unmarshal([]byte(lines[2]), &event); err != nil {
+			t.Fatal(err)
+		}
+		event.Data = json.RawMessage(`{"n":42}`)
+		line, _ := json.Marshal(event)
+		lines[2] = string(line)
+		return lines
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func([]string) []string
+		wantErr error
+	}{
+		{
+			name:   "intact",
+			tamper: func(lines []string) []string { return lines },
+		},
+		{
+			name:    "altered",
+			tamper:  alter,
+			wantErr: ErrBrokenChain,
+		},
+		{
+			name: "reordered",
+			tamper: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			wantErr: ErrBrokenChain,
+		},
+		{
+			name: "removed",
+			tamper: func(lines []string) []string {
+				return append(lines[:2:2], lines[3:]...)
+			},
+			wantErr: ErrBrokenChain,
+		},
+		{
+			name: "truncated",
+			tamper: func(lines []string) []string {
+				return lines[:3]
+			},
+			wantErr: ErrIncomplete,
+		},
+		{
+			name: "appended after completion",
+			tamper: func(lines []string) []string {
+				var last Event
+				if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+					t.Fatal(err)
+				}
+				extra, _ := Seal(&last, Event{ExecutionID: "exec-1", Type: EventResult, Time: time.Now()})
+				line, _ := json.Marshal(extra)
+				return append(lines, string(line))
+			},
+			wantErr: ErrBrokenChain,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trail := tt.tamper(append([]string(nil), lines...))
+			count, err := Verify(strings.NewReader(strings.Join(trail, "\n") + "\n"))
+			if tt.wantErr == nil {
+				if err != nil || count != len(lines) {
+					t.Errorf("Verify() = %d, %v, want %d events", count, err, len(lines))
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyDir(t *testing.T) {
+	newDir := func(t *testing.T) string {
+		dir := t.TempDir()
+		store, err := NewFileStore(dir)
+		if err != nil {
+			t.Fatalf("NewFileStore() error = %v", err)
+		}
+		record(t, store, "exec-1", EventInput, EventBids, EventCompleted)
+		record(t, store, "exec-2", EventInput, EventSelection, EventCompleted)
+		// Executions still running are not in the ledger yet
+		record(t, store, "exec-3", EventInput)
+		return dir
+	}
+	rewrite := func(t *testing.T, path string, edit func([]string) []string) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := edit(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		trails, head, err := VerifyDir(newDir(t))
+		if err != nil || trails != 2 || head == "" {
+			t.Errorf("VerifyDir() = %d, %q, %v, want 2 trails and a head", trails, head, err)
+		}
+	})
+
+	t.Run("trail removed", func(t *testing.T) {
+		dir := newDir(t)
+		if err := os.Remove(filepath.Join(dir, "exec-1.jsonl")); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := VerifyDir(dir); !errors.Is(err, ErrIncomplete) {
+			t.Errorf("VerifyDir() error = %v, want ErrIncomplete", err)
+		}
+	})
+
+	t.Run("trail truncated", func(t *testing.T) {
+		dir := newDir(t)
+		rewrite(t, filepath.Join(dir, "exec-2.jsonl"), func(lines []string) []string { return lines[:2] })
+		if _, _, err := VerifyDir(dir); !errors.Is(err, ErrIncomplete) {
+			t.Errorf("VerifyDir() error = %v, want ErrIncomplete", err)
+		}
+	})
+
+	t.Run("ledger entry removed", func(t *testing.T) {
+		dir := newDir(t)
+		rewrite(t, filepath.Join(dir, LedgerFile), func(lines []string) []string { return lines[1:] })
+		if _, _, err := VerifyDir(dir); !errors.Is(err, ErrBrokenChain) {
+			t.Errorf("VerifyDir() error = %v, want ErrBrokenChain", err)
+		}
+	})
+
+	t.Run("ledger and trail removed", func(t *testing.T) {
+		// Removing the last entry with its trail leaves a valid ledger,
+		// whose head no longer matches the one kept outside the store
+		dir := newDir(t)
+		_, head, err := VerifyDir(dir)
+		if err != nil {
+			t.Fatalf("VerifyDir() error = %v", err)
+		}
+		rewrite(t, filepath.Join(dir, LedgerFile), func(lines []string) []string { return lines[:1] })
+		if err := os.Remove(filepath.Join(dir, "exec-2.jsonl")); err != nil {
+			t.Fatal(err)
+		}
+		trails, truncated, err := VerifyDir(dir)
+		if err != nil || trails != 1 || truncated == head {
+			t.Errorf("VerifyDir() = %d, %q, %v, want 1 trail and a head other than %q", trails, truncated, err, head)
+		}
+	})
+}
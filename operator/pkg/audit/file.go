@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileStore keeps each execution's trail in its own JSON Lines file under
+// Dir, and records completed trails in the ledger of Dir. Files are only
+// ever appended to.
+type FileStore struct {
+	Dir string
+
+	mu   sync.Mutex
+	last map[string]Event
+	// ledger is the last ledger entry, read from the ledger on first use
+	ledger     *LedgerEntry
+	ledgerRead bool
+}
+
+var _ Store = &FileStore{}
+
+// NewFileStore creates dir if needed and returns a store in it
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir, last: make(map[string]Event)}, nil
+}
+
+func (s *FileStore) path(executionID string) (string, error) {
+	if executionID == "" || strings.ContainsAny(executionID, `/\`) || executionID == "." || executionID == ".." {
+		return "", fmt.Errorf("invalid execution id %q", executionID)
+	}
+	return filepath.Join(s.Dir, executionID+".jsonl"), nil
+}
+
+// Append implements Store
+func (s *FileStore) Append(ctx context.Context, event Event) (Event, error) {
+	path, err := s.path(event.ExecutionID)
+	if err != nil {
+		return Event{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prev *Event
+	if last, ok := s.last[event.ExecutionID]; ok {
+		prev = &last
+	} else {
+		// The trail may have been started by a previous process
+		events, err := readLines[Event](path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Event{}, err
+		}
+		if len(events) > 0 {
+			prev = &events[len(events)-1]
+		}
+	}
+
+	sealed, err := Seal(prev, event)
+	if err != nil {
+		return Event{}, err
+	}
+	if err := appendLine(path, sealed); err != nil {
+		return Event{}, err
+	}
+	if sealed.Type == EventCompleted {
+		delete(s.last, event.ExecutionID)
+		if err := s.appendLedger(sealed); err != nil {
+			return Event{}, fmt.Errorf("failed to record trail in ledger: %w", err)
+		}
+	} else {
+		s.last[event.ExecutionID] = sealed
+	}
+	return sealed, nil
+}
+
+// Events implements Store
+func (s *FileStore) Events(ctx context.Context, executionID string) ([]Event, error) {
+	path, err := s.path(executionID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := readLines[Event](path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no audit trail for execution %s", executionID)
+	}
+	return events, err
+}
+
+// appendLedger records a completed trail in the ledger
+func (s *FileStore) appendLedger(completed Event) error {
+	path := filepath.Join(s.Dir, LedgerFile)
+	if !s.ledgerRead {
+		entries, err := readLines[LedgerEntry](path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if len(entries) > 0 {
+			s.ledger = &entries[len(entries)-1]
+		}
+		s.ledgerRead = true
+	}
+
+	entry, err := SealEntry(s.ledger, LedgerEntry{
+		ExecutionID: completed.ExecutionID,
+		Time:        completed.Time,
+		Events:      completed.Seq,
+		LastHash:    completed.Hash,
+	})
+	if err != nil {
+		return err
+	}
+	if err := appendLine(path, entry); err != nil {
+		return err
+	}
+	s.ledger = &entry
+	return nil
+}
+
+// appendLine appends v as a JSON line and syncs the file
+func appendLine(path string, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readLines[T any](path string) ([]T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var values []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var value T
+		if err := json.Unmarshal(scanner.Bytes(), &value); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		values = append(values, value)
+	}
+	return values, scanner.Err()
+}
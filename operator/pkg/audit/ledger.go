@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LedgerFile is the name of the ledger in a FileStore's directory. It has
+// no .jsonl extension, so it cannot be taken for an execution's trail.
+const LedgerFile = "ledger"
+
+// LedgerEntry records an execution's completed trail in the ledger of a
+// store. Entries are hash-chained like events; the hash of the last entry,
+// kept outside the store, anchors every trail recorded until then.
+type LedgerEntry struct {
+	// Seq numbers the entries of the ledger from 1
+	Seq         int64     `json:"seq"`
+	ExecutionID string    `json:"executionId"`
+	Time        time.Time `json:"time"`
+	// Events is the length of the trail
+	Events int64 `json:"events"`
+	// LastHash is the hash of the trail's completed event
+	LastHash string `json:"lastHash"`
+	// PrevHash is the hash of the previous entry, empty for the first
+	PrevHash string `json:"prevHash"`
+	// Hash covers every other field of the entry
+	Hash string `json:"hash"`
+}
+
+// Digest computes the entry's hash
+func (e LedgerEntry) Digest() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SealEntry chains entry to prev, which is nil for the first entry, and
+// sets its hash
+func SealEntry(prev *LedgerEntry, entry LedgerEntry) (LedgerEntry, error) {
+	entry.Seq = 1
+	entry.PrevHash = ""
+	if prev != nil {
+		entry.Seq = prev.Seq + 1
+		entry.PrevHash = prev.Hash
+	}
+	entry.Time = entry.Time.UTC()
+
+	hash, err := entry.Digest()
+	if err != nil {
+		return LedgerEntry{}, err
+	}
+	entry.Hash = hash
+	return entry, nil
+}
+
+// VerifyDir checks the trails of a FileStore directory against its ledger
+// and returns the number of completed trails verified with the hash of the
+// last ledger entry. Every ledger entry must match a complete trail and
+// every completed trail must be in the ledger; the trails of executions
+// still running are only checked for a broken chain.
+func VerifyDir(dir string) (int, string, error) {
+	entries, err := readLines[LedgerEntry](filepath.Join(dir, LedgerFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, "", err
+	}
+
+	var prev *LedgerEntry
+	recorded := make(map[string]bool, len(entries))
+	for i, entry := range entries {
+		expected, err := SealEntry(prev, entry)
+		if err != nil {
+			return i, "", fmt.Errorf("ledger entry %d: %w", entry.Seq, err)
+		}
+		if entry.Seq != expected.Seq || entry.PrevHash != expected.PrevHash || entry.Hash != expected.Hash {
+			return i, "", fmt.Errorf("%w: ledger entry %d has been modified or does not follow entry %d", ErrBrokenChain, entry.Seq, expected.Seq-1)
+		}
+		prev = &entries[i]
+		recorded[entry.ExecutionID] = true
+
+		events, err := readLines[Event](filepath.Join(dir, entry.ExecutionID+".jsonl"))
+		if errors.Is(err, os.ErrNotExist) {
+			return i, "", fmt.Errorf("%w: the trail of execution %s has been removed", ErrIncomplete, entry.ExecutionID)
+		}
+		if err != nil {
+			return i, "", err
+		}
+		v := newVerifier()
+		for _, event := range events {
+			if err := v.add(event); err != nil {
+				return i, "", err
+			}
+		}
+		if err := v.complete(); err != nil {
+			return i, "", err
+		}
+		if n := int64(len(events)); n == 0 || n != entry.Events || events[n-1].Hash != entry.LastHash {
+			return i, "", fmt.Errorf("%w: the trail of execution %s does not match its ledger entry", ErrBrokenChain, entry.ExecutionID)
+		}
+	}
+
+	trails, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return len(entries), "", err
+	}
+	for _, path := range trails {
+		executionID := strings.TrimSuffix(filepath.Base(path), ".jsonl")
+		if recorded[executionID] {
+			continue
+		}
+		events, err := readLines[Event](path)
+		if err != nil {
+			return len(entries), "", err
+		}
+		v := newVerifier()
+		for _, event := range events {
+			if err := v.add(event); err != nil {
+				return len(entries), "", err
+			}
+		}
+		if len(events) > 0 && events[len(events)-1].Type == EventCompleted {
+			return len(entries), "", fmt.Errorf("%w: the completed trail of execution %s is not in the ledger", ErrBrokenChain, executionID)
+		}
+	}
+
+	head := ""
+	if prev != nil {
+		head = prev.Hash
+	}
+	return len(entries), head, nil
+}
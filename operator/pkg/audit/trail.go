@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Trail records the events of one execution. A nil Trail records nothing,
+// so callers need not check whether auditing is enabled for the realm.
+type Trail struct {
+	Store       Store
+	ExecutionID string
+	Namespace   string
+	Realm       string
+	LoopStack   string
+}
+
+// Record appends an event with data marshalled to JSON
+func (t *Trail) Record(ctx context.Context, step, eventType string, data interface{}) error {
+	if t == nil {
+		return nil
+	}
+
+	raw, ok := data.(json.RawMessage)
+	if !ok && data != nil {
+		var err error
+		if raw, err = json.Marshal(data); err != nil {
+			return err
+		}
+	}
+
+	_, err := t.Store.Append(ctx, Event{
+		ExecutionID: t.ExecutionID,
+		Namespace:   t.Namespace,
+		Realm:       t.Realm,
+		LoopStack:   t.LoopStack,
+		Step:        step,
+		Type:        eventType,
+		Time:        time.Now(),
+		Data:        raw,
+	})
+	return err
+}
+
+// InputDigest describes an execution input without recording its content
+type InputDigest struct {
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// Digest returns the digest of an input
+func Digest(input []byte) InputDigest {
+	sum := sha256.Sum256(input)
+	return InputDigest{SHA256: hex.EncodeToString(sum[:]), Size: len(input)}
+}
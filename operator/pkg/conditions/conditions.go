@@ -0,0 +1,42 @@
+// Package conditions sets the standard conditions of LoopStacks statuses.
+// Every status carries a Ready condition, which kubectl wait and Argo CD
+// health checks read, next to kind-specific conditions. Conditions record
+// the generation they were observed at.
+package conditions
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Ready is true when an object is reconciled and usable: an Agent that
+// may be deployed, a Realm, a LoopStack that may be executed, or an
+// AgentInstance whose pods all bid
+const Ready = "Ready"
+
+// Set adds or updates a condition, keeping its transition time unless its
+// status changes. It reports whether the condition changed.
+func Set(conditions *[]metav1.Condition, generation int64, conditionType string, status metav1.ConditionStatus, reason, message string) bool {
+	return meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// True sets a condition to true
+func True(conditions *[]metav1.Condition, generation int64, conditionType, reason, message string) bool {
+	return Set(conditions, generation, conditionType, metav1.ConditionTrue, reason, message)
+}
+
+// False sets a condition to false
+func False(conditions *[]metav1.Condition, generation int64, conditionType, reason, message string) bool {
+	return Set(conditions, generation, conditionType, metav1.ConditionFalse, reason, message)
+}
+
+// Unknown sets a condition to unknown
+func Unknown(conditions *[]metav1.Condition, generation int64, conditionType, reason, message string) bool {
+	return Set(conditions, generation, conditionType, metav1.ConditionUnknown, reason, message)
+}
@@ -3,29 +3,49 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"time"
+	"sort"
+	"strings"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	loopstacksv2 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v2"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/conditions"
 )
 
+// Policies of AgentSpec.DeletionPolicy. Agents without one block.
+const (
+	DeletionPolicyBlock   = "Block"
+	DeletionPolicyCascade = "Cascade"
+	DeletionPolicyOrphan  = "Orphan"
+)
+
+// maxListedInstances bounds the AgentInstances named in a status message
+const maxListedInstances = 10
+
 // AgentReconciler reconciles a Agent object
 type AgentReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=loopstacks.io,resources=agents,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=loopstacks.io,resources=agents/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=loopstacks.io,resources=agents/finalizers,verbs=update
+// +kubebuilder:rbac:groups=loopstacks.io,resources=agentinstances,verbs=get;list;watch;patch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *AgentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("agent", req.NamespacedName)
@@ -47,7 +67,9 @@ func (r *AgentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 	finalizerName := "loopstacks.io/agent-finalizer"
 	if agent.DeletionTimestamp == nil && !controllerutil.ContainsFinalizer(agent, finalizerName) {
 		controllerutil.AddFinalizer(agent, finalizerName)
-		return ctrl.Result{}, r.Update(ctx, agent)
+		if err := r.Update(ctx, agent); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
 	// Handle deletion
@@ -61,39 +83,22 @@ func (r *AgentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 
 func (r *AgentReconciler) reconcileAgent(ctx context.Context, agent *loopstacksv1.Agent) (ctrl.Result, error) {
 	log := r.Log.WithValues("agent", agent.Name, "namespace", agent.Namespace)
+	before := agent.DeepCopy()
+	agent.Status.ObservedGeneration = agent.Generation
 
-	// Initialize status if needed
-	if agent.Status.Phase == "" {
-		agent.Status.Phase = "Pending"
-		agent.Status.LastUpdated = metav1.NewTime(time.Now())
-		if err := r.Status().Update(ctx, agent); err != nil {
-			log.Error(err, "Failed to update Agent status")
-			return ctrl.Result{}, err
-		}
-	}
-
-	// Validate agent runtime
-	if err := r.validateAgentRuntime(agent); err != nil {
-		log.Error(err, "Agent runtime validation failed")
+	// Validate agent runtime and schema
+	if err := r.validateAgent(agent); err != nil {
+		reason := ReasonOf(err, ReasonInvalidRuntime)
+		log.Error(err, "Agent validation failed", "reason", reason)
+		r.Recorder.Event(agent, corev1.EventTypeWarning, reason, err.Error())
 		agent.Status.Phase = "Failed"
 		agent.Status.Message = err.Error()
-		agent.Status.LastUpdated = metav1.NewTime(time.Now())
-		if updateErr := r.Status().Update(ctx, agent); updateErr != nil {
-			log.Error(updateErr, "Failed to update Agent status")
-		}
-		return ctrl.Result{RequeueAfter: time.Minute * 5}, nil
-	}
-
-	// Validate agent schema
-	if err := r.validateAgentSchema(agent); err != nil {
-		log.Error(err, "Agent schema validation failed")
-		agent.Status.Phase = "Failed"
-		agent.Status.Message = err.Error()
-		agent.Status.LastUpdated = metav1.NewTime(time.Now())
-		if updateErr := r.Status().Update(ctx, agent); updateErr != nil {
-			log.Error(updateErr, "Failed to update Agent status")
+		conditions.False(&agent.Status.Conditions, agent.Generation, conditions.Ready, reason, err.Error())
+		if _, err := patchStatus(ctx, r.Client, agent, before, &agent.Status, &before.Status); err != nil {
+			log.Error(err, "Failed to update Agent status")
+			return requeueOnConflict(ctrl.Result{}, err)
 		}
-		return ctrl.Result{RequeueAfter: time.Minute * 5}, nil
+		return ctrl.Result{}, nil
 	}
 
 	// Count associated AgentInstances
@@ -107,37 +112,51 @@ func (r *AgentReconciler) reconcileAgent(ctx context.Context, agent *loopstacksv
 	agent.Status.Phase = "Ready"
 	agent.Status.Message = "Agent is ready for deployment"
 	agent.Status.Instances = instanceCount
-	agent.Status.LastUpdated = metav1.NewTime(time.Now())
+	validated := conditions.True(&agent.Status.Conditions, agent.Generation, conditions.Ready, ReasonValidated, agent.Status.Message)
 
-	if err := r.Status().Update(ctx, agent); err != nil {
+	changed, err := patchStatus(ctx, r.Client, agent, before, &agent.Status, &before.Status)
+	if err != nil {
 		log.Error(err, "Failed to update Agent status")
-		return ctrl.Result{}, err
+		return requeueOnConflict(ctrl.Result{}, err)
 	}
-
-	log.Info("Agent reconciled successfully", "instances", instanceCount)
-	return ctrl.Result{RequeueAfter: time.Minute * 10}, nil
+	if validated {
+		r.Recorder.Event(agent, corev1.EventTypeNormal, ReasonValidated, agent.Status.Message)
+	}
+	if changed {
+		log.Info("Agent reconciled successfully", "instances", instanceCount)
+	}
+	return ctrl.Result{}, nil
 }
 
 func (r *AgentReconciler) handleDeletion(ctx context.Context, agent *loopstacksv1.Agent, finalizerName string) (ctrl.Result, error) {
-	log := r.Log.WithValues("agent", agent.Name, "namespace", agent.Namespace)
+	log := r.Log.WithValues("agent", agent.Name, "namespace", agent.Namespace, "deletionPolicy", agent.Spec.DeletionPolicy)
 	log.Info("Handling Agent deletion")
 
 	// Check if there are any AgentInstances referencing this Agent
-	instanceCount, err := r.getAgentInstanceCount(ctx, agent)
+	instances, err := listAgentInstances(ctx, r, agent.Namespace, AgentInstanceAgentField, agent.Name)
 	if err != nil {
-		log.Error(err, "Failed to count AgentInstances during deletion")
+		log.Error(err, "Failed to list AgentInstances during deletion")
 		return ctrl.Result{}, err
 	}
 
-	if instanceCount > 0 {
-		log.Info("Cannot delete Agent, AgentInstances still exist", "count", instanceCount)
-		agent.Status.Phase = "Terminating"
-		agent.Status.Message = "Waiting for AgentInstances to be deleted"
-		agent.Status.LastUpdated = metav1.NewTime(time.Now())
-		if err := r.Status().Update(ctx, agent); err != nil {
-			log.Error(err, "Failed to update Agent status")
+	if len(instances) > 0 {
+		switch agent.Spec.DeletionPolicy {
+		case DeletionPolicyOrphan:
+			log.Info("Orphaning AgentInstances", "count", len(instances))
+			for i := range instances {
+				if err := r.annotate(ctx, &instances[i], OrphanedAnnotation); err != nil {
+					log.Error(err, "Failed to mark AgentInstance orphaned", "agentinstance", instances[i].Name)
+					return ctrl.Result{}, err
+				}
+			}
+			r.Recorder.Eventf(agent, corev1.EventTypeNormal, ReasonInstancesOrphaned, "Left %d AgentInstances running: %s", len(instances), instanceNames(instances))
+		case DeletionPolicyCascade:
+			return r.cascade(ctx, log, agent, instances)
+		default:
+			log.Info("Cannot delete Agent, AgentInstances still exist", "count", len(instances))
+			message := fmt.Sprintf("AgentInstances still reference the Agent: %s", instanceNames(instances))
+			return r.setTerminating(ctx, agent, len(instances), ReasonInstancesRemaining, message)
 		}
-		return ctrl.Result{RequeueAfter: time.Second * 30}, nil
 	}
 
 	// Remove finalizer
@@ -151,6 +170,96 @@ func (r *AgentReconciler) handleDeletion(ctx context.Context, agent *loopstacksv
 	return ctrl.Result{}, nil
 }
 
+// cascade drains the AgentInstances of a deleted Agent and deletes each
+// once it is drained. The Agent is rechecked until they are gone, as their
+// status changes do not trigger reconciles.
+func (r *AgentReconciler) cascade(ctx context.Context, log logr.Logger, agent *loopstacksv1.Agent, instances []loopstacksv1.AgentInstance) (ctrl.Result, error) {
+	for i := range instances {
+		instance := &instances[i]
+		var err error
+		switch {
+		case instance.DeletionTimestamp != nil:
+		case drained(instance):
+			log.Info("Deleting drained AgentInstance", "agentinstance", instance.Name)
+			err = client.IgnoreNotFound(r.Delete(ctx, instance))
+		default:
+			err = r.annotate(ctx, instance, DrainingAnnotation)
+		}
+		if err != nil {
+			log.Error(err, "Failed to drain AgentInstance", "agentinstance", instance.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	message := fmt.Sprintf("Draining AgentInstances before deleting them: %s", instanceNames(instances))
+	result, err := r.setTerminating(ctx, agent, len(instances), ReasonDeletingInstances, message)
+	if err == nil && result.IsZero() {
+		result.RequeueAfter = drainInterval
+	}
+	return result, err
+}
+
+// annotate sets one of the deletion policy annotations on an AgentInstance
+func (r *AgentReconciler) annotate(ctx context.Context, instance *loopstacksv1.AgentInstance, annotation string) error {
+	if _, ok := instance.Annotations[annotation]; ok || instance.DeletionTimestamp != nil {
+		return nil
+	}
+	patch := client.MergeFrom(instance.DeepCopy())
+	metav1.SetMetaDataAnnotation(&instance.ObjectMeta, annotation, "true")
+	return client.IgnoreNotFound(r.Patch(ctx, instance, patch))
+}
+
+// setTerminating reports an Agent whose deletion waits for its
+// AgentInstances. The warning is recorded when the status changes; the
+// Agent is reconciled again as the instances go away.
+func (r *AgentReconciler) setTerminating(ctx context.Context, agent *loopstacksv1.Agent, instances int, reason, message string) (ctrl.Result, error) {
+	before := agent.DeepCopy()
+	agent.Status.Phase = "Terminating"
+	agent.Status.Message = message
+	agent.Status.Instances = int32(instances)
+	agent.Status.ObservedGeneration = agent.Generation
+	conditions.False(&agent.Status.Conditions, agent.Generation, conditions.Ready, reason, message)
+	changed, err := patchStatus(ctx, r.Client, agent, before, &agent.Status, &before.Status)
+	if err != nil {
+		r.Log.Error(err, "Failed to update Agent status", "agent", agent.Name)
+		return requeueOnConflict(ctrl.Result{}, err)
+	}
+	if changed {
+		eventType := corev1.EventTypeNormal
+		if reason == ReasonInstancesRemaining {
+			eventType = corev1.EventTypeWarning
+		}
+		r.Recorder.Event(agent, eventType, reason, message)
+	}
+	return ctrl.Result{}, nil
+}
+
+// instanceNames lists AgentInstances by name for status messages, eliding
+// all but the first maxListedInstances
+func instanceNames(instances []loopstacksv1.AgentInstance) string {
+	names := make([]string, 0, len(instances))
+	for i := range instances {
+		names = append(names, instances[i].Name)
+	}
+	sort.Strings(names)
+	if len(names) > maxListedInstances {
+		return fmt.Sprintf("%s and %d more", strings.Join(names[:maxListedInstances], ", "), len(names)-maxListedInstances)
+	}
+	return strings.Join(names, ", ")
+}
+
+// validateAgent checks the runtime and schema of an Agent. Its errors are
+// ReasonErrors.
+func (r *AgentReconciler) validateAgent(agent *loopstacksv1.Agent) error {
+	if err := r.validateAgentRuntime(agent); err != nil {
+		return &ReasonError{Reason: ReasonInvalidRuntime, Err: err}
+	}
+	if err := r.validateAgentSchema(agent); err != nil {
+		return &ReasonError{Reason: ReasonSchemaInvalid, Err: err}
+	}
+	return nil
+}
+
 func (r *AgentReconciler) validateAgentRuntime(agent *loopstacksv1.Agent) error {
 	// Validate runtime image
 	if agent.Spec.Runtime.Image == "" {
@@ -170,6 +279,11 @@ func (r *AgentReconciler) validateAgentRuntime(agent *loopstacksv1.Agent) error
 		return fmt.Errorf("unsupported runtime language: %s", agent.Spec.Runtime.Language)
 	}
 
+	// Validate resources, as read by the workload renderer
+	if err := (&loopstacksv2.Agent{}).ConvertFrom(agent); err != nil {
+		return fmt.Errorf("invalid runtime resources: %w", err)
+	}
+
 	return nil
 }
 
@@ -185,24 +299,20 @@ func (r *AgentReconciler) validateAgentSchema(agent *loopstacksv1.Agent) error {
 }
 
 func (r *AgentReconciler) getAgentInstanceCount(ctx context.Context, agent *loopstacksv1.Agent) (int32, error) {
-	var agentInstances loopstacksv1.AgentInstanceList
-	err := r.List(ctx, &agentInstances, client.InNamespace(agent.Namespace))
+	instances, err := listAgentInstances(ctx, r, agent.Namespace, AgentInstanceAgentField, agent.Name)
 	if err != nil {
 		return 0, err
 	}
-
-	count := int32(0)
-	for _, instance := range agentInstances.Items {
-		if instance.Spec.Agent == agent.Name {
-			count++
-		}
-	}
-	return count, nil
+	return int32(len(instances)), nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. Status updates
+// do not trigger reconciles; AgentInstances coming and going do, as they
+// are counted in the status and hold up deletion.
 func (r *AgentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&loopstacksv1.Agent{}).
+		For(&loopstacksv1.Agent{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&loopstacksv1.AgentInstance{}, enqueueAgentInstanceOwner(agentInstanceToAgent),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(r)
 }
\ No newline at end of file
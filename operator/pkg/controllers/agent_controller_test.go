@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/conditions"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/backends"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/memory"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/liveness"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+const agentFinalizer = "loopstacks.io/agent-finalizer"
+
+func newTestClient(t *testing.T, objects ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := loopstacksv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&loopstacksv1.Agent{}, &loopstacksv1.AgentInstance{}).
+		WithIndex(&loopstacksv1.AgentInstance{}, AgentInstanceAgentField, func(obj client.Object) []string {
+			return []string{obj.(*loopstacksv1.AgentInstance).Spec.Agent}
+		}).
+		WithIndex(&loopstacksv1.AgentInstance{}, AgentInstanceSecretField, agentInstanceSecrets).
+		WithIndex(&loopstacksv1.Agent{}, AgentSecretField, agentSecrets).
+		Build()
+}
+
+func deletedAgent(policy string) *loopstacksv1.Agent {
+	now := metav1.Now()
+	return &loopstacksv1.Agent{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "support-agent",
+			Finalizers:        []string{agentFinalizer},
+			DeletionTimestamp: &now,
+		},
+		Spec: loopstacksv1.AgentSpec{DeletionPolicy: policy},
+	}
+}
+
+func agentInstance(name string) *loopstacksv1.AgentInstance {
+	return &loopstacksv1.AgentInstance{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       loopstacksv1.AgentInstanceSpec{Agent: "support-agent", Realm: "default-realm", Replicas: 2},
+	}
+}
+
+func TestAgentDeletionPolicies(t *testing.T) {
+	ctx := context.Background()
+	key := types.NamespacedName{Namespace: "default", Name: "support-agent"}
+
+	reconcile := func(t *testing.T, r *AgentReconciler) ctrl.Result {
+		t.Helper()
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		if err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		return result
+	}
+	newReconciler := func(c client.Client) *AgentReconciler {
+		return &AgentReconciler{Client: c, Log: logr.Discard(), Recorder: record.NewFakeRecorder(100)}
+	}
+	getInstance := func(t *testing.T, c client.Client, name string) *loopstacksv1.AgentInstance {
+		t.Helper()
+		instance := &loopstacksv1.AgentInstance{}
+		err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, instance)
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return instance
+	}
+	agentDeleted := func(t *testing.T, c client.Client) bool {
+		t.Helper()
+		err := c.Get(ctx, key, &loopstacksv1.Agent{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		return apierrors.IsNotFound(err)
+	}
+
+	t.Run("Block", func(t *testing.T) {
+		c := newTestClient(t, deletedAgent(""), agentInstance("support-b"), agentInstance("support-a"))
+		reconcile(t, newReconciler(c))
+
+		agent := &loopstacksv1.Agent{}
+		if err := c.Get(ctx, key, agent); err != nil {
+			t.Fatalf("Agent was deleted: %v", err)
+		}
+		ready := meta.FindStatusCondition(agent.Status.Conditions, conditions.Ready)
+		if agent.Status.Phase != "Terminating" || ready == nil || ready.Reason != ReasonInstancesRemaining ||
+			!strings.HasSuffix(ready.Message, "support-a, support-b") {
+			t.Errorf("Agent status = %+v", agent.Status)
+		}
+		for _, name := range []string{"support-a", "support-b"} {
+			if instance := getInstance(t, c, name); instance == nil || len(instance.Annotations) > 0 {
+				t.Errorf("AgentInstance %s = %+v, want it untouched", name, instance)
+			}
+		}
+	})
+
+	t.Run("Orphan", func(t *testing.T) {
+		c := newTestClient(t, deletedAgent(DeletionPolicyOrphan), agentInstance("support-a"))
+		reconcile(t, newReconciler(c))
+
+		if !agentDeleted(t, c) {
+			t.Error("Agent was not deleted")
+		}
+		instance := getInstance(t, c, "support-a")
+		if instance == nil {
+			t.Fatal("AgentInstance was deleted")
+		}
+		if _, ok := instance.Annotations[OrphanedAnnotation]; !ok {
+			t.Errorf("AgentInstance annotations = %v, want %s", instance.Annotations, OrphanedAnnotation)
+		}
+	})
+
+	t.Run("Cascade", func(t *testing.T) {
+		c := newTestClient(t, deletedAgent(DeletionPolicyCascade), agentInstance("support-a"), agentInstance("support-b"))
+		r := newReconciler(c)
+
+		if result := reconcile(t, r); result.RequeueAfter == 0 {
+			t.Error("Reconcile() does not recheck draining AgentInstances")
+		}
+		for _, name := range []string{"support-a", "support-b"} {
+			instance := getInstance(t, c, name)
+			if instance == nil {
+				t.Fatalf("AgentInstance %s was deleted before draining", name)
+			}
+			if _, ok := instance.Annotations[DrainingAnnotation]; !ok {
+				t.Errorf("AgentInstance %s annotations = %v, want %s", name, instance.Annotations, DrainingAnnotation)
+			}
+		}
+
+		// The AgentInstance controller reports each drained in turn
+		for i, name := range []string{"support-a", "support-b"} {
+			instance := getInstance(t, c, name)
+			instance.Status.Phase = "Drained"
+			if err := c.Status().Update(ctx, instance); err != nil {
+				t.Fatal(err)
+			}
+			reconcile(t, r)
+			if getInstance(t, c, name) != nil {
+				t.Errorf("drained AgentInstance %s was not deleted", name)
+			}
+			if i == 0 && getInstance(t, c, "support-b") == nil {
+				t.Error("AgentInstance support-b was deleted before it drained")
+			}
+		}
+
+		if agentDeleted(t, c) {
+			t.Fatal("Agent was deleted before its last reconcile")
+		}
+		reconcile(t, r)
+		if !agentDeleted(t, c) {
+			t.Error("Agent was not deleted after its AgentInstances")
+		}
+	})
+}
+
+func TestAgentInstanceDrain(t *testing.T) {
+	ctx := context.Background()
+	instance := agentInstance("support")
+	instance.Annotations = map[string]string{DrainingAnnotation: "true"}
+	realm := &loopstacksv1.Realm{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "default-realm"}}
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "support", Labels: map[string]string{liveness.InstanceLabel: "support"}},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "support-0", Labels: map[string]string{liveness.InstanceLabel: "support"}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+
+	c := newTestClient(t, instance, realm, pod)
+	if err := ctrl.SetControllerReference(instance, deployment, c.Scheme()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Create(ctx, deployment); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := memory.New(0)
+	registry := liveness.NewRegistry()
+	registry.Open = func(ctx context.Context, opts backends.Options) (coordination.Backend, error) {
+		return backend, nil
+	}
+	if err := backend.Heartbeat(ctx, &protocol.Heartbeat{
+		AgentID:       "support-0",
+		Pod:           "support-0",
+		Capabilities:  []string{"reply"},
+		LastHeartbeat: time.Now().UnixMilli(),
+		ActiveLoops:   1,
+		Draining:      true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &AgentInstanceReconciler{Client: c, Log: logr.Discard(), Recorder: record.NewFakeRecorder(100), Registry: registry}
+	key := types.NamespacedName{Namespace: "default", Name: "support"}
+	check := func(t *testing.T, phase string, activeLoops int32) {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		got := &loopstacksv1.AgentInstance{}
+		if err := c.Get(ctx, key, got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Status.Phase != phase || got.Status.ActiveLoops != activeLoops {
+			t.Errorf("AgentInstance status = %s with %d active loops, want %s with %d", got.Status.Phase, got.Status.ActiveLoops, phase, activeLoops)
+		}
+		if drained(got) != (phase == "Drained") {
+			t.Errorf("drained() = %v in phase %s", drained(got), got.Status.Phase)
+		}
+	}
+
+	// The pod is still running its loop after its Deployment scaled down
+	check(t, "Draining", 1)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(deployment), deployment); err != nil {
+		t.Fatal(err)
+	}
+	if *deployment.Spec.Replicas != 0 {
+		t.Errorf("Deployment replicas = %d, want 0", *deployment.Spec.Replicas)
+	}
+
+	// The pod's agent finished its loop, deregistered and exited
+	if err := backend.Deregister(ctx, "support-0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, pod); err != nil {
+		t.Fatal(err)
+	}
+	check(t, "Drained", 0)
+}
+
+func TestAgentInstanceOrphaned(t *testing.T) {
+	ctx := context.Background()
+	instance := agentInstance("support")
+	instance.Annotations = map[string]string{OrphanedAnnotation: "true"}
+	c := newTestClient(t, instance)
+	r := &AgentInstanceReconciler{Client: c, Log: logr.Discard(), Recorder: record.NewFakeRecorder(100), Registry: liveness.NewRegistry()}
+
+	key := types.NamespacedName{Namespace: "default", Name: "support"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	got := &loopstacksv1.AgentInstance{}
+	if err := c.Get(ctx, key, got); err != nil {
+		t.Fatal(err)
+	}
+	ready := meta.FindStatusCondition(got.Status.Conditions, conditions.Ready)
+	if got.Status.Phase != "Orphaned" || ready == nil || ready.Reason != ReasonOrphaned {
+		t.Errorf("AgentInstance status = %+v", got.Status)
+	}
+
+	// An Agent of the same name adopts it
+	if err := c.Create(ctx, &loopstacksv1.Agent{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "support-agent"}}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err := c.Get(ctx, key, got); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Annotations[OrphanedAnnotation]; ok {
+		t.Errorf("AgentInstance annotations = %v after its Agent was created again", got.Annotations)
+	}
+}
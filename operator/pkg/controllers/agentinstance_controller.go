@@ -2,37 +2,413 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/conditions"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/liveness"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/schema"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workload"
 )
 
+// AgentInstance condition types
+const (
+	// ConditionRegistered is true when every running pod has registered
+	// with the realm's coordination backend
+	ConditionRegistered = "Registered"
+	// ConditionCapabilitiesMatch is true when the registered capabilities
+	// equal those declared on the Agent
+	ConditionCapabilitiesMatch = "CapabilitiesMatch"
+)
+
+// livenessInterval is how often registrations are rechecked
+const livenessInterval = 30 * time.Second
+
 // AgentInstanceReconciler reconciles a AgentInstance object
 type AgentInstanceReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Registry lists the agents registered in each realm
+	Registry *liveness.Registry
+	// StartupGrace overrides liveness.DefaultStartupGrace
+	StartupGrace time.Duration
+	// History provides the execution stats canaries are analyzed with.
+	// Canaries are only promoted by annotation when nil.
+	History history.Store
 }
 
 // +kubebuilder:rbac:groups=loopstacks.io,resources=agentinstances,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=loopstacks.io,resources=agentinstances/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=loopstacks.io,resources=agentinstances/finalizers,verbs=update
+// +kubebuilder:rbac:groups=loopstacks.io,resources=agents;realms,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *AgentInstanceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("agentinstance", req.NamespacedName)
 	log.Info("Reconciling AgentInstance")
 
-	// TODO: Implement agent instance reconciliation logic
-	return ctrl.Result{}, nil
+	instance := &loopstacksv1.AgentInstance{}
+	if err := r.Get(ctx, req.NamespacedName, instance); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("AgentInstance resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get AgentInstance")
+		return ctrl.Result{}, err
+	}
+
+	if instance.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+	before := instance.DeepCopy()
+	if _, ok := instance.Annotations[DrainingAnnotation]; ok {
+		return r.drain(ctx, log, instance, before)
+	}
+
+	agent := &loopstacksv1.Agent{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: instance.Spec.Agent}, agent); err != nil {
+		if apierrors.IsNotFound(err) {
+			if _, ok := instance.Annotations[OrphanedAnnotation]; ok {
+				return r.setPhase(ctx, instance, before, "Orphaned", ReasonOrphaned,
+					fmt.Sprintf("Agent %s was deleted with its AgentInstances orphaned; the pods keep running", instance.Spec.Agent))
+			}
+			return r.setPhase(ctx, instance, before, "Pending", ReasonAgentNotFound, fmt.Sprintf("Agent %s not found", instance.Spec.Agent))
+		}
+		log.Error(err, "Failed to get Agent")
+		return ctrl.Result{}, err
+	}
+	if _, ok := instance.Annotations[OrphanedAnnotation]; ok && agent.DeletionTimestamp == nil {
+		if err := r.adopt(ctx, instance); err != nil {
+			log.Error(err, "Failed to adopt orphaned AgentInstance")
+			return ctrl.Result{}, err
+		}
+	}
+
+	realm := &loopstacksv1.Realm{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: instance.Spec.Realm}, realm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return r.setPhase(ctx, instance, before, "Pending", ReasonRealmNotFound, fmt.Sprintf("Realm %s not found", instance.Spec.Realm))
+		}
+		log.Error(err, "Failed to get Realm")
+		return ctrl.Result{}, err
+	}
+
+	if err := r.checkQuota(ctx, instance, realm); err != nil {
+		var reasonErr *ReasonError
+		if !errors.As(err, &reasonErr) {
+			log.Error(err, "Failed to check the realm quota")
+			return ctrl.Result{}, err
+		}
+		return r.setPhase(ctx, instance, before, "Pending", reasonErr.Reason, err.Error())
+	}
+
+	if err := validateConfig(agent, instance); err != nil {
+		return r.setPhase(ctx, instance, before, "Failed", ReasonOf(err, ReasonInvalidConfig), fmt.Sprintf("Invalid config: %v", err))
+	}
+	if err := r.reconcileConfig(ctx, instance); err != nil {
+		log.Error(err, "Failed to reconcile config")
+		return ctrl.Result{}, err
+	}
+
+	missing, secretsHash, err := r.resolveSecrets(ctx, agent, instance)
+	if err != nil {
+		log.Error(err, "Failed to resolve Secrets")
+		return ctrl.Result{}, err
+	}
+	setSecretsCondition(instance, missing)
+	if len(missing) > 0 {
+		return r.setPhase(ctx, instance, before, "Pending", ReasonSecretMissing, strings.Join(missing, "; "))
+	}
+
+	template, err := workload.PodTemplate(agent, instance, realm, secretsHash)
+	if err != nil {
+		log.Error(err, "Failed to render agent pods")
+		return r.setPhase(ctx, instance, before, "Failed", ReasonInvalidPodTemplate, fmt.Sprintf("Invalid agent pods: %v", err))
+	}
+	if err := r.reconcileRollout(ctx, log, instance, template); err != nil {
+		log.Error(err, "Failed to reconcile rollout")
+		return ctrl.Result{}, err
+	}
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(instance.Namespace), client.MatchingLabels{liveness.InstanceLabel: instance.Name}); err != nil {
+		log.Error(err, "Failed to list pods")
+		return ctrl.Result{}, err
+	}
+
+	heartbeats, err := r.Registry.Agents(ctx, realm)
+	if err != nil {
+		log.Error(err, "Failed to read agent registrations", "realm", realm.Name)
+		instance.Status.Message = fmt.Sprintf("Failed to read agent registrations: %v", err)
+		instance.Status.ObservedGeneration = instance.Generation
+		conditions.Unknown(&instance.Status.Conditions, instance.Generation, conditions.Ready, ReasonRegistryUnavailable, instance.Status.Message)
+		r.Recorder.Event(instance, corev1.EventTypeWarning, ReasonRegistryUnavailable, instance.Status.Message)
+		if _, err := patchStatus(ctx, r.Client, instance, before, &instance.Status, &before.Status); err != nil {
+			log.Error(err, "Failed to update AgentInstance status")
+			return requeueOnConflict(ctrl.Result{}, err)
+		}
+		return ctrl.Result{RequeueAfter: livenessInterval}, nil
+	}
+
+	grace := r.StartupGrace
+	if grace <= 0 {
+		grace = liveness.DefaultStartupGrace
+	}
+	report := liveness.Evaluate(pods.Items, heartbeats, agent.Spec.Capabilities, time.Now(), grace)
+
+	r.applyReport(instance, report)
+	if err := r.applyShadowStats(ctx, instance); err != nil {
+		log.Error(err, "Failed to read shadow execution stats")
+	}
+	changed, err := patchStatus(ctx, r.Client, instance, before, &instance.Status, &before.Status)
+	if err != nil {
+		log.Error(err, "Failed to update AgentInstance status")
+		return requeueOnConflict(ctrl.Result{}, err)
+	}
+
+	if changed {
+		log.Info("AgentInstance reconciled successfully", "phase", instance.Status.Phase, "running", report.Running, "registered", report.Registered)
+	}
+	return ctrl.Result{RequeueAfter: livenessInterval}, nil
+}
+
+// validateConfig checks the AgentInstance's config against the Agent's
+// config schema
+func validateConfig(agent *loopstacksv1.Agent, instance *loopstacksv1.AgentInstance) error {
+	validator, err := schema.Compile(agent.Spec.Schema.Config.Raw)
+	if err != nil {
+		return reasonf(ReasonSchemaInvalid, "agent %s has an invalid config schema: %w", agent.Name, err)
+	}
+	if err := validator.Validate(workload.Config(instance)); err != nil {
+		return reasonf(ReasonInvalidConfig, "does not match the config schema of agent %s: %w", agent.Name, err)
+	}
+	return nil
+}
+
+// checkQuota fails with ReasonQuotaExceeded when the realm's
+// maxAgentInstances are taken by AgentInstances created before this one
+func (r *AgentInstanceReconciler) checkQuota(ctx context.Context, instance *loopstacksv1.AgentInstance, realm *loopstacksv1.Realm) error {
+	limit := realm.Spec.Resources.MaxAgentInstances
+	if limit <= 0 {
+		return nil
+	}
+
+	instances, err := listAgentInstances(ctx, r, instance.Namespace, AgentInstanceRealmField, realm.Name)
+	if err != nil {
+		return err
+	}
+	older := int32(0)
+	for i := range instances {
+		other := &instances[i]
+		if other.DeletionTimestamp != nil || other.UID == instance.UID {
+			continue
+		}
+		if createdBefore(other, instance) {
+			older++
+		}
+	}
+	if older >= limit {
+		return reasonf(ReasonQuotaExceeded, "realm %s allows %d AgentInstances, all taken by older ones", realm.Name, limit)
+	}
+	return nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// createdBefore orders objects by creation time, then name
+func createdBefore(a, b client.Object) bool {
+	at, bt := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+	if !at.Equal(&bt) {
+		return at.Before(&bt)
+	}
+	return a.GetName() < b.GetName()
+}
+
+// reconcileConfig creates or updates the ConfigMap mounted into agent pods
+func (r *AgentInstanceReconciler) reconcileConfig(ctx context.Context, instance *loopstacksv1.AgentInstance) error {
+	desired := workload.ConfigMap(instance)
+	existing := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: desired.Namespace, Name: desired.Name}, existing)
+	if apierrors.IsNotFound(err) {
+		if err := ctrl.SetControllerReference(instance, desired, r.Scheme); err != nil {
+			return err
+		}
+		return r.Create(ctx, desired)
+	}
+	if err != nil {
+		return err
+	}
+	if maps.Equal(existing.Data, desired.Data) {
+		return nil
+	}
+	existing.Data = desired.Data
+	return r.Update(ctx, existing)
+}
+
+// setPhase reports an AgentInstance that cannot run, writing its status
+// against before, the instance as it was read. The warning is recorded
+// when the status changes rather than on every recheck.
+func (r *AgentInstanceReconciler) setPhase(ctx context.Context, instance, before *loopstacksv1.AgentInstance, phase, reason, message string) (ctrl.Result, error) {
+	instance.Status.Phase = phase
+	instance.Status.Message = message
+	instance.Status.ObservedGeneration = instance.Generation
+	conditions.False(&instance.Status.Conditions, instance.Generation, conditions.Ready, reason, message)
+	changed, err := patchStatus(ctx, r.Client, instance, before, &instance.Status, &before.Status)
+	if err != nil {
+		r.Log.Error(err, "Failed to update AgentInstance status", "agentinstance", instance.Name)
+		return requeueOnConflict(ctrl.Result{}, err)
+	}
+	if changed {
+		r.Recorder.Event(instance, corev1.EventTypeWarning, reason, message)
+	}
+	return ctrl.Result{RequeueAfter: livenessInterval}, nil
+}
+
+func (r *AgentInstanceReconciler) applyReport(instance *loopstacksv1.AgentInstance, report liveness.Report) {
+	status := &instance.Status
+	generation := instance.Generation
+
+	status.CurrentReplicas = report.Running
+	status.ReadyReplicas = report.Registered
+	status.ActiveLoops = report.ActiveLoops
+	status.ObservedGeneration = generation
+
+	switch {
+	case report.Running == 0:
+		status.Phase = "Pending"
+		status.Message = "No agent pods are running"
+		conditions.False(&status.Conditions, generation, conditions.Ready, "NoRunningPods", status.Message)
+	case len(report.Unregistered) > 0:
+		status.Phase = "Degraded"
+		status.Message = fmt.Sprintf("%d of %d running pods have not registered for bidding", len(report.Unregistered), report.Running)
+		conditions.False(&status.Conditions, generation, conditions.Ready, "PodsNotRegistered", status.Message)
+	default:
+		status.Phase = "Running"
+		status.Message = fmt.Sprintf("%d of %d running pods registered for bidding", report.Registered, report.Running)
+		if conditions.True(&status.Conditions, generation, conditions.Ready, ReasonAgentsRegistered, status.Message) {
+			r.Recorder.Event(instance, corev1.EventTypeNormal, ReasonAgentsRegistered, status.Message)
+		}
+	}
+
+	switch {
+	case len(report.Unregistered) > 0:
+		conditions.False(&status.Conditions, generation, ConditionRegistered, "PodsNotRegistered",
+			"Running pods without a heartbeat: "+strings.Join(report.Unregistered, ", "))
+	case len(report.Starting) > 0:
+		conditions.Unknown(&status.Conditions, generation, ConditionRegistered, "PodsStarting",
+			"Waiting for pods to register: "+strings.Join(report.Starting, ", "))
+	case report.Running == 0:
+		conditions.Unknown(&status.Conditions, generation, ConditionRegistered, "NoRunningPods", "No agent pods are running")
+	default:
+		conditions.True(&status.Conditions, generation, ConditionRegistered, "AllPodsRegistered", "All running pods have registered")
+	}
+
+	if len(report.Mismatches) > 0 {
+		conditions.False(&status.Conditions, generation, ConditionCapabilitiesMatch, "CapabilityMismatch", describeMismatches(report.Mismatches))
+	} else {
+		conditions.True(&status.Conditions, generation, ConditionCapabilitiesMatch, "CapabilitiesMatch", "Registered capabilities match the Agent")
+	}
+}
+
+// applyShadowStats reports how the results of a shadow AgentInstance
+// compared with the steps it ran on since it entered shadow mode
+func (r *AgentInstanceReconciler) applyShadowStats(ctx context.Context, instance *loopstacksv1.AgentInstance) error {
+	if !instance.Spec.Shadow {
+		instance.Status.Shadow = nil
+		return nil
+	}
+	if instance.Status.Shadow == nil {
+		start := metav1.NewTime(time.Now())
+		instance.Status.Shadow = &loopstacksv1.AgentInstanceShadowStatus{StartTime: &start}
+	}
+	if r.History == nil {
+		return nil
+	}
+
+	status := instance.Status.Shadow
+	stats, err := r.History.ShadowStats(ctx, history.ShadowQuery{
+		Namespace:     instance.Namespace,
+		AgentInstance: instance.Name,
+		Since:         status.StartTime.Time,
+	})
+	if err != nil {
+		return err
+	}
+	status.Executions = int32(stats.Runs)
+	status.Failures = int32(stats.Failures)
+	status.SchemaValidRate = 0
+	status.AgreementRate = 0
+	if stats.Runs > 0 {
+		status.SchemaValidRate = int32(stats.SchemaValid * 100 / stats.Runs)
+		status.AgreementRate = int32(stats.Agreed * 100 / stats.Runs)
+	}
+	status.Latency = stats.P95Latency.String()
+	return nil
+}
+
+func describeMismatches(mismatches []liveness.CapabilityMismatch) string {
+	parts := make([]string, 0, len(mismatches))
+	for _, m := range mismatches {
+		var diffs []string
+		if len(m.Missing) > 0 {
+			diffs = append(diffs, "missing "+strings.Join(m.Missing, ", "))
+		}
+		if len(m.Extra) > 0 {
+			diffs = append(diffs, "undeclared "+strings.Join(m.Extra, ", "))
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", m.AgentID, strings.Join(diffs, "; ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// podToAgentInstance maps an agent pod to its AgentInstance
+func podToAgentInstance(ctx context.Context, obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[liveness.InstanceLabel]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
+
+// SetupWithManager sets up the controller with the Manager. Status updates
+// do not trigger reconciles; annotations do, as they promote rollouts.
+// Secrets are watched by metadata only, and pods are only cached with the
+// instance label when the manager is created with CacheOptions.
 func (r *AgentInstanceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Registry == nil {
+		r.Registry = liveness.NewRegistry()
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&loopstacksv1.AgentInstance{}).
+		For(&loopstacksv1.AgentInstance{}, builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.ConfigMap{}).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(podToAgentInstance)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.secretToAgentInstances), builder.OnlyMetadata).
 		Complete(r)
-}
\ No newline at end of file
+}
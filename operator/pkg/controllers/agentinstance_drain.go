@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/conditions"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/liveness"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// Annotations the Agent controller sets on the AgentInstances of a deleted
+// Agent, following its deletion policy
+const (
+	// DrainingAnnotation stops the pods of an AgentInstance, which finish
+	// their loops, before the AgentInstance is deleted
+	DrainingAnnotation = "loopstacks.io/draining"
+	// OrphanedAnnotation marks an AgentInstance whose Agent was deleted
+	// with its pods left running. It is removed when an Agent of the same
+	// name is created.
+	OrphanedAnnotation = "loopstacks.io/orphaned"
+)
+
+// drainInterval is how often draining AgentInstances are rechecked
+const drainInterval = 5 * time.Second
+
+// drain scales the Deployments of a draining AgentInstance to zero. Their
+// pods stop bidding and finish the loops they are executing; the instance
+// is Drained once no pod runs and its agents report no active loops.
+func (r *AgentInstanceReconciler) drain(ctx context.Context, log logr.Logger, instance, before *loopstacksv1.AgentInstance) (ctrl.Result, error) {
+	var deployments appsv1.DeploymentList
+	if err := r.List(ctx, &deployments, client.InNamespace(instance.Namespace), client.MatchingLabels{liveness.InstanceLabel: instance.Name}); err != nil {
+		log.Error(err, "Failed to list Deployments")
+		return ctrl.Result{}, err
+	}
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		if !metav1.IsControlledBy(deployment, instance) {
+			continue
+		}
+		if err := r.syncDeployment(ctx, deployment, 0, deployment.Spec.Strategy); err != nil {
+			log.Error(err, "Failed to scale down Deployment")
+			return ctrl.Result{}, err
+		}
+	}
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(instance.Namespace), client.MatchingLabels{liveness.InstanceLabel: instance.Name}); err != nil {
+		log.Error(err, "Failed to list pods")
+		return ctrl.Result{}, err
+	}
+	// Without its Realm, only pods are waited for
+	var heartbeats []protocol.Heartbeat
+	realm := &loopstacksv1.Realm{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: instance.Spec.Realm}, realm)
+	if err == nil {
+		heartbeats, err = r.Registry.Agents(ctx, realm)
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Error(err, "Failed to read agent registrations", "realm", instance.Spec.Realm)
+		return ctrl.Result{}, err
+	}
+	report := liveness.Evaluate(pods.Items, heartbeats, nil, time.Now(), liveness.DefaultStartupGrace)
+
+	status := &instance.Status
+	status.CurrentReplicas = report.Running
+	status.ReadyReplicas = report.Registered
+	status.ActiveLoops = report.ActiveLoops
+	status.ObservedGeneration = instance.Generation
+	status.Phase = "Drained"
+	status.Message = "Agent pods stopped with their loops finished"
+	reason := ReasonDrained
+	if report.Running > 0 || report.ActiveLoops > 0 {
+		status.Phase = "Draining"
+		reason = ReasonDraining
+		status.Message = fmt.Sprintf("Waiting for %d running pods to stop and %d active loops to finish", report.Running, report.ActiveLoops)
+	}
+	transitioned := conditions.False(&status.Conditions, instance.Generation, conditions.Ready, reason, status.Message)
+	if _, err := patchStatus(ctx, r.Client, instance, before, &instance.Status, &before.Status); err != nil {
+		log.Error(err, "Failed to update AgentInstance status")
+		return requeueOnConflict(ctrl.Result{}, err)
+	}
+	if transitioned {
+		r.Recorder.Event(instance, corev1.EventTypeNormal, reason, status.Message)
+	}
+	if reason == ReasonDrained {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: drainInterval}, nil
+}
+
+// drained reports whether a draining AgentInstance may be deleted
+func drained(instance *loopstacksv1.AgentInstance) bool {
+	_, draining := instance.Annotations[DrainingAnnotation]
+	return draining && instance.Status.Phase == "Drained"
+}
+
+// adopt removes the OrphanedAnnotation of an AgentInstance whose Agent was
+// created again
+func (r *AgentInstanceReconciler) adopt(ctx context.Context, instance *loopstacksv1.AgentInstance) error {
+	patch := client.MergeFrom(instance.DeepCopy())
+	delete(instance.Annotations, OrphanedAnnotation)
+	return r.Patch(ctx, instance, patch)
+}
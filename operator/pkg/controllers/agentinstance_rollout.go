@@ -0,0 +1,368 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/liveness"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/rollout"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workload"
+)
+
+// The stable Deployment of an AgentInstance has the AgentInstance's name.
+// BlueGreen and Canary rollouts start the new revision in a candidate
+// Deployment named after the AgentInstance and the revision, and promote it
+// by moving the stable Deployment to the revision once loops are routed to
+// the candidate.
+
+// reconcileRollout deploys the revision of template according to the
+// AgentInstance's rollout strategy and records its progress in the rollout
+// status
+func (r *AgentInstanceReconciler) reconcileRollout(ctx context.Context, log logr.Logger, instance *loopstacksv1.AgentInstance, template corev1.PodTemplateSpec) error {
+	revision := workload.Revision(template)
+	status := &instance.Status.Rollout
+
+	stable := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}, stable)
+	if apierrors.IsNotFound(err) {
+		if err := r.createDeployment(ctx, instance, instance.Name, revision, template, instance.Spec.Replicas); err != nil {
+			return err
+		}
+		log.Info("Created agent Deployment", "revision", revision)
+		now := metav1.NewTime(time.Now())
+		*status = loopstacksv1.AgentInstanceRolloutStatus{
+			StableRevision: revision,
+			UpdateRevision: revision,
+			Phase:          rollout.PhaseProgressing,
+			Message:        fmt.Sprintf("Starting pods of revision %s", revision),
+			StartTime:      &now,
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get Deployment: %w", err)
+	}
+
+	if workload.TemplateRevision(stable) == revision {
+		return r.settle(ctx, log, instance, stable, revision)
+	}
+
+	switch instance.Spec.Rollout.Strategy {
+	case rollout.BlueGreen, rollout.Canary:
+		return r.rolloutCandidate(ctx, log, instance, stable, revision, template)
+	default:
+		desired := workload.Deployment(instance, instance.Name, revision, template, instance.Spec.Replicas)
+		stable.Spec.Template = desired.Spec.Template
+		stable.Spec.Replicas = desired.Spec.Replicas
+		stable.Spec.Strategy = deploymentStrategy(instance)
+		if err := r.Update(ctx, stable); err != nil {
+			return fmt.Errorf("failed to update Deployment: %w", err)
+		}
+		log.Info("Rolling update started", "revision", revision)
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, ReasonRolloutStarted, "Rolling update to revision %s started", revision)
+		r.startRollout(instance, revision)
+		status.Message = fmt.Sprintf("Replacing pods with revision %s", revision)
+		return nil
+	}
+}
+
+// settle brings the rollout to completion once the stable Deployment runs
+// revision, removing candidate Deployments when its pods are available
+func (r *AgentInstanceReconciler) settle(ctx context.Context, log logr.Logger, instance *loopstacksv1.AgentInstance, stable *appsv1.Deployment, revision string) error {
+	status := &instance.Status.Rollout
+	if err := r.syncDeployment(ctx, stable, instance.Spec.Replicas, deploymentStrategy(instance)); err != nil {
+		return err
+	}
+
+	if !rolledOut(stable) {
+		if status.Phase != rollout.PhasePromoting {
+			if status.UpdateRevision != revision {
+				r.startRollout(instance, revision)
+			}
+			status.Phase = rollout.PhaseProgressing
+			status.Message = fmt.Sprintf("%d of %d pods run revision %s", stable.Status.UpdatedReplicas, instance.Spec.Replicas, revision)
+		}
+		return nil
+	}
+
+	if err := r.deleteCandidates(ctx, instance, ""); err != nil {
+		return err
+	}
+	if status.Phase != rollout.PhaseCompleted || status.StableRevision != revision {
+		log.Info("Rollout completed", "revision", revision)
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, ReasonRolloutCompleted, "All pods run revision %s", revision)
+	}
+	status.StableRevision = revision
+	status.UpdateRevision = revision
+	status.Phase = rollout.PhaseCompleted
+	status.Weight = 0
+	status.Message = fmt.Sprintf("All pods run revision %s", revision)
+	return nil
+}
+
+// rolloutCandidate runs revision in a candidate Deployment next to the
+// stable one and promotes or rolls it back
+func (r *AgentInstanceReconciler) rolloutCandidate(ctx context.Context, log logr.Logger, instance *loopstacksv1.AgentInstance, stable *appsv1.Deployment, revision string, template corev1.PodTemplateSpec) error {
+	status := &instance.Status.Rollout
+	strategy := instance.Spec.Rollout.Strategy
+	name := instance.Name + "-" + revision
+
+	if err := r.syncDeployment(ctx, stable, instance.Spec.Replicas, stable.Spec.Strategy); err != nil {
+		return err
+	}
+
+	if status.UpdateRevision == revision && status.Phase == rollout.PhaseRolledBack {
+		return r.deleteCandidates(ctx, instance, "")
+	}
+	if status.UpdateRevision != revision {
+		log.Info("Rollout started", "strategy", strategy, "revision", revision, "stableRevision", workload.TemplateRevision(stable))
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, ReasonRolloutStarted, "%s rollout of revision %s started", strategy, revision)
+		r.startRollout(instance, revision)
+		status.StableRevision = workload.TemplateRevision(stable)
+	}
+	if err := r.deleteCandidates(ctx, instance, name); err != nil {
+		return err
+	}
+
+	replicas := instance.Spec.Replicas
+	if strategy == rollout.Canary {
+		replicas = instance.Spec.Rollout.Canary.Replicas
+		if replicas <= 0 {
+			replicas = rollout.DefaultCanaryReplicas
+		}
+	}
+
+	candidate := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: name}, candidate)
+	if apierrors.IsNotFound(err) {
+		if err := r.createDeployment(ctx, instance, name, revision, template, replicas); err != nil {
+			return err
+		}
+		status.Phase = rollout.PhaseProgressing
+		status.Message = fmt.Sprintf("Starting pods of revision %s", revision)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get Deployment %s: %w", name, err)
+	}
+	if err := r.syncDeployment(ctx, candidate, replicas, candidate.Spec.Strategy); err != nil {
+		return err
+	}
+
+	if !rolledOut(candidate) {
+		status.Phase = rollout.PhaseProgressing
+		status.Weight = 0
+		status.Message = fmt.Sprintf("%d of %d pods of revision %s are available", candidate.Status.AvailableReplicas, replicas, revision)
+		return nil
+	}
+
+	if rollout.Promoted(instance, revision) || (strategy == rollout.BlueGreen && instance.Spec.Rollout.BlueGreen.AutoPromote) {
+		return r.promote(ctx, log, instance, stable, revision, template)
+	}
+
+	if strategy == rollout.BlueGreen {
+		status.Phase = rollout.PhasePaused
+		status.Weight = 0
+		status.Message = fmt.Sprintf("Revision %s is ready; annotate with %s=%s to switch loops to it", revision, rollout.PromoteAnnotation, revision)
+		return nil
+	}
+	return r.analyze(ctx, log, instance, stable, revision, template)
+}
+
+// analyze routes loops to a canary and judges it by its execution stats
+func (r *AgentInstanceReconciler) analyze(ctx context.Context, log logr.Logger, instance *loopstacksv1.AgentInstance, stable *appsv1.Deployment, revision string, template corev1.PodTemplateSpec) error {
+	status := &instance.Status.Rollout
+	canary := instance.Spec.Rollout.Canary
+
+	now := time.Now()
+	if status.Analysis.StartTime == nil {
+		start := metav1.NewTime(now)
+		status.Analysis.StartTime = &start
+	}
+	status.Phase = rollout.PhaseAnalyzing
+	status.Weight = canary.Weight
+	if status.Weight <= 0 {
+		status.Weight = rollout.DefaultCanaryWeight
+	}
+
+	if r.History == nil {
+		status.Message = fmt.Sprintf("Execution history is not configured; annotate with %s=%s to promote revision %s", rollout.PromoteAnnotation, revision, revision)
+		return nil
+	}
+
+	stats, err := r.History.AgentStats(ctx, history.AgentStatsQuery{
+		Namespace:     instance.Namespace,
+		AgentInstance: instance.Name,
+		Revision:      revision,
+		Since:         status.Analysis.StartTime.Time,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read canary execution stats: %w", err)
+	}
+	status.Analysis.Executions = int32(stats.Runs)
+	status.Analysis.Failures = int32(stats.Failures)
+	status.Analysis.Latency = stats.P95Latency.String()
+
+	verdict, reason, err := rollout.Analyze(canary, stats, status.Analysis.StartTime.Time, now)
+	if err != nil {
+		status.Message = err.Error()
+		return nil
+	}
+	switch verdict {
+	case rollout.Promote:
+		log.Info("Canary passed analysis", "revision", revision, "reason", reason)
+		return r.promote(ctx, log, instance, stable, revision, template)
+	case rollout.Rollback:
+		if err := r.deleteCandidates(ctx, instance, ""); err != nil {
+			return err
+		}
+		log.Info("Canary rolled back", "revision", revision, "reason", reason)
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, ReasonRolledBack, "Canary of revision %s rolled back: %s", revision, reason)
+		status.Phase = rollout.PhaseRolledBack
+		status.Weight = 0
+		status.Message = reason + "; change the AgentInstance to roll out another revision"
+	default:
+		status.Message = reason
+	}
+	return nil
+}
+
+// promote routes all loops to revision and moves the stable Deployment to
+// it. The candidate is removed by settle once the stable pods are replaced.
+func (r *AgentInstanceReconciler) promote(ctx context.Context, log logr.Logger, instance *loopstacksv1.AgentInstance, stable *appsv1.Deployment, revision string, template corev1.PodTemplateSpec) error {
+	desired := workload.Deployment(instance, instance.Name, revision, template, instance.Spec.Replicas)
+	stable.Spec.Template = desired.Spec.Template
+	if err := r.Update(ctx, stable); err != nil {
+		return fmt.Errorf("failed to update Deployment: %w", err)
+	}
+	log.Info("Promoted revision", "revision", revision)
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, ReasonPromoted, "Promoted revision %s", revision)
+
+	status := &instance.Status.Rollout
+	status.Phase = rollout.PhasePromoting
+	status.Weight = 100
+	status.Message = fmt.Sprintf("Routing all loops to revision %s while the stable pods are replaced", revision)
+	return nil
+}
+
+// startRollout resets the rollout status for a new revision
+func (r *AgentInstanceReconciler) startRollout(instance *loopstacksv1.AgentInstance, revision string) {
+	now := metav1.NewTime(time.Now())
+	instance.Status.Rollout = loopstacksv1.AgentInstanceRolloutStatus{
+		StableRevision: instance.Status.Rollout.StableRevision,
+		UpdateRevision: revision,
+		Phase:          rollout.PhaseProgressing,
+		StartTime:      &now,
+	}
+}
+
+func (r *AgentInstanceReconciler) createDeployment(ctx context.Context, instance *loopstacksv1.AgentInstance, name, revision string, template corev1.PodTemplateSpec, replicas int32) error {
+	deployment := workload.Deployment(instance, name, revision, template, replicas)
+	if name == instance.Name {
+		deployment.Spec.Strategy = deploymentStrategy(instance)
+	}
+	if err := ctrl.SetControllerReference(instance, deployment, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, deployment); err != nil {
+		return fmt.Errorf("failed to create Deployment %s: %w", name, err)
+	}
+	return nil
+}
+
+// syncDeployment updates the replicas and strategy of a Deployment when
+// they changed
+func (r *AgentInstanceReconciler) syncDeployment(ctx context.Context, deployment *appsv1.Deployment, replicas int32, strategy appsv1.DeploymentStrategy) error {
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == replicas &&
+		deployment.Spec.Strategy.Type == strategy.Type && equalRollingUpdate(deployment.Spec.Strategy.RollingUpdate, strategy.RollingUpdate) {
+		return nil
+	}
+	deployment.Spec.Replicas = &replicas
+	deployment.Spec.Strategy = strategy
+	if err := r.Update(ctx, deployment); err != nil {
+		return fmt.Errorf("failed to update Deployment %s: %w", deployment.Name, err)
+	}
+	return nil
+}
+
+// deleteCandidates deletes the candidate Deployments of an AgentInstance
+// except keep
+func (r *AgentInstanceReconciler) deleteCandidates(ctx context.Context, instance *loopstacksv1.AgentInstance, keep string) error {
+	var deployments appsv1.DeploymentList
+	if err := r.List(ctx, &deployments, client.InNamespace(instance.Namespace), client.MatchingLabels{liveness.InstanceLabel: instance.Name}); err != nil {
+		return fmt.Errorf("failed to list Deployments: %w", err)
+	}
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		if deployment.Name == instance.Name || deployment.Name == keep || !metav1.IsControlledBy(deployment, instance) {
+			continue
+		}
+		if err := r.Delete(ctx, deployment); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("failed to delete Deployment %s: %w", deployment.Name, err)
+		}
+	}
+	return nil
+}
+
+// defaultSurge is the Deployment default of maxSurge and maxUnavailable
+var defaultSurge = intstr.FromString("25%")
+
+// deploymentStrategy is the strategy of the stable Deployment, which
+// RollingUpdate rollouts update in place. Unset limits take the Deployment
+// defaults, so that the strategy compares equal to the stored one.
+func deploymentStrategy(instance *loopstacksv1.AgentInstance) appsv1.DeploymentStrategy {
+	update := instance.Spec.Rollout.RollingUpdate
+	strategy := appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       update.MaxSurge,
+			MaxUnavailable: update.MaxUnavailable,
+		},
+	}
+	if strategy.RollingUpdate.MaxSurge == nil {
+		strategy.RollingUpdate.MaxSurge = &defaultSurge
+	}
+	if strategy.RollingUpdate.MaxUnavailable == nil {
+		strategy.RollingUpdate.MaxUnavailable = &defaultSurge
+	}
+	return strategy
+}
+
+func equalRollingUpdate(a, b *appsv1.RollingUpdateDeployment) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return equalIntOrString(a.MaxSurge, b.MaxSurge) && equalIntOrString(a.MaxUnavailable, b.MaxUnavailable)
+}
+
+func equalIntOrString(a, b *intstr.IntOrString) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// rolledOut reports whether all pods of a Deployment run its template and
+// are available
+func rolledOut(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	s := deployment.Status
+	return s.ObservedGeneration >= deployment.Generation &&
+		s.UpdatedReplicas == replicas && s.Replicas == replicas && s.AvailableReplicas == replicas
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/conditions"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workload"
+)
+
+// ConditionSecretsAvailable is true when every Secret key read by the
+// AgentInstance's pods exists
+const ConditionSecretsAvailable = "SecretsAvailable"
+
+// resolveSecrets reads the Secrets referenced by the AgentInstance's pods.
+// It describes the missing ones and hashes the content of the others
+// whose change rolls out a new revision: all of them, except Secrets
+// mounted next to the config under the HotReload strategy. The hash is
+// empty when there is no such content.
+func (r *AgentInstanceReconciler) resolveSecrets(ctx context.Context, agent *loopstacksv1.Agent, instance *loopstacksv1.AgentInstance) ([]string, string, error) {
+	var missing []string
+	hashed := false
+	hash := fnv.New32a()
+	secrets := make(map[string]*corev1.Secret)
+	for _, ref := range workload.SecretReferences(agent, instance) {
+		secret, ok := secrets[ref.Name]
+		if !ok {
+			secret = &corev1.Secret{}
+			if err := r.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: ref.Name}, secret); err != nil {
+				if !apierrors.IsNotFound(err) {
+					return nil, "", fmt.Errorf("failed to get Secret %s: %w", ref.Name, err)
+				}
+				secret = nil
+			}
+			secrets[ref.Name] = secret
+		}
+
+		switch {
+		case secret == nil:
+			if !ref.Optional {
+				missing = append(missing, fmt.Sprintf("Secret %s not found", ref.Name))
+			}
+			continue
+		case ref.Key != "":
+			if _, ok := secret.Data[ref.Key]; !ok && !ref.Optional {
+				missing = append(missing, fmt.Sprintf("Secret %s has no key %s", ref.Name, ref.Key))
+				continue
+			}
+		}
+		if ref.Mounted && instance.Spec.ConfigUpdate == workload.ConfigHotReload {
+			continue
+		}
+
+		keys := []string{ref.Key}
+		if ref.Key == "" {
+			keys = make([]string, 0, len(secret.Data))
+			for key := range secret.Data {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+		}
+		hashed = true
+		for _, key := range keys {
+			fmt.Fprintf(hash, "%s/%s=", ref.Name, key)
+			hash.Write(secret.Data[key])
+			hash.Write([]byte{0})
+		}
+	}
+	if !hashed {
+		return slices.Compact(missing), "", nil
+	}
+	return slices.Compact(missing), rand.SafeEncodeString(fmt.Sprint(hash.Sum32())), nil
+}
+
+// setSecretsCondition reports missing Secrets
+func setSecretsCondition(instance *loopstacksv1.AgentInstance, missing []string) {
+	if len(missing) > 0 {
+		conditions.False(&instance.Status.Conditions, instance.Generation, ConditionSecretsAvailable, "SecretMissing", strings.Join(missing, "; "))
+		return
+	}
+	conditions.True(&instance.Status.Conditions, instance.Generation, ConditionSecretsAvailable, "SecretsFound", "All referenced Secrets exist")
+}
+
+// secretToAgentInstances maps a Secret to the AgentInstances whose pods
+// read it, directly or through their Agent
+func (r *AgentInstanceReconciler) secretToAgentInstances(ctx context.Context, obj client.Object) []reconcile.Request {
+	instances, err := listAgentInstances(ctx, r, obj.GetNamespace(), AgentInstanceSecretField, obj.GetName())
+	if err != nil {
+		r.Log.Error(err, "Failed to list AgentInstances", "secret", obj.GetName())
+		return nil
+	}
+	var agents loopstacksv1.AgentList
+	if err := r.List(ctx, &agents, client.InNamespace(obj.GetNamespace()), client.MatchingFields{AgentSecretField: obj.GetName()}); err != nil {
+		r.Log.Error(err, "Failed to list Agents", "secret", obj.GetName())
+		return nil
+	}
+	for _, agent := range agents.Items {
+		deployed, err := listAgentInstances(ctx, r, obj.GetNamespace(), AgentInstanceAgentField, agent.Name)
+		if err != nil {
+			r.Log.Error(err, "Failed to list AgentInstances", "secret", obj.GetName(), "agent", agent.Name)
+			return nil
+		}
+		instances = append(instances, deployed...)
+	}
+
+	requests := make([]reconcile.Request, 0, len(instances))
+	for i := range instances {
+		request := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&instances[i])}
+		if !slices.Contains(requests, request) {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
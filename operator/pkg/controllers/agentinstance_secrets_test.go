@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workload"
+)
+
+func secret(name string, data map[string]string) *corev1.Secret {
+	s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}, Data: map[string][]byte{}}
+	for key, value := range data {
+		s.Data[key] = []byte(value)
+	}
+	return s
+}
+
+func secretKeyRef(name, key string) corev1.SecretKeySelector {
+	return corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+}
+
+// secretsAgent reads the openai key of model-keys and every key of
+// shared-env
+func secretsAgent() *loopstacksv1.Agent {
+	agent := &loopstacksv1.Agent{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "support-agent"}}
+	agent.Spec.Runtime.SecretRefs = []loopstacksv1.SecretRef{{Env: "OPENAI_API_KEY", SecretKeyRef: secretKeyRef("model-keys", "openai")}}
+	agent.Spec.Runtime.EnvFrom = []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "shared-env"}}}}
+	return agent
+}
+
+// secretsInstance mounts the search token of search-keys next to its config
+func secretsInstance(strategy string) *loopstacksv1.AgentInstance {
+	instance := &loopstacksv1.AgentInstance{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "support-prod"}}
+	instance.Spec.Agent = "support-agent"
+	instance.Spec.ConfigUpdate = strategy
+	instance.Spec.ConfigSecrets = []loopstacksv1.AgentInstanceConfigSecret{{Name: "search-token", SecretKeyRef: secretKeyRef("search-keys", "token")}}
+	return instance
+}
+
+func TestResolveSecrets(t *testing.T) {
+	ctx := context.Background()
+	resolve := func(strategy string, secrets ...client.Object) ([]string, string) {
+		t.Helper()
+		r := &AgentInstanceReconciler{Client: newTestClient(t, secrets...), Log: logr.Discard()}
+		missing, hash, err := r.resolveSecrets(ctx, secretsAgent(), secretsInstance(strategy))
+		if err != nil {
+			t.Fatalf("resolveSecrets() error = %v", err)
+		}
+		return missing, hash
+	}
+	modelKeys := secret("model-keys", map[string]string{"openai": "sk-1", "anthropic": "sk-2"})
+	sharedEnv := secret("shared-env", map[string]string{"LOG_LEVEL": "info", "REGION": "us"})
+	searchKeys := secret("search-keys", map[string]string{"token": "t-1"})
+
+	missing, base := resolve(workload.ConfigRestart, modelKeys, sharedEnv, searchKeys)
+	if len(missing) != 0 || base == "" {
+		t.Fatalf("resolveSecrets() = %v, %q, want a hash and nothing missing", missing, base)
+	}
+	if _, again := resolve(workload.ConfigRestart, modelKeys, sharedEnv, searchKeys); again != base {
+		t.Errorf("hash of the same Secrets = %q, want %q", again, base)
+	}
+
+	tests := []struct {
+		name    string
+		secrets []client.Object
+		changed bool
+	}{
+		{
+			name:    "referenced key changed",
+			secrets: []client.Object{secret("model-keys", map[string]string{"openai": "sk-9", "anthropic": "sk-2"}), sharedEnv, searchKeys},
+			changed: true,
+		},
+		{
+			name:    "unreferenced key changed",
+			secrets: []client.Object{secret("model-keys", map[string]string{"openai": "sk-1", "anthropic": "sk-9"}), sharedEnv, searchKeys},
+		},
+		{
+			name:    "key of an envFrom Secret added",
+			secrets: []client.Object{modelKeys, secret("shared-env", map[string]string{"LOG_LEVEL": "info", "REGION": "us", "DEBUG": "1"}), searchKeys},
+			changed: true,
+		},
+		{
+			name:    "mounted key changed",
+			secrets: []client.Object{modelKeys, sharedEnv, secret("search-keys", map[string]string{"token": "t-2"})},
+			changed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, hash := resolve(workload.ConfigRestart, tt.secrets...)
+			if changed := hash != base; changed != tt.changed {
+				t.Errorf("hash = %q, base %q: changed = %v, want %v", hash, base, changed, tt.changed)
+			}
+		})
+	}
+
+	// Under HotReload the mounted Secret is updated in place rather than
+	// rolled out
+	_, hotReload := resolve(workload.ConfigHotReload, modelKeys, sharedEnv, searchKeys)
+	if _, updated := resolve(workload.ConfigHotReload, modelKeys, sharedEnv, secret("search-keys", map[string]string{"token": "t-2"})); updated != hotReload {
+		t.Errorf("hash after a mounted key changed under HotReload = %q, want %q", updated, hotReload)
+	}
+
+	missing, _ = resolve(workload.ConfigRestart, secret("model-keys", map[string]string{"anthropic": "sk-2"}), searchKeys)
+	want := []string{"Secret model-keys has no key openai", "Secret shared-env not found"}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("missing = %v, want %v", missing, want)
+	}
+}
+
+func TestSecretToAgentInstances(t *testing.T) {
+	agent := secretsAgent()
+	other := &loopstacksv1.Agent{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "billing-agent"}}
+	prod := secretsInstance(workload.ConfigRestart)
+	staging := secretsInstance(workload.ConfigRestart)
+	staging.Name = "support-staging"
+	staging.Spec.ConfigSecrets = nil
+	billing := &loopstacksv1.AgentInstance{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "billing-prod"}}
+	billing.Spec.Agent = "billing-agent"
+	billing.Spec.EnvFrom = []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "model-keys"}}}}
+
+	r := &AgentInstanceReconciler{Client: newTestClient(t, agent, other, prod, staging, billing), Log: logr.Discard()}
+	tests := []struct {
+		secret string
+		want   []string
+	}{
+		{secret: "model-keys", want: []string{"billing-prod", "support-prod", "support-staging"}},
+		{secret: "shared-env", want: []string{"support-prod", "support-staging"}},
+		{secret: "search-keys", want: []string{"support-prod"}},
+		{secret: "unused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.secret, func(t *testing.T) {
+			var got []string
+			for _, req := range r.secretToAgentInstances(context.Background(), secret(tt.secret, nil)) {
+				got = append(got, req.Name)
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("secretToAgentInstances(%s) = %v, want %v", tt.secret, got, tt.want)
+			}
+		})
+	}
+}
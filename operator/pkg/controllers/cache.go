@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/liveness"
+)
+
+// CacheOptions keeps the manager's cache to the pods and ConfigMaps of
+// AgentInstances, rather than every pod and ConfigMap in the cluster
+func CacheOptions() cache.Options {
+	requirement, err := labels.NewRequirement(liveness.InstanceLabel, selection.Exists, nil)
+	if err != nil {
+		panic(err)
+	}
+	instanceObjects := cache.ByObject{Label: labels.NewSelector().Add(*requirement)}
+
+	return cache.Options{
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.Pod{}:       instanceObjects,
+			&corev1.ConfigMap{}: instanceObjects,
+		},
+	}
+}
+
+// ClientOptions reads Secrets from the API server. The AgentInstance
+// controller watches only their metadata, so a cached read would start an
+// informer holding the content of every Secret in the cluster.
+func ClientOptions() client.Options {
+	return client.Options{
+		Cache: &client.CacheOptions{DisableFor: []client.Object{&corev1.Secret{}}},
+	}
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workload"
+)
+
+// Cache indexes of AgentInstances, for listing the instances of an Agent
+// or Realm, or that read a Secret, with client.MatchingFields
+const (
+	AgentInstanceAgentField  = "spec.agent"
+	AgentInstanceRealmField  = "spec.realm"
+	AgentInstanceSecretField = "secrets"
+)
+
+// AgentSecretField indexes Agents by the Secrets their runtime reads
+const AgentSecretField = "secrets"
+
+// SetupIndexes registers the cache indexes the controllers list with. It
+// must be called once, before the manager starts.
+func SetupIndexes(ctx context.Context, mgr ctrl.Manager) error {
+	indexer := mgr.GetFieldIndexer()
+	if err := indexer.IndexField(ctx, &loopstacksv1.AgentInstance{}, AgentInstanceAgentField, func(obj client.Object) []string {
+		return []string{obj.(*loopstacksv1.AgentInstance).Spec.Agent}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &loopstacksv1.AgentInstance{}, AgentInstanceRealmField, func(obj client.Object) []string {
+		return []string{obj.(*loopstacksv1.AgentInstance).Spec.Realm}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(ctx, &loopstacksv1.AgentInstance{}, AgentInstanceSecretField, agentInstanceSecrets); err != nil {
+		return err
+	}
+	return indexer.IndexField(ctx, &loopstacksv1.Agent{}, AgentSecretField, agentSecrets)
+}
+
+// agentInstanceSecrets names the Secrets an AgentInstance reads itself,
+// besides those of its Agent
+func agentInstanceSecrets(obj client.Object) []string {
+	return secretNames(workload.SecretReferences(&loopstacksv1.Agent{}, obj.(*loopstacksv1.AgentInstance)))
+}
+
+// agentSecrets names the Secrets the runtime of an Agent reads
+func agentSecrets(obj client.Object) []string {
+	return secretNames(workload.SecretReferences(obj.(*loopstacksv1.Agent), &loopstacksv1.AgentInstance{}))
+}
+
+func secretNames(references []workload.SecretReference) []string {
+	names := make([]string, 0, len(references))
+	for _, ref := range references {
+		names = append(names, ref.Name)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// listAgentInstances lists the AgentInstances in namespace whose field,
+// one of the AgentInstance indexes, is value
+func listAgentInstances(ctx context.Context, c client.Reader, namespace, field, value string) ([]loopstacksv1.AgentInstance, error) {
+	var instances loopstacksv1.AgentInstanceList
+	if err := c.List(ctx, &instances, client.InNamespace(namespace), client.MatchingFields{field: value}); err != nil {
+		return nil, err
+	}
+	return instances.Items, nil
+}
+
+// agentInstanceToAgent maps an AgentInstance to the Agent it deploys
+func agentInstanceToAgent(ctx context.Context, obj client.Object) []reconcile.Request {
+	instance := obj.(*loopstacksv1.AgentInstance)
+	if instance.Spec.Agent == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: instance.Namespace, Name: instance.Spec.Agent}}}
+}
+
+// agentInstanceToRealm maps an AgentInstance to the Realm it runs in
+func agentInstanceToRealm(ctx context.Context, obj client.Object) []reconcile.Request {
+	instance := obj.(*loopstacksv1.AgentInstance)
+	if instance.Spec.Realm == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: instance.Namespace, Name: instance.Spec.Realm}}}
+}
+
+// enqueueAgentInstanceOwner enqueues what mapFn maps an AgentInstance to.
+// On update it enqueues both the old and the new owner, so an Agent or
+// Realm an instance moved away from recounts it too.
+func enqueueAgentInstanceOwner(mapFn func(context.Context, client.Object) []reconcile.Request) handler.EventHandler {
+	enqueue := func(ctx context.Context, q workqueue.TypedRateLimitingInterface[reconcile.Request], objs ...client.Object) {
+		for _, obj := range objs {
+			for _, req := range mapFn(ctx, obj) {
+				q.Add(req)
+			}
+		}
+	}
+	return handler.TypedFuncs[client.Object, reconcile.Request]{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(ctx, q, e.Object)
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(ctx, q, e.ObjectOld, e.ObjectNew)
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(ctx, q, e.Object)
+		},
+		GenericFunc: func(ctx context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+			enqueue(ctx, q, e.Object)
+		},
+	}
+}
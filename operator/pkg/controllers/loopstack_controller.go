@@ -4,35 +4,86 @@ import (
 	"context"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/conditions"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workflow"
 )
 
 // LoopStackReconciler reconciles a LoopStack object
 type LoopStackReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=loopstacks.io,resources=loopstacks,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=loopstacks.io,resources=loopstacks/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=loopstacks.io,resources=loopstacks/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *LoopStackReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("loopstack", req.NamespacedName)
 	log.Info("Reconciling LoopStack")
 
-	// TODO: Implement loopstack reconciliation logic
+	// Fetch the LoopStack instance
+	loopStack := &loopstacksv1.LoopStack{}
+	err := r.Get(ctx, req.NamespacedName, loopStack)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("LoopStack resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get LoopStack")
+		return ctrl.Result{}, err
+	}
+
+	before := loopStack.DeepCopy()
+	loopStack.Status.ObservedGeneration = loopStack.Generation
+
+	// Validate the workflow steps, including their CEL conditions
+	if _, err := workflow.Compile(&loopStack.Spec); err != nil {
+		log.Error(err, "LoopStack workflow validation failed")
+		r.Recorder.Event(loopStack, corev1.EventTypeWarning, ReasonInvalidWorkflow, err.Error())
+		loopStack.Status.Phase = "Failed"
+		loopStack.Status.Message = err.Error()
+		conditions.False(&loopStack.Status.Conditions, loopStack.Generation, conditions.Ready, ReasonInvalidWorkflow, err.Error())
+		if _, err := patchStatus(ctx, r.Client, loopStack, before, &loopStack.Status, &before.Status); err != nil {
+			log.Error(err, "Failed to update LoopStack status")
+			return requeueOnConflict(ctrl.Result{}, err)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	loopStack.Status.Phase = "Ready"
+	loopStack.Status.Message = "LoopStack is ready for execution"
+	validated := conditions.True(&loopStack.Status.Conditions, loopStack.Generation, conditions.Ready, ReasonValidated, loopStack.Status.Message)
+	changed, err := patchStatus(ctx, r.Client, loopStack, before, &loopStack.Status, &before.Status)
+	if err != nil {
+		log.Error(err, "Failed to update LoopStack status")
+		return requeueOnConflict(ctrl.Result{}, err)
+	}
+	if validated {
+		r.Recorder.Event(loopStack, corev1.EventTypeNormal, ReasonValidated, loopStack.Status.Message)
+	}
+	if changed {
+		log.Info("LoopStack reconciled successfully")
+	}
 	return ctrl.Result{}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *LoopStackReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&loopstacksv1.LoopStack{}).
+		For(&loopstacksv1.LoopStack{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(r)
-}
\ No newline at end of file
+}
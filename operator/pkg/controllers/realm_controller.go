@@ -2,37 +2,239 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/conditions"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/federation"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/liveness"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/sharing"
 )
 
+// federationProbeInterval is how often federation peers are probed
+const federationProbeInterval = 30 * time.Second
+
+// federationProbeTimeout bounds a single peer probe
+const federationProbeTimeout = 10 * time.Second
+
 // RealmReconciler reconciles a Realm object
 type RealmReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Federation probes the federation endpoints of federated realms.
+	// Peer health is not reported when nil.
+	Federation *federation.Client
+
+	// Registry holds the connections to realms' coordination backends,
+	// which are closed when a realm is deleted or its coordination
+	// settings change
+	Registry *liveness.Registry
 }
 
 // +kubebuilder:rbac:groups=loopstacks.io,resources=realms,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=loopstacks.io,resources=realms/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=loopstacks.io,resources=realms/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 func (r *RealmReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("realm", req.NamespacedName)
 	log.Info("Reconciling Realm")
 
-	// TODO: Implement realm reconciliation logic
-	return ctrl.Result{}, nil
+	realm := &loopstacksv1.Realm{}
+	if err := r.Get(ctx, req.NamespacedName, realm); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("Realm resource not found. Ignoring since object must be deleted")
+			r.forgetBackend(log, req.Namespace, req.Name)
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Realm")
+		return ctrl.Result{}, err
+	}
+
+	if realm.DeletionTimestamp != nil {
+		r.forgetBackend(log, realm.Namespace, realm.Name)
+		return ctrl.Result{}, nil
+	}
+	if r.Registry != nil && r.Registry.Changed(realm) {
+		log.Info("Coordination settings changed, closing backend connection")
+		r.forgetBackend(log, realm.Namespace, realm.Name)
+	}
+
+	before := realm.DeepCopy()
+
+	var realms loopstacksv1.RealmList
+	if err := r.List(ctx, &realms); err != nil {
+		log.Error(err, "Failed to list Realms")
+		return ctrl.Result{}, err
+	}
+	imports := sharing.Resolve(realm, realms.Items)
+	realm.Status.Imports = imports
+
+	instances, err := listAgentInstances(ctx, r, realm.Namespace, AgentInstanceRealmField, realm.Name)
+	if err != nil {
+		log.Error(err, "Failed to list AgentInstances")
+		return ctrl.Result{}, err
+	}
+	agentInstances := int32(0)
+	for i := range instances {
+		if instances[i].DeletionTimestamp == nil {
+			agentInstances++
+		}
+	}
+	realm.Status.AgentInstances = agentInstances
+
+	result := ctrl.Result{}
+	if r.Federation != nil && federation.Enabled(realm) {
+		peers := r.probePeers(ctx, realm)
+		r.recordUnreachablePeers(realm, peers)
+		realm.Status.Federation = peers
+		result.RequeueAfter = federationProbeInterval
+	} else {
+		realm.Status.Federation = nil
+	}
+
+	message := fmt.Sprintf("%d capability imports resolved", len(imports))
+	realm.Status.Phase = "Active"
+	realm.Status.ObservedGeneration = realm.Generation
+	reconciled := conditions.True(&realm.Status.Conditions, realm.Generation, conditions.Ready, ReasonReconciled, message)
+
+	changed, err := patchStatus(ctx, r.Client, realm, before, &realm.Status, &before.Status)
+	if err != nil {
+		log.Error(err, "Failed to update Realm status")
+		return requeueOnConflict(result, err)
+	}
+	if reconciled {
+		r.Recorder.Event(realm, corev1.EventTypeNormal, ReasonReconciled, message)
+	}
+	if !changed {
+		return result, nil
+	}
+
+	healthy := 0
+	for _, peer := range realm.Status.Federation {
+		if peer.Healthy {
+			healthy++
+		}
+	}
+	log.Info("Realm reconciled successfully", "imports", len(imports), "agentInstances", agentInstances, "peers", len(realm.Status.Federation), "healthyPeers", healthy)
+	return result, nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// probePeers probes every federation endpoint of a realm at once. The
+// last healthy time of each endpoint carries over from the previous status.
+func (r *RealmReconciler) probePeers(ctx context.Context, realm *loopstacksv1.Realm) []loopstacksv1.FederationPeerStatus {
+	previous := make(map[string]loopstacksv1.FederationPeerStatus, len(realm.Status.Federation))
+	for _, peer := range realm.Status.Federation {
+		previous[peer.Endpoint] = peer
+	}
+
+	endpoints := realm.Spec.Networking.FederationEndpoints
+	peers := make([]loopstacksv1.FederationPeerStatus, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, federationProbeTimeout)
+			defer cancel()
+			info, err := r.Federation.Probe(probeCtx, endpoint)
+
+			now := metav1.NewTime(time.Now())
+			peer := loopstacksv1.FederationPeerStatus{
+				Endpoint:        endpoint,
+				LastProbeTime:   now,
+				LastHealthyTime: previous[endpoint].LastHealthyTime,
+			}
+			if err != nil {
+				peer.Message = err.Error()
+			} else {
+				peer.Healthy = true
+				peer.Agents = int32(info.Agents)
+				peer.LastHealthyTime = &now
+			}
+			peers[i] = peer
+		}()
+	}
+	wg.Wait()
+	return peers
+}
+
+// recordUnreachablePeers emits a warning for each peer that failed its
+// probe after being healthy or on its first probe
+func (r *RealmReconciler) recordUnreachablePeers(realm *loopstacksv1.Realm, peers []loopstacksv1.FederationPeerStatus) {
+	reachable := make(map[string]bool, len(realm.Status.Federation))
+	for _, peer := range realm.Status.Federation {
+		reachable[peer.Endpoint] = peer.Healthy
+	}
+	for _, peer := range peers {
+		if healthy, probed := reachable[peer.Endpoint]; peer.Healthy || (probed && !healthy) {
+			continue
+		}
+		r.Recorder.Eventf(realm, corev1.EventTypeWarning, ReasonPeerUnreachable, "Federation peer %s is unreachable: %s", peer.Endpoint, peer.Message)
+	}
+}
+
+// importersOf maps a Realm to the realms importing from it, whose effective
+// imports depend on its exports
+func (r *RealmReconciler) importersOf(ctx context.Context, obj client.Object) []reconcile.Request {
+	var realms loopstacksv1.RealmList
+	if err := r.List(ctx, &realms); err != nil {
+		r.Log.Error(err, "Failed to list Realms")
+		return nil
+	}
+
+	exporter := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	var requests []reconcile.Request
+	for i := range realms.Items {
+		if sharing.Imports(&realms.Items[i], exporter) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: realms.Items[i].Namespace,
+				Name:      realms.Items[i].Name,
+			}})
+		}
+	}
+	return requests
+}
+
+// forgetBackend closes the connection to a realm's coordination backend
+func (r *RealmReconciler) forgetBackend(log logr.Logger, namespace, name string) {
+	if r.Registry == nil {
+		return
+	}
+	if err := r.Registry.Forget(namespace, name); err != nil {
+		log.Error(err, "Failed to close coordination backend connection")
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager. Status updates
+// do not trigger reconciles; peers are probed on a timer instead, while
+// AgentInstances are counted as they come and go.
 func (r *RealmReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&loopstacksv1.Realm{}).
+		For(&loopstacksv1.Realm{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&loopstacksv1.Realm{}, handler.EnqueueRequestsFromMapFunc(r.importersOf),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&loopstacksv1.AgentInstance{}, enqueueAgentInstanceOwner(agentInstanceToRealm),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(r)
-}
\ No newline at end of file
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons of the events and condition transitions the controllers report.
+// They are stable so that alerts and tooling can match on them.
+const (
+	ReasonReconciling         = "Reconciling"
+	ReasonValidated           = "Validated"
+	ReasonReconciled          = "Reconciled"
+	ReasonInvalidRuntime      = "InvalidRuntime"
+	ReasonSchemaInvalid       = "SchemaInvalid"
+	ReasonInvalidWorkflow     = "InvalidWorkflow"
+	ReasonInstancesRemaining  = "InstancesRemaining"
+	ReasonDeletingInstances   = "DeletingInstances"
+	ReasonInstancesOrphaned   = "InstancesOrphaned"
+	ReasonDraining            = "Draining"
+	ReasonDrained             = "Drained"
+	ReasonOrphaned            = "Orphaned"
+	ReasonAgentNotFound       = "AgentNotFound"
+	ReasonRealmNotFound       = "RealmNotFound"
+	ReasonInvalidConfig       = "InvalidConfig"
+	ReasonSecretMissing       = "SecretMissing"
+	ReasonQuotaExceeded       = "QuotaExceeded"
+	ReasonInvalidPodTemplate  = "InvalidPodTemplate"
+	ReasonRegistryUnavailable = "RegistryUnavailable"
+	ReasonAgentsRegistered    = "AgentsRegistered"
+	ReasonRolloutStarted      = "RolloutStarted"
+	ReasonRolloutCompleted    = "RolloutCompleted"
+	ReasonPromoted            = "Promoted"
+	ReasonRolledBack          = "RolledBack"
+	ReasonPeerUnreachable     = "PeerUnreachable"
+)
+
+// ReasonError is an error reported under a stable reason
+type ReasonError struct {
+	Reason string
+	Err    error
+}
+
+func (e *ReasonError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ReasonError) Unwrap() error {
+	return e.Err
+}
+
+// reasonf formats an error like fmt.Errorf and attaches reason to it
+func reasonf(reason, format string, args ...interface{}) error {
+	return &ReasonError{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// ReasonOf returns the reason of the first ReasonError in err's chain, or
+// fallback when there is none
+func ReasonOf(err error, fallback string) string {
+	var reasonErr *ReasonError
+	if errors.As(err, &reasonErr) {
+		return reasonErr.Reason
+	}
+	return fallback
+}
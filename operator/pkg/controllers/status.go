@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// objectStatus is the status of an object, which records when it last changed
+type objectStatus interface {
+	GetLastUpdated() metav1.Time
+	SetLastUpdated(metav1.Time)
+}
+
+// patchStatus writes status, reconciled into obj, with a single merge patch
+// against before, a copy of obj taken when it was read, whose status is
+// previous. It writes nothing and reports false when the status is
+// unchanged; otherwise the status's LastUpdated is set to now, so
+// reconcilers leave it alone.
+//
+// The patch carries obj's resourceVersion: a status computed from a stale
+// read fails with a conflict rather than overwriting a newer one.
+func patchStatus(ctx context.Context, c client.Client, obj, before client.Object, status, previous objectStatus) (bool, error) {
+	status.SetLastUpdated(previous.GetLastUpdated())
+	if equality.Semantic.DeepEqual(status, previous) {
+		return false, nil
+	}
+	status.SetLastUpdated(metav1.NewTime(time.Now()))
+	return true, c.Status().Patch(ctx, obj, client.MergeFromWithOptions(before, client.MergeFromWithOptimisticLock{}))
+}
+
+// conflictRequeueDelay is how soon a reconcile whose status patch
+// conflicted is retried
+const conflictRequeueDelay = time.Second
+
+// requeueOnConflict turns the conflict of a status patch into a quiet
+// requeue, as the next reconcile reads the newer object anyway
+func requeueOnConflict(result ctrl.Result, err error) (ctrl.Result, error) {
+	if apierrors.IsConflict(err) {
+		return ctrl.Result{RequeueAfter: conflictRequeueDelay}, nil
+	}
+	return result, err
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+)
+
+func TestPatchStatus(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, &loopstacksv1.Agent{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "support-agent"},
+	})
+	patches := 0
+	c = interceptor.NewClient(c.(client.WithWatch), interceptor.Funcs{
+		SubResourcePatch: func(ctx context.Context, c client.Client, subResource string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			patches++
+			return c.SubResource(subResource).Patch(ctx, obj, patch, opts...)
+		},
+	})
+	get := func() *loopstacksv1.Agent {
+		t.Helper()
+		agent := &loopstacksv1.Agent{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "support-agent"}, agent); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		return agent
+	}
+
+	agent := get()
+	before := agent.DeepCopy()
+	agent.Status.Phase = "Ready"
+	changed, err := patchStatus(ctx, c, agent, before, &agent.Status, &before.Status)
+	if err != nil || !changed {
+		t.Fatalf("patchStatus() = %v, %v, want a write", changed, err)
+	}
+	written := get()
+	if written.Status.Phase != "Ready" || written.Status.LastUpdated.IsZero() {
+		t.Errorf("written status = %+v, want Ready with LastUpdated", written.Status)
+	}
+
+	// Reconciling the same status again writes nothing, whatever the
+	// reconciler left in LastUpdated
+	agent = get()
+	before = agent.DeepCopy()
+	agent.Status.Phase = "Ready"
+	agent.Status.LastUpdated = metav1.Now()
+	changed, err = patchStatus(ctx, c, agent, before, &agent.Status, &before.Status)
+	if err != nil || changed {
+		t.Errorf("patchStatus() of an unchanged status = %v, %v, want no write", changed, err)
+	}
+	if patches != 1 {
+		t.Errorf("status patches = %d, want 1", patches)
+	}
+
+	// A status computed from a stale read conflicts with the newer one
+	stale := get()
+	fresh := stale.DeepCopy()
+	fresh.Status.Phase = "Degraded"
+	if _, err := patchStatus(ctx, c, fresh, stale, &fresh.Status, &stale.Status); err != nil {
+		t.Fatalf("patchStatus() error = %v", err)
+	}
+	before = stale.DeepCopy()
+	stale.Status.Phase = "Failed"
+	if _, err := patchStatus(ctx, c, stale, before, &stale.Status, &before.Status); !apierrors.IsConflict(err) {
+		t.Errorf("patchStatus() of a stale read error = %v, want a conflict", err)
+	}
+	if phase := get().Status.Phase; phase != "Degraded" {
+		t.Errorf("status phase = %s, want the newer Degraded", phase)
+	}
+}
@@ -0,0 +1,83 @@
+// Package coordination defines the transport for the loop coordination
+// protocol. The execution engine announces loops, collects bids, selects
+// agents and gathers their results through a Backend; agents use the same
+// Backend to bid, receive selections, submit results and send heartbeats.
+package coordination
+
+import (
+	"context"
+	"errors"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+var (
+	// ErrNotFound is returned when a looked up loop or agent does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrMissingLoopID is returned for bids and results without a loop id
+	ErrMissingLoopID = errors.New("message has no loop id")
+	// ErrMissingAgentID is returned for selections without an agent id
+	ErrMissingAgentID = errors.New("message has no agent id")
+)
+
+// Handler processes a delivered message. Returning an error stops the
+// subscription; the message is not acknowledged and is delivered again to
+// the next subscription of the same consumer. Handler is an alias, so that
+// backends also implement interfaces declared without this package, such
+// as the Go agent SDK's.
+type Handler[T any] = func(ctx context.Context, msg T) error
+
+// Backend transports coordination messages. Subscribe methods block until
+// ctx is done, returning nil, or until the handler or the backend fails.
+type Backend interface {
+	// Announce opens a loop for bidding
+	Announce(ctx context.Context, announcement *protocol.LoopAnnouncement) error
+	// Announcement looks up a previously announced loop
+	Announcement(ctx context.Context, loopID string) (*protocol.LoopAnnouncement, error)
+	// SubscribeAnnouncements delivers announcements to a durable consumer,
+	// usually the agent id. A consumer that reconnects receives the
+	// announcements published while it was away.
+	SubscribeAnnouncements(ctx context.Context, consumer string, handler Handler[*protocol.LoopAnnouncement]) error
+
+	// Bid submits a bid for a loop
+	Bid(ctx context.Context, bid *protocol.Bid) error
+	// SubscribeBids delivers all bids for a loop, starting with the first
+	SubscribeBids(ctx context.Context, loopID string, handler Handler[*protocol.Bid]) error
+
+	// Select notifies an agent that it was selected for a loop
+	Select(ctx context.Context, selection *protocol.Selection) error
+	// SubscribeSelections delivers the selections of an agent durably
+	SubscribeSelections(ctx context.Context, agentID string, handler Handler[*protocol.Selection]) error
+
+	// SubmitResult records an agent's result for a loop
+	SubmitResult(ctx context.Context, result *protocol.Result) error
+	// SubscribeResults delivers all results for a loop, starting with the first
+	SubscribeResults(ctx context.Context, loopID string, handler Handler[*protocol.Result]) error
+
+	// Heartbeat registers an agent or refreshes its registration
+	Heartbeat(ctx context.Context, heartbeat *protocol.Heartbeat) error
+	// Deregister removes an agent's registration
+	Deregister(ctx context.Context, agentID string) error
+	// Agents lists the agents whose registration has not expired
+	Agents(ctx context.Context) ([]protocol.Heartbeat, error)
+
+	// Close releases the backend's connections
+	Close() error
+}
+
+// Decoder adapts handler to raw message payloads for backend
+// implementations. Payloads that fail to decode are dropped rather than
+// returned as errors, since a malformed message would otherwise be
+// redelivered to the consumer forever.
+func Decoder[T any, PT interface {
+	*T
+	protocol.Message
+}](ctx context.Context, handler Handler[PT]) func(data []byte) error {
+	return func(data []byte) error {
+		msg := PT(new(T))
+		if err := protocol.Decode(data, msg); err != nil {
+			return nil
+		}
+		return handler(ctx, msg)
+	}
+}
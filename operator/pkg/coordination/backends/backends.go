@@ -0,0 +1,80 @@
+// Package backends opens the coordination backend selected by a Realm
+package backends
+
+import (
+	"context"
+	"fmt"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/memory"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/nats"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/redis"
+)
+
+// Coordination backends selectable with RealmResources.CoordinationBackend
+const (
+	Redis  = "redis"
+	NATS   = "nats"
+	Memory = "memory"
+)
+
+// Options selects and configures a backend
+type Options struct {
+	// Backend is redis, nats or memory. Empty selects redis.
+	Backend string
+
+	RedisURL string
+
+	NATSURL      string
+	NATSStream   string
+	NATSReplicas int
+}
+
+// Source connects to the backends of realms. liveness.Registry keeps one
+// connection per realm.
+type Source interface {
+	Backend(ctx context.Context, realm *loopstacksv1.Realm) (coordination.Backend, error)
+}
+
+// ForRealm returns the options configured on a realm
+func ForRealm(realm *loopstacksv1.Realm) Options {
+	resources := realm.Spec.Resources
+	return Options{
+		Backend:      resources.CoordinationBackend,
+		RedisURL:     resources.RedisConfig.URL,
+		NATSURL:      resources.NATSConfig.URL,
+		NATSStream:   resources.NATSConfig.Stream,
+		NATSReplicas: int(resources.NATSConfig.Replicas),
+	}
+}
+
+// Validate checks that the backend is known
+func (o Options) Validate() error {
+	switch o.Backend {
+	case "", Redis, NATS, Memory:
+		return nil
+	default:
+		return fmt.Errorf("unknown coordination backend %q, expected %s or %s", o.Backend, Redis, NATS)
+	}
+}
+
+// Open connects to the selected backend
+func Open(ctx context.Context, opts Options) (coordination.Backend, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch opts.Backend {
+	case NATS:
+		return nats.New(ctx, nats.Options{
+			URL:      opts.NATSURL,
+			Stream:   opts.NATSStream,
+			Replicas: opts.NATSReplicas,
+		})
+	case Memory:
+		return memory.New(0), nil
+	default:
+		return redis.New(redis.Options{URL: opts.RedisURL})
+	}
+}
@@ -0,0 +1,87 @@
+package coordination
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// CollectBids announces a loop and gathers its bids, in arrival order,
+// until ctx is done or until maxBids agents have bid. An agent's latest bid
+// replaces its earlier ones. announced, when set, is called once the loop
+// has been announced.
+func CollectBids(ctx context.Context, backend Backend, announcement *protocol.LoopAnnouncement, maxBids int, announced func()) ([]protocol.Bid, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Subscribe first so no bid is missed, then announce
+	bidCh := make(chan protocol.Bid)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- backend.SubscribeBids(ctx, announcement.LoopID, func(ctx context.Context, bid *protocol.Bid) error {
+			select {
+			case bidCh <- *bid:
+			case <-ctx.Done():
+			}
+			return nil
+		})
+	}()
+
+	if err := backend.Announce(ctx, announcement); err != nil {
+		return nil, fmt.Errorf("failed to announce loop: %w", err)
+	}
+	if announced != nil {
+		announced()
+	}
+
+	var bids []protocol.Bid
+	seen := make(map[string]bool)
+	for {
+		select {
+		case bid := <-bidCh:
+			if seen[bid.AgentID] {
+				for i := range bids {
+					if bids[i].AgentID == bid.AgentID {
+						bids[i] = bid
+					}
+				}
+				continue
+			}
+			seen[bid.AgentID] = true
+			bids = append(bids, bid)
+			if maxBids > 0 && len(bids) >= maxBids {
+				return bids, nil
+			}
+		case err := <-errCh:
+			if err != nil && ctx.Err() == nil {
+				return nil, fmt.Errorf("failed to collect bids: %w", err)
+			}
+			return bids, nil
+		case <-ctx.Done():
+			return bids, nil
+		}
+	}
+}
+
+// AwaitResult waits for an agent's result for a loop until ctx is done
+func AwaitResult(ctx context.Context, backend Backend, loopID, agentID string) (*protocol.Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var found *protocol.Result
+	err := backend.SubscribeResults(ctx, loopID, func(ctx context.Context, result *protocol.Result) error {
+		if result.AgentID == agentID {
+			found = result
+			cancel()
+		}
+		return nil
+	})
+	if found != nil {
+		return found, nil
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return nil, err
+}
@@ -0,0 +1,317 @@
+// Package coordinationtest checks that coordination backends honour the
+// guarantees of coordination.Backend, so the engine and agents behave the
+// same on every backend.
+package coordinationtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// probePrefix marks the loops announced and selected to wait for a
+// subscription to be ready. They are not returned by next.
+const probePrefix = "probe-"
+
+// timeout bounds every wait for a message
+const timeout = 5 * time.Second
+
+// Run runs the conformance tests against the backends newBackend creates,
+// each test with a backend of its own
+func Run(t *testing.T, newBackend func(t *testing.T) coordination.Backend) {
+	t.Run("RoundTrip", func(t *testing.T) { testRoundTrip(t, newBackend(t)) })
+	t.Run("Redelivery", func(t *testing.T) { testRedelivery(t, newBackend(t)) })
+	t.Run("Deregistration", func(t *testing.T) { testDeregistration(t, newBackend(t)) })
+}
+
+// announcement returns a valid announcement of loopID
+func announcement(loopID string) *protocol.LoopAnnouncement {
+	return &protocol.LoopAnnouncement{LoopID: loopID, LoopStack: "support", Capabilities: []string{"reply"}}
+}
+
+// subscription is a subscription running in the background
+type subscription[T any] struct {
+	received chan T
+	stop     func()
+}
+
+// subscribe runs subscribe in the background until stopped or the test ends
+func subscribe[T any](t *testing.T, subscribe func(context.Context, coordination.Handler[T]) error) *subscription[T] {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan T, 64)
+	done := make(chan error, 1)
+	go func() {
+		done <- subscribe(ctx, func(ctx context.Context, msg T) error {
+			select {
+			case received <- msg:
+			case <-ctx.Done():
+			}
+			return nil
+		})
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("subscription error = %v", err)
+			}
+		})
+	}
+	t.Cleanup(stop)
+	return &subscription[T]{received: received, stop: stop}
+}
+
+// next returns the next message that is not a probe
+func next[T any](t *testing.T, s *subscription[T], loopID func(T) string) T {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg := <-s.received:
+			if !strings.HasPrefix(loopID(msg), probePrefix) {
+				return msg
+			}
+		case <-deadline:
+			t.Fatal("timed out waiting for message")
+			var zero T
+			return zero
+		}
+	}
+}
+
+// ready publishes probes until the subscription receives one. Durable
+// consumers only receive what is published once they exist, which some
+// backends create asynchronously.
+func ready[T any](t *testing.T, s *subscription[T], loopID func(T) string, publish func(loopID string) error) {
+	t.Helper()
+	deadline := time.After(timeout)
+	for i := 0; ; i++ {
+		if err := publish(fmt.Sprintf("%s%d", probePrefix, i)); err != nil {
+			t.Fatalf("publishing probe: %v", err)
+		}
+		wait := time.After(50 * time.Millisecond)
+		for waiting := true; waiting; {
+			select {
+			case msg := <-s.received:
+				if strings.HasPrefix(loopID(msg), probePrefix) {
+					return
+				}
+			case <-wait:
+				waiting = false
+			case <-deadline:
+				t.Fatal("subscription did not become ready")
+			}
+		}
+	}
+}
+
+func announcementLoop(a *protocol.LoopAnnouncement) string { return a.LoopID }
+func bidLoop(b *protocol.Bid) string                       { return b.LoopID }
+func selectionLoop(s *protocol.Selection) string           { return s.LoopID }
+func resultLoop(r *protocol.Result) string                 { return r.LoopID }
+
+func subscribeAnnouncements(t *testing.T, backend coordination.Backend, consumer string) *subscription[*protocol.LoopAnnouncement] {
+	t.Helper()
+	s := subscribe(t, func(ctx context.Context, h coordination.Handler[*protocol.LoopAnnouncement]) error {
+		return backend.SubscribeAnnouncements(ctx, consumer, h)
+	})
+	ready(t, s, announcementLoop, func(loopID string) error {
+		return backend.Announce(context.Background(), announcement(loopID))
+	})
+	return s
+}
+
+func subscribeSelections(t *testing.T, backend coordination.Backend, agentID string) *subscription[*protocol.Selection] {
+	t.Helper()
+	s := subscribe(t, func(ctx context.Context, h coordination.Handler[*protocol.Selection]) error {
+		return backend.SubscribeSelections(ctx, agentID, h)
+	})
+	ready(t, s, selectionLoop, func(loopID string) error {
+		return backend.Select(context.Background(), &protocol.Selection{LoopID: loopID, AgentID: agentID})
+	})
+	return s
+}
+
+// testRoundTrip runs a loop through announcement, bid, selection and result
+func testRoundTrip(t *testing.T, backend coordination.Backend) {
+	ctx := context.Background()
+	announcements := subscribeAnnouncements(t, backend, "agent-a")
+	selections := subscribeSelections(t, backend, "agent-a")
+
+	if err := backend.Announce(ctx, announcement("loop-1")); err != nil {
+		t.Fatalf("Announce() error = %v", err)
+	}
+	if got := next(t, announcements, announcementLoop); got.LoopID != "loop-1" || got.LoopStack != "support" {
+		t.Errorf("announcement = %+v, want loop-1 of support", got)
+	}
+	stored, err := backend.Announcement(ctx, "loop-1")
+	if err != nil {
+		t.Fatalf("Announcement() error = %v", err)
+	}
+	if stored.LoopID != "loop-1" || len(stored.Capabilities) != 1 {
+		t.Errorf("Announcement() = %+v", stored)
+	}
+	if _, err := backend.Announcement(ctx, "loop-unknown"); !errors.Is(err, coordination.ErrNotFound) {
+		t.Errorf("Announcement(unknown) error = %v, want ErrNotFound", err)
+	}
+
+	// Bids and results are delivered from the start of the loop, so they
+	// may be published before subscribing
+	for _, bid := range []*protocol.Bid{
+		{LoopID: "loop-1", AgentID: "agent-a", Timestamp: 1, Confidence: 0.8},
+		{LoopID: "loop-1", AgentID: "agent-b", Timestamp: 2, Confidence: 0.5},
+	} {
+		if err := backend.Bid(ctx, bid); err != nil {
+			t.Fatalf("Bid() error = %v", err)
+		}
+	}
+	bids := subscribe(t, func(ctx context.Context, h coordination.Handler[*protocol.Bid]) error {
+		return backend.SubscribeBids(ctx, "loop-1", h)
+	})
+	if got := next(t, bids, bidLoop); got.AgentID != "agent-a" || got.Confidence != 0.8 {
+		t.Errorf("first bid = %+v, want agent-a's", got)
+	}
+	if got := next(t, bids, bidLoop); got.AgentID != "agent-b" {
+		t.Errorf("second bid = %+v, want agent-b's", got)
+	}
+
+	if err := backend.Select(ctx, &protocol.Selection{LoopID: "loop-1", AgentID: "agent-a"}); err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if got := next(t, selections, selectionLoop); got.LoopID != "loop-1" || got.AgentID != "agent-a" {
+		t.Errorf("selection = %+v, want loop-1 for agent-a", got)
+	}
+
+	if err := backend.SubmitResult(ctx, &protocol.Result{LoopID: "loop-1", AgentID: "agent-a", Result: []byte(`{"answer":"shipped"}`)}); err != nil {
+		t.Fatalf("SubmitResult() error = %v", err)
+	}
+	results := subscribe(t, func(ctx context.Context, h coordination.Handler[*protocol.Result]) error {
+		return backend.SubscribeResults(ctx, "loop-1", h)
+	})
+	if got := next(t, results, resultLoop); got.AgentID != "agent-a" || string(got.Result) != `{"answer":"shipped"}` {
+		t.Errorf("result = %+v, want agent-a's", got)
+	}
+
+	if err := backend.Bid(ctx, &protocol.Bid{AgentID: "agent-a"}); !errors.Is(err, coordination.ErrMissingLoopID) {
+		t.Errorf("Bid(no loop id) error = %v, want ErrMissingLoopID", err)
+	}
+	if err := backend.Select(ctx, &protocol.Selection{LoopID: "loop-1"}); !errors.Is(err, coordination.ErrMissingAgentID) {
+		t.Errorf("Select(no agent id) error = %v, want ErrMissingAgentID", err)
+	}
+	if err := backend.SubmitResult(ctx, &protocol.Result{AgentID: "agent-a"}); !errors.Is(err, coordination.ErrMissingLoopID) {
+		t.Errorf("SubmitResult(no loop id) error = %v, want ErrMissingLoopID", err)
+	}
+}
+
+// testRedelivery checks that a consumer that reconnects receives what was
+// published while it was away, and what it failed to handle
+func testRedelivery(t *testing.T, backend coordination.Backend) {
+	ctx := context.Background()
+	subscribeAnnouncements(t, backend, "agent-a").stop()
+	subscribeSelections(t, backend, "agent-a").stop()
+
+	if err := backend.Announce(ctx, announcement("loop-1")); err != nil {
+		t.Fatalf("Announce() error = %v", err)
+	}
+	if err := backend.Select(ctx, &protocol.Selection{LoopID: "loop-0", AgentID: "agent-a"}); err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+
+	// A handler error ends the subscription without acknowledging, so the
+	// next subscription receives the message again
+	errFailed := errors.New("failed")
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := backend.SubscribeAnnouncements(ctx, "agent-a", func(ctx context.Context, a *protocol.LoopAnnouncement) error {
+		if strings.HasPrefix(a.LoopID, probePrefix) {
+			return nil
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("SubscribeAnnouncements() error = %v, want the handler's error", err)
+	}
+
+	announcements := subscribe(t, func(ctx context.Context, h coordination.Handler[*protocol.LoopAnnouncement]) error {
+		return backend.SubscribeAnnouncements(ctx, "agent-a", h)
+	})
+	if got := next(t, announcements, announcementLoop); got.LoopID != "loop-1" {
+		t.Errorf("redelivered announcement = %q, want loop-1", got.LoopID)
+	}
+	if err := backend.Announce(context.Background(), announcement("loop-2")); err != nil {
+		t.Fatalf("Announce() error = %v", err)
+	}
+	if got := next(t, announcements, announcementLoop); got.LoopID != "loop-2" {
+		t.Errorf("announcement = %q, want loop-2", got.LoopID)
+	}
+
+	selections := subscribe(t, func(ctx context.Context, h coordination.Handler[*protocol.Selection]) error {
+		return backend.SubscribeSelections(ctx, "agent-a", h)
+	})
+	if got := next(t, selections, selectionLoop); got.LoopID != "loop-0" {
+		t.Errorf("selection received on reconnect = %q, want loop-0", got.LoopID)
+	}
+}
+
+// testDeregistration checks that a deregistered agent is no longer listed
+// and that its consumers are dropped
+func testDeregistration(t *testing.T, backend coordination.Backend) {
+	ctx := context.Background()
+	for _, id := range []string{"agent-a", "agent-b"} {
+		if err := backend.Heartbeat(ctx, &protocol.Heartbeat{AgentID: id, Capabilities: []string{"reply"}}); err != nil {
+			t.Fatalf("Heartbeat() error = %v", err)
+		}
+	}
+	agents, err := backend.Agents(ctx)
+	if err != nil {
+		t.Fatalf("Agents() error = %v", err)
+	}
+	if len(agents) != 2 {
+		t.Fatalf("Agents() = %v, want 2 agents", agents)
+	}
+
+	// Agents stop subscribing before they deregister
+	subscribeAnnouncements(t, backend, "agent-a").stop()
+	if err := backend.Deregister(ctx, "agent-a"); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	agents, err = backend.Agents(ctx)
+	if err != nil {
+		t.Fatalf("Agents() error = %v", err)
+	}
+	if len(agents) != 1 || agents[0].AgentID != "agent-b" {
+		t.Errorf("Agents() = %v, want agent-b only", agents)
+	}
+
+	// What is announced after deregistering is not kept for the agent: an
+	// agent of the same id starts afresh
+	if err := backend.Announce(ctx, announcement("loop-1")); err != nil {
+		t.Fatalf("Announce() error = %v", err)
+	}
+	announcements := subscribeAnnouncements(t, backend, "agent-a")
+	if err := backend.Announce(ctx, announcement("loop-2")); err != nil {
+		t.Fatalf("Announce() error = %v", err)
+	}
+	if got := next(t, announcements, announcementLoop); got.LoopID != "loop-2" {
+		t.Errorf("announcement after registering again = %q, want loop-2", got.LoopID)
+	}
+	announcements.stop()
+
+	// Deregistering twice or an unknown agent is not an error
+	if err := backend.Deregister(ctx, "agent-a"); err != nil {
+		t.Errorf("Deregister() again error = %v", err)
+	}
+	if err := backend.Deregister(ctx, "agent-unknown"); err != nil {
+		t.Errorf("Deregister(unknown) error = %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+// Package memory implements an in-process coordination backend for unit
+// tests and single-binary development mode. Messages are kept encoded so
+// the wire format is exercised exactly as with a networked backend.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+const (
+	// DefaultRegistrationTTL is how long a registration lives without heartbeats
+	DefaultRegistrationTTL = 5 * time.Minute
+
+	// Loops are forgotten like the keys of the Redis backend expire
+	loopTTL   = time.Hour
+	resultTTL = 24 * time.Hour
+	// pruneInterval is how often expired loops are looked for
+	pruneInterval = time.Minute
+)
+
+// Backend is an in-memory coordination.Backend
+type Backend struct {
+	registrationTTL time.Duration
+
+	mu            sync.Mutex
+	announcements *topic
+	announced     map[string]registration
+	bids          map[string]*topic
+	results       map[string]*topic
+	selections    map[string]*topic
+	agents        map[string]registration
+	pruned        time.Time
+}
+
+// registration is an announced loop or a registered agent
+type registration struct {
+	data    []byte
+	expires time.Time
+}
+
+var _ coordination.Backend = &Backend{}
+
+// New creates an empty in-memory backend. A zero registrationTTL selects
+// DefaultRegistrationTTL.
+func New(registrationTTL time.Duration) *Backend {
+	if registrationTTL <= 0 {
+		registrationTTL = DefaultRegistrationTTL
+	}
+	return &Backend{
+		registrationTTL: registrationTTL,
+		announcements:   newTopic(true),
+		announced:       make(map[string]registration),
+		bids:            make(map[string]*topic),
+		results:         make(map[string]*topic),
+		selections:      make(map[string]*topic),
+		agents:          make(map[string]registration),
+	}
+}
+
+// Announce implements coordination.Backend
+func (b *Backend) Announce(ctx context.Context, announcement *protocol.LoopAnnouncement) error {
+	data, err := protocol.Encode(announcement)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.prune(time.Now())
+	b.announced[announcement.LoopID] = registration{data: data, expires: time.Now().Add(loopTTL)}
+	b.mu.Unlock()
+	b.announcements.publish(data)
+	return nil
+}
+
+// Announcement implements coordination.Backend
+func (b *Backend) Announcement(ctx context.Context, loopID string) (*protocol.LoopAnnouncement, error) {
+	b.mu.Lock()
+	loop, ok := b.announced[loopID]
+	b.mu.Unlock()
+	if !ok || time.Now().After(loop.expires) {
+		return nil, coordination.ErrNotFound
+	}
+	announcement := &protocol.LoopAnnouncement{}
+	if err := protocol.Decode(loop.data, announcement); err != nil {
+		return nil, err
+	}
+	return announcement, nil
+}
+
+// SubscribeAnnouncements implements coordination.Backend
+func (b *Backend) SubscribeAnnouncements(ctx context.Context, consumer string, handler coordination.Handler[*protocol.LoopAnnouncement]) error {
+	return b.announcements.consume(ctx, consumer, coordination.Decoder(ctx, handler))
+}
+
+// Bid implements coordination.Backend
+func (b *Backend) Bid(ctx context.Context, bid *protocol.Bid) error {
+	if bid.LoopID == "" {
+		return coordination.ErrMissingLoopID
+	}
+	data, err := protocol.Encode(bid)
+	if err != nil {
+		return err
+	}
+	b.topic(b.bids, bid.LoopID, loopTTL).publish(data)
+	return nil
+}
+
+// SubscribeBids implements coordination.Backend
+func (b *Backend) SubscribeBids(ctx context.Context, loopID string, handler coordination.Handler[*protocol.Bid]) error {
+	return b.topic(b.bids, loopID, loopTTL).consume(ctx, "", coordination.Decoder(ctx, handler))
+}
+
+// Select implements coordination.Backend
+func (b *Backend) Select(ctx context.Context, selection *protocol.Selection) error {
+	if selection.AgentID == "" {
+		return coordination.ErrMissingAgentID
+	}
+	data, err := protocol.Encode(selection)
+	if err != nil {
+		return err
+	}
+	b.topic(b.selections, selection.AgentID, 0).publish(data)
+	return nil
+}
+
+// SubscribeSelections implements coordination.Backend
+func (b *Backend) SubscribeSelections(ctx context.Context, agentID string, handler coordination.Handler[*protocol.Selection]) error {
+	return b.topic(b.selections, agentID, 0).consume(ctx, agentID, coordination.Decoder(ctx, handler))
+}
+
+// SubmitResult implements coordination.Backend
+func (b *Backend) SubmitResult(ctx context.Context, result *protocol.Result) error {
+	if result.LoopID == "" {
+		return coordination.ErrMissingLoopID
+	}
+	data, err := protocol.Encode(result)
+	if err != nil {
+		return err
+	}
+	b.topic(b.results, result.LoopID, resultTTL).publish(data)
+	return nil
+}
+
+// SubscribeResults implements coordination.Backend
+func (b *Backend) SubscribeResults(ctx context.Context, loopID string, handler coordination.Handler[*protocol.Result]) error {
+	return b.topic(b.results, loopID, resultTTL).consume(ctx, "", coordination.Decoder(ctx, handler))
+}
+
+// Heartbeat implements coordination.Backend
+func (b *Backend) Heartbeat(ctx context.Context, heartbeat *protocol.Heartbeat) error {
+	data, err := protocol.Encode(heartbeat)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.agents[heartbeat.AgentID] = registration{data: data, expires: time.Now().Add(b.registrationTTL)}
+	return nil
+}
+
+// Deregister implements coordination.Backend. The agent's announcement
+// cursor and selections go with its registration.
+func (b *Backend) Deregister(ctx context.Context, agentID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.forget(agentID)
+	return nil
+}
+
+// Agents implements coordination.Backend
+func (b *Backend) Agents(ctx context.Context) ([]protocol.Heartbeat, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	agents := make([]protocol.Heartbeat, 0, len(b.agents))
+	for id, reg := range b.agents {
+		if now.After(reg.expires) {
+			b.forget(id)
+			continue
+		}
+		var heartbeat protocol.Heartbeat
+		if err := protocol.Decode(reg.data, &heartbeat); err != nil {
+			return nil, err
+		}
+		agents = append(agents, heartbeat)
+	}
+	return agents, nil
+}
+
+// Close implements coordination.Backend
+func (b *Backend) Close() error {
+	return nil
+}
+
+// forget removes an agent's registration, announcement cursor and
+// selections. b.mu must be held.
+func (b *Backend) forget(agentID string) {
+	delete(b.agents, agentID)
+	delete(b.selections, agentID)
+	b.announcements.remove(agentID)
+}
+
+// topic returns the topic of key, creating it if needed. Topics with a ttl
+// are loop topics, dropped when nothing was published to them for ttl.
+func (b *Backend) topic(topics map[string]*topic, key string, ttl time.Duration) *topic {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.prune(now)
+	t, ok := topics[key]
+	if !ok {
+		t = newTopic(ttl == 0)
+		t.ttl = ttl
+		t.expires = now.Add(ttl)
+		topics[key] = t
+	}
+	return t
+}
+
+// prune drops expired loops. b.mu must be held.
+func (b *Backend) prune(now time.Time) {
+	if now.Sub(b.pruned) < pruneInterval {
+		return
+	}
+	b.pruned = now
+	for id, loop := range b.announced {
+		if now.After(loop.expires) {
+			delete(b.announced, id)
+		}
+	}
+	for _, topics := range []map[string]*topic{b.bids, b.results} {
+		for id, t := range topics {
+			if t.expired(now) {
+				delete(topics, id)
+			}
+		}
+	}
+}
+
+// topic is a message log with per-consumer cursors. Durable topics are read
+// by named consumers, which start with the messages published after they
+// first subscribe, and drop the messages every consumer has read. Other
+// topics are read from the beginning, by the empty consumer.
+type topic struct {
+	mu      sync.Mutex
+	durable bool
+	// first is the position of messages[0]. Positions count every message
+	// ever published.
+	first    int
+	messages [][]byte
+	cursors  map[string]int
+	notify   chan struct{}
+	// ttl and expires bound the life of loop topics
+	ttl     time.Duration
+	expires time.Time
+}
+
+func newTopic(durable bool) *topic {
+	return &topic{durable: durable, cursors: make(map[string]int), notify: make(chan struct{})}
+}
+
+func (t *topic) publish(data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, data)
+	if t.ttl > 0 {
+		t.expires = time.Now().Add(t.ttl)
+	}
+	t.trim()
+	close(t.notify)
+	t.notify = make(chan struct{})
+}
+
+func (t *topic) expired(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ttl > 0 && now.After(t.expires)
+}
+
+// remove forgets a consumer's cursor
+func (t *topic) remove(consumer string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.cursors, consumer)
+	t.trim()
+}
+
+// trim drops the messages of a durable topic that every consumer has read.
+// t.mu must be held.
+func (t *topic) trim() {
+	if !t.durable {
+		return
+	}
+	read := t.first + len(t.messages)
+	for _, cursor := range t.cursors {
+		read = min(read, cursor)
+	}
+	n := read - t.first
+	if n <= 0 {
+		return
+	}
+	clear(t.messages[:n])
+	t.messages = t.messages[n:]
+	t.first = read
+}
+
+func (t *topic) consume(ctx context.Context, consumer string, deliver func([]byte) error) error {
+	t.mu.Lock()
+	next := t.first
+	if consumer != "" {
+		cursor, ok := t.cursors[consumer]
+		if !ok {
+			// A new consumer starts with messages published from now on
+			cursor = t.first + len(t.messages)
+			t.cursors[consumer] = cursor
+		}
+		next = cursor
+	}
+	t.mu.Unlock()
+
+	for {
+		t.mu.Lock()
+		next = max(next, t.first)
+		if next < t.first+len(t.messages) {
+			data := t.messages[next-t.first]
+			t.mu.Unlock()
+
+			if err := deliver(data); err != nil {
+				return err
+			}
+
+			next++
+			if consumer != "" {
+				t.mu.Lock()
+				if t.cursors[consumer] < next {
+					t.cursors[consumer] = next
+				}
+				t.trim()
+				t.mu.Unlock()
+			}
+			continue
+		}
+		notify := t.notify
+		t.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-notify:
+		}
+	}
+}
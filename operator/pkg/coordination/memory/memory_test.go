@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/coordinationtest"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+func TestConformance(t *testing.T) {
+	coordinationtest.Run(t, func(t *testing.T) coordination.Backend { return New(time.Minute) })
+}
+
+func TestDeregisterDropsCursors(t *testing.T) {
+	ctx := context.Background()
+	backend := New(time.Minute)
+	announce := func(loopID string) {
+		t.Helper()
+		if err := backend.Announce(ctx, &protocol.LoopAnnouncement{LoopID: loopID, Capabilities: []string{"write"}}); err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+	}
+	consume := func(consumer string) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		if err := backend.SubscribeAnnouncements(ctx, consumer, func(context.Context, *protocol.LoopAnnouncement) error { return nil }); err != nil {
+			t.Fatalf("SubscribeAnnouncements() error = %v", err)
+		}
+	}
+
+	consume("agent-a")
+	consume("agent-b")
+	announce("loop-1")
+	announce("loop-2")
+	consume("agent-b")
+
+	// agent-a has not read the announcements, so they are kept for it
+	topic := backend.announcements
+	if got := len(topic.messages); got != 2 {
+		t.Fatalf("announcements kept = %d, want 2", got)
+	}
+
+	// Once it deregisters nothing is waiting for them
+	if err := backend.Deregister(ctx, "agent-a"); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	if _, ok := topic.cursors["agent-a"]; ok {
+		t.Error("cursor of deregistered agent kept")
+	}
+	if got := len(topic.messages); got != 0 {
+		t.Errorf("announcements kept after Deregister() = %d, want 0", got)
+	}
+
+	// New announcements are read from the right position
+	announce("loop-3")
+	received := make(chan string, 1)
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	backend.SubscribeAnnouncements(ctx, "agent-b", func(ctx context.Context, a *protocol.LoopAnnouncement) error {
+		received <- a.LoopID
+		cancel()
+		return nil
+	})
+	if got := <-received; got != "loop-3" {
+		t.Errorf("announcement = %q, want loop-3", got)
+	}
+}
@@ -0,0 +1,392 @@
+// Package nats implements the coordination backend on NATS JetStream.
+//
+// All protocol messages are stored in one stream. Announcements and
+// selections are read through durable consumers named after the agent, so
+// an agent that reconnects resumes where it left off; bids and results are
+// read with ordered consumers from the start of the loop. Announced loops
+// and agent registrations are kept in key-value buckets whose TTL expires
+// them like the Redis keys of the Redis backend.
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+const (
+	// DefaultStream is the JetStream stream holding coordination messages
+	DefaultStream = "LOOPSTACKS"
+	// DefaultRegistrationTTL is how long a registration lives without heartbeats
+	DefaultRegistrationTTL = 5 * time.Minute
+	// DefaultMaxAge is how long messages are retained in the stream
+	DefaultMaxAge = 24 * time.Hour
+
+	loopTTL = time.Hour
+
+	// consumerInactiveThreshold removes durable consumers of agents that
+	// have been gone for a long time
+	consumerInactiveThreshold = 24 * time.Hour
+)
+
+// Options configures the NATS backend
+type Options struct {
+	// URL locates the NATS server, e.g. nats://localhost:4222
+	URL string
+	// Stream overrides DefaultStream. Realms sharing a NATS server need
+	// distinct streams.
+	Stream string
+	// SubjectPrefix prefixes every coordination subject and defaults to the
+	// lowercased stream name
+	SubjectPrefix string
+	// Replicas is the replication factor of the stream and buckets
+	Replicas int
+	// RegistrationTTL overrides DefaultRegistrationTTL
+	RegistrationTTL time.Duration
+	// MaxAge overrides DefaultMaxAge
+	MaxAge time.Duration
+}
+
+// Backend is a coordination.Backend on NATS JetStream
+type Backend struct {
+	conn   *natsgo.Conn
+	js     jetstream.JetStream
+	stream string
+	prefix string
+
+	loops  jetstream.KeyValue
+	agents jetstream.KeyValue
+}
+
+var _ coordination.Backend = &Backend{}
+
+// New connects to NATS and creates the stream and buckets if needed
+func New(ctx context.Context, opts Options) (*Backend, error) {
+	if opts.URL == "" {
+		opts.URL = natsgo.DefaultURL
+	}
+	if opts.Stream == "" {
+		opts.Stream = DefaultStream
+	}
+	if opts.SubjectPrefix == "" {
+		opts.SubjectPrefix = strings.ToLower(opts.Stream)
+	}
+	if opts.Replicas <= 0 {
+		opts.Replicas = 1
+	}
+	if opts.RegistrationTTL <= 0 {
+		opts.RegistrationTTL = DefaultRegistrationTTL
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+
+	conn, err := natsgo.Connect(opts.URL, natsgo.Name("loopstacks"), natsgo.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+
+	b, err := provision(ctx, conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func provision(ctx context.Context, conn *natsgo.Conn, opts Options) (*Backend, error) {
+	js, err := jetstream.New(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      opts.Stream,
+		Subjects:  []string{opts.SubjectPrefix + ".>"},
+		Retention: jetstream.LimitsPolicy,
+		Storage:   jetstream.FileStorage,
+		MaxAge:    opts.MaxAge,
+		Replicas:  opts.Replicas,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream %s: %w", opts.Stream, err)
+	}
+
+	loops, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:   opts.Stream + "_loops",
+		TTL:      loopTTL,
+		Replicas: opts.Replicas,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create loops bucket: %w", err)
+	}
+
+	agents, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:   opts.Stream + "_agents",
+		TTL:      opts.RegistrationTTL,
+		Replicas: opts.Replicas,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create agents bucket: %w", err)
+	}
+
+	return &Backend{
+		conn:   conn,
+		js:     js,
+		stream: opts.Stream,
+		prefix: opts.SubjectPrefix,
+		loops:  loops,
+		agents: agents,
+	}, nil
+}
+
+func (b *Backend) announcementsSubject() string {
+	return b.prefix + ".announcements"
+}
+
+func (b *Backend) bidsSubject(loopID string) string {
+	return b.prefix + ".loops." + token(loopID) + ".bids"
+}
+
+func (b *Backend) resultsSubject(loopID string) string {
+	return b.prefix + ".loops." + token(loopID) + ".results"
+}
+
+func (b *Backend) selectionsSubject(agentID string) string {
+	return b.prefix + ".agents." + token(agentID) + ".selections"
+}
+
+// Announce implements coordination.Backend
+func (b *Backend) Announce(ctx context.Context, announcement *protocol.LoopAnnouncement) error {
+	data, err := protocol.Encode(announcement)
+	if err != nil {
+		return err
+	}
+	if _, err := b.loops.Put(ctx, token(announcement.LoopID), data); err != nil {
+		return err
+	}
+	_, err = b.js.Publish(ctx, b.announcementsSubject(), data)
+	return err
+}
+
+// Announcement implements coordination.Backend
+func (b *Backend) Announcement(ctx context.Context, loopID string) (*protocol.LoopAnnouncement, error) {
+	entry, err := b.loops.Get(ctx, token(loopID))
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, coordination.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	announcement := &protocol.LoopAnnouncement{}
+	if err := protocol.Decode(entry.Value(), announcement); err != nil {
+		return nil, err
+	}
+	return announcement, nil
+}
+
+// SubscribeAnnouncements implements coordination.Backend
+func (b *Backend) SubscribeAnnouncements(ctx context.Context, consumer string, handler coordination.Handler[*protocol.LoopAnnouncement]) error {
+	return b.consumeDurable(ctx, "announcements-"+token(consumer), b.announcementsSubject(), coordination.Decoder(ctx, handler))
+}
+
+// Bid implements coordination.Backend
+func (b *Backend) Bid(ctx context.Context, bid *protocol.Bid) error {
+	if bid.LoopID == "" {
+		return coordination.ErrMissingLoopID
+	}
+	data, err := protocol.Encode(bid)
+	if err != nil {
+		return err
+	}
+	_, err = b.js.Publish(ctx, b.bidsSubject(bid.LoopID), data)
+	return err
+}
+
+// SubscribeBids implements coordination.Backend
+func (b *Backend) SubscribeBids(ctx context.Context, loopID string, handler coordination.Handler[*protocol.Bid]) error {
+	return b.consumeOrdered(ctx, b.bidsSubject(loopID), coordination.Decoder(ctx, handler))
+}
+
+// Select implements coordination.Backend
+func (b *Backend) Select(ctx context.Context, selection *protocol.Selection) error {
+	if selection.AgentID == "" {
+		return coordination.ErrMissingAgentID
+	}
+	data, err := protocol.Encode(selection)
+	if err != nil {
+		return err
+	}
+	_, err = b.js.Publish(ctx, b.selectionsSubject(selection.AgentID), data)
+	return err
+}
+
+// SubscribeSelections implements coordination.Backend
+func (b *Backend) SubscribeSelections(ctx context.Context, agentID string, handler coordination.Handler[*protocol.Selection]) error {
+	return b.consumeDurable(ctx, "selections-"+token(agentID), b.selectionsSubject(agentID), coordination.Decoder(ctx, handler))
+}
+
+// SubmitResult implements coordination.Backend
+func (b *Backend) SubmitResult(ctx context.Context, result *protocol.Result) error {
+	if result.LoopID == "" {
+		return coordination.ErrMissingLoopID
+	}
+	data, err := protocol.Encode(result)
+	if err != nil {
+		return err
+	}
+	_, err = b.js.Publish(ctx, b.resultsSubject(result.LoopID), data)
+	return err
+}
+
+// SubscribeResults implements coordination.Backend
+func (b *Backend) SubscribeResults(ctx context.Context, loopID string, handler coordination.Handler[*protocol.Result]) error {
+	return b.consumeOrdered(ctx, b.resultsSubject(loopID), coordination.Decoder(ctx, handler))
+}
+
+// Heartbeat implements coordination.Backend
+func (b *Backend) Heartbeat(ctx context.Context, heartbeat *protocol.Heartbeat) error {
+	data, err := protocol.Encode(heartbeat)
+	if err != nil {
+		return err
+	}
+	_, err = b.agents.Put(ctx, token(heartbeat.AgentID), data)
+	return err
+}
+
+// Deregister implements coordination.Backend. The agent's durable
+// consumers go with its registration rather than lingering until their
+// inactive threshold.
+func (b *Backend) Deregister(ctx context.Context, agentID string) error {
+	err := b.agents.Purge(ctx, token(agentID))
+	if err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return err
+	}
+	for _, name := range []string{"announcements-" + token(agentID), "selections-" + token(agentID)} {
+		err := b.js.DeleteConsumer(ctx, b.stream, name)
+		if err != nil && !errors.Is(err, jetstream.ErrConsumerNotFound) {
+			return fmt.Errorf("failed to delete consumer %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Agents implements coordination.Backend
+func (b *Backend) Agents(ctx context.Context) ([]protocol.Heartbeat, error) {
+	lister, err := b.agents.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer lister.Stop()
+
+	var agents []protocol.Heartbeat
+	for key := range lister.Keys() {
+		entry, err := b.agents.Get(ctx, key)
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var heartbeat protocol.Heartbeat
+		if err := protocol.Decode(entry.Value(), &heartbeat); err != nil {
+			continue
+		}
+		agents = append(agents, heartbeat)
+	}
+	return agents, nil
+}
+
+// Close implements coordination.Backend
+func (b *Backend) Close() error {
+	return b.conn.Drain()
+}
+
+// consumeDurable reads a subject through a durable consumer. A consumer
+// created for the first time starts with messages published from now on.
+func (b *Backend) consumeDurable(ctx context.Context, name, subject string, deliver func([]byte) error) error {
+	consumer, err := b.js.CreateOrUpdateConsumer(ctx, b.stream, jetstream.ConsumerConfig{
+		Durable:           name,
+		FilterSubject:     subject,
+		DeliverPolicy:     jetstream.DeliverNewPolicy,
+		AckPolicy:         jetstream.AckExplicitPolicy,
+		InactiveThreshold: consumerInactiveThreshold,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer %s: %w", name, err)
+	}
+
+	return consume(ctx, consumer, func(msg jetstream.Msg) error {
+		if err := deliver(msg.Data()); err != nil {
+			_ = msg.Nak()
+			return err
+		}
+		return msg.Ack()
+	})
+}
+
+// consumeOrdered reads a subject from its first message
+func (b *Backend) consumeOrdered(ctx context.Context, subject string, deliver func([]byte) error) error {
+	consumer, err := b.js.OrderedConsumer(ctx, b.stream, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{subject},
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer for %s: %w", subject, err)
+	}
+
+	return consume(ctx, consumer, func(msg jetstream.Msg) error {
+		return deliver(msg.Data())
+	})
+}
+
+func consume(ctx context.Context, consumer jetstream.Consumer, handle func(jetstream.Msg) error) error {
+	messages, err := consumer.Messages()
+	if err != nil {
+		return err
+	}
+	defer messages.Stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		messages.Stop()
+	}()
+
+	for {
+		msg, err := messages.Next()
+		if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+			return nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// token makes an id usable as a subject token, consumer name and key
+func token(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, id)
+}
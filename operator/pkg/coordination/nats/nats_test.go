@@ -0,0 +1,146 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/coordinationtest"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// startServer runs an in-process NATS server with JetStream enabled,
+// storing its streams under a temporary directory
+func startServer(t *testing.T) string {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+	t.Cleanup(func() {
+		srv.Shutdown()
+		srv.WaitForShutdown()
+	})
+	return srv.ClientURL()
+}
+
+// newTestBackend connects to a server of its own and closes the backend
+// afterwards
+func newTestBackend(t *testing.T) *Backend {
+	t.Helper()
+	backend, err := New(context.Background(), Options{URL: startServer(t), RegistrationTTL: time.Minute})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	return backend
+}
+
+// collect subscribes in the background and returns a channel of the
+// messages received and a function ending the subscription
+func collect[T any](t *testing.T, subscribe func(context.Context, coordination.Handler[T]) error) (<-chan T, func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan T, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- subscribe(ctx, func(ctx context.Context, msg T) error {
+			received <- msg
+			return nil
+		})
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("subscription error = %v", err)
+			}
+		})
+	}
+	t.Cleanup(stop)
+	return received, stop
+}
+
+// waitForConsumer waits until a durable consumer exists, as messages
+// published before it is created are not delivered to it
+func waitForConsumer(t *testing.T, backend *Backend, name string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := backend.js.Consumer(context.Background(), backend.stream, name)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, jetstream.ErrConsumerNotFound) || time.Now().After(deadline) {
+			t.Fatalf("consumer %s: %v", name, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	coordinationtest.Run(t, func(t *testing.T) coordination.Backend { return newTestBackend(t) })
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	backend := newTestBackend(t)
+
+	for _, id := range []string{"agent-a", "agent-b"} {
+		if err := backend.Heartbeat(ctx, &protocol.Heartbeat{AgentID: id, Capabilities: []string{"write"}}); err != nil {
+			t.Fatalf("Heartbeat() error = %v", err)
+		}
+	}
+	agents, err := backend.Agents(ctx)
+	if err != nil {
+		t.Fatalf("Agents() error = %v", err)
+	}
+	if len(agents) != 2 {
+		t.Fatalf("Agents() = %v, want 2 agents", agents)
+	}
+
+	// Agents stop subscribing before they deregister
+	_, stop := collect(t, func(ctx context.Context, h coordination.Handler[*protocol.LoopAnnouncement]) error {
+		return backend.SubscribeAnnouncements(ctx, "agent-a", h)
+	})
+	waitForConsumer(t, backend, "announcements-agent-a")
+	stop()
+
+	if err := backend.Deregister(ctx, "agent-a"); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+	agents, err = backend.Agents(ctx)
+	if err != nil {
+		t.Fatalf("Agents() error = %v", err)
+	}
+	if len(agents) != 1 || agents[0].AgentID != "agent-b" {
+		t.Errorf("Agents() = %v, want agent-b only", agents)
+	}
+	if _, err := backend.js.Consumer(ctx, backend.stream, "announcements-agent-a"); !errors.Is(err, jetstream.ErrConsumerNotFound) {
+		t.Errorf("consumer of deregistered agent: error = %v, want ErrConsumerNotFound", err)
+	}
+
+	// Deregistering twice or an unknown agent is not an error
+	if err := backend.Deregister(ctx, "agent-a"); err != nil {
+		t.Errorf("Deregister() again error = %v", err)
+	}
+}
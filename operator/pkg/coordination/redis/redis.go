@@ -0,0 +1,440 @@
+// Package redis implements the coordination backend on Redis Streams.
+//
+// Announcements and selections are appended to streams read through
+// consumer groups, so an agent that reconnects resumes where it left off
+// instead of missing everything published while it was away, as happens
+// with pub/sub. Bids and results are per-loop streams read from the start.
+//
+// For compatibility with peers that still use the pub/sub protocol, every
+// write is mirrored to the legacy keys and channels: announcements are
+// published on loop:announcements, bids and results are stored in the
+// loop:<id>:bids and loop:<id>:results hashes and selections are published
+// on agent:<id>:selected.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+const (
+	// DefaultRegistrationTTL is how long a registration lives without heartbeats
+	DefaultRegistrationTTL = 5 * time.Minute
+	// DefaultMaxLen caps the announcement and selection streams
+	DefaultMaxLen = 10000
+
+	loopTTL   = time.Hour
+	bidTTL    = time.Hour
+	resultTTL = 24 * time.Hour
+
+	// payloadField is the stream entry field holding the encoded message
+	payloadField = "data"
+	// blockTimeout bounds blocking reads so cancellation is noticed
+	blockTimeout = time.Second
+)
+
+// Options configures the Redis backend
+type Options struct {
+	// URL locates the realm's Redis, e.g. redis://localhost:6379
+	URL string
+	// RegistrationTTL overrides DefaultRegistrationTTL
+	RegistrationTTL time.Duration
+	// MaxLen overrides DefaultMaxLen
+	MaxLen int64
+}
+
+// Backend is a coordination.Backend on Redis Streams
+type Backend struct {
+	client          *goredis.Client
+	registrationTTL time.Duration
+	maxLen          int64
+}
+
+var _ coordination.Backend = &Backend{}
+
+// New connects to Redis
+func New(opts Options) (*Backend, error) {
+	if opts.URL == "" {
+		opts.URL = "redis://localhost:6379"
+	}
+	if opts.RegistrationTTL <= 0 {
+		opts.RegistrationTTL = DefaultRegistrationTTL
+	}
+	if opts.MaxLen <= 0 {
+		opts.MaxLen = DefaultMaxLen
+	}
+
+	clientOpts, err := goredis.ParseURL(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+
+	return &Backend{
+		client:          goredis.NewClient(clientOpts),
+		registrationTTL: opts.RegistrationTTL,
+		maxLen:          opts.MaxLen,
+	}, nil
+}
+
+// Keys and channels. The legacy ones match the control plane's RedisService.
+const (
+	announcementsStream  = "stream:loop:announcements"
+	announcementsChannel = "loop:announcements"
+	agentsIndex          = "agents"
+)
+
+func loopKey(loopID string) string           { return "loop:" + loopID }
+func bidsStream(loopID string) string        { return "stream:loop:" + loopID + ":bids" }
+func bidsHash(loopID string) string          { return "loop:" + loopID + ":bids" }
+func resultsStream(loopID string) string     { return "stream:loop:" + loopID + ":results" }
+func resultsHash(loopID string) string       { return "loop:" + loopID + ":results" }
+func selectedSet(loopID string) string       { return "loop:" + loopID + ":selected" }
+func agentKey(agentID string) string         { return "agent:" + agentID }
+func selectionsStream(agentID string) string { return "stream:agent:" + agentID + ":selections" }
+func selectedChannel(agentID string) string  { return "agent:" + agentID + ":selected" }
+
+// Announce implements coordination.Backend
+func (b *Backend) Announce(ctx context.Context, announcement *protocol.LoopAnnouncement) error {
+	data, err := protocol.Encode(announcement)
+	if err != nil {
+		return err
+	}
+
+	pipe := b.client.TxPipeline()
+	pipe.Set(ctx, loopKey(announcement.LoopID), data, loopTTL)
+	pipe.XAdd(ctx, &goredis.XAddArgs{
+		Stream: announcementsStream,
+		MaxLen: b.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{payloadField: data},
+	})
+	pipe.Publish(ctx, announcementsChannel, data)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Announcement implements coordination.Backend
+func (b *Backend) Announcement(ctx context.Context, loopID string) (*protocol.LoopAnnouncement, error) {
+	data, err := b.client.Get(ctx, loopKey(loopID)).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, coordination.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The control plane stores the loop record without its loop id
+	if data, err = withField(data, "loopId", loopID); err != nil {
+		return nil, err
+	}
+	announcement := &protocol.LoopAnnouncement{}
+	if err := protocol.Decode(data, announcement); err != nil {
+		return nil, err
+	}
+	return announcement, nil
+}
+
+// SubscribeAnnouncements implements coordination.Backend. Each consumer has
+// its own consumer group, so every agent sees every announcement.
+func (b *Backend) SubscribeAnnouncements(ctx context.Context, consumer string, handler coordination.Handler[*protocol.LoopAnnouncement]) error {
+	return b.consumeGroup(ctx, announcementsStream, consumer, coordination.Decoder(ctx, handler))
+}
+
+// Bid implements coordination.Backend
+func (b *Backend) Bid(ctx context.Context, bid *protocol.Bid) error {
+	if bid.LoopID == "" {
+		return coordination.ErrMissingLoopID
+	}
+	data, err := protocol.Encode(bid)
+	if err != nil {
+		return err
+	}
+
+	pipe := b.client.TxPipeline()
+	pipe.XAdd(ctx, &goredis.XAddArgs{Stream: bidsStream(bid.LoopID), Values: map[string]interface{}{payloadField: data}})
+	pipe.Expire(ctx, bidsStream(bid.LoopID), bidTTL)
+	pipe.HSet(ctx, bidsHash(bid.LoopID), bid.AgentID, data)
+	pipe.Expire(ctx, bidsHash(bid.LoopID), bidTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// SubscribeBids implements coordination.Backend
+func (b *Backend) SubscribeBids(ctx context.Context, loopID string, handler coordination.Handler[*protocol.Bid]) error {
+	return b.consumeAll(ctx, bidsStream(loopID), coordination.Decoder(ctx, handler))
+}
+
+// Select implements coordination.Backend
+func (b *Backend) Select(ctx context.Context, selection *protocol.Selection) error {
+	if selection.AgentID == "" {
+		return coordination.ErrMissingAgentID
+	}
+	data, err := protocol.Encode(selection)
+	if err != nil {
+		return err
+	}
+
+	pipe := b.client.TxPipeline()
+	pipe.XAdd(ctx, &goredis.XAddArgs{
+		Stream: selectionsStream(selection.AgentID),
+		MaxLen: b.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{payloadField: data},
+	})
+	pipe.SAdd(ctx, selectedSet(selection.LoopID), selection.AgentID)
+	pipe.Expire(ctx, selectedSet(selection.LoopID), bidTTL)
+	pipe.Publish(ctx, selectedChannel(selection.AgentID), data)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// SubscribeSelections implements coordination.Backend
+func (b *Backend) SubscribeSelections(ctx context.Context, agentID string, handler coordination.Handler[*protocol.Selection]) error {
+	return b.consumeGroup(ctx, selectionsStream(agentID), agentID, coordination.Decoder(ctx, handler))
+}
+
+// SubmitResult implements coordination.Backend
+func (b *Backend) SubmitResult(ctx context.Context, result *protocol.Result) error {
+	if result.LoopID == "" {
+		return coordination.ErrMissingLoopID
+	}
+	data, err := protocol.Encode(result)
+	if err != nil {
+		return err
+	}
+
+	pipe := b.client.TxPipeline()
+	pipe.XAdd(ctx, &goredis.XAddArgs{Stream: resultsStream(result.LoopID), Values: map[string]interface{}{payloadField: data}})
+	pipe.Expire(ctx, resultsStream(result.LoopID), resultTTL)
+	pipe.HSet(ctx, resultsHash(result.LoopID), result.AgentID, data)
+	pipe.Expire(ctx, resultsHash(result.LoopID), resultTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// SubscribeResults implements coordination.Backend
+func (b *Backend) SubscribeResults(ctx context.Context, loopID string, handler coordination.Handler[*protocol.Result]) error {
+	return b.consumeAll(ctx, resultsStream(loopID), coordination.Decoder(ctx, handler))
+}
+
+// Heartbeat implements coordination.Backend. Registrations are indexed in
+// a sorted set by heartbeat time so listing agents does not need KEYS.
+func (b *Backend) Heartbeat(ctx context.Context, heartbeat *protocol.Heartbeat) error {
+	data, err := protocol.Encode(heartbeat)
+	if err != nil {
+		return err
+	}
+
+	pipe := b.client.TxPipeline()
+	pipe.Set(ctx, agentKey(heartbeat.AgentID), data, b.registrationTTL)
+	pipe.ZAdd(ctx, agentsIndex, goredis.Z{Score: float64(time.Now().UnixMilli()), Member: heartbeat.AgentID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Deregister implements coordination.Backend
+func (b *Backend) Deregister(ctx context.Context, agentID string) error {
+	return b.forget(ctx, agentID)
+}
+
+// Agents implements coordination.Backend
+func (b *Backend) Agents(ctx context.Context) ([]protocol.Heartbeat, error) {
+	// Agents that stopped without deregistering are forgotten once their
+	// registration expires
+	cutoff := time.Now().Add(-b.registrationTTL).UnixMilli()
+	expired, err := b.client.ZRangeByScore(ctx, agentsIndex, &goredis.ZRangeBy{Min: "-inf", Max: fmt.Sprintf("(%d", cutoff)}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.forget(ctx, expired...); err != nil {
+		return nil, err
+	}
+
+	ids, err := b.client.ZRange(ctx, agentsIndex, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, agentKey(id))
+	}
+	values, err := b.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	agents := make([]protocol.Heartbeat, 0, len(values))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		// Agents registered by the control plane omit their id
+		record, err := withField([]byte(data), "agentId", ids[i])
+		if err != nil {
+			continue
+		}
+		var heartbeat protocol.Heartbeat
+		if err := protocol.Decode(record, &heartbeat); err != nil {
+			continue
+		}
+		agents = append(agents, heartbeat)
+	}
+	return agents, nil
+}
+
+// Close implements coordination.Backend
+func (b *Backend) Close() error {
+	return b.client.Close()
+}
+
+// forget removes agents' registrations along with their selection streams
+// and announcement consumer groups. Agent ids are pod names, so without
+// this every pod ever replaced would leave a consumer group on the
+// announcement stream, each holding its own pending entries.
+func (b *Backend) forget(ctx context.Context, agentIDs ...string) error {
+	if len(agentIDs) == 0 {
+		return nil
+	}
+
+	pipe := b.client.TxPipeline()
+	for _, id := range agentIDs {
+		pipe.Del(ctx, agentKey(id), selectionsStream(id))
+		pipe.ZRem(ctx, agentsIndex, id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	for _, id := range agentIDs {
+		err := b.client.XGroupDestroy(ctx, announcementsStream, id).Err()
+		// The stream does not exist until the first announcement or
+		// subscription
+		if err != nil && !strings.Contains(err.Error(), "requires the key to exist") {
+			return fmt.Errorf("failed to destroy consumer group %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// consumeGroup reads a stream through a consumer group named after the
+// consumer. Entries delivered but not acknowledged before a restart are
+// redelivered first.
+func (b *Backend) consumeGroup(ctx context.Context, stream, consumer string, deliver func([]byte) error) error {
+	err := b.client.XGroupCreateMkStream(ctx, stream, consumer, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group %s on %s: %w", consumer, stream, err)
+	}
+
+	// "0" reads this consumer's pending entries, ">" new ones
+	id := "0"
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		streams, err := b.client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    consumer,
+			Consumer: consumer,
+			Streams:  []string{stream, id},
+			Count:    100,
+			Block:    blockTimeout,
+		}).Result()
+		if errors.Is(err, goredis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		entries := 0
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				entries++
+				if err := deliver(payload(msg)); err != nil {
+					return err
+				}
+				if err := b.client.XAck(ctx, stream, consumer, msg.ID).Err(); err != nil {
+					return err
+				}
+			}
+		}
+		if id == "0" && entries == 0 {
+			id = ">"
+		}
+	}
+}
+
+// consumeAll reads a stream from its first entry
+func (b *Backend) consumeAll(ctx context.Context, stream string, deliver func([]byte) error) error {
+	id := "0"
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		streams, err := b.client.XRead(ctx, &goredis.XReadArgs{
+			Streams: []string{stream, id},
+			Count:   100,
+			Block:   blockTimeout,
+		}).Result()
+		if errors.Is(err, goredis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				if err := deliver(payload(msg)); err != nil {
+					return err
+				}
+				id = msg.ID
+			}
+		}
+	}
+}
+
+// withField sets a missing top-level field of a JSON object
+func withField(data []byte, field, value string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if _, ok := fields[field]; ok {
+		return data, nil
+	}
+	fields[field], _ = json.Marshal(value)
+	return json.Marshal(fields)
+}
+
+func payload(msg goredis.XMessage) []byte {
+	switch v := msg.Values[payloadField].(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/coordinationtest"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+func newTestBackend(t *testing.T) (*Backend, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	backend, err := New(Options{URL: "redis://" + server.Addr(), RegistrationTTL: time.Minute})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	return backend, server
+}
+
+func TestConformance(t *testing.T) {
+	coordinationtest.Run(t, func(t *testing.T) coordination.Backend {
+		backend, _ := newTestBackend(t)
+		return backend
+	})
+}
+
+// subscribe consumes announcements as consumer until the first one
+// arrives, so its consumer group exists
+func subscribe(t *testing.T, backend *Backend, consumer string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	received := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- backend.SubscribeAnnouncements(ctx, consumer, func(ctx context.Context, a *protocol.LoopAnnouncement) error {
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+			return nil
+		})
+	}()
+
+	// The group is created from the end of the stream, so announce until
+	// the subscription has caught up
+	for {
+		if err := backend.Announce(context.Background(), &protocol.LoopAnnouncement{LoopID: "loop", Capabilities: []string{"write"}}); err != nil {
+			t.Fatalf("Announce() error = %v", err)
+		}
+		select {
+		case <-received:
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatalf("SubscribeAnnouncements() error = %v", err)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("no announcement received")
+		}
+	}
+}
+
+func groups(t *testing.T, backend *Backend, server *miniredis.Miniredis) []string {
+	t.Helper()
+	if !server.Exists(announcementsStream) {
+		return nil
+	}
+	infos, err := backend.client.XInfoGroups(context.Background(), announcementsStream).Result()
+	if err != nil {
+		t.Fatalf("XInfoGroups() error = %v", err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func TestDeregisterDestroysConsumerGroup(t *testing.T) {
+	ctx := context.Background()
+	backend, server := newTestBackend(t)
+
+	for _, id := range []string{"agent-a", "agent-b"} {
+		if err := backend.Heartbeat(ctx, &protocol.Heartbeat{AgentID: id, Capabilities: []string{"write"}}); err != nil {
+			t.Fatalf("Heartbeat() error = %v", err)
+		}
+		subscribe(t, backend, id)
+	}
+	if err := backend.Select(ctx, &protocol.Selection{LoopID: "loop", AgentID: "agent-a"}); err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+
+	if err := backend.Deregister(ctx, "agent-a"); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+
+	if got := groups(t, backend, server); len(got) != 1 || got[0] != "agent-b" {
+		t.Errorf("consumer groups = %v, want [agent-b]", got)
+	}
+	if server.Exists(selectionsStream("agent-a")) {
+		t.Error("selection stream of deregistered agent still exists")
+	}
+	agents, err := backend.Agents(ctx)
+	if err != nil {
+		t.Fatalf("Agents() error = %v", err)
+	}
+	if len(agents) != 1 || agents[0].AgentID != "agent-b" {
+		t.Errorf("Agents() = %v, want agent-b only", agents)
+	}
+}
+
+func TestDeregisterWithoutStream(t *testing.T) {
+	backend, _ := newTestBackend(t)
+	if err := backend.Deregister(context.Background(), "agent-a"); err != nil {
+		t.Fatalf("Deregister() error = %v", err)
+	}
+}
+
+func TestAgentsForgetsExpiredAgents(t *testing.T) {
+	ctx := context.Background()
+	backend, server := newTestBackend(t)
+
+	if err := backend.Heartbeat(ctx, &protocol.Heartbeat{AgentID: "agent-a", Capabilities: []string{"write"}}); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+	subscribe(t, backend, "agent-a")
+
+	// Backdate the registration past its TTL, as for a pod that was killed
+	// without deregistering
+	expired := float64(time.Now().Add(-2 * time.Minute).UnixMilli())
+	if _, err := server.ZAdd(agentsIndex, expired, "agent-a"); err != nil {
+		t.Fatalf("ZAdd() error = %v", err)
+	}
+
+	agents, err := backend.Agents(ctx)
+	if err != nil {
+		t.Fatalf("Agents() error = %v", err)
+	}
+	if len(agents) != 0 {
+		t.Errorf("Agents() = %v, want none", agents)
+	}
+	if got := groups(t, backend, server); len(got) != 0 {
+		t.Errorf("consumer groups = %v, want none", got)
+	}
+}
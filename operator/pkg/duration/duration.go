@@ -0,0 +1,59 @@
+// Package duration parses the duration strings used throughout the
+// LoopStacks API, such as phase timeouts ("30s") and retention periods
+// ("30d").
+package duration
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Day is the length of the "d" unit
+	Day = 24 * time.Hour
+	// Week is the length of the "w" unit
+	Week = 7 * Day
+)
+
+// Parse parses a duration string. In addition to the units understood by
+// time.ParseDuration it accepts whole days ("7d") and weeks ("2w"), which
+// the standard library does not support.
+func Parse(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	for suffix, unit := range map[string]time.Duration{"d": Day, "w": Week} {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSuffix(s, suffix), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		if n < 0 {
+			return 0, fmt.Errorf("negative duration %q", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
+
+// ParseOrDefault parses s, returning def when s is empty
+func ParseOrDefault(s string, def time.Duration) (time.Duration, error) {
+	if strings.TrimSpace(s) == "" {
+		return def, nil
+	}
+	return Parse(s)
+}
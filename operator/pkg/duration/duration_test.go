@@ -0,0 +1,51 @@
+package duration
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "30s", want: 30 * time.Second},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: "7d", want: 7 * Day},
+		{in: "0d", want: 0},
+		{in: "2w", want: 14 * Day},
+		{in: " 1d ", want: Day},
+		{in: "", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "1.5d", wantErr: true},
+		{in: "-1d", wantErr: true},
+		{in: "-1w", wantErr: true},
+		{in: "-5s", wantErr: true},
+		{in: "1dw", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOrDefault(t *testing.T) {
+	got, err := ParseOrDefault("  ", time.Minute)
+	if err != nil || got != time.Minute {
+		t.Errorf("ParseOrDefault(blank) = %v, %v, want %v", got, err, time.Minute)
+	}
+	got, err = ParseOrDefault("1w", time.Minute)
+	if err != nil || got != Week {
+		t.Errorf("ParseOrDefault(1w) = %v, %v, want %v", got, err, Week)
+	}
+}
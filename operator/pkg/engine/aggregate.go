@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Aggregation strategies of LoopStackOutputPhase.AggregationStrategy
+const (
+	AggregateMerge     = "merge"
+	AggregateSelect    = "select"
+	AggregateConsensus = "consensus"
+)
+
+// ErrNoResults is returned when no selected agent produced a result
+var ErrNoResults = errors.New("no agent produced a result")
+
+// AgentResult is the outcome of one selected agent, in selection order
+type AgentResult struct {
+	AgentID    string          `json:"agentId"`
+	Confidence float64         `json:"confidence"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	// Latency runs from the agent's selection to its result
+	Latency time.Duration `json:"-"`
+}
+
+// Aggregate combines the successful results by strategy. An empty or
+// unknown strategy merges them.
+func Aggregate(strategy string, results []AgentResult) (json.RawMessage, error) {
+	var succeeded []AgentResult
+	for _, result := range results {
+		if result.Error == "" {
+			succeeded = append(succeeded, result)
+		}
+	}
+	if len(succeeded) == 0 {
+		if len(results) > 0 {
+			return nil, errors.Join(ErrNoResults, errors.New(results[0].Error))
+		}
+		return nil, ErrNoResults
+	}
+
+	switch strategy {
+	case AggregateSelect:
+		return succeeded[0].Result, nil
+	case AggregateConsensus:
+		return consensus(succeeded), nil
+	default:
+		if len(succeeded) == 1 {
+			return succeeded[0].Result, nil
+		}
+		outputs := make([]json.RawMessage, 0, len(succeeded))
+		for _, result := range succeeded {
+			outputs = append(outputs, result.Result)
+		}
+		return json.Marshal(map[string]interface{}{
+			"results": outputs,
+			"aggregate": map[string]interface{}{
+				"count": len(succeeded),
+			},
+		})
+	}
+}
+
+// consensus returns the most common result, the first in selection order
+// winning ties
+func consensus(results []AgentResult) json.RawMessage {
+	counts := make([]int, len(results))
+	best := 0
+	for i := range results {
+		for j := 0; j <= i; j++ {
+			if equalJSON(results[i].Result, results[j].Result) {
+				counts[j]++
+				break
+			}
+		}
+	}
+	for i, count := range counts {
+		if count > counts[best] {
+			best = i
+		}
+	}
+	return results[best].Result
+}
+
+// equalJSON compares two documents regardless of formatting and key order
+func equalJSON(a, b json.RawMessage) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ca, errA := json.Marshal(va)
+	cb, errB := json.Marshal(vb)
+	return errA == nil && errB == nil && bytes.Equal(ca, cb)
+}
+
+// aggregationDecision describes an aggregation for the audit trail
+func aggregationDecision(strategy string, output json.RawMessage, err error) map[string]interface{} {
+	if strategy == "" {
+		strategy = AggregateMerge
+	}
+	decision := map[string]interface{}{"strategy": strategy}
+	if err != nil {
+		decision["error"] = err.Error()
+	} else {
+		decision["result"] = output
+	}
+	return decision
+}
@@ -0,0 +1,304 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workflow"
+)
+
+// ApprovalLabel marks the ConfigMaps of pending approvals with the name of
+// the LoopStack
+const ApprovalLabel = "loopstacks.io/approval"
+
+// Keys of an approval ConfigMap
+const (
+	approvalRequestKey   = "request"
+	approvalExecutionKey = "execution"
+	approvalDecisionKey  = "decision"
+)
+
+var (
+	// ErrNotApprover is returned when a user outside a step's approvers
+	// posts a decision
+	ErrNotApprover = errors.New("not an approver")
+	// ErrAlreadyDecided is returned when a decision was already posted
+	ErrAlreadyDecided = errors.New("a decision was already posted")
+)
+
+// pausedExecution is what an approval ConfigMap keeps to resume its
+// execution
+type pausedExecution struct {
+	LoopStack string          `json:"loopstack"`
+	Realm     string          `json:"realm"`
+	Input     json.RawMessage `json:"input,omitempty"`
+}
+
+// pendingApproval is an approval read from its ConfigMap
+type pendingApproval struct {
+	configMap *corev1.ConfigMap
+	execution pausedExecution
+	request   workflow.ApprovalRequest
+	decision  *workflow.ApprovalDecision
+}
+
+// ApprovalStore keeps the approvals executions are paused on in ConfigMaps
+// of the LoopStack's namespace, with what is needed to resume them, so an
+// execution survives restarts of the operator while it awaits a decision.
+// Decisions are posted by authenticated users through the executions API.
+type ApprovalStore struct {
+	Client client.Client
+	// Reader reads the approval ConfigMaps, which the manager's cache does
+	// not hold
+	Reader client.Reader
+
+	mu sync.Mutex
+	// waiting wakes the executions awaiting a decision by ConfigMap
+	waiting map[types.NamespacedName]chan struct{}
+}
+
+// gate returns the ApprovalGate of an execution
+func (s *ApprovalStore) gate(execution Execution, log logr.Logger) workflow.ApprovalGate {
+	return &executionApprovals{store: s, execution: execution, log: log}
+}
+
+// executionApprovals is the ApprovalGate of one execution
+type executionApprovals struct {
+	store     *ApprovalStore
+	execution Execution
+	log       logr.Logger
+}
+
+// Await implements workflow.ApprovalGate. The approval is kept until it is
+// decided or times out; when the execution is cancelled it is left for the
+// execution to be resumed.
+func (g *executionApprovals) Await(ctx context.Context, req workflow.ApprovalRequest) (workflow.ApprovalDecision, error) {
+	configMap, err := newApprovalConfigMap(g.execution, req)
+	if err != nil {
+		return workflow.ApprovalDecision{}, err
+	}
+	// The approval is read even past its deadline, as a resumed execution
+	// may find it decided meanwhile
+	storeCtx := context.WithoutCancel(ctx)
+	if err := g.store.Client.Create(storeCtx, configMap); err != nil && !apierrors.IsAlreadyExists(err) {
+		return workflow.ApprovalDecision{}, fmt.Errorf("failed to save pending approval: %w", err)
+	}
+
+	key := client.ObjectKeyFromObject(configMap)
+	wake := g.store.wait(key)
+	defer g.store.done(key)
+
+	for {
+		approval, err := g.store.get(storeCtx, key)
+		if err != nil {
+			return workflow.ApprovalDecision{}, fmt.Errorf("failed to read pending approval: %w", err)
+		}
+		if approval.decision != nil {
+			g.delete(storeCtx, approval.configMap)
+			return *approval.decision, nil
+		}
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				g.delete(storeCtx, approval.configMap)
+			}
+			return workflow.ApprovalDecision{}, ctx.Err()
+		}
+	}
+}
+
+// delete removes a finished approval. The execution goes on if it fails;
+// the approval is then listed until deleted by hand.
+func (g *executionApprovals) delete(ctx context.Context, configMap *corev1.ConfigMap) {
+	if err := g.store.Client.Delete(ctx, configMap); err != nil && !apierrors.IsNotFound(err) {
+		g.log.Error(err, "Failed to delete finished approval", "configMap", client.ObjectKeyFromObject(configMap))
+	}
+}
+
+// Post decides the approval that a step of an execution of namespace
+// awaits, on behalf of user
+func (s *ApprovalStore) Post(ctx context.Context, namespace, executionID, step, user string, decision workflow.ApprovalDecision) error {
+	approval, err := s.find(ctx, namespace, executionID, step)
+	if err != nil {
+		return err
+	}
+	if approval == nil {
+		return workflow.ErrNoPendingApproval
+	}
+	key := client.ObjectKeyFromObject(approval.configMap)
+	if approvers := approval.request.Approvers; len(approvers) > 0 && !slices.Contains(approvers, user) {
+		return fmt.Errorf("%w for step %s: %q", ErrNotApprover, step, user)
+	}
+	if approval.decision != nil {
+		return ErrAlreadyDecided
+	}
+
+	decision.Approver = user
+	decision.DecidedAt = time.Now()
+	decision.TimedOut = false
+	data, err := json.Marshal(decision)
+	if err != nil {
+		return err
+	}
+	approval.configMap.Data[approvalDecisionKey] = string(data)
+	// The resourceVersion read above makes concurrent decisions conflict
+	if err := s.Client.Update(ctx, approval.configMap); err != nil {
+		if apierrors.IsConflict(err) {
+			return ErrAlreadyDecided
+		}
+		return fmt.Errorf("failed to save decision: %w", err)
+	}
+
+	s.mu.Lock()
+	if wake, ok := s.waiting[key]; ok {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Pending lists the approvals awaiting a decision in namespace, oldest
+// first
+func (s *ApprovalStore) Pending(ctx context.Context, namespace string) ([]workflow.ApprovalRequest, error) {
+	approvals, err := s.list(ctx, client.InNamespace(namespace))
+	if err != nil {
+		return nil, err
+	}
+	requests := make([]workflow.ApprovalRequest, 0, len(approvals))
+	for _, approval := range approvals {
+		if approval.decision == nil {
+			requests = append(requests, approval.request)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].RequestedAt.Before(requests[j].RequestedAt)
+	})
+	return requests, nil
+}
+
+// list reads the approval ConfigMaps, skipping the ones that cannot be
+// parsed
+func (s *ApprovalStore) list(ctx context.Context, opts ...client.ListOption) ([]*pendingApproval, error) {
+	var configMaps corev1.ConfigMapList
+	if err := s.Reader.List(ctx, &configMaps, append(opts, client.HasLabels{ApprovalLabel})...); err != nil {
+		return nil, fmt.Errorf("failed to list pending approvals: %w", err)
+	}
+	approvals := make([]*pendingApproval, 0, len(configMaps.Items))
+	for i := range configMaps.Items {
+		if approval, err := parseApproval(&configMaps.Items[i]); err == nil {
+			approvals = append(approvals, approval)
+		}
+	}
+	return approvals, nil
+}
+
+// find returns the approval a step of an execution of namespace awaits, or
+// nil when there is none
+func (s *ApprovalStore) find(ctx context.Context, namespace, executionID, step string) (*pendingApproval, error) {
+	approval, err := s.get(ctx, types.NamespacedName{Namespace: namespace, Name: approvalName(executionID, step)})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if approval.request.ExecutionID != executionID || approval.request.Step != step {
+		return nil, nil
+	}
+	return approval, nil
+}
+
+func (s *ApprovalStore) get(ctx context.Context, key types.NamespacedName) (*pendingApproval, error) {
+	var configMap corev1.ConfigMap
+	if err := s.Reader.Get(ctx, key, &configMap); err != nil {
+		return nil, err
+	}
+	return parseApproval(&configMap)
+}
+
+func (s *ApprovalStore) wait(key types.NamespacedName) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.waiting == nil {
+		s.waiting = make(map[types.NamespacedName]chan struct{})
+	}
+	wake := make(chan struct{}, 1)
+	s.waiting[key] = wake
+	return wake
+}
+
+func (s *ApprovalStore) done(key types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.waiting, key)
+}
+
+// approvalName names the ConfigMap of an approval. Execution ids and step
+// names need not be valid object names, so they are hashed.
+func approvalName(executionID, step string) string {
+	sum := sha256.Sum256([]byte(executionID + "/" + step))
+	return "loopstacks-approval-" + hex.EncodeToString(sum[:10])
+}
+
+func newApprovalConfigMap(execution Execution, req workflow.ApprovalRequest) (*corev1.ConfigMap, error) {
+	request, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	paused, err := json.Marshal(pausedExecution{
+		LoopStack: execution.LoopStack.Name,
+		Realm:     execution.Realm.Name,
+		Input:     execution.Input,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: execution.LoopStack.Namespace,
+			Name:      approvalName(req.ExecutionID, req.Step),
+			Labels:    map[string]string{ApprovalLabel: execution.LoopStack.Name},
+		},
+		Data: map[string]string{
+			approvalRequestKey:   string(request),
+			approvalExecutionKey: string(paused),
+		},
+	}, nil
+}
+
+func parseApproval(configMap *corev1.ConfigMap) (*pendingApproval, error) {
+	approval := &pendingApproval{configMap: configMap}
+	if err := json.Unmarshal([]byte(configMap.Data[approvalRequestKey]), &approval.request); err != nil {
+		return nil, fmt.Errorf("invalid approval request in ConfigMap %s: %w", configMap.Name, err)
+	}
+	if err := json.Unmarshal([]byte(configMap.Data[approvalExecutionKey]), &approval.execution); err != nil {
+		return nil, fmt.Errorf("invalid paused execution in ConfigMap %s: %w", configMap.Name, err)
+	}
+	if data, ok := configMap.Data[approvalDecisionKey]; ok {
+		approval.decision = &workflow.ApprovalDecision{}
+		if err := json.Unmarshal([]byte(data), approval.decision); err != nil {
+			return nil, fmt.Errorf("invalid decision in ConfigMap %s: %w", configMap.Name, err)
+		}
+	}
+	return approval, nil
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+)
+
+// ErrUnauthenticated is returned for bearer tokens the API server does not
+// accept
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Auth authenticates the callers of the executions API and authorizes
+// their requests
+type Auth interface {
+	// Authenticate returns the user a bearer token belongs to
+	Authenticate(ctx context.Context, token string) (authenticationv1.UserInfo, error)
+	// Authorize reports whether user may perform verb on the subresource of
+	// LoopStacks in namespace. name is empty for requests about any
+	// LoopStack.
+	Authorize(ctx context.Context, user authenticationv1.UserInfo, verb, namespace, name, subresource string) (bool, error)
+}
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// KubernetesAuth authenticates bearer tokens with TokenReviews and
+// authorizes requests with SubjectAccessReviews, so callers use their
+// Kubernetes credentials and are granted access by RBAC rules on the
+// executions and approvals subresources of loopstacks
+type KubernetesAuth struct {
+	Client client.Client
+}
+
+var _ Auth = &KubernetesAuth{}
+
+// Authenticate implements Auth
+func (a *KubernetesAuth) Authenticate(ctx context.Context, token string) (authenticationv1.UserInfo, error) {
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := a.Client.Create(ctx, review); err != nil {
+		return authenticationv1.UserInfo{}, fmt.Errorf("failed to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return authenticationv1.UserInfo{}, ErrUnauthenticated
+	}
+	return review.Status.User, nil
+}
+
+// Authorize implements Auth
+func (a *KubernetesAuth) Authorize(ctx context.Context, user authenticationv1.UserInfo, verb, namespace, name, subresource string) (bool, error) {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, values := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(values)
+	}
+	review := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+		User:   user.Username,
+		UID:    user.UID,
+		Groups: user.Groups,
+		Extra:  extra,
+		ResourceAttributes: &authorizationv1.ResourceAttributes{
+			Namespace:   namespace,
+			Verb:        verb,
+			Group:       loopstacksv1.GroupName,
+			Resource:    "loopstacks",
+			Subresource: subresource,
+			Name:        name,
+		},
+	}}
+	if err := a.Client.Create(ctx, review); err != nil {
+		return false, fmt.Errorf("failed to review access: %w", err)
+	}
+	return review.Status.Allowed, nil
+}
@@ -0,0 +1,640 @@
+// Package engine executes LoopStacks. It runs their workflow and carries
+// out each agent step over a coordination backend: the loop is announced,
+// bids are collected and ranked, the selected agents execute it and their
+// results are aggregated, as configured by the LoopStack's phases.
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/audit"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/duration"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/federation"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/metrics"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/rollout"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/schema"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/shadow"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/sharing"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/tracing"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workflow"
+)
+
+// Phase defaults, matching the LoopStack CRD
+const (
+	DefaultBiddingTimeout   = 5 * time.Second
+	DefaultExecutionTimeout = 300 * time.Second
+	DefaultMinBids          = 1
+	DefaultMaxBids          = 10
+)
+
+// ErrNotEnoughBids is returned when fewer agents than MinBids bid on a loop
+var ErrNotEnoughBids = errors.New("not enough bids")
+
+// errNoResult ends the spans of agents that did not answer
+var errNoResult = errors.New("no result before the execution timeout")
+
+// Engine executes LoopStacks
+type Engine struct {
+	Backend   coordination.Backend
+	Approvals workflow.ApprovalGate
+	// History, when set, receives a record of every execution and of the
+	// runs of the agents selected for it
+	History history.Store
+	// Audit, when set, receives the audit trail of executions in realms
+	// with LoopAuditingEnabled
+	Audit audit.Store
+	// Federation, when set, forwards loops of federated realms that
+	// receive fewer bids than MinBids to the realms' federation endpoints
+	Federation *federation.Client
+	// Sharing, when set, also announces loops to the agents of realms that
+	// export all the loop's capabilities to the executing realm
+	Sharing *sharing.Resolver
+	// Rollouts, when set, routes loops between the revisions of
+	// AgentInstances under a BlueGreen or Canary rollout
+	Rollouts *rollout.Router
+	// Shadows, when set, also runs the bidding agents of shadow
+	// AgentInstances on every step and records how their results compare
+	Shadows *shadow.Evaluator
+	Log     logr.Logger
+}
+
+// Execution is a request to run a LoopStack
+type Execution struct {
+	ID        string
+	LoopStack *loopstacksv1.LoopStack
+	Realm     *loopstacksv1.Realm
+	Input     json.RawMessage
+	// Paused, when set, resumes an execution interrupted while awaiting
+	// this approval
+	Paused *workflow.ApprovalRequest
+}
+
+// Execute runs the LoopStack's workflow to completion
+func (e *Engine) Execute(ctx context.Context, execution Execution) (*workflow.Result, error) {
+	ls := execution.LoopStack
+	log := e.Log.WithValues("executionId", execution.ID, "loopstack", ls.Name)
+
+	ctx, span := tracing.Tracer().Start(ctx, "loop.execute", trace.WithAttributes(
+		attribute.String("loopstacks.execution_id", execution.ID),
+		attribute.String("loopstacks.loopstack", ls.Name),
+		attribute.String("loopstacks.realm", execution.Realm.Name),
+		attribute.String("k8s.namespace.name", ls.Namespace),
+	))
+
+	var trail *audit.Trail
+	if e.Audit != nil && execution.Realm.Spec.Governance.LoopAuditingEnabled {
+		trail = &audit.Trail{
+			Store:       e.Audit,
+			ExecutionID: execution.ID,
+			Namespace:   ls.Namespace,
+			Realm:       execution.Realm.Name,
+			LoopStack:   ls.Name,
+		}
+	}
+	if execution.Paused == nil {
+		e.record(ctx, log, trail, "", audit.EventInput, audit.Digest(execution.Input))
+	}
+
+	started := time.Now()
+	result, err := e.execute(ctx, log, execution, trail)
+	if errors.Is(err, workflow.ErrApprovalInterrupted) {
+		log.Info("Execution interrupted while awaiting approval")
+		tracing.End(span, err)
+		return result, err
+	}
+
+	completed := map[string]interface{}{"status": history.StatusCompleted}
+	outcome := metrics.OutcomeCompleted
+	if err != nil {
+		completed["status"] = history.StatusFailed
+		completed["error"] = err.Error()
+		outcome = metrics.OutcomeFailed
+	}
+	e.record(context.WithoutCancel(ctx), log, trail, "", audit.EventCompleted, completed)
+	metrics.Executions.WithLabelValues(ls.Namespace, ls.Name, outcome).Inc()
+	metrics.ExecutionDuration.WithLabelValues(ls.Namespace, ls.Name, outcome).Observe(time.Since(started).Seconds())
+	tracing.End(span, err)
+
+	return result, err
+}
+
+func (e *Engine) execute(ctx context.Context, log logr.Logger, execution Execution, trail *audit.Trail) (*workflow.Result, error) {
+	ls := execution.LoopStack
+
+	_, intake := tracing.Tracer().Start(ctx, "loop.intake")
+	err := validateIntake(&ls.Spec, execution.Input)
+	tracing.End(intake, err)
+	if err != nil {
+		return nil, err
+	}
+
+	wf, err := workflow.Compile(&ls.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var input interface{}
+	if len(execution.Input) > 0 {
+		if err := json.Unmarshal(execution.Input, &input); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+	}
+
+	executor := &stepExecutor{
+		engine:    e,
+		log:       log,
+		trail:     trail,
+		loopstack: ls,
+		realm:     execution.Realm,
+		input:     execution.Input,
+	}
+	if e.Federation != nil && federation.Enabled(execution.Realm) {
+		executor.peers = execution.Realm.Spec.Networking.FederationEndpoints
+	}
+	runner := &workflow.Runner{Executor: executor, Approvals: e.Approvals, Paused: execution.Paused}
+
+	if e.History == nil {
+		return runner.Run(ctx, wf, execution.ID, input)
+	}
+	recorder := &history.Recorder{Runner: runner, Store: e.History, Log: log}
+	return recorder.Run(ctx, history.Execution{
+		ID:        execution.ID,
+		Namespace: ls.Namespace,
+		Realm:     execution.Realm.Name,
+		LoopStack: ls.Name,
+	}, wf, input)
+}
+
+// record appends to the audit trail. Failing to audit is logged rather
+// than failing the execution.
+func (e *Engine) record(ctx context.Context, log logr.Logger, trail *audit.Trail, step, eventType string, data interface{}) {
+	if err := trail.Record(ctx, step, eventType, data); err != nil {
+		log.Error(err, "Failed to write audit event", "type", eventType, "step", step)
+	}
+}
+
+func validateIntake(spec *loopstacksv1.LoopStackSpec, input json.RawMessage) error {
+	validation := spec.Phases.Intake.Validation
+	if len(input) == 0 {
+		if validation.Required {
+			return errors.New("input is required")
+		}
+		return nil
+	}
+
+	validator, err := schema.Compile(validation.Schema.Raw)
+	if err != nil {
+		return fmt.Errorf("invalid intake schema: %w", err)
+	}
+	if err := validator.Validate(input); err != nil {
+		return fmt.Errorf("input does not match intake schema: %w", err)
+	}
+	return nil
+}
+
+// stepExecutor runs the agent steps of one execution
+type stepExecutor struct {
+	engine    *Engine
+	log       logr.Logger
+	trail     *audit.Trail
+	loopstack *loopstacksv1.LoopStack
+	realm     *loopstacksv1.Realm
+	input     json.RawMessage
+	// peers are the federation endpoints of a federated realm
+	peers []string
+}
+
+// ExecuteStep implements workflow.StepExecutor
+func (s *stepExecutor) ExecuteStep(ctx context.Context, req workflow.StepRequest) (interface{}, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "loop.step", trace.WithAttributes(attribute.String("loopstacks.step", req.Step.Name)))
+	value, err := s.executeStep(ctx, req)
+	tracing.End(span, err)
+	return value, err
+}
+
+// executeStep announces an agent step, selects among the bids and
+// aggregates the results of the selected agents
+func (s *stepExecutor) executeStep(ctx context.Context, req workflow.StepRequest) (interface{}, error) {
+	phases := s.loopstack.Spec.Phases
+	step := req.Step.Name
+	log := s.log.WithValues("step", step)
+
+	loopID := req.ExecutionID
+	if step != workflow.DefaultStepName {
+		loopID = req.ExecutionID + "-" + step
+	}
+
+	biddingTimeout, err := duration.ParseOrDefault(phases.Bidding.Timeout, DefaultBiddingTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bidding timeout: %w", err)
+	}
+	executionTimeout, err := duration.ParseOrDefault(phases.Execution.Timeout, DefaultExecutionTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid execution timeout: %w", err)
+	}
+	minBids := int(phases.Bidding.MinBids)
+	if minBids <= 0 {
+		minBids = DefaultMinBids
+	}
+	maxBids := int(phases.Bidding.MaxBids)
+	if maxBids <= 0 {
+		maxBids = DefaultMaxBids
+	}
+
+	steps, err := stepOutputs(req.Previous)
+	if err != nil {
+		return nil, err
+	}
+
+	biddingCtx, bidding := tracing.Tracer().Start(ctx, "loop.bidding", trace.WithAttributes(attribute.String("loopstacks.loop_id", loopID)))
+	now := time.Now()
+	announcement := &protocol.LoopAnnouncement{
+		LoopID:       loopID,
+		LoopStack:    s.loopstack.Name,
+		Step:         step,
+		Realm:        s.realm.Name,
+		Capabilities: req.Step.Capabilities,
+		Input:        s.input,
+		Steps:        steps,
+		Timestamp:    now.UnixMilli(),
+		Deadline:     now.Add(biddingTimeout).UnixMilli(),
+	}
+	tracing.Inject(biddingCtx, &announcement.TraceContext)
+
+	var exporters []sharing.Exporter
+	if s.engine.Sharing != nil {
+		if exporters, err = s.engine.Sharing.Exporters(biddingCtx, s.realm, announcement.Capabilities); err != nil {
+			log.Error(err, "Failed to resolve imported capabilities", "loopId", loopID)
+		}
+	}
+
+	// Agents of other realms are selected and awaited through the route
+	// they bid from
+	var bids, imported []protocol.Bid
+	remote := make(map[string]route)
+	if len(exporters) == 0 {
+		bids, err = s.collectBids(biddingCtx, log, announcement, biddingTimeout, maxBids)
+	} else {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			imported = s.collectImported(biddingCtx, log, announcement, biddingTimeout, maxBids, exporters, remote)
+		}()
+		bids, err = s.collectBids(biddingCtx, log, announcement, biddingTimeout, maxBids)
+		<-done
+	}
+	if err != nil {
+		tracing.End(bidding, err)
+		return nil, err
+	}
+	for _, bid := range bids {
+		delete(remote, bid.AgentID)
+	}
+
+	var agents map[string]protocol.Heartbeat
+	if s.engine.Rollouts != nil || s.engine.History != nil || s.engine.Shadows != nil {
+		agents = s.registeredAgents(ctx, log)
+	}
+	if s.engine.Rollouts != nil {
+		routed, revisions, err := s.engine.Rollouts.Route(ctx, s.realm.Namespace, agents, bids)
+		if err != nil {
+			log.Error(err, "Failed to route loop between agent revisions", "loopId", loopID)
+		} else {
+			bids = routed
+			if len(revisions) > 0 {
+				s.engine.record(ctx, log, s.trail, step, audit.EventRouted, revisions)
+			}
+		}
+	}
+	var shadows []shadowAgent
+	if s.engine.Shadows != nil {
+		bids, shadows = s.splitShadows(ctx, log, agents, bids)
+	}
+	bids = merge(bids, imported)
+
+	if len(bids) < minBids && len(s.peers) > 0 {
+		bids = append(bids, s.federate(biddingCtx, log, announcement, biddingTimeout, maxBids-len(bids), bids, remote)...)
+	}
+	s.engine.record(ctx, log, s.trail, step, audit.EventBids, bids)
+	log.Info("Bidding closed", "loopId", loopID, "bids", len(bids), "remoteBids", len(remote))
+	s.observePhase(metrics.PhaseBidding, now)
+	metrics.Bids.WithLabelValues(s.loopstack.Namespace, s.loopstack.Name).Observe(float64(len(bids)))
+
+	for _, bid := range bids {
+		tracing.Link(bidding, bid.TraceContext)
+	}
+	bidding.SetAttributes(attribute.Int("loopstacks.bids", len(bids)))
+
+	strategy := phases.Bidding.SelectionStrategy
+	if len(bids) < minBids {
+		s.observeSelection(strategy, metrics.OutcomeNotEnoughBids)
+		err := fmt.Errorf("%w: received %d of %d", ErrNotEnoughBids, len(bids), minBids)
+		tracing.End(bidding, err)
+		return nil, err
+	}
+	tracing.End(bidding, nil)
+
+	selected := Select(strategy, bids, maxBids)
+	s.engine.record(ctx, log, s.trail, step, audit.EventSelection, selectionDecision(strategy, minBids, maxBids, bids, selected))
+
+	var outcome stepOutcome
+	if len(shadows) > 0 {
+		outcomes := s.runShadows(ctx, log, req.ExecutionID, step, loopID, shadows, executionTimeout)
+		defer func() { outcomes <- outcome }()
+	}
+
+	parallelism := phases.Execution.Parallelism
+	started := time.Now()
+	executionCtx, execution := tracing.Tracer().Start(ctx, "loop.execution", trace.WithAttributes(
+		attribute.String("loopstacks.selection_strategy", strategy),
+		attribute.String("loopstacks.parallelism", parallelism),
+		attribute.Int("loopstacks.selected", len(selected)),
+	))
+	results, err := s.runAgents(executionCtx, log, step, loopID, selected, remote, parallelism, executionTimeout)
+	if err == nil {
+		execution.SetAttributes(attribute.Int("loopstacks.results", len(results)))
+	}
+	tracing.End(execution, err)
+	if err != nil {
+		return nil, err
+	}
+	s.observePhase(metrics.PhaseExecution, started)
+	switch len(results) {
+	case len(selected):
+		s.observeSelection(strategy, metrics.OutcomeAnswered)
+	case 0:
+		s.observeSelection(strategy, metrics.OutcomeUnanswered)
+	default:
+		s.observeSelection(strategy, metrics.OutcomePartiallyAnswered)
+	}
+	if s.engine.History != nil {
+		s.recordRuns(ctx, log, req.ExecutionID, step, selected, remote, agents, results, started)
+	}
+
+	aggregation := phases.Output.AggregationStrategy
+	aggregating := time.Now()
+	_, outputSpan := tracing.Tracer().Start(ctx, "loop.output", trace.WithAttributes(attribute.String("loopstacks.aggregation_strategy", aggregation)))
+	output, err := Aggregate(aggregation, results)
+	tracing.End(outputSpan, err)
+	s.observePhase(metrics.PhaseAggregation, aggregating)
+	s.engine.record(ctx, log, s.trail, step, audit.EventAggregation, aggregationDecision(aggregation, output, err))
+	if err != nil {
+		return nil, err
+	}
+	outcome = stepOutcome{output: output, results: results}
+
+	var value interface{}
+	if len(output) > 0 {
+		if err := json.Unmarshal(output, &value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// stepOutputs encodes the outputs of the steps completed before a step by
+// step name, so that its agents can build on them
+func stepOutputs(previous []workflow.StepResult) (map[string]json.RawMessage, error) {
+	var outputs map[string]json.RawMessage
+	for _, res := range previous {
+		if res.Status != workflow.StepCompleted || res.Output == nil {
+			continue
+		}
+		data, err := json.Marshal(res.Output)
+		if err != nil {
+			return nil, fmt.Errorf("encoding the output of step %s: %w", res.Name, err)
+		}
+		if outputs == nil {
+			outputs = make(map[string]json.RawMessage, len(previous))
+		}
+		outputs[res.Name] = data
+	}
+	return outputs, nil
+}
+
+// observePhase observes the duration of a phase of the step that began at
+// start
+func (s *stepExecutor) observePhase(phase string, start time.Time) {
+	metrics.PhaseDuration.WithLabelValues(s.loopstack.Namespace, s.loopstack.Name, phase).Observe(time.Since(start).Seconds())
+}
+
+// observeSelection counts a selection outcome of strategy, labelled as
+// Select interprets it
+func (s *stepExecutor) observeSelection(strategy, outcome string) {
+	switch strategy {
+	case SelectFirst, SelectRandom, SelectAll:
+	default:
+		strategy = SelectBest
+	}
+	metrics.Selections.WithLabelValues(s.loopstack.Namespace, s.loopstack.Name, strategy, outcome).Inc()
+}
+
+// registeredAgents returns the agents registered in the realm by agent id
+func (s *stepExecutor) registeredAgents(ctx context.Context, log logr.Logger) map[string]protocol.Heartbeat {
+	heartbeats, err := s.engine.Backend.Agents(ctx)
+	if err != nil {
+		log.Error(err, "Failed to list registered agents")
+		return nil
+	}
+	agents := make(map[string]protocol.Heartbeat, len(heartbeats))
+	for _, heartbeat := range heartbeats {
+		agents[heartbeat.AgentID] = heartbeat
+	}
+	return agents
+}
+
+// recordRuns saves the runs of the realm's selected agents to the history.
+// Agents that did not answer count as failed, with the time they were
+// waited for as latency.
+func (s *stepExecutor) recordRuns(ctx context.Context, log logr.Logger, executionID, step string, selected []protocol.Bid, remote map[string]route, agents map[string]protocol.Heartbeat, results []AgentResult, started time.Time) {
+	now := time.Now()
+	answered := make(map[string]AgentResult, len(results))
+	for _, result := range results {
+		answered[result.AgentID] = result
+	}
+
+	runs := make([]history.AgentRun, 0, len(selected))
+	for _, bid := range selected {
+		if _, ok := remote[bid.AgentID]; ok {
+			continue
+		}
+		agent := agents[bid.AgentID]
+		run := history.AgentRun{
+			ExecutionID:   executionID,
+			Namespace:     s.realm.Namespace,
+			Realm:         s.realm.Name,
+			Step:          step,
+			AgentID:       bid.AgentID,
+			AgentInstance: agent.AgentInstance,
+			Revision:      agent.Revision,
+			Failed:        true,
+			Latency:       now.Sub(started),
+			CompletedAt:   now,
+		}
+		if result, ok := answered[bid.AgentID]; ok {
+			run.Failed = result.Error != ""
+			run.Latency = result.Latency
+		}
+		runs = append(runs, run)
+	}
+
+	if err := s.engine.History.SaveAgentRuns(context.WithoutCancel(ctx), runs); err != nil {
+		log.Error(err, "Failed to save agent runs", "step", step)
+	}
+}
+
+// collectBids announces the loop and gathers bids until the bidding
+// timeout or until maxBids agents have bid
+func (s *stepExecutor) collectBids(ctx context.Context, log logr.Logger, announcement *protocol.LoopAnnouncement, timeout time.Duration, maxBids int) ([]protocol.Bid, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return coordination.CollectBids(ctx, s.engine.Backend, announcement, maxBids, func() {
+		s.engine.record(ctx, log, s.trail, announcement.Step, audit.EventAnnounced, map[string]interface{}{
+			"loopId":       announcement.LoopID,
+			"capabilities": announcement.Capabilities,
+			"deadline":     announcement.Deadline,
+		})
+	})
+}
+
+// runAgents notifies the selected agents and waits for their results.
+// Sequential parallelism selects the next agent only once the previous one
+// has answered.
+func (s *stepExecutor) runAgents(ctx context.Context, log logr.Logger, step, loopID string, selected []protocol.Bid, remote map[string]route, parallelism string, timeout time.Duration) ([]AgentResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resultCh := make(chan protocol.Result)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.engine.Backend.SubscribeResults(ctx, loopID, func(ctx context.Context, result *protocol.Result) error {
+			select {
+			case resultCh <- *result:
+			case <-ctx.Done():
+			}
+			return nil
+		})
+	}()
+
+	batches := [][]protocol.Bid{selected}
+	if parallelism == "sequential" {
+		batches = make([][]protocol.Bid, 0, len(selected))
+		for _, bid := range selected {
+			batches = append(batches, []protocol.Bid{bid})
+		}
+	}
+
+	chosen := make(map[string]bool, len(selected))
+	for _, bid := range selected {
+		chosen[bid.AgentID] = true
+	}
+
+	// Each selected agent's invocation is a span, ended when its result
+	// arrives. Agents still running when runAgents returns did not answer.
+	spans := make(map[string]trace.Span, len(selected))
+	defer func() {
+		for _, span := range spans {
+			tracing.End(span, errNoResult)
+		}
+	}()
+
+	received := make(map[string]protocol.Result)
+	selectedAt := make(map[string]time.Time, len(selected))
+	latencies := make(map[string]time.Duration, len(selected))
+	for _, batch := range batches {
+		pending := make(map[string]bool, len(batch))
+		for _, bid := range batch {
+			if _, ok := received[bid.AgentID]; ok {
+				continue
+			}
+			r, routed := remote[bid.AgentID]
+			agentCtx, span := tracing.Tracer().Start(ctx, "loop.agent", trace.WithAttributes(
+				attribute.String("loopstacks.agent_id", bid.AgentID),
+				attribute.Float64("loopstacks.confidence", bid.Confidence),
+				attribute.Bool("loopstacks.routed", routed),
+			))
+			spans[bid.AgentID] = span
+			if routed {
+				if err := r.selectAgent(agentCtx, bid.AgentID); err != nil {
+					return nil, fmt.Errorf("failed to select agent %s in %s: %w", bid.AgentID, r, err)
+				}
+				go awaitRoute(ctx, r, bid.AgentID, resultCh)
+			} else if err := s.engine.Backend.Select(agentCtx, newSelection(agentCtx, loopID, bid.AgentID)); err != nil {
+				return nil, fmt.Errorf("failed to select agent %s: %w", bid.AgentID, err)
+			}
+			pending[bid.AgentID] = true
+			selectedAt[bid.AgentID] = time.Now()
+		}
+
+		for len(pending) > 0 {
+			select {
+			case result := <-resultCh:
+				if _, ok := received[result.AgentID]; ok || !chosen[result.AgentID] {
+					continue
+				}
+				received[result.AgentID] = result
+				latencies[result.AgentID] = time.Since(selectedAt[result.AgentID])
+				delete(pending, result.AgentID)
+				if span, ok := spans[result.AgentID]; ok {
+					tracing.Link(span, result.TraceContext)
+					var err error
+					if result.Error != "" {
+						err = errors.New(result.Error)
+					}
+					tracing.End(span, err)
+					delete(spans, result.AgentID)
+				}
+				s.engine.record(ctx, log, s.trail, step, audit.EventResult, result)
+			case err := <-errCh:
+				if err != nil && ctx.Err() == nil {
+					return nil, fmt.Errorf("failed to collect results: %w", err)
+				}
+				log.Info("Execution timed out waiting for agents", "loopId", loopID, "pending", len(pending))
+				return collect(selected, received, latencies), nil
+			case <-ctx.Done():
+				log.Info("Execution timed out waiting for agents", "loopId", loopID, "pending", len(pending))
+				return collect(selected, received, latencies), nil
+			}
+		}
+	}
+	return collect(selected, received, latencies), nil
+}
+
+// newSelection selects an agent for a loop, continuing the trace of ctx
+func newSelection(ctx context.Context, loopID, agentID string) *protocol.Selection {
+	selection := &protocol.Selection{LoopID: loopID, AgentID: agentID}
+	tracing.Inject(ctx, &selection.TraceContext)
+	return selection
+}
+
+// collect orders the received results by selection rank
+func collect(selected []protocol.Bid, received map[string]protocol.Result, latencies map[string]time.Duration) []AgentResult {
+	results := make([]AgentResult, 0, len(received))
+	for _, bid := range selected {
+		result, ok := received[bid.AgentID]
+		if !ok {
+			continue
+		}
+		results = append(results, AgentResult{
+			AgentID:    bid.AgentID,
+			Confidence: bid.Confidence,
+			Result:     result.Result,
+			Error:      result.Error,
+			Latency:    latencies[bid.AgentID],
+		})
+	}
+	return results
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/memory"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workflow"
+)
+
+// runAgent runs an agent speaking the coordination protocol over backend
+// until the test ends. It registers with heartbeat, bids on every loop it
+// has the capabilities of and answers the loops it is selected for with
+// handle.
+func runAgent(t *testing.T, backend coordination.Backend, heartbeat protocol.Heartbeat, handle func(*protocol.LoopAnnouncement) (interface{}, error)) {
+	t.Helper()
+	agentID := heartbeat.AgentID
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := backend.Heartbeat(ctx, &heartbeat); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+
+	// The consumers are created before the agent runs, so it receives
+	// every loop announced once this returns
+	stopped, stop := context.WithCancel(ctx)
+	stop()
+	_ = backend.SubscribeAnnouncements(stopped, agentID, nil)
+	_ = backend.SubscribeSelections(stopped, agentID, nil)
+
+	done := make(chan error, 2)
+	go func() {
+		done <- backend.SubscribeAnnouncements(ctx, agentID, func(ctx context.Context, announcement *protocol.LoopAnnouncement) error {
+			if !capable(heartbeat.Capabilities, announcement.Capabilities) {
+				return nil
+			}
+			return backend.Bid(ctx, &protocol.Bid{
+				LoopID:       announcement.LoopID,
+				AgentID:      agentID,
+				Timestamp:    time.Now().UnixMilli(),
+				Confidence:   1,
+				Capabilities: announcement.Capabilities,
+			})
+		})
+	}()
+	go func() {
+		done <- backend.SubscribeSelections(ctx, agentID, func(ctx context.Context, selection *protocol.Selection) error {
+			announcement, err := backend.Announcement(ctx, selection.LoopID)
+			if err != nil {
+				return err
+			}
+			result := &protocol.Result{LoopID: selection.LoopID, AgentID: agentID, Timestamp: time.Now().UnixMilli()}
+			output, err := handle(announcement)
+			if err == nil {
+				result.Result, err = json.Marshal(output)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			return backend.SubmitResult(ctx, result)
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		for range 2 {
+			if err := <-done; err != nil {
+				t.Errorf("agent %s: %v", agentID, err)
+			}
+		}
+	})
+}
+
+// capable reports whether have includes every capability of want
+func capable(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			found = found || h == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// TestExecutePassesStepOutputs checks that the agents of a step receive
+// the outputs of the steps before it
+func TestExecutePassesStepOutputs(t *testing.T) {
+	backend := memory.New(0)
+	announced := make(chan *protocol.LoopAnnouncement, 2)
+	runAgent(t, backend, protocol.Heartbeat{AgentID: "writer-0", Capabilities: []string{"draft"}}, func(a *protocol.LoopAnnouncement) (interface{}, error) {
+		announced <- a
+		return map[string]string{"draft": "Your order shipped"}, nil
+	})
+	runAgent(t, backend, protocol.Heartbeat{AgentID: "editor-0", Capabilities: []string{"review"}}, func(a *protocol.LoopAnnouncement) (interface{}, error) {
+		announced <- a
+		var draft struct {
+			Draft string `json:"draft"`
+		}
+		if err := json.Unmarshal(a.Steps["write"], &draft); err != nil {
+			return nil, err
+		}
+		return map[string]string{"reply": draft.Draft + "."}, nil
+	})
+
+	loopstack := &loopstacksv1.LoopStack{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "support"},
+		Spec: loopstacksv1.LoopStackSpec{
+			Phases: loopstacksv1.LoopStackPhases{
+				Bidding: loopstacksv1.LoopStackBiddingPhase{Timeout: "2s", MaxBids: 1},
+			},
+			Steps: []loopstacksv1.LoopStackStep{
+				{Name: "write", Type: workflow.StepTypeAgent, Capabilities: []string{"draft"}},
+				{Name: "edit", Type: workflow.StepTypeAgent, Capabilities: []string{"review"}},
+			},
+		},
+	}
+	engine := &Engine{Backend: backend, Log: logr.Discard()}
+	result, err := engine.Execute(context.Background(), Execution{
+		ID:        "exec-1",
+		LoopStack: loopstack,
+		Realm:     &loopstacksv1.Realm{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: DefaultRealm}},
+		Input:     json.RawMessage(`{"customer":"c-42"}`),
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	write, edit := <-announced, <-announced
+	if write.Step != "write" || len(write.Steps) != 0 {
+		t.Errorf("first step announced %s with steps %v, want write without steps", write.Step, write.Steps)
+	}
+	if edit.Step != "edit" || string(edit.Steps["write"]) != `{"draft":"Your order shipped"}` {
+		t.Errorf("second step announced %s with steps %v, want edit with the output of write", edit.Step, edit.Steps)
+	}
+	if string(edit.Input) != `{"customer":"c-42"}` {
+		t.Errorf("second step input = %s, want the execution input", edit.Input)
+	}
+	output, _ := json.Marshal(result.Steps[1].Output)
+	if string(output) != `{"reply":"Your order shipped."}` {
+		t.Errorf("edit output = %s", output)
+	}
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/audit"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// federationSlack covers the round trip to a peer on top of its bidding
+// timeout
+const federationSlack = 10 * time.Second
+
+// federate forwards an announcement to all peers at once and returns the
+// bids of agents that have not bid yet, adding the peer each remote agent
+// bid from to routes. Unreachable peers are skipped.
+func (s *stepExecutor) federate(ctx context.Context, log logr.Logger, announcement *protocol.LoopAnnouncement, timeout time.Duration, maxBids int, local []protocol.Bid, routes map[string]route) []protocol.Bid {
+	type peerBids struct {
+		bids []protocol.Bid
+		err  error
+	}
+
+	now := time.Now()
+	forwarded := *announcement
+	forwarded.Timestamp = now.UnixMilli()
+	forwarded.Deadline = now.Add(timeout).UnixMilli()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout+federationSlack)
+	defer cancel()
+
+	answers := make([]peerBids, len(s.peers))
+	var wg sync.WaitGroup
+	for i, endpoint := range s.peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bids, err := s.engine.Federation.Announce(ctx, endpoint, &forwarded, maxBids)
+			answers[i] = peerBids{bids: bids, err: err}
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool, len(local))
+	for _, bid := range local {
+		seen[bid.AgentID] = true
+	}
+
+	var bids []protocol.Bid
+	decision := make(map[string]interface{}, len(s.peers))
+	for i, endpoint := range s.peers {
+		answer := answers[i]
+		if answer.err != nil {
+			log.Error(answer.err, "Failed to forward loop to federation peer", "loopId", announcement.LoopID, "endpoint", endpoint)
+			decision[endpoint] = map[string]interface{}{"error": answer.err.Error()}
+			continue
+		}
+
+		agents := make([]string, 0, len(answer.bids))
+		for _, bid := range answer.bids {
+			if seen[bid.AgentID] {
+				continue
+			}
+			seen[bid.AgentID] = true
+			bids = append(bids, bid)
+			routes[bid.AgentID] = &peerRoute{client: s.engine.Federation, endpoint: endpoint, loopID: announcement.LoopID}
+			agents = append(agents, bid.AgentID)
+		}
+		decision[endpoint] = map[string]interface{}{"agents": agents}
+	}
+
+	s.engine.record(ctx, log, s.trail, announcement.Step, audit.EventFederated, decision)
+	return bids
+}
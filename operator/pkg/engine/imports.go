@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/audit"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/sharing"
+)
+
+// collectImported announces the loop in every exporting realm at once,
+// under a loop id of its own so realms sharing a backend do not mix their
+// bids, and returns the bids of their agents, adding the realm each agent
+// bid from to routes
+func (s *stepExecutor) collectImported(ctx context.Context, log logr.Logger, announcement *protocol.LoopAnnouncement, timeout time.Duration, maxBids int, exporters []sharing.Exporter, routes map[string]route) []protocol.Bid {
+	type realmBids struct {
+		route *realmRoute
+		bids  []protocol.Bid
+		err   error
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	answers := make([]realmBids, len(exporters))
+	var wg sync.WaitGroup
+	for i, exporter := range exporters {
+		name := exporter.Realm.Namespace + "/" + exporter.Realm.Name
+		r := &realmRoute{backend: exporter.Backend, realm: name, loopID: announcement.LoopID + "@" + exporter.Realm.Namespace + "." + exporter.Realm.Name}
+
+		imported := *announcement
+		imported.LoopID = r.loopID
+		imported.Realm = exporter.Realm.Name
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bids, err := coordination.CollectBids(ctx, exporter.Backend, &imported, maxBids, nil)
+			answers[i] = realmBids{route: r, bids: bids, err: err}
+		}()
+	}
+	wg.Wait()
+
+	var bids []protocol.Bid
+	decision := make(map[string]interface{}, len(exporters))
+	for _, answer := range answers {
+		if answer.err != nil {
+			log.Error(answer.err, "Failed to announce loop in exporting realm", "loopId", announcement.LoopID, "exporter", answer.route.realm)
+			decision[answer.route.realm] = map[string]interface{}{"error": answer.err.Error()}
+			continue
+		}
+
+		agents := make([]string, 0, len(answer.bids))
+		for _, bid := range answer.bids {
+			if _, ok := routes[bid.AgentID]; ok {
+				continue
+			}
+			routes[bid.AgentID] = answer.route
+			bids = append(bids, bid)
+			agents = append(agents, bid.AgentID)
+		}
+		decision[answer.route.realm] = map[string]interface{}{"loopId": answer.route.loopID, "agents": agents}
+	}
+
+	s.engine.record(ctx, log, s.trail, announcement.Step, audit.EventImported, decision)
+	return bids
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/federation"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// route reaches an agent that bid outside the executing realm's backend,
+// under the loop id it was announced with there
+type route interface {
+	selectAgent(ctx context.Context, agentID string) error
+	awaitResult(ctx context.Context, agentID string) (*protocol.Result, error)
+	String() string
+}
+
+// realmRoute reaches the agents of a realm exporting capabilities
+type realmRoute struct {
+	backend coordination.Backend
+	realm   string
+	loopID  string
+}
+
+func (r *realmRoute) selectAgent(ctx context.Context, agentID string) error {
+	return r.backend.Select(ctx, newSelection(ctx, r.loopID, agentID))
+}
+
+func (r *realmRoute) awaitResult(ctx context.Context, agentID string) (*protocol.Result, error) {
+	return coordination.AwaitResult(ctx, r.backend, r.loopID, agentID)
+}
+
+func (r *realmRoute) String() string {
+	return "realm " + r.realm
+}
+
+// peerRoute reaches the agents of a federation peer
+type peerRoute struct {
+	client   *federation.Client
+	endpoint string
+	loopID   string
+}
+
+func (r *peerRoute) selectAgent(ctx context.Context, agentID string) error {
+	return r.client.Select(ctx, r.endpoint, newSelection(ctx, r.loopID, agentID))
+}
+
+func (r *peerRoute) awaitResult(ctx context.Context, agentID string) (*protocol.Result, error) {
+	return r.client.AwaitResult(ctx, r.endpoint, r.loopID, agentID)
+}
+
+func (r *peerRoute) String() string {
+	return r.endpoint
+}
+
+// awaitRoute delivers a routed agent's result, or the failure to obtain
+// it, to results
+func awaitRoute(ctx context.Context, r route, agentID string, results chan<- protocol.Result) {
+	result, err := r.awaitResult(ctx, agentID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		result = &protocol.Result{
+			AgentID: agentID,
+			Error:   fmt.Sprintf("failed to get result from %s: %v", r, err),
+		}
+	}
+
+	select {
+	case results <- *result:
+	case <-ctx.Done():
+	}
+}
+
+// merge combines bids collected from several realms in bid time order.
+// Agents that bid twice keep their first bid.
+func merge(local, imported []protocol.Bid) []protocol.Bid {
+	if len(imported) == 0 {
+		return local
+	}
+
+	seen := make(map[string]bool, len(local))
+	bids := make([]protocol.Bid, 0, len(local)+len(imported))
+	for _, bid := range append(local, imported...) {
+		if !seen[bid.AgentID] {
+			seen[bid.AgentID] = true
+			bids = append(bids, bid)
+		}
+	}
+	sort.SliceStable(bids, func(i, j int) bool { return bids[i].Timestamp < bids[j].Timestamp })
+	return bids
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// Selection strategies of LoopStackBiddingPhase.SelectionStrategy
+const (
+	SelectFirst  = "first"
+	SelectRandom = "random"
+	SelectBest   = "best"
+	SelectAll    = "all"
+)
+
+// Select picks up to maxBids of the bids, which are in arrival order,
+// ranked by strategy. An empty or unknown strategy selects the best bids.
+func Select(strategy string, bids []protocol.Bid, maxBids int) []protocol.Bid {
+	ranked := make([]protocol.Bid, len(bids))
+	copy(ranked, bids)
+
+	switch strategy {
+	case SelectFirst, SelectAll:
+		// Arrival order
+	case SelectRandom:
+		rand.Shuffle(len(ranked), func(i, j int) { ranked[i], ranked[j] = ranked[j], ranked[i] })
+	default:
+		sort.SliceStable(ranked, func(i, j int) bool {
+			if ranked[i].Confidence != ranked[j].Confidence {
+				return ranked[i].Confidence > ranked[j].Confidence
+			}
+			return ranked[i].Timestamp < ranked[j].Timestamp
+		})
+	}
+
+	if strategy == SelectFirst {
+		maxBids = 1
+	}
+	if maxBids > 0 && len(ranked) > maxBids {
+		ranked = ranked[:maxBids]
+	}
+	return ranked
+}
+
+// selectionDecision describes a selection for the audit trail
+func selectionDecision(strategy string, minBids, maxBids int, bids, selected []protocol.Bid) map[string]interface{} {
+	if strategy == "" {
+		strategy = SelectBest
+	}
+
+	chosen := make(map[string]bool, len(selected))
+	agents := make([]string, 0, len(selected))
+	for _, bid := range selected {
+		chosen[bid.AgentID] = true
+		agents = append(agents, bid.AgentID)
+	}
+	rejected := make([]string, 0, len(bids)-len(selected))
+	for _, bid := range bids {
+		if !chosen[bid.AgentID] {
+			rejected = append(rejected, bid.AgentID)
+		}
+	}
+
+	return map[string]interface{}{
+		"strategy": strategy,
+		"minBids":  minBids,
+		"maxBids":  maxBids,
+		"selected": agents,
+		"rejected": rejected,
+	}
+}
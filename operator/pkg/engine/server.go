@@ -0,0 +1,627 @@
+package engine
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/backends"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/duration"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workflow"
+)
+
+// Executions API defaults
+const (
+	// DefaultRealm runs the executions that do not name a realm, as in the
+	// control plane
+	DefaultRealm = "default-realm"
+	// DefaultFinishedRetention is how long finished executions are kept in
+	// memory for status requests
+	DefaultFinishedRetention = 15 * time.Minute
+	// maxRequestSize bounds request bodies, which carry loop inputs
+	maxRequestSize = 8 << 20
+	// maxListLimit bounds the executions listed from the history
+	maxListLimit = 1000
+)
+
+// StatusRunning is the status of executions that have not finished
+const StatusRunning = "Running"
+
+// ExecutionRequest starts an execution of a LoopStack
+type ExecutionRequest struct {
+	LoopStack string `json:"loopstack"`
+	// Realm defaults to DefaultRealm
+	Realm string          `json:"realm,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+// ExecutionStatus is the state of an execution
+type ExecutionStatus struct {
+	ID          string                `json:"id"`
+	Namespace   string                `json:"namespace"`
+	Realm       string                `json:"realm"`
+	LoopStack   string                `json:"loopstack"`
+	Status      string                `json:"status"`
+	Error       string                `json:"error,omitempty"`
+	Input       json.RawMessage       `json:"input,omitempty"`
+	Output      json.RawMessage       `json:"output,omitempty"`
+	Steps       []workflow.StepResult `json:"steps,omitempty"`
+	StartedAt   time.Time             `json:"startedAt"`
+	CompletedAt *time.Time            `json:"completedAt,omitempty"`
+}
+
+// Server serves the executions API, through which LoopStacks are run and
+// their humanApproval steps decided. Each execution runs on an Engine built
+// from Engine with the backend of the execution's realm. Executions are
+// listed while they run and for FinishedRetention after; older ones are
+// looked up and searched in the engine's History. The Server runs as a manager Runnable
+// on the leader only, so every execution is run by one replica, and resumes
+// the executions paused on an approval when it starts.
+type Server struct {
+	Addr string
+	// TLS, when set, serves the API over TLS. Callers send bearer tokens,
+	// so only local development should do without.
+	TLS      *tls.Config
+	Client   client.Reader
+	Backends backends.Source
+	Auth     Auth
+	// Engine is copied for every execution, with the Backend of its realm
+	// and, when Approvals is set, an ApprovalGate saving to Approvals
+	Engine            Engine
+	Approvals         *ApprovalStore
+	FinishedRetention time.Duration
+	Log               logr.Logger
+
+	mu sync.Mutex
+	// ctx is cancelled when the server stops, interrupting executions
+	ctx        context.Context
+	executions map[string]*ExecutionStatus
+	wg         sync.WaitGroup
+}
+
+// Start implements manager.Runnable
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves the API on listener until ctx is cancelled, then waits for
+// the interrupted executions to return
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		s.wg.Wait()
+	}()
+
+	s.mu.Lock()
+	s.ctx = ctx
+	s.executions = make(map[string]*ExecutionStatus)
+	s.mu.Unlock()
+
+	if s.Approvals != nil {
+		if err := s.resume(ctx); err != nil {
+			return err
+		}
+	}
+
+	server := &http.Server{
+		Handler:           s.Handler(),
+		TLSConfig:         s.TLS,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.Log.Info("Serving executions API", "address", listener.Addr().String(), "tls", s.TLS != nil)
+		if s.TLS != nil {
+			errCh <- server.ServeTLS(listener, "", "")
+		} else {
+			errCh <- server.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (s *Server) NeedLeaderElection() bool {
+	return true
+}
+
+// Handler returns the API's routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /namespaces/{namespace}/executions", s.authenticated(s.createExecution))
+	mux.HandleFunc("GET /namespaces/{namespace}/executions/{id}", s.authenticated(s.getExecution))
+	if s.Engine.History != nil {
+		mux.HandleFunc("GET /namespaces/{namespace}/executions", s.authenticated(s.listExecutions))
+	}
+	if s.Approvals != nil {
+		mux.HandleFunc("GET /namespaces/{namespace}/approvals", s.authenticated(s.listApprovals))
+		mux.HandleFunc("POST /namespaces/{namespace}/approvals/{id}/{step}", s.authenticated(s.decideApproval))
+	}
+	return mux
+}
+
+type authenticatedHandler func(w http.ResponseWriter, r *http.Request, user authenticationv1.UserInfo)
+
+// authenticated resolves the caller of a request from its bearer token
+func (s *Server) authenticated(handler authenticatedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeError(w, http.StatusUnauthorized, errors.New("a bearer token is required"))
+			return
+		}
+		user, err := s.Auth.Authenticate(r.Context(), token)
+		if errors.Is(err, ErrUnauthenticated) {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if err != nil {
+			s.Log.Error(err, "Failed to authenticate request")
+			writeError(w, http.StatusInternalServerError, errors.New("failed to authenticate"))
+			return
+		}
+		handler(w, r, user)
+	}
+}
+
+// authorize checks that user may perform verb on the subresource of the
+// LoopStack name, or of any LoopStack when name is empty, and answers the
+// request when not
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, user authenticationv1.UserInfo, verb, name, subresource string) bool {
+	namespace := r.PathValue("namespace")
+	allowed, err := s.Auth.Authorize(r.Context(), user, verb, namespace, name, subresource)
+	if err != nil {
+		s.Log.Error(err, "Failed to authorize request", "user", user.Username)
+		writeError(w, http.StatusInternalServerError, errors.New("failed to authorize"))
+		return false
+	}
+	if !allowed {
+		resource := "loopstacks/" + subresource
+		if name != "" {
+			resource += " of " + name
+		}
+		writeError(w, http.StatusForbidden, fmt.Errorf("user %q cannot %s %s in namespace %s", user.Username, verb, resource, namespace))
+		return false
+	}
+	return true
+}
+
+func (s *Server) createExecution(w http.ResponseWriter, r *http.Request, user authenticationv1.UserInfo) {
+	var req ExecutionRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid execution request: %w", err))
+		return
+	}
+	if req.LoopStack == "" {
+		writeError(w, http.StatusBadRequest, errors.New("loopstack is required"))
+		return
+	}
+	if !s.authorize(w, r, user, "create", req.LoopStack, "executions") {
+		return
+	}
+	if req.Realm == "" {
+		req.Realm = DefaultRealm
+	}
+
+	namespace := r.PathValue("namespace")
+	var loopstack loopstacksv1.LoopStack
+	if !s.get(w, r, "LoopStack", types.NamespacedName{Namespace: namespace, Name: req.LoopStack}, &loopstack) {
+		return
+	}
+	var realm loopstacksv1.Realm
+	if !s.get(w, r, "Realm", types.NamespacedName{Namespace: namespace, Name: req.Realm}, &realm) {
+		return
+	}
+
+	backend, err := s.Backends.Backend(r.Context(), &realm)
+	if err != nil {
+		s.Log.Error(err, "Failed to connect to realm backend", "realm", req.Realm, "namespace", namespace)
+		writeError(w, http.StatusServiceUnavailable, errors.New("realm backend unavailable"))
+		return
+	}
+
+	status, err := s.start(Execution{
+		ID:        string(uuid.NewUUID()),
+		LoopStack: &loopstack,
+		Realm:     &realm,
+		Input:     req.Input,
+	}, backend)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	s.Log.Info("Started execution", "executionId", status.ID, "loopstack", loopstack.Name, "realm", realm.Name,
+		"namespace", namespace, "user", user.Username)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func (s *Server) getExecution(w http.ResponseWriter, r *http.Request, user authenticationv1.UserInfo) {
+	status, err := s.lookup(r.Context(), r.PathValue("namespace"), r.PathValue("id"))
+	if err != nil {
+		s.Log.Error(err, "Failed to look up execution", "executionId", r.PathValue("id"))
+		writeError(w, http.StatusInternalServerError, errors.New("failed to look up execution"))
+		return
+	}
+
+	// Whether an execution exists is only told to those who may see the
+	// executions of every LoopStack
+	name := ""
+	if status != nil {
+		name = status.LoopStack
+	}
+	if !s.authorize(w, r, user, "get", name, "executions") {
+		return
+	}
+	if status == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("execution %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// listExecutions searches the history of finished executions. Filters are
+// query parameters: realm, loopstack, status, since and until, as RFC 3339
+// times or durations before now such as 7d, input.FIELD matching top-level
+// string fields of the input, and limit.
+func (s *Server) listExecutions(w http.ResponseWriter, r *http.Request, user authenticationv1.UserInfo) {
+	params := r.URL.Query()
+	query := history.Query{
+		Namespace: r.PathValue("namespace"),
+		Realm:     params.Get("realm"),
+		LoopStack: params.Get("loopstack"),
+		Status:    params.Get("status"),
+	}
+	if !s.authorize(w, r, user, "list", query.LoopStack, "executions") {
+		return
+	}
+
+	now := time.Now()
+	for _, bound := range []struct {
+		param string
+		dst   *time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}} {
+		if value := params.Get(bound.param); value != "" {
+			t, err := parseTime(value, now)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %w", bound.param, err))
+				return
+			}
+			*bound.dst = t
+		}
+	}
+	for param, values := range params {
+		if field, ok := strings.CutPrefix(param, "input."); ok && field != "" {
+			if query.Input == nil {
+				query.Input = make(map[string]string)
+			}
+			query.Input[field] = values[0]
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q: must be between 1 and %d", value, maxListLimit))
+			return
+		}
+		query.Limit = limit
+	}
+
+	records, err := s.Engine.History.List(r.Context(), query)
+	if err != nil {
+		s.Log.Error(err, "Failed to list executions", "namespace", query.Namespace)
+		writeError(w, http.StatusInternalServerError, errors.New("failed to list executions"))
+		return
+	}
+	executions := make([]ExecutionStatus, 0, len(records))
+	for i := range records {
+		executions = append(executions, *recordStatus(&records[i]))
+	}
+	writeJSON(w, http.StatusOK, executions)
+}
+
+// parseTime reads an RFC 3339 time, or a duration before now
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := duration.Parse(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", value)
+	}
+	return now.Add(-d), nil
+}
+
+func (s *Server) listApprovals(w http.ResponseWriter, r *http.Request, user authenticationv1.UserInfo) {
+	if !s.authorize(w, r, user, "list", "", "approvals") {
+		return
+	}
+	requests, err := s.Approvals.Pending(r.Context(), r.PathValue("namespace"))
+	if err != nil {
+		s.Log.Error(err, "Failed to list pending approvals", "namespace", r.PathValue("namespace"))
+		writeError(w, http.StatusInternalServerError, errors.New("failed to list pending approvals"))
+		return
+	}
+	writeJSON(w, http.StatusOK, requests)
+}
+
+// decideApproval posts a decision on behalf of the caller, who must be
+// allowed to create approvals of the LoopStack and be one of the step's
+// approvers when it lists any
+func (s *Server) decideApproval(w http.ResponseWriter, r *http.Request, user authenticationv1.UserInfo) {
+	namespace, id, step := r.PathValue("namespace"), r.PathValue("id"), r.PathValue("step")
+	var decision workflow.ApprovalDecision
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(&decision); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid decision: %w", err))
+		return
+	}
+	if decision.Outcome != workflow.OutcomeApproved && decision.Outcome != workflow.OutcomeRejected {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid outcome %q: must be %q or %q",
+			decision.Outcome, workflow.OutcomeApproved, workflow.OutcomeRejected))
+		return
+	}
+
+	approval, err := s.Approvals.find(r.Context(), namespace, id, step)
+	if err != nil {
+		s.Log.Error(err, "Failed to look up approval", "executionId", id, "step", step)
+		writeError(w, http.StatusInternalServerError, errors.New("failed to look up approval"))
+		return
+	}
+	// As for executions, only those who may decide for every LoopStack are
+	// told whether an approval exists
+	name := ""
+	if approval != nil {
+		name = approval.execution.LoopStack
+	}
+	if !s.authorize(w, r, user, "create", name, "approvals") {
+		return
+	}
+
+	err = s.Approvals.Post(r.Context(), namespace, id, step, user.Username, decision)
+	switch {
+	case err == nil:
+		s.Log.Info("Approval decided", "executionId", id, "step", step, "outcome", decision.Outcome, "user", user.Username)
+		w.WriteHeader(http.StatusAccepted)
+	case errors.Is(err, workflow.ErrNoPendingApproval):
+		writeError(w, http.StatusNotFound, fmt.Errorf("no pending approval for step %s of execution %s", step, id))
+	case errors.Is(err, ErrNotApprover):
+		writeError(w, http.StatusForbidden, err)
+	case errors.Is(err, ErrAlreadyDecided):
+		writeError(w, http.StatusConflict, err)
+	default:
+		s.Log.Error(err, "Failed to post decision", "executionId", id, "step", step)
+		writeError(w, http.StatusInternalServerError, errors.New("failed to post decision"))
+	}
+}
+
+// resume restarts the executions paused on an approval. Approvals of
+// LoopStacks or Realms that were deleted are dropped; the others are
+// retried on the next start when their realm's backend is unavailable.
+func (s *Server) resume(ctx context.Context) error {
+	approvals, err := s.Approvals.list(ctx)
+	if err != nil {
+		return err
+	}
+	for _, approval := range approvals {
+		namespace := approval.configMap.Namespace
+		log := s.Log.WithValues("executionId", approval.request.ExecutionID, "step", approval.request.Step,
+			"loopstack", approval.execution.LoopStack, "namespace", namespace)
+
+		var loopstack loopstacksv1.LoopStack
+		var realm loopstacksv1.Realm
+		err := s.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: approval.execution.LoopStack}, &loopstack)
+		if err == nil {
+			err = s.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: approval.execution.Realm}, &realm)
+		}
+		if apierrors.IsNotFound(err) {
+			log.Info("Dropping approval of a deleted LoopStack or Realm", "realm", approval.execution.Realm)
+			if err := s.Approvals.Client.Delete(ctx, approval.configMap); err != nil && !apierrors.IsNotFound(err) {
+				log.Error(err, "Failed to delete approval")
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to resume execution %s: %w", approval.request.ExecutionID, err)
+		}
+
+		backend, err := s.Backends.Backend(ctx, &realm)
+		if err != nil {
+			log.Error(err, "Failed to connect to realm backend, execution not resumed", "realm", realm.Name)
+			continue
+		}
+		request := approval.request
+		if _, err := s.start(Execution{
+			ID:        request.ExecutionID,
+			LoopStack: &loopstack,
+			Realm:     &realm,
+			Input:     approval.execution.Input,
+			Paused:    &request,
+		}, backend); err != nil {
+			return err
+		}
+		log.Info("Resumed execution awaiting approval")
+	}
+	return nil
+}
+
+// get reads a LoopStack or Realm of a request, answering it on failure
+func (s *Server) get(w http.ResponseWriter, r *http.Request, kind string, key types.NamespacedName, obj client.Object) bool {
+	err := s.Client.Get(r.Context(), key, obj)
+	switch {
+	case err == nil:
+		return true
+	case apierrors.IsNotFound(err):
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s not found", kind, key))
+	default:
+		s.Log.Error(err, "Failed to get "+kind, "key", key)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to get %s %s", kind, key))
+	}
+	return false
+}
+
+// start runs an execution in the background until it finishes or the
+// server stops
+func (s *Server) start(execution Execution, backend coordination.Backend) (ExecutionStatus, error) {
+	status := &ExecutionStatus{
+		ID:        execution.ID,
+		Namespace: execution.LoopStack.Namespace,
+		Realm:     execution.Realm.Name,
+		LoopStack: execution.LoopStack.Name,
+		Status:    StatusRunning,
+		Input:     execution.Input,
+		StartedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	if s.ctx == nil || s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return ExecutionStatus{}, errors.New("the executions API is not running")
+	}
+	ctx := s.ctx
+	s.prune()
+	s.executions[status.ID] = status
+	s.wg.Add(1)
+	started := *status
+	s.mu.Unlock()
+
+	engine := s.Engine
+	engine.Backend = backend
+	if s.Approvals != nil {
+		engine.Approvals = s.Approvals.gate(execution, s.Log.WithValues("executionId", execution.ID))
+	}
+	go func() {
+		defer s.wg.Done()
+		result, err := engine.Execute(ctx, execution)
+		s.finish(status, result, err)
+	}()
+	return started, nil
+}
+
+// finish records the outcome of an execution
+func (s *Server) finish(status *ExecutionStatus, result *workflow.Result, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	status.CompletedAt = &now
+	status.Status = history.StatusCompleted
+	if err != nil {
+		status.Status = history.StatusFailed
+		status.Error = err.Error()
+	}
+	if result != nil {
+		status.Steps = result.Steps
+		if result.Output != nil {
+			status.Output, _ = json.Marshal(result.Output)
+		}
+	}
+}
+
+// prune forgets the executions that finished more than FinishedRetention
+// ago. s.mu must be held.
+func (s *Server) prune() {
+	retention := s.FinishedRetention
+	if retention <= 0 {
+		retention = DefaultFinishedRetention
+	}
+	for id, status := range s.executions {
+		if status.CompletedAt != nil && time.Since(*status.CompletedAt) > retention {
+			delete(s.executions, id)
+		}
+	}
+}
+
+// lookup returns the status of an execution of namespace, or nil when it
+// is unknown
+func (s *Server) lookup(ctx context.Context, namespace, id string) (*ExecutionStatus, error) {
+	s.mu.Lock()
+	if status, ok := s.executions[id]; ok {
+		copied := *status
+		s.mu.Unlock()
+		if copied.Namespace != namespace {
+			return nil, nil
+		}
+		return &copied, nil
+	}
+	s.mu.Unlock()
+
+	if s.Engine.History == nil {
+		return nil, nil
+	}
+	record, err := s.Engine.History.Get(ctx, id)
+	if errors.Is(err, history.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.Namespace != namespace {
+		return nil, nil
+	}
+	return recordStatus(record), nil
+}
+
+// recordStatus returns the status of an execution from its history record
+func recordStatus(record *history.Record) *ExecutionStatus {
+	completedAt := record.CompletedAt
+	return &ExecutionStatus{
+		ID:          record.ID,
+		Namespace:   record.Namespace,
+		Realm:       record.Realm,
+		LoopStack:   record.LoopStack,
+		Status:      record.Status,
+		Error:       record.Error,
+		Input:       record.Input,
+		Output:      record.Output,
+		Steps:       record.Steps,
+		StartedAt:   record.StartedAt,
+		CompletedAt: &completedAt,
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
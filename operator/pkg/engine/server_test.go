@@ -0,0 +1,487 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/audit"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/memory"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history/sqlite"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/rollout"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/shadow"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workflow"
+)
+
+// testAuth knows users by token and allows them what allowed lists
+type testAuth struct {
+	users   map[string]string
+	allowed map[string]bool
+}
+
+func (a *testAuth) Authenticate(ctx context.Context, token string) (authenticationv1.UserInfo, error) {
+	username, ok := a.users[token]
+	if !ok {
+		return authenticationv1.UserInfo{}, ErrUnauthenticated
+	}
+	return authenticationv1.UserInfo{Username: username}, nil
+}
+
+func (a *testAuth) Authorize(ctx context.Context, user authenticationv1.UserInfo, verb, namespace, name, subresource string) (bool, error) {
+	return a.allowed[fmt.Sprintf("%s %s %s/%s", user.Username, verb, namespace, subresource)], nil
+}
+
+// staticBackends connects every realm to the same backend
+type staticBackends struct {
+	backend coordination.Backend
+}
+
+func (s staticBackends) Backend(ctx context.Context, realm *loopstacksv1.Realm) (coordination.Backend, error) {
+	return s.backend, nil
+}
+
+func newTestClient(t *testing.T, objects ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := loopstacksv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+// serve runs server on a local port until stopped or the test ends and
+// returns its URL
+func serve(t *testing.T, server *Server) (url string, stop func()) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ctx, listener) }()
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("Serve() error = %v", err)
+			}
+		})
+	}
+	t.Cleanup(stop)
+	return "http://" + listener.Addr().String(), stop
+}
+
+func request(t *testing.T, method, url, token string, body interface{}, out interface{}) int {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// TestServerExecutes runs a LoopStack through the executions API with an
+// agent on an in-memory backend, and checks what the execution recorded
+func TestServerExecutes(t *testing.T) {
+	ctx := context.Background()
+	backend := memory.New(0)
+
+	loopstack := &loopstacksv1.LoopStack{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "support"},
+		Spec: loopstacksv1.LoopStackSpec{
+			Capabilities: []string{"reply"},
+			Phases: loopstacksv1.LoopStackPhases{
+				Bidding: loopstacksv1.LoopStackBiddingPhase{Timeout: "2s", MaxBids: 1},
+			},
+		},
+	}
+	realm := &loopstacksv1.Realm{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: DefaultRealm}}
+	realm.Spec.Governance.LoopAuditingEnabled = true
+	c := newTestClient(t, loopstack, realm)
+
+	store, err := sqlite.Open(ctx, filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("sqlite.Open() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	trails, err := audit.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	runAgent(t, backend, protocol.Heartbeat{
+		AgentID:       "support-agents-r1-0",
+		Agent:         "support-agent",
+		AgentInstance: "support-agents",
+		Revision:      "r1",
+		Realm:         DefaultRealm,
+		Capabilities:  []string{"reply"},
+	}, func(announcement *protocol.LoopAnnouncement) (interface{}, error) {
+		var input struct {
+			Customer string `json:"customer"`
+		}
+		if err := json.Unmarshal(announcement.Input, &input); err != nil {
+			return nil, err
+		}
+		return map[string]string{"reply": "hello " + input.Customer}, nil
+	})
+
+	url, _ := serve(t, &Server{
+		Client:   c,
+		Backends: staticBackends{backend},
+		Auth: &testAuth{
+			users:   map[string]string{"token": "alice"},
+			allowed: map[string]bool{"alice create default/executions": true, "alice get default/executions": true},
+		},
+		Engine: Engine{
+			History:  store,
+			Audit:    trails,
+			Rollouts: &rollout.Router{Client: c},
+			Shadows:  &shadow.Evaluator{Client: c, Store: store},
+		},
+	})
+
+	var started ExecutionStatus
+	code := request(t, http.MethodPost, url+"/namespaces/default/executions", "token", ExecutionRequest{
+		LoopStack: "support",
+		Input:     json.RawMessage(`{"customer":"c-42"}`),
+	}, &started)
+	if code != http.StatusAccepted {
+		t.Fatalf("POST executions = %d, want %d", code, http.StatusAccepted)
+	}
+	if started.Status != StatusRunning || started.Realm != DefaultRealm {
+		t.Errorf("started execution = %+v", started)
+	}
+
+	status := awaitExecution(t, url, started.ID)
+	if status.Status != history.StatusCompleted {
+		t.Fatalf("execution status = %s (%s), want %s", status.Status, status.Error, history.StatusCompleted)
+	}
+	if string(status.Output) != `{"reply":"hello c-42"}` {
+		t.Errorf("execution output = %s", status.Output)
+	}
+
+	record, err := store.Get(ctx, started.ID)
+	if err != nil {
+		t.Fatalf("history Get() error = %v", err)
+	}
+	if record.Status != history.StatusCompleted || record.LoopStack != "support" || record.Realm != DefaultRealm || len(record.Steps) != 1 {
+		t.Errorf("history record = %+v", record)
+	}
+	stats, err := store.AgentStats(ctx, history.AgentStatsQuery{Namespace: "default", AgentInstance: "support-agents", Revision: "r1"})
+	if err != nil {
+		t.Fatalf("AgentStats() error = %v", err)
+	}
+	if stats.Runs != 1 || stats.Failures != 0 {
+		t.Errorf("AgentStats() = %+v, want one successful run", stats)
+	}
+
+	events, err := trails.Events(ctx, started.ID)
+	if err != nil {
+		t.Fatalf("audit Events() error = %v", err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	want := []string{audit.EventInput, audit.EventAnnounced, audit.EventBids, audit.EventSelection, audit.EventResult, audit.EventAggregation, audit.EventCompleted}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("audit events = %v, want %v", types, want)
+	}
+	var exported bytes.Buffer
+	if err := audit.Export(ctx, trails, started.ID, &exported); err != nil {
+		t.Fatalf("audit Export() error = %v", err)
+	}
+	if n, err := audit.Verify(&exported); err != nil || n != len(want) {
+		t.Errorf("audit Verify() = %d, %v, want %d events", n, err, len(want))
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	url, _ := serve(t, &Server{
+		Client:   newTestClient(t),
+		Backends: staticBackends{memory.New(0)},
+		Auth: &testAuth{
+			users:   map[string]string{"token": "bob"},
+			allowed: map[string]bool{"bob get default/executions": true},
+		},
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "no token", method: http.MethodPost, path: "/namespaces/default/executions", want: http.StatusUnauthorized},
+		{name: "unknown token", method: http.MethodPost, path: "/namespaces/default/executions", token: "forged", want: http.StatusUnauthorized},
+		{name: "not allowed to create", method: http.MethodPost, path: "/namespaces/default/executions", token: "token", want: http.StatusForbidden},
+		{name: "not allowed in namespace", method: http.MethodGet, path: "/namespaces/other/executions/e-1", token: "token", want: http.StatusForbidden},
+		{name: "unknown execution", method: http.MethodGet, path: "/namespaces/default/executions/e-1", token: "token", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := request(t, tt.method, url+tt.path, tt.token, ExecutionRequest{LoopStack: "support"}, nil); got != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestServerListExecutions searches the execution history, e.g. for what
+// the agents told a customer last week
+func TestServerListExecutions(t *testing.T) {
+	ctx := context.Background()
+	store, err := sqlite.Open(ctx, filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("sqlite.Open() error = %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	for _, record := range []history.Record{
+		{ID: "e-1", Namespace: "default", Realm: "default-realm", LoopStack: "support", Status: history.StatusCompleted,
+			Input: json.RawMessage(`{"customerId":"c-42"}`), CompletedAt: now.Add(-10 * 24 * time.Hour)},
+		{ID: "e-2", Namespace: "default", Realm: "default-realm", LoopStack: "support", Status: history.StatusCompleted,
+			Input: json.RawMessage(`{"customerId":"c-42"}`), Output: json.RawMessage(`{"answer":"shipped"}`), CompletedAt: now.Add(-2 * 24 * time.Hour)},
+		{ID: "e-3", Namespace: "default", Realm: "default-realm", LoopStack: "support", Status: history.StatusFailed,
+			Input: json.RawMessage(`{"customerId":"c-7"}`), CompletedAt: now.Add(-24 * time.Hour)},
+		{ID: "e-4", Namespace: "other", Realm: "default-realm", LoopStack: "support", Status: history.StatusCompleted,
+			Input: json.RawMessage(`{"customerId":"c-42"}`), CompletedAt: now.Add(-24 * time.Hour)},
+	} {
+		if err := store.Save(ctx, &record); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	url, _ := serve(t, &Server{
+		Client:   newTestClient(t),
+		Backends: staticBackends{memory.New(0)},
+		Engine:   Engine{History: store},
+		Auth: &testAuth{
+			users:   map[string]string{"token": "alice", "other": "bob"},
+			allowed: map[string]bool{"alice list default/executions": true},
+		},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		token string
+		want  []string
+		code  int
+	}{
+		{name: "all", token: "token", want: []string{"e-3", "e-2", "e-1"}, code: http.StatusOK},
+		{name: "customer last week", query: "?input.customerId=c-42&since=7d", token: "token", want: []string{"e-2"}, code: http.StatusOK},
+		{name: "status", query: "?status=Failed", token: "token", want: []string{"e-3"}, code: http.StatusOK},
+		{name: "until", query: "?until=" + now.Add(-5*24*time.Hour).UTC().Format(time.RFC3339), token: "token", want: []string{"e-1"}, code: http.StatusOK},
+		{name: "limit", query: "?limit=1", token: "token", want: []string{"e-3"}, code: http.StatusOK},
+		{name: "invalid since", query: "?since=yesterday", token: "token", code: http.StatusBadRequest},
+		{name: "invalid limit", query: "?limit=0", token: "token", code: http.StatusBadRequest},
+		{name: "not allowed", token: "other", code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var executions []ExecutionStatus
+			if got := request(t, http.MethodGet, url+"/namespaces/default/executions"+tt.query, tt.token, nil, &executions); got != tt.code {
+				t.Fatalf("GET executions%s = %d, want %d", tt.query, got, tt.code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			ids := make([]string, 0, len(executions))
+			for _, execution := range executions {
+				ids = append(ids, execution.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("GET executions%s = %v, want %v", tt.query, ids, tt.want)
+			}
+		})
+	}
+
+	var executions []ExecutionStatus
+	request(t, http.MethodGet, url+"/namespaces/default/executions?input.customerId=c-42&since=7d", "token", nil, &executions)
+	if len(executions) == 1 && (string(executions[0].Output) != `{"answer":"shipped"}` || string(executions[0].Input) != `{"customerId":"c-42"}`) {
+		t.Errorf("execution = %+v, want its input and output", executions[0])
+	}
+}
+
+// TestServerApprovals pauses an execution on an approval, restarts the
+// server and decides the approval as an authenticated approver
+func TestServerApprovals(t *testing.T) {
+	loopstack := &loopstacksv1.LoopStack{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "release"},
+		Spec: loopstacksv1.LoopStackSpec{
+			Capabilities: []string{"publish"},
+			Steps: []loopstacksv1.LoopStackStep{{
+				Name: "signoff",
+				Type: workflow.StepTypeHumanApproval,
+				HumanApproval: &loopstacksv1.LoopStackHumanApproval{
+					Message:   "Publish the release?",
+					Approvers: []string{"carol"},
+				},
+			}},
+		},
+	}
+	realm := &loopstacksv1.Realm{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: DefaultRealm}}
+	c := newTestClient(t, loopstack, realm)
+	auth := &testAuth{
+		users: map[string]string{"token": "alice", "carol": "carol"},
+		allowed: map[string]bool{
+			"alice create default/executions": true,
+			"alice get default/executions":    true,
+			"alice list default/approvals":    true,
+			"alice create default/approvals":  true,
+			"carol create default/approvals":  true,
+		},
+	}
+	newServer := func() *Server {
+		return &Server{
+			Client:    c,
+			Backends:  staticBackends{memory.New(0)},
+			Auth:      auth,
+			Approvals: &ApprovalStore{Client: c, Reader: c},
+		}
+	}
+
+	url, stop := serve(t, newServer())
+	var started ExecutionStatus
+	if code := request(t, http.MethodPost, url+"/namespaces/default/executions", "token", ExecutionRequest{LoopStack: "release"}, &started); code != http.StatusAccepted {
+		t.Fatalf("POST executions = %d, want %d", code, http.StatusAccepted)
+	}
+	pending := awaitApprovals(t, url, 1)
+	if pending[0].ExecutionID != started.ID || pending[0].Step != "signoff" || pending[0].Message != "Publish the release?" {
+		t.Fatalf("pending approval = %+v", pending[0])
+	}
+
+	// Restarting interrupts the execution, which resumes from its approval
+	stop()
+	url, _ = serve(t, newServer())
+	awaitApprovals(t, url, 1)
+
+	decisions := url + "/namespaces/default/approvals/" + started.ID + "/signoff"
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		decision workflow.ApprovalDecision
+		want     int
+	}{
+		{name: "no token", path: decisions, decision: workflow.ApprovalDecision{Outcome: workflow.OutcomeApproved}, want: http.StatusUnauthorized},
+		{name: "invalid outcome", path: decisions, token: "carol", decision: workflow.ApprovalDecision{Outcome: "maybe"}, want: http.StatusBadRequest},
+		{name: "unknown step", path: url + "/namespaces/default/approvals/" + started.ID + "/publish", token: "token", decision: workflow.ApprovalDecision{Outcome: workflow.OutcomeApproved}, want: http.StatusNotFound},
+		{name: "not an approver", path: decisions, token: "token", decision: workflow.ApprovalDecision{Outcome: workflow.OutcomeApproved}, want: http.StatusForbidden},
+		{
+			name:     "approver claimed in the body is ignored",
+			path:     decisions,
+			token:    "token",
+			decision: workflow.ApprovalDecision{Outcome: workflow.OutcomeApproved, Approver: "carol"},
+			want:     http.StatusForbidden,
+		},
+		{name: "approver", path: decisions, token: "carol", decision: workflow.ApprovalDecision{Outcome: workflow.OutcomeApproved, Comment: "ship it"}, want: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := request(t, http.MethodPost, tt.path, tt.token, tt.decision, nil); got != tt.want {
+				t.Errorf("POST %s = %d, want %d", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	status := awaitExecution(t, url, started.ID)
+	if status.Status != history.StatusCompleted || len(status.Steps) != 1 {
+		t.Fatalf("execution = %+v, want one completed step", status)
+	}
+	output, _ := json.Marshal(status.Steps[0].Output)
+	if want := `{"approved":true,"approver":"carol","comment":"ship it","outcome":"approved","timedOut":false}`; string(output) != want {
+		t.Errorf("approval output = %s, want %s", output, want)
+	}
+	var configMaps corev1.ConfigMapList
+	if err := c.List(context.Background(), &configMaps, client.HasLabels{ApprovalLabel}); err != nil {
+		t.Fatal(err)
+	}
+	if len(configMaps.Items) != 0 {
+		t.Errorf("%d approvals left after the decision", len(configMaps.Items))
+	}
+}
+
+func awaitApprovals(t *testing.T, url string, n int) []workflow.ApprovalRequest {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var pending []workflow.ApprovalRequest
+		if code := request(t, http.MethodGet, url+"/namespaces/default/approvals", "token", nil, &pending); code != http.StatusOK {
+			t.Fatalf("GET approvals = %d, want %d", code, http.StatusOK)
+		}
+		if len(pending) == n {
+			return pending
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d pending approvals, want %d", len(pending), n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func awaitExecution(t *testing.T, url, id string) ExecutionStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var status ExecutionStatus
+		if code := request(t, http.MethodGet, url+"/namespaces/default/executions/"+id, "token", nil, &status); code != http.StatusOK {
+			t.Fatalf("GET execution = %d, want %d", code, http.StatusOK)
+		}
+		if status.Status != StatusRunning {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("execution %s still running", id)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// shadowAgent is a bidding agent of a shadow AgentInstance
+type shadowAgent struct {
+	heartbeat protocol.Heartbeat
+	// agent is the name of the Agent it runs
+	agent string
+}
+
+// stepOutcome is what a step's shadow agents are compared with
+type stepOutcome struct {
+	output  json.RawMessage
+	results []AgentResult
+}
+
+// splitShadows separates the bids of shadow agents, which never count
+// towards MinBids nor compete for selection
+func (s *stepExecutor) splitShadows(ctx context.Context, log logr.Logger, agents map[string]protocol.Heartbeat, bids []protocol.Bid) ([]protocol.Bid, []shadowAgent) {
+	instances, err := s.engine.Shadows.Instances(ctx, s.realm.Namespace)
+	if err != nil {
+		log.Error(err, "Failed to list shadow AgentInstances")
+		return bids, nil
+	}
+	if len(instances) == 0 {
+		return bids, nil
+	}
+
+	var shadows []shadowAgent
+	regular := make([]protocol.Bid, 0, len(bids))
+	for _, bid := range bids {
+		heartbeat := agents[bid.AgentID]
+		if instance, ok := instances[heartbeat.AgentInstance]; ok {
+			shadows = append(shadows, shadowAgent{heartbeat: heartbeat, agent: instance.Spec.Agent})
+			continue
+		}
+		regular = append(regular, bid)
+	}
+	return regular, shadows
+}
+
+// runShadows selects the shadow agents and awaits their results in the
+// background until the execution timeout. Once the step's outcome is sent
+// on the returned channel, which must happen exactly once, their results
+// are compared with it and recorded. Neither delays the step.
+func (s *stepExecutor) runShadows(ctx context.Context, log logr.Logger, executionID, step, loopID string, shadows []shadowAgent, timeout time.Duration) chan<- stepOutcome {
+	outcomes := make(chan stepOutcome, 1)
+	background := context.WithoutCancel(ctx)
+	ctx, cancel := context.WithTimeout(background, timeout)
+
+	var wg sync.WaitGroup
+	runs := make([]history.ShadowRun, len(shadows))
+	for i, shadow := range shadows {
+		runs[i] = history.ShadowRun{
+			ExecutionID:   executionID,
+			Namespace:     s.realm.Namespace,
+			Realm:         s.realm.Name,
+			Step:          step,
+			AgentID:       shadow.heartbeat.AgentID,
+			AgentInstance: shadow.heartbeat.AgentInstance,
+			Revision:      shadow.heartbeat.Revision,
+		}
+		selected := time.Now()
+		if err := s.engine.Backend.Select(ctx, newSelection(ctx, loopID, shadow.heartbeat.AgentID)); err != nil {
+			runs[i].Error = fmt.Sprintf("failed to select agent: %v", err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(run *history.ShadowRun) {
+			defer wg.Done()
+			result, err := coordination.AwaitResult(ctx, s.engine.Backend, loopID, run.AgentID)
+			run.Latency = time.Since(selected)
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				run.Error = "no result before the execution timeout"
+			case err != nil:
+				run.Error = fmt.Sprintf("failed to get result: %v", err)
+			default:
+				run.Result = result.Result
+				run.Error = result.Error
+			}
+		}(&runs[i])
+	}
+
+	go func() {
+		defer cancel()
+		wg.Wait()
+		outcome := <-outcomes
+
+		results := make([]json.RawMessage, 0, len(outcome.results))
+		for _, result := range outcome.results {
+			if result.Error == "" {
+				results = append(results, result.Result)
+			}
+		}
+		now := time.Now()
+		for i := range runs {
+			runs[i].CompletedAt = now
+			if err := s.engine.Shadows.Compare(background, &runs[i], shadows[i].agent, outcome.output, results); err != nil {
+				log.Error(err, "Failed to compare shadow result", "agentId", runs[i].AgentID)
+			}
+		}
+		if err := s.engine.Shadows.Record(background, runs); err != nil {
+			log.Error(err, "Failed to save shadow runs", "loopId", loopID)
+		}
+	}()
+	return outcomes
+}
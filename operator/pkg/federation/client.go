@@ -0,0 +1,151 @@
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// DefaultResultPoll is how long a single result request waits at the peer
+const DefaultResultPoll = 30 * time.Second
+
+// ErrNoResult is returned by Result when the agent has not answered yet
+var ErrNoResult = errors.New("no result yet")
+
+// Client calls the federation API of peer realms
+type Client struct {
+	HTTP *http.Client
+}
+
+// NewClient creates a client authenticating with the given TLS config
+func NewClient(config *tls.Config) *Client {
+	return &Client{HTTP: &http.Client{Transport: &http.Transport{
+		TLSClientConfig:     config,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+	}}}
+}
+
+// Probe fetches a peer realm's info
+func (c *Client) Probe(ctx context.Context, endpoint string) (*RealmInfo, error) {
+	var info RealmInfo
+	if err := c.do(ctx, http.MethodGet, endpoint, nil, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Announce forwards a loop to a peer realm and returns the bids its agents
+// placed before the announcement's deadline
+func (c *Client) Announce(ctx context.Context, endpoint string, announcement *protocol.LoopAnnouncement, maxBids int) ([]protocol.Bid, error) {
+	target, err := url.JoinPath(endpoint, "loops")
+	if err != nil {
+		return nil, err
+	}
+	body, err := protocol.Encode(announcement)
+	if err != nil {
+		return nil, err
+	}
+
+	var response BidsResponse
+	query := url.Values{"maxBids": {strconv.Itoa(maxBids)}}
+	if err := c.do(ctx, http.MethodPost, target, query, body, &response); err != nil {
+		return nil, err
+	}
+	return response.Bids, nil
+}
+
+// Select notifies a peer realm's agent that it was selected
+func (c *Client) Select(ctx context.Context, endpoint string, selection *protocol.Selection) error {
+	target, err := url.JoinPath(endpoint, "loops", selection.LoopID, "selections")
+	if err != nil {
+		return err
+	}
+	body, err := protocol.Encode(selection)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, target, nil, body, nil)
+}
+
+// Result waits up to wait for a peer realm's agent to submit its result,
+// returning ErrNoResult if it has not
+func (c *Client) Result(ctx context.Context, endpoint, loopID, agentID string, wait time.Duration) (*protocol.Result, error) {
+	target, err := url.JoinPath(endpoint, "loops", loopID, "results", agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result protocol.Result
+	query := url.Values{"wait": {wait.String()}}
+	if err := c.do(ctx, http.MethodGet, target, query, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.AgentID == "" {
+		return nil, ErrNoResult
+	}
+	return &result, nil
+}
+
+// AwaitResult polls a peer realm until its agent submits a result or ctx
+// is done
+func (c *Client) AwaitResult(ctx context.Context, endpoint, loopID, agentID string) (*protocol.Result, error) {
+	for {
+		wait := DefaultResultPoll
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			wait = time.Until(deadline)
+		}
+		result, err := c.Result(ctx, endpoint, loopID, agentID, wait)
+		if !errors.Is(err, ErrNoResult) {
+			return result, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, target string, query url.Values, body []byte, out interface{}) error {
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var failure errorResponse
+		if json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&failure) == nil && failure.Error != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, target, resp.Status, failure.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, target, resp.Status)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
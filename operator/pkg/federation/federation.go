@@ -0,0 +1,50 @@
+// Package federation lets realms in different clusters borrow each other's
+// agents. A federated realm that receives fewer bids than MinBids forwards
+// the loop to the realms listed in its FederationEndpoints; each peer
+// announces it to its own agents and returns their bids, and the selected
+// remote agents' results come back over the same API.
+//
+// The API is JSON over HTTPS with mutual TLS: peers trust each other's
+// certificates through a shared federation CA. A realm only serves the
+// peers whose certificates match the hosts of its FederationEndpoints or
+// the names in its FederationPeers. Each realm is served under
+// /realms/<namespace>/<realm>:
+//
+//	GET  /realms/<ns>/<realm>                                  RealmInfo, used as health probe
+//	POST /realms/<ns>/<realm>/loops                            announce, returns the BidsResponse
+//	POST /realms/<ns>/<realm>/loops/<loopId>/selections        select a bidding agent
+//	GET  /realms/<ns>/<realm>/loops/<loopId>/results/<agentId> wait for an agent's result
+package federation
+
+import (
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// IsolationFederated is the RealmSpec.Isolation of realms taking part in
+// federation
+const IsolationFederated = "federated"
+
+// Enabled reports whether a realm forwards loops to peers and serves loops
+// forwarded by them
+func Enabled(realm *loopstacksv1.Realm) bool {
+	return realm.Spec.Isolation == IsolationFederated
+}
+
+// RealmInfo describes a served realm
+type RealmInfo struct {
+	Namespace       string `json:"namespace"`
+	Realm           string `json:"realm"`
+	Agents          int    `json:"agents"`
+	ProtocolVersion string `json:"protocolVersion"`
+}
+
+// BidsResponse carries the bids a peer's agents placed on a forwarded loop
+type BidsResponse struct {
+	Bids []protocol.Bid `json:"bids"`
+}
+
+// errorResponse is the body of failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
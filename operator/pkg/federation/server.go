@@ -0,0 +1,288 @@
+package federation
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/backends"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/tracing"
+)
+
+// Server defaults
+const (
+	DefaultMaxBiddingTimeout = 30 * time.Second
+	DefaultMaxResultWait     = 60 * time.Second
+	// maxMessageSize bounds request bodies, which carry loop inputs
+	maxMessageSize = 8 << 20
+)
+
+// Server serves the federation API of the cluster's federated realms. It
+// runs as a manager Runnable on every replica.
+type Server struct {
+	Addr     string
+	TLS      *tls.Config
+	Client   client.Client
+	Backends backends.Source
+	// MaxBiddingTimeout caps how long a forwarded loop is open for bidding
+	MaxBiddingTimeout time.Duration
+	// MaxResultWait caps how long a result request waits
+	MaxResultWait time.Duration
+	Log           logr.Logger
+}
+
+// Start implements manager.Runnable
+func (s *Server) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.Addr,
+		Handler:           s.Handler(),
+		TLSConfig:         s.TLS,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.Log.Info("Serving federation API", "address", s.Addr)
+		errCh <- server.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Handler returns the API's routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /realms/{namespace}/{realm}", s.realm(s.info))
+	mux.HandleFunc("POST /realms/{namespace}/{realm}/loops", s.realm(s.announce))
+	mux.HandleFunc("POST /realms/{namespace}/{realm}/loops/{loopId}/selections", s.realm(s.selectAgent))
+	mux.HandleFunc("GET /realms/{namespace}/{realm}/loops/{loopId}/results/{agentId}", s.realm(s.result))
+	return mux
+}
+
+type realmHandler func(w http.ResponseWriter, r *http.Request, realm *loopstacksv1.Realm, backend coordination.Backend)
+
+// realm resolves the federated realm and its backend of a request
+func (s *Server) realm(handler realmHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := types.NamespacedName{Namespace: r.PathValue("namespace"), Name: r.PathValue("realm")}
+
+		var realm loopstacksv1.Realm
+		if err := s.Client.Get(r.Context(), key, &realm); err != nil {
+			if apierrors.IsNotFound(err) {
+				writeError(w, http.StatusNotFound, fmt.Errorf("realm %s not found", key))
+				return
+			}
+			s.Log.Error(err, "Failed to get Realm", "realm", key)
+			writeError(w, http.StatusInternalServerError, errors.New("failed to get realm"))
+			return
+		}
+		if !Enabled(&realm) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("realm %s is not federated", key))
+			return
+		}
+		if !authorized(r, &realm) {
+			s.Log.Info("Rejected federation request of unknown peer", "realm", key, "peer", peerName(r))
+			writeError(w, http.StatusForbidden, fmt.Errorf("peer %q is not a peer of realm %s", peerName(r), key))
+			return
+		}
+
+		backend, err := s.Backends.Backend(r.Context(), &realm)
+		if err != nil {
+			s.Log.Error(err, "Failed to connect to realm backend", "realm", key)
+			writeError(w, http.StatusServiceUnavailable, errors.New("realm backend unavailable"))
+			return
+		}
+
+		handler(w, r, &realm, backend)
+	}
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request, realm *loopstacksv1.Realm, backend coordination.Backend) {
+	agents, err := backend.Agents(r.Context())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("failed to list agents: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, RealmInfo{
+		Namespace:       realm.Namespace,
+		Realm:           realm.Name,
+		Agents:          len(agents),
+		ProtocolVersion: protocol.Version,
+	})
+}
+
+func (s *Server) announce(w http.ResponseWriter, r *http.Request, realm *loopstacksv1.Realm, backend coordination.Backend) {
+	var announcement protocol.LoopAnnouncement
+	if err := decode(r, &announcement); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	maxBids, _ := strconv.Atoi(r.URL.Query().Get("maxBids"))
+
+	maxTimeout := s.MaxBiddingTimeout
+	if maxTimeout <= 0 {
+		maxTimeout = DefaultMaxBiddingTimeout
+	}
+	timeout := time.Until(time.UnixMilli(announcement.Deadline))
+	if timeout <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("bidding deadline has passed"))
+		return
+	}
+	timeout = min(timeout, maxTimeout)
+
+	// The loop is announced to the agents of this realm, as part of the
+	// forwarding realm's trace
+	announcement.Realm = realm.Name
+	ctx, span := tracing.Tracer().Start(tracing.Extract(r.Context(), announcement.TraceContext), "federation.bidding", trace.WithAttributes(
+		attribute.String("loopstacks.loop_id", announcement.LoopID),
+		attribute.String("loopstacks.realm", realm.Name),
+	))
+	tracing.Inject(ctx, &announcement.TraceContext)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	bids, err := coordination.CollectBids(ctx, backend, &announcement, maxBids, nil)
+	tracing.End(span, err)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	s.Log.Info("Collected bids for forwarded loop", "realm", realm.Name, "namespace", realm.Namespace,
+		"loopId", announcement.LoopID, "bids", len(bids), "peer", peerName(r))
+	if bids == nil {
+		bids = []protocol.Bid{}
+	}
+	writeJSON(w, http.StatusOK, BidsResponse{Bids: bids})
+}
+
+func (s *Server) selectAgent(w http.ResponseWriter, r *http.Request, realm *loopstacksv1.Realm, backend coordination.Backend) {
+	var selection protocol.Selection
+	if err := decode(r, &selection); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if selection.LoopID != r.PathValue("loopId") {
+		writeError(w, http.StatusBadRequest, errors.New("selection is for another loop"))
+		return
+	}
+
+	if err := backend.Select(r.Context(), &selection); err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) result(w http.ResponseWriter, r *http.Request, realm *loopstacksv1.Realm, backend coordination.Backend) {
+	maxWait := s.MaxResultWait
+	if maxWait <= 0 {
+		maxWait = DefaultMaxResultWait
+	}
+	wait := maxWait
+	if value := r.URL.Query().Get("wait"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid wait: %w", err))
+			return
+		}
+		wait = min(max(parsed, 0), maxWait)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	result, err := coordination.AwaitResult(ctx, backend, r.PathValue("loopId"), r.PathValue("agentId"))
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, result)
+	case errors.Is(err, context.DeadlineExceeded) && r.Context().Err() == nil:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusBadGateway, err)
+	}
+}
+
+// decode reads and validates a protocol message from a request body
+func decode(r *http.Request, msg protocol.Message) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize))
+	if err != nil {
+		return err
+	}
+	return protocol.Decode(data, msg)
+}
+
+// authorized reports whether the calling peer may use realm. Its
+// certificate must be valid for the host of one of the realm's
+// FederationEndpoints or for a name in its FederationPeers: any peer of
+// another realm can present a certificate of the shared CA.
+func authorized(r *http.Request, realm *loopstacksv1.Realm) bool {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return false
+	}
+	cert := r.TLS.PeerCertificates[0]
+
+	networking := realm.Spec.Networking
+	names := make([]string, 0, len(networking.FederationEndpoints)+len(networking.FederationPeers))
+	for _, endpoint := range networking.FederationEndpoints {
+		if u, err := url.Parse(endpoint); err == nil && u.Hostname() != "" {
+			names = append(names, u.Hostname())
+		}
+	}
+	names = append(names, networking.FederationPeers...)
+
+	for _, name := range names {
+		if name == cert.Subject.CommonName || cert.VerifyHostname(name) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// peerName is the common name of the calling peer's certificate
+func peerName(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
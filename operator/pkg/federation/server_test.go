@@ -0,0 +1,270 @@
+package federation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/memory"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// testCA issues the certificates of a federation
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "federation-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate for name, which is also its DNS name
+func (ca *testCA) issue(t *testing.T, name string, ips ...net.IP) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  ips,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// client returns a client presenting a certificate for name
+func (ca *testCA) client(t *testing.T, name string) *Client {
+	t.Helper()
+	return NewClient(&tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, name)},
+		RootCAs:      ca.pool,
+		MinVersion:   tls.VersionTLS12,
+	})
+}
+
+// staticBackends connects every realm to the same backend
+type staticBackends struct {
+	backend coordination.Backend
+}
+
+func (s staticBackends) Backend(ctx context.Context, realm *loopstacksv1.Realm) (coordination.Backend, error) {
+	return s.backend, nil
+}
+
+// serve runs the federation API of realms over mutual TLS until the test
+// ends and returns its URL
+func serve(t *testing.T, ca *testCA, backend coordination.Backend, realms ...*loopstacksv1.Realm) string {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := loopstacksv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, realm := range realms {
+		builder = builder.WithObjects(realm)
+	}
+	server := &Server{
+		Client:            builder.Build(),
+		Backends:          staticBackends{backend},
+		MaxBiddingTimeout: time.Second,
+		MaxResultWait:     time.Second,
+		Log:               logr.Discard(),
+	}
+
+	ts := httptest.NewUnstartedServer(server.Handler())
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "federation.local", net.IPv4(127, 0, 0, 1))},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func realm(name, isolation string, endpoints, peers []string) *loopstacksv1.Realm {
+	r := &loopstacksv1.Realm{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	r.Spec.Isolation = isolation
+	r.Spec.Networking.FederationEndpoints = endpoints
+	r.Spec.Networking.FederationPeers = peers
+	return r
+}
+
+func TestServerAuthorizesPeers(t *testing.T) {
+	ca := newTestCA(t)
+	url := serve(t, ca, memory.New(0),
+		realm("us-realm", IsolationFederated, []string{"https://eu.example.com:9444/realms/default/eu-realm"}, []string{"ap.example.com"}),
+		realm("private", "", []string{"https://eu.example.com:9444/realms/default/eu-realm"}, nil),
+	)
+
+	tests := []struct {
+		name   string
+		peer   string
+		method string
+		path   string
+		want   int
+	}{
+		{name: "endpoint host", peer: "eu.example.com", path: "/realms/default/us-realm", want: http.StatusOK},
+		{name: "listed peer", peer: "ap.example.com", path: "/realms/default/us-realm", want: http.StatusOK},
+		{name: "unknown peer", peer: "intruder.example.com", path: "/realms/default/us-realm", want: http.StatusForbidden},
+		{name: "unknown peer announcing", peer: "intruder.example.com", method: http.MethodPost, path: "/realms/default/us-realm/loops", want: http.StatusForbidden},
+		{name: "realm not federated", peer: "eu.example.com", path: "/realms/default/private", want: http.StatusForbidden},
+		{name: "unknown realm", peer: "eu.example.com", path: "/realms/default/other", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, err := http.NewRequest(method, url+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := ca.client(t, tt.peer).HTTP.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s: %v", method, tt.path, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s as %s = %d, want %d", method, tt.path, tt.peer, resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	// A certificate of another CA is refused during the handshake
+	other := newTestCA(t)
+	client := other.client(t, "eu.example.com")
+	client.HTTP.Transport.(*http.Transport).TLSClientConfig.RootCAs = ca.pool
+	if _, err := client.Probe(context.Background(), url+"/realms/default/us-realm"); err == nil {
+		t.Error("Probe() with a certificate of another CA error = nil")
+	}
+}
+
+// TestServerForwardsLoops forwards a loop to a realm's agent and returns its
+// bid and result to the peer
+func TestServerForwardsLoops(t *testing.T) {
+	ctx := context.Background()
+	ca := newTestCA(t)
+	backend := memory.New(0)
+	endpoint := serve(t, ca, backend, realm("us-realm", IsolationFederated, []string{"https://eu.example.com:9444/realms/default/eu-realm"}, nil)) + "/realms/default/us-realm"
+	client := ca.client(t, "eu.example.com")
+
+	// An agent of the realm bids on every loop and answers its selections
+	const agentID = "writer-0"
+	if err := backend.Heartbeat(ctx, &protocol.Heartbeat{AgentID: agentID, Capabilities: []string{"reply"}}); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+	stopped, stop := context.WithCancel(ctx)
+	stop()
+	_ = backend.SubscribeAnnouncements(stopped, agentID, nil)
+	_ = backend.SubscribeSelections(stopped, agentID, nil)
+	agentCtx, stopAgent := context.WithCancel(ctx)
+	t.Cleanup(stopAgent)
+	go backend.SubscribeAnnouncements(agentCtx, agentID, func(ctx context.Context, a *protocol.LoopAnnouncement) error {
+		if a.Realm != "us-realm" {
+			t.Errorf("forwarded announcement realm = %q, want us-realm", a.Realm)
+		}
+		return backend.Bid(ctx, &protocol.Bid{LoopID: a.LoopID, AgentID: agentID, Timestamp: time.Now().UnixMilli(), Confidence: 0.9})
+	})
+	go backend.SubscribeSelections(agentCtx, agentID, func(ctx context.Context, s *protocol.Selection) error {
+		return backend.SubmitResult(ctx, &protocol.Result{LoopID: s.LoopID, AgentID: agentID, Timestamp: time.Now().UnixMilli(), Result: []byte(`{"reply":"hello"}`)})
+	})
+
+	info, err := client.Probe(ctx, endpoint)
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if info.Realm != "us-realm" || info.Agents != 1 || info.ProtocolVersion != protocol.Version {
+		t.Errorf("Probe() = %+v", info)
+	}
+
+	bids, err := client.Announce(ctx, endpoint, &protocol.LoopAnnouncement{
+		LoopID:       "exec-1",
+		Realm:        "eu-realm",
+		Capabilities: []string{"reply"},
+		Deadline:     time.Now().Add(5 * time.Second).UnixMilli(),
+	}, 1)
+	if err != nil {
+		t.Fatalf("Announce() error = %v", err)
+	}
+	if len(bids) != 1 || bids[0].AgentID != agentID || bids[0].Confidence != 0.9 {
+		t.Fatalf("Announce() = %+v, want the bid of %s", bids, agentID)
+	}
+
+	if err := client.Select(ctx, endpoint, &protocol.Selection{LoopID: "exec-1", AgentID: agentID}); err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := client.AwaitResult(waitCtx, endpoint, "exec-1", agentID)
+	if err != nil {
+		t.Fatalf("AwaitResult() error = %v", err)
+	}
+	if string(result.Result) != `{"reply":"hello"}` {
+		t.Errorf("AwaitResult() = %s (%s)", result.Result, result.Error)
+	}
+
+	// Announcements past their deadline are refused
+	if _, err := client.Announce(ctx, endpoint, &protocol.LoopAnnouncement{
+		LoopID:       "exec-2",
+		Capabilities: []string{"reply"},
+		Deadline:     time.Now().Add(-time.Second).UnixMilli(),
+	}, 1); err == nil {
+		t.Error("Announce() past the deadline error = nil")
+	}
+}
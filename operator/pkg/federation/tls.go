@@ -0,0 +1,50 @@
+package federation
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Files of a federation certificate directory, as written by cert-manager
+// into a Certificate's secret
+const (
+	CertFile = "tls.crt"
+	KeyFile  = "tls.key"
+	CAFile   = "ca.crt"
+)
+
+// LoadTLS reads the federation certificate, key and CA from dir. The
+// returned server config requires clients to present a certificate signed
+// by the CA; the client config presents the same certificate and trusts
+// only servers signed by the CA.
+func LoadTLS(dir string) (server *tls.Config, client *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, CertFile), filepath.Join(dir, KeyFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load federation certificate: %w", err)
+	}
+
+	ca, err := os.ReadFile(filepath.Join(dir, CAFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read federation CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, nil, fmt.Errorf("no certificates in %s", filepath.Join(dir, CAFile))
+	}
+
+	server = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	client = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	return server, client, nil
+}
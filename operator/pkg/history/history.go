@@ -0,0 +1,167 @@
+// Package history persists completed loop executions beyond the lifetime
+// of the coordination backend's keys. Records are kept until the realm's
+// RealmRetentionPolicy.LoopHistory has passed, when the Reaper deletes
+// them.
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workflow"
+)
+
+// Execution statuses
+const (
+	StatusCompleted = "Completed"
+	StatusFailed    = "Failed"
+)
+
+// ErrNotFound is returned when a looked up execution does not exist
+var ErrNotFound = errors.New("execution not found")
+
+// Record is a completed loop execution
+type Record struct {
+	ID        string `json:"id"`
+	Namespace string `json:"namespace"`
+	Realm     string `json:"realm"`
+	LoopStack string `json:"loopstack"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+
+	Input  json.RawMessage `json:"input,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+	// Steps holds every step's result, including what the agents returned
+	Steps []workflow.StepResult `json:"steps,omitempty"`
+
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// AgentRun is the part a selected agent took in a loop execution step,
+// kept to compare agent revisions during rollouts
+type AgentRun struct {
+	ExecutionID   string
+	Namespace     string
+	Realm         string
+	Step          string
+	AgentID       string
+	AgentInstance string
+	Revision      string
+	// Failed is set when the agent returned an error, or no result before
+	// the execution timeout
+	Failed bool
+	// Latency runs from the agent's selection to its result
+	Latency     time.Duration
+	CompletedAt time.Time
+}
+
+// AgentStatsQuery selects the runs of an AgentInstance revision
+type AgentStatsQuery struct {
+	Namespace     string
+	AgentInstance string
+	Revision      string
+	// Since bounds the completion time
+	Since time.Time
+}
+
+// AgentStats summarizes agent runs
+type AgentStats struct {
+	Runs     int
+	Failures int
+	// P95Latency is the 95th percentile latency of the runs
+	P95Latency time.Duration
+}
+
+// ShadowRun is a shadow agent's run of a loop execution step, compared
+// with the step's output
+type ShadowRun struct {
+	ExecutionID   string          `json:"executionId"`
+	Namespace     string          `json:"namespace"`
+	Realm         string          `json:"realm"`
+	Step          string          `json:"step"`
+	AgentID       string          `json:"agentId"`
+	AgentInstance string          `json:"agentInstance"`
+	Revision      string          `json:"revision,omitempty"`
+	Result        json.RawMessage `json:"result,omitempty"`
+	// Error is the agent's error, or why it produced no result
+	Error string `json:"error,omitempty"`
+	// Expected is the step's output
+	Expected    json.RawMessage `json:"expected,omitempty"`
+	SchemaValid bool            `json:"schemaValid"`
+	Agreed      bool            `json:"agreed"`
+	// Diff lists the differences between Expected and Result
+	Diff        json.RawMessage `json:"diff,omitempty"`
+	Latency     time.Duration   `json:"latency"`
+	CompletedAt time.Time       `json:"completedAt"`
+}
+
+// ShadowQuery selects the runs of a shadow AgentInstance
+type ShadowQuery struct {
+	Namespace     string
+	AgentInstance string
+	// Since bounds the completion time
+	Since time.Time
+	// Disagreed selects only the runs that did not agree
+	Disagreed bool
+	// Limit caps the number of runs listed, newest first. Zero means 100.
+	Limit int
+}
+
+// ShadowStats summarizes shadow runs
+type ShadowStats struct {
+	Runs        int
+	Failures    int
+	SchemaValid int
+	Agreed      int
+	// P95Latency is the 95th percentile latency of the runs
+	P95Latency time.Duration
+}
+
+// Query selects records. Empty fields match everything.
+type Query struct {
+	Namespace string
+	Realm     string
+	LoopStack string
+	Status    string
+	// Since and Until bound the completion time, Until exclusive
+	Since time.Time
+	Until time.Time
+	// Input matches top-level string fields of the execution input, e.g.
+	// {"customerId": "c-42"}
+	Input map[string]string
+	// Limit caps the number of records, newest first. Zero means 100.
+	Limit int
+}
+
+// DefaultLimit is the number of records returned when Query.Limit is zero
+const DefaultLimit = 100
+
+// Store persists execution records
+type Store interface {
+	// Save inserts or replaces a record
+	Save(ctx context.Context, record *Record) error
+	// Get looks up a record by execution id
+	Get(ctx context.Context, id string) (*Record, error)
+	// List returns the records matching query, most recently completed first
+	List(ctx context.Context, query Query) ([]Record, error)
+	// DeleteBefore removes a realm's records completed before cutoff and
+	// returns how many were deleted. The realm's agent and shadow runs
+	// completed before cutoff are removed too.
+	DeleteBefore(ctx context.Context, namespace, realm string, cutoff time.Time) (int64, error)
+	// SaveAgentRuns inserts agent runs
+	SaveAgentRuns(ctx context.Context, runs []AgentRun) error
+	// AgentStats summarizes the agent runs matching query
+	AgentStats(ctx context.Context, query AgentStatsQuery) (AgentStats, error)
+	// SaveShadowRuns inserts shadow runs
+	SaveShadowRuns(ctx context.Context, runs []ShadowRun) error
+	// ShadowStats summarizes the shadow runs matching query
+	ShadowStats(ctx context.Context, query ShadowQuery) (ShadowStats, error)
+	// ListShadowRuns returns the shadow runs matching query, most recently
+	// completed first
+	ListShadowRuns(ctx context.Context, query ShadowQuery) ([]ShadowRun, error)
+	// Close releases the store's connections
+	Close() error
+}
@@ -0,0 +1,92 @@
+// Package postgres stores execution history in PostgreSQL
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	// Registers the pgx driver
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+)
+
+// Dialect is the PostgreSQL dialect of history.SQLStore
+var Dialect = history.Dialect{
+	Schema: []string{
+		`CREATE TABLE IF NOT EXISTS loop_executions (
+  id TEXT PRIMARY KEY,
+  namespace TEXT NOT NULL,
+  realm TEXT NOT NULL,
+  loopstack TEXT NOT NULL,
+  status TEXT NOT NULL,
+  error TEXT NOT NULL DEFAULT '',
+  input JSONB,
+  output JSONB,
+  steps JSONB,
+  started_at BIGINT NOT NULL,
+  completed_at BIGINT NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS loop_executions_realm ON loop_executions (namespace, realm, completed_at)`,
+		`CREATE INDEX IF NOT EXISTS loop_executions_loopstack ON loop_executions (namespace, loopstack, completed_at)`,
+		`CREATE TABLE IF NOT EXISTS agent_runs (
+  execution_id TEXT NOT NULL,
+  namespace TEXT NOT NULL,
+  realm TEXT NOT NULL,
+  step TEXT NOT NULL,
+  agent_id TEXT NOT NULL,
+  agent_instance TEXT NOT NULL,
+  revision TEXT NOT NULL,
+  failed BOOLEAN NOT NULL,
+  latency_ms BIGINT NOT NULL,
+  completed_at BIGINT NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS agent_runs_revision ON agent_runs (namespace, agent_instance, revision, completed_at)`,
+		`CREATE INDEX IF NOT EXISTS agent_runs_realm ON agent_runs (namespace, realm, completed_at)`,
+		`CREATE TABLE IF NOT EXISTS shadow_runs (
+  execution_id TEXT NOT NULL,
+  namespace TEXT NOT NULL,
+  realm TEXT NOT NULL,
+  step TEXT NOT NULL,
+  agent_id TEXT NOT NULL,
+  agent_instance TEXT NOT NULL,
+  revision TEXT NOT NULL,
+  result JSONB,
+  error TEXT NOT NULL DEFAULT '',
+  expected JSONB,
+  schema_valid BOOLEAN NOT NULL,
+  agreed BOOLEAN NOT NULL,
+  diff JSONB,
+  latency_ms BIGINT NOT NULL,
+  completed_at BIGINT NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS shadow_runs_instance ON shadow_runs (namespace, agent_instance, completed_at)`,
+		`CREATE INDEX IF NOT EXISTS shadow_runs_realm ON shadow_runs (namespace, realm, completed_at)`,
+	},
+	Placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	InputField: func(placeholder string) string {
+		return "input ->> " + placeholder + "::text"
+	},
+	InputFieldArg: func(field string) string { return field },
+}
+
+// Open connects to the database at dsn, e.g.
+// postgres://loopstacks@postgres:5432/loopstacks
+func Open(ctx context.Context, dsn string) (*history.SQLStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	store, err := history.NewSQLStore(ctx, db, Dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
@@ -0,0 +1,83 @@
+package history
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/duration"
+)
+
+// DefaultReapInterval is how often expired records are deleted
+const DefaultReapInterval = time.Hour
+
+// Reaper deletes records older than their realm's LoopHistory retention.
+// Realms without a LoopHistory keep their records forever. It runs as a
+// manager Runnable on the leader only.
+type Reaper struct {
+	Client   client.Client
+	Store    Store
+	Interval time.Duration
+	Log      logr.Logger
+}
+
+// Start implements manager.Runnable
+func (r *Reaper) Start(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultReapInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.Reap(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (r *Reaper) NeedLeaderElection() bool {
+	return true
+}
+
+// Reap deletes expired records of all realms once
+func (r *Reaper) Reap(ctx context.Context) {
+	var realms loopstacksv1.RealmList
+	if err := r.Client.List(ctx, &realms); err != nil {
+		r.Log.Error(err, "Failed to list Realms")
+		return
+	}
+
+	now := time.Now()
+	for _, realm := range realms.Items {
+		retention := realm.Spec.Governance.RetentionPolicy.LoopHistory
+		if retention == "" {
+			continue
+		}
+
+		log := r.Log.WithValues("realm", realm.Name, "namespace", realm.Namespace)
+		keep, err := duration.Parse(retention)
+		if err != nil {
+			log.Error(err, "Invalid loop history retention", "loopHistory", retention)
+			continue
+		}
+
+		deleted, err := r.Store.DeleteBefore(ctx, realm.Namespace, realm.Name, now.Add(-keep))
+		if err != nil {
+			log.Error(err, "Failed to delete expired execution history")
+			continue
+		}
+		if deleted > 0 {
+			log.Info("Deleted expired execution history", "records", deleted, "loopHistory", retention)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workflow"
+)
+
+// Execution identifies a loop execution being recorded
+type Execution struct {
+	ID        string
+	Namespace string
+	Realm     string
+	LoopStack string
+}
+
+// Recorder runs workflows and saves every execution to a Store when it
+// completes, whether it succeeded or failed
+type Recorder struct {
+	Runner *workflow.Runner
+	Store  Store
+	Log    logr.Logger
+}
+
+// Run runs wf and records the execution. Failing to save the record is
+// logged but does not fail the execution. An execution interrupted while
+// awaiting approval is recorded when it is resumed and completes.
+func (r *Recorder) Run(ctx context.Context, execution Execution, wf *workflow.Workflow, input interface{}) (*workflow.Result, error) {
+	startedAt := time.Now()
+	if paused := r.Runner.Paused; paused != nil && len(paused.Completed) > 0 {
+		startedAt = paused.Completed[0].StartTime
+	}
+	result, runErr := r.Runner.Run(ctx, wf, execution.ID, input)
+	if errors.Is(runErr, workflow.ErrApprovalInterrupted) {
+		return result, runErr
+	}
+
+	record := &Record{
+		ID:          execution.ID,
+		Namespace:   execution.Namespace,
+		Realm:       execution.Realm,
+		LoopStack:   execution.LoopStack,
+		Status:      StatusCompleted,
+		StartedAt:   startedAt,
+		CompletedAt: time.Now(),
+	}
+	if runErr != nil {
+		record.Status = StatusFailed
+		record.Error = runErr.Error()
+	}
+	if result != nil {
+		record.Steps = result.Steps
+		record.Output = marshal(result.Output)
+	}
+	record.Input = marshal(input)
+
+	// The execution is over; its record is saved even if ctx was cancelled
+	if err := r.Store.Save(context.WithoutCancel(ctx), record); err != nil {
+		r.Log.Error(err, "Failed to save execution history", "executionId", execution.ID)
+	}
+	return result, runErr
+}
+
+func marshal(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
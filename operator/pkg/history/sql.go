@@ -0,0 +1,416 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dialect adapts SQLStore to a database
+type Dialect struct {
+	// Schema creates the executions table and its indexes idempotently
+	Schema []string
+	// Placeholder returns the n-th bind parameter, starting at 1
+	Placeholder func(n int) string
+	// InputField returns an expression selecting a top-level string field
+	// of the input column; the field name is bound to placeholder
+	InputField func(placeholder string) string
+	// InputFieldArg converts a field name to the value bound for InputField
+	InputFieldArg func(field string) string
+}
+
+// SQLStore is a Store on a SQL database
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var _ Store = &SQLStore{}
+
+// NewSQLStore creates the schema if needed and returns a store on db
+func NewSQLStore(ctx context.Context, db *sql.DB, dialect Dialect) (*SQLStore, error) {
+	for _, statement := range dialect.Schema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return nil, fmt.Errorf("failed to create history schema: %w", err)
+		}
+	}
+	return &SQLStore{db: db, dialect: dialect}, nil
+}
+
+const columns = "id, namespace, realm, loopstack, status, error, input, output, steps, started_at, completed_at"
+
+// Save implements Store
+func (s *SQLStore) Save(ctx context.Context, record *Record) error {
+	if record.ID == "" {
+		return errors.New("record has no execution id")
+	}
+
+	steps, err := json.Marshal(record.Steps)
+	if err != nil {
+		return fmt.Errorf("failed to marshal steps: %w", err)
+	}
+
+	placeholders := make([]string, 11)
+	for i := range placeholders {
+		placeholders[i] = s.dialect.Placeholder(i + 1)
+	}
+	query := fmt.Sprintf(`INSERT INTO loop_executions (%s) VALUES (%s)
+ON CONFLICT (id) DO UPDATE SET
+  namespace = excluded.namespace, realm = excluded.realm, loopstack = excluded.loopstack,
+  status = excluded.status, error = excluded.error, input = excluded.input,
+  output = excluded.output, steps = excluded.steps,
+  started_at = excluded.started_at, completed_at = excluded.completed_at`,
+		columns, strings.Join(placeholders, ", "))
+
+	_, err = s.db.ExecContext(ctx, query,
+		record.ID, record.Namespace, record.Realm, record.LoopStack, record.Status, record.Error,
+		nullableJSON(record.Input), nullableJSON(record.Output), string(steps),
+		record.StartedAt.UnixMilli(), record.CompletedAt.UnixMilli(),
+	)
+	return err
+}
+
+// Get implements Store
+func (s *SQLStore) Get(ctx context.Context, id string) (*Record, error) {
+	query := fmt.Sprintf("SELECT %s FROM loop_executions WHERE id = %s", columns, s.dialect.Placeholder(1))
+	rows, err := s.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	records, err := scan(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNotFound
+	}
+	return &records[0], nil
+}
+
+// List implements Store
+func (s *SQLStore) List(ctx context.Context, q Query) ([]Record, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	bind := func(v interface{}) string {
+		args = append(args, v)
+		return s.dialect.Placeholder(len(args))
+	}
+
+	for _, filter := range []struct{ column, value string }{
+		{"namespace", q.Namespace},
+		{"realm", q.Realm},
+		{"loopstack", q.LoopStack},
+		{"status", q.Status},
+	} {
+		if filter.value != "" {
+			where = append(where, filter.column+" = "+bind(filter.value))
+		}
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "completed_at >= "+bind(q.Since.UnixMilli()))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "completed_at < "+bind(q.Until.UnixMilli()))
+	}
+
+	fields := make([]string, 0, len(q.Input))
+	for field := range q.Input {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		expr := s.dialect.InputField(bind(s.dialect.InputFieldArg(field)))
+		where = append(where, expr+" = "+bind(q.Input[field]))
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	query := "SELECT " + columns + " FROM loop_executions"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY completed_at DESC LIMIT %d", limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scan(rows)
+}
+
+// DeleteBefore implements Store
+func (s *SQLStore) DeleteBefore(ctx context.Context, namespace, realm string, cutoff time.Time) (int64, error) {
+	where := fmt.Sprintf("WHERE namespace = %s AND realm = %s AND completed_at < %s",
+		s.dialect.Placeholder(1), s.dialect.Placeholder(2), s.dialect.Placeholder(3))
+	for _, table := range []string{"agent_runs", "shadow_runs"} {
+		if _, err := s.db.ExecContext(ctx, "DELETE FROM "+table+" "+where, namespace, realm, cutoff.UnixMilli()); err != nil {
+			return 0, err
+		}
+	}
+	result, err := s.db.ExecContext(ctx, "DELETE FROM loop_executions "+where, namespace, realm, cutoff.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// maxStatsRuns caps the runs AgentStats reads, newest first
+const maxStatsRuns = 10000
+
+// SaveAgentRuns implements Store
+func (s *SQLStore) SaveAgentRuns(ctx context.Context, runs []AgentRun) error {
+	if len(runs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholders := make([]string, 10)
+	for i := range placeholders {
+		placeholders[i] = s.dialect.Placeholder(i + 1)
+	}
+	query := fmt.Sprintf(`INSERT INTO agent_runs
+  (execution_id, namespace, realm, step, agent_id, agent_instance, revision, failed, latency_ms, completed_at)
+  VALUES (%s)`, strings.Join(placeholders, ", "))
+	for _, run := range runs {
+		if _, err := tx.ExecContext(ctx, query,
+			run.ExecutionID, run.Namespace, run.Realm, run.Step, run.AgentID, run.AgentInstance, run.Revision,
+			run.Failed, run.Latency.Milliseconds(), run.CompletedAt.UnixMilli(),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AgentStats implements Store
+func (s *SQLStore) AgentStats(ctx context.Context, q AgentStatsQuery) (AgentStats, error) {
+	query := fmt.Sprintf(`SELECT failed, latency_ms FROM agent_runs
+WHERE namespace = %s AND agent_instance = %s AND revision = %s AND completed_at >= %s
+ORDER BY completed_at DESC LIMIT %d`,
+		s.dialect.Placeholder(1), s.dialect.Placeholder(2), s.dialect.Placeholder(3), s.dialect.Placeholder(4), maxStatsRuns)
+	rows, err := s.db.QueryContext(ctx, query, q.Namespace, q.AgentInstance, q.Revision, q.Since.UnixMilli())
+	if err != nil {
+		return AgentStats{}, err
+	}
+	defer rows.Close()
+
+	var (
+		stats     AgentStats
+		latencies []int64
+	)
+	for rows.Next() {
+		var (
+			failed  bool
+			latency int64
+		)
+		if err := rows.Scan(&failed, &latency); err != nil {
+			return AgentStats{}, err
+		}
+		stats.Runs++
+		if failed {
+			stats.Failures++
+		}
+		latencies = append(latencies, latency)
+	}
+	if err := rows.Err(); err != nil {
+		return AgentStats{}, err
+	}
+
+	stats.P95Latency = p95(latencies)
+	return stats, nil
+}
+
+const shadowColumns = "execution_id, namespace, realm, step, agent_id, agent_instance, revision, result, error, expected, schema_valid, agreed, diff, latency_ms, completed_at"
+
+// SaveShadowRuns implements Store
+func (s *SQLStore) SaveShadowRuns(ctx context.Context, runs []ShadowRun) error {
+	if len(runs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholders := make([]string, 15)
+	for i := range placeholders {
+		placeholders[i] = s.dialect.Placeholder(i + 1)
+	}
+	query := fmt.Sprintf("INSERT INTO shadow_runs (%s) VALUES (%s)", shadowColumns, strings.Join(placeholders, ", "))
+	for _, run := range runs {
+		if _, err := tx.ExecContext(ctx, query,
+			run.ExecutionID, run.Namespace, run.Realm, run.Step, run.AgentID, run.AgentInstance, run.Revision,
+			nullableJSON(run.Result), run.Error, nullableJSON(run.Expected), run.SchemaValid, run.Agreed, nullableJSON(run.Diff),
+			run.Latency.Milliseconds(), run.CompletedAt.UnixMilli(),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// shadowWhere builds the filter of a ShadowQuery
+func (s *SQLStore) shadowWhere(q ShadowQuery) (string, []interface{}) {
+	where := fmt.Sprintf("WHERE namespace = %s AND agent_instance = %s AND completed_at >= %s",
+		s.dialect.Placeholder(1), s.dialect.Placeholder(2), s.dialect.Placeholder(3))
+	args := []interface{}{q.Namespace, q.AgentInstance, q.Since.UnixMilli()}
+	if q.Disagreed {
+		where += " AND agreed = " + s.dialect.Placeholder(4)
+		args = append(args, false)
+	}
+	return where, args
+}
+
+// ShadowStats implements Store
+func (s *SQLStore) ShadowStats(ctx context.Context, q ShadowQuery) (ShadowStats, error) {
+	where, args := s.shadowWhere(q)
+	query := fmt.Sprintf("SELECT error, schema_valid, agreed, latency_ms FROM shadow_runs %s ORDER BY completed_at DESC LIMIT %d", where, maxStatsRuns)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return ShadowStats{}, err
+	}
+	defer rows.Close()
+
+	var (
+		stats     ShadowStats
+		latencies []int64
+	)
+	for rows.Next() {
+		var (
+			runErr              string
+			schemaValid, agreed bool
+			latency             int64
+		)
+		if err := rows.Scan(&runErr, &schemaValid, &agreed, &latency); err != nil {
+			return ShadowStats{}, err
+		}
+		stats.Runs++
+		if runErr != "" {
+			stats.Failures++
+		}
+		if schemaValid {
+			stats.SchemaValid++
+		}
+		if agreed {
+			stats.Agreed++
+		}
+		latencies = append(latencies, latency)
+	}
+	if err := rows.Err(); err != nil {
+		return ShadowStats{}, err
+	}
+
+	stats.P95Latency = p95(latencies)
+	return stats, nil
+}
+
+// ListShadowRuns implements Store
+func (s *SQLStore) ListShadowRuns(ctx context.Context, q ShadowQuery) ([]ShadowRun, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	where, args := s.shadowWhere(q)
+	query := fmt.Sprintf("SELECT %s FROM shadow_runs %s ORDER BY completed_at DESC LIMIT %d", shadowColumns, where, limit)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []ShadowRun
+	for rows.Next() {
+		var (
+			run                    ShadowRun
+			result, expected, diff []byte
+			latency, completedAt   int64
+		)
+		if err := rows.Scan(&run.ExecutionID, &run.Namespace, &run.Realm, &run.Step, &run.AgentID, &run.AgentInstance, &run.Revision,
+			&result, &run.Error, &expected, &run.SchemaValid, &run.Agreed, &diff, &latency, &completedAt); err != nil {
+			return nil, err
+		}
+		for _, field := range []struct {
+			data []byte
+			dst  *json.RawMessage
+		}{{result, &run.Result}, {expected, &run.Expected}, {diff, &run.Diff}} {
+			if len(field.data) > 0 {
+				*field.dst = json.RawMessage(field.data)
+			}
+		}
+		run.Latency = time.Duration(latency) * time.Millisecond
+		run.CompletedAt = time.UnixMilli(completedAt)
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// p95 returns the 95th percentile of latencies in milliseconds
+func p95(latencies []int64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return time.Duration(latencies[(len(latencies)*95-1)/100]) * time.Millisecond
+}
+
+// Close implements Store
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func scan(rows *sql.Rows) ([]Record, error) {
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var (
+			record               Record
+			input, output, steps []byte
+			startedAt            int64
+			completedAt          int64
+		)
+		if err := rows.Scan(&record.ID, &record.Namespace, &record.Realm, &record.LoopStack,
+			&record.Status, &record.Error, &input, &output, &steps, &startedAt, &completedAt); err != nil {
+			return nil, err
+		}
+		if len(input) > 0 {
+			record.Input = json.RawMessage(input)
+		}
+		if len(output) > 0 {
+			record.Output = json.RawMessage(output)
+		}
+		if len(steps) > 0 {
+			if err := json.Unmarshal(steps, &record.Steps); err != nil {
+				return nil, fmt.Errorf("execution %s: invalid steps: %w", record.ID, err)
+			}
+		}
+		record.StartedAt = time.UnixMilli(startedAt)
+		record.CompletedAt = time.UnixMilli(completedAt)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func nullableJSON(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
@@ -0,0 +1,93 @@
+// Package sqlite stores execution history in an embedded SQLite database,
+// for single-node installations and development. The driver is pure Go, so
+// the operator builds without cgo.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	// Registers the sqlite driver
+	_ "modernc.org/sqlite"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+)
+
+// Dialect is the SQLite dialect of history.SQLStore
+var Dialect = history.Dialect{
+	Schema: []string{
+		`CREATE TABLE IF NOT EXISTS loop_executions (
+  id TEXT PRIMARY KEY,
+  namespace TEXT NOT NULL,
+  realm TEXT NOT NULL,
+  loopstack TEXT NOT NULL,
+  status TEXT NOT NULL,
+  error TEXT NOT NULL DEFAULT '',
+  input TEXT,
+  output TEXT,
+  steps TEXT,
+  started_at INTEGER NOT NULL,
+  completed_at INTEGER NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS loop_executions_realm ON loop_executions (namespace, realm, completed_at)`,
+		`CREATE INDEX IF NOT EXISTS loop_executions_loopstack ON loop_executions (namespace, loopstack, completed_at)`,
+		`CREATE TABLE IF NOT EXISTS agent_runs (
+  execution_id TEXT NOT NULL,
+  namespace TEXT NOT NULL,
+  realm TEXT NOT NULL,
+  step TEXT NOT NULL,
+  agent_id TEXT NOT NULL,
+  agent_instance TEXT NOT NULL,
+  revision TEXT NOT NULL,
+  failed INTEGER NOT NULL,
+  latency_ms INTEGER NOT NULL,
+  completed_at INTEGER NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS agent_runs_revision ON agent_runs (namespace, agent_instance, revision, completed_at)`,
+		`CREATE INDEX IF NOT EXISTS agent_runs_realm ON agent_runs (namespace, realm, completed_at)`,
+		`CREATE TABLE IF NOT EXISTS shadow_runs (
+  execution_id TEXT NOT NULL,
+  namespace TEXT NOT NULL,
+  realm TEXT NOT NULL,
+  step TEXT NOT NULL,
+  agent_id TEXT NOT NULL,
+  agent_instance TEXT NOT NULL,
+  revision TEXT NOT NULL,
+  result TEXT,
+  error TEXT NOT NULL DEFAULT '',
+  expected TEXT,
+  schema_valid INTEGER NOT NULL,
+  agreed INTEGER NOT NULL,
+  diff TEXT,
+  latency_ms INTEGER NOT NULL,
+  completed_at INTEGER NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS shadow_runs_instance ON shadow_runs (namespace, agent_instance, completed_at)`,
+		`CREATE INDEX IF NOT EXISTS shadow_runs_realm ON shadow_runs (namespace, realm, completed_at)`,
+	},
+	Placeholder: func(int) string { return "?" },
+	InputField: func(placeholder string) string {
+		return "json_extract(input, " + placeholder + ")"
+	},
+	InputFieldArg: func(field string) string {
+		return `$."` + strings.ReplaceAll(field, `"`, `\"`) + `"`
+	},
+}
+
+// Open opens or creates the database file at path
+func Open(ctx context.Context, path string) (*history.SQLStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer
+	db.SetMaxOpenConns(1)
+
+	store, err := history.NewSQLStore(ctx, db, Dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
@@ -0,0 +1,196 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/workflow"
+)
+
+func openTestStore(t *testing.T) *history.SQLStore {
+	t.Helper()
+	store, err := Open(context.Background(), filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func record(id, realm, status string, input string, completed time.Time) *history.Record {
+	return &history.Record{
+		ID:          id,
+		Namespace:   "default",
+		Realm:       realm,
+		LoopStack:   "support",
+		Status:      status,
+		Input:       json.RawMessage(input),
+		Output:      json.RawMessage(`{"answer":"shipped"}`),
+		Steps:       []workflow.StepResult{{Name: "reply", Output: map[string]interface{}{"answer": "shipped"}}},
+		StartedAt:   completed.Add(-time.Second),
+		CompletedAt: completed,
+	}
+}
+
+func ids(records []history.Record) []string {
+	ids := make([]string, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestSaveAndGet(t *testing.T) {
+	ctx := context.Background()
+	store := openTestStore(t)
+	now := time.Now().Truncate(time.Millisecond)
+
+	saved := record("exec-1", "realm-a", history.StatusCompleted, `{"customerId":"c-42"}`, now)
+	if err := store.Save(ctx, saved); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, err := store.Get(ctx, "exec-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Realm != "realm-a" || string(got.Input) != `{"customerId":"c-42"}` || !got.CompletedAt.Equal(now) {
+		t.Errorf("Get() = %+v", got)
+	}
+	if len(got.Steps) != 1 || got.Steps[0].Name != "reply" {
+		t.Errorf("Get() steps = %+v", got.Steps)
+	}
+
+	// Saving again replaces the record
+	saved.Status = history.StatusFailed
+	saved.Error = "agent failed"
+	if err := store.Save(ctx, saved); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got, _ := store.Get(ctx, "exec-1"); got.Status != history.StatusFailed || got.Error != "agent failed" {
+		t.Errorf("Get() after update = %+v", got)
+	}
+
+	if _, err := store.Get(ctx, "exec-2"); !errors.Is(err, history.ErrNotFound) {
+		t.Errorf("Get(unknown) error = %v, want ErrNotFound", err)
+	}
+	if err := store.Save(ctx, &history.Record{}); err == nil {
+		t.Error("Save(no id) error = nil")
+	}
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	store := openTestStore(t)
+	now := time.Now()
+
+	for _, r := range []*history.Record{
+		record("exec-1", "realm-a", history.StatusCompleted, `{"customerId":"c-42"}`, now.Add(-10*24*time.Hour)),
+		record("exec-2", "realm-a", history.StatusFailed, `{"customerId":"c-42"}`, now.Add(-3*24*time.Hour)),
+		record("exec-3", "realm-a", history.StatusCompleted, `{"customerId":"c-7"}`, now.Add(-2*24*time.Hour)),
+		record("exec-4", "realm-b", history.StatusCompleted, `{"customerId":"c-42"}`, now.Add(-time.Hour)),
+	} {
+		if err := store.Save(ctx, r); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query history.Query
+		want  []string
+	}{
+		{name: "all, newest first", query: history.Query{}, want: []string{"exec-4", "exec-3", "exec-2", "exec-1"}},
+		{name: "realm", query: history.Query{Realm: "realm-a"}, want: []string{"exec-3", "exec-2", "exec-1"}},
+		{name: "status", query: history.Query{Status: history.StatusFailed}, want: []string{"exec-2"}},
+		{name: "input field", query: history.Query{Input: map[string]string{"customerId": "c-42"}}, want: []string{"exec-4", "exec-2", "exec-1"}},
+		{
+			name:  "customer last week",
+			query: history.Query{Input: map[string]string{"customerId": "c-42"}, Since: now.Add(-7 * 24 * time.Hour), Until: now.Add(-2 * time.Hour)},
+			want:  []string{"exec-2"},
+		},
+		{name: "limit", query: history.Query{Limit: 2}, want: []string{"exec-4", "exec-3"}},
+		{name: "other namespace", query: history.Query{Namespace: "other"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.List(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			got := ids(records)
+			if len(got) != len(tt.want) {
+				t.Fatalf("List() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("List() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReap(t *testing.T) {
+	ctx := context.Background()
+	store := openTestStore(t)
+	now := time.Now()
+
+	// realm-a keeps a week of history, realm-b keeps it forever
+	for _, r := range []*history.Record{
+		record("old-a", "realm-a", history.StatusCompleted, `{}`, now.Add(-8*24*time.Hour)),
+		record("new-a", "realm-a", history.StatusCompleted, `{}`, now.Add(-6*24*time.Hour)),
+		record("old-b", "realm-b", history.StatusCompleted, `{}`, now.Add(-30*24*time.Hour)),
+	} {
+		if err := store.Save(ctx, r); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if err := store.SaveAgentRuns(ctx, []history.AgentRun{
+		{ExecutionID: "old-a", Namespace: "default", Realm: "realm-a", AgentInstance: "writer", Revision: "1", CompletedAt: now.Add(-8 * 24 * time.Hour)},
+		{ExecutionID: "new-a", Namespace: "default", Realm: "realm-a", AgentInstance: "writer", Revision: "1", CompletedAt: now.Add(-6 * 24 * time.Hour)},
+	}); err != nil {
+		t.Fatalf("SaveAgentRuns() error = %v", err)
+	}
+
+	scheme := runtime.NewScheme()
+	if err := loopstacksv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	realm := func(name, loopHistory string) *loopstacksv1.Realm {
+		r := &loopstacksv1.Realm{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		r.Spec.Governance.RetentionPolicy.LoopHistory = loopHistory
+		return r
+	}
+	reaper := &history.Reaper{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(realm("realm-a", "7d"), realm("realm-b", "")).Build(),
+		Store:  store,
+		Log:    logr.Discard(),
+	}
+	reaper.Reap(ctx)
+
+	records, err := store.List(ctx, history.Query{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got := ids(records); len(got) != 2 || got[0] != "new-a" || got[1] != "old-b" {
+		t.Errorf("records after Reap() = %v, want [new-a old-b]", got)
+	}
+	stats, err := store.AgentStats(ctx, history.AgentStatsQuery{Namespace: "default", AgentInstance: "writer", Revision: "1"})
+	if err != nil {
+		t.Fatalf("AgentStats() error = %v", err)
+	}
+	if stats.Runs != 1 {
+		t.Errorf("agent runs after Reap() = %d, want 1", stats.Runs)
+	}
+}
@@ -0,0 +1,125 @@
+package liveness
+
+import (
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+const (
+	// InstanceLabel carries the AgentInstance name on the instance's pods
+	InstanceLabel = "loopstacks.io/agent-instance"
+
+	// DefaultStartupGrace is how long a running pod may take to register
+	// before it is reported as unregistered
+	DefaultStartupGrace = 2 * time.Minute
+)
+
+// Report describes how the running pods of an AgentInstance take part in
+// bidding
+type Report struct {
+	// Running is the number of running pods
+	Running int32
+	// Registered is the number of running pods with a live registration
+	Registered int32
+	// ActiveLoops is the number of loops the agents of the pods are
+	// executing, counting pods that are terminating while they finish theirs
+	ActiveLoops int32
+	// Unregistered lists running pods past their startup grace that have
+	// no registration
+	Unregistered []string
+	// Starting lists running pods without a registration that are still
+	// within their startup grace
+	Starting []string
+	// Mismatches lists registered agents whose capabilities differ from
+	// the declared ones
+	Mismatches []CapabilityMismatch
+}
+
+// CapabilityMismatch compares an agent's registered capabilities with the
+// capabilities declared on its Agent
+type CapabilityMismatch struct {
+	AgentID string
+	// Missing capabilities are declared but not registered
+	Missing []string
+	// Extra capabilities are registered but not declared
+	Extra []string
+}
+
+// Evaluate matches pods with heartbeats. A heartbeat belongs to a pod when
+// its pod, or for agents that do not report their pod its agent id, is the
+// pod's name.
+func Evaluate(pods []corev1.Pod, heartbeats []protocol.Heartbeat, declared []string, now time.Time, grace time.Duration) Report {
+	byPod := make(map[string]protocol.Heartbeat, len(heartbeats))
+	for _, heartbeat := range heartbeats {
+		pod := heartbeat.Pod
+		if pod == "" {
+			pod = heartbeat.AgentID
+		}
+		byPod[pod] = heartbeat
+	}
+
+	var report Report
+	for _, pod := range pods {
+		heartbeat, ok := byPod[pod.Name]
+		if ok {
+			report.ActiveLoops += heartbeat.ActiveLoops
+		}
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		report.Running++
+
+		if !ok {
+			if pod.Status.StartTime != nil && now.Sub(pod.Status.StartTime.Time) < grace {
+				report.Starting = append(report.Starting, pod.Name)
+			} else {
+				report.Unregistered = append(report.Unregistered, pod.Name)
+			}
+			continue
+		}
+		report.Registered++
+
+		missing, extra := difference(declared, heartbeat.Capabilities)
+		if len(missing) > 0 || len(extra) > 0 {
+			report.Mismatches = append(report.Mismatches, CapabilityMismatch{
+				AgentID: heartbeat.AgentID,
+				Missing: missing,
+				Extra:   extra,
+			})
+		}
+	}
+
+	sort.Strings(report.Unregistered)
+	sort.Strings(report.Starting)
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		return report.Mismatches[i].AgentID < report.Mismatches[j].AgentID
+	})
+	return report
+}
+
+// difference returns the elements only in want and only in have
+func difference(want, have []string) (missing, extra []string) {
+	wanted := make(map[string]bool, len(want))
+	for _, w := range want {
+		wanted[w] = true
+	}
+	had := make(map[string]bool, len(have))
+	for _, h := range have {
+		had[h] = true
+		if !wanted[h] {
+			extra = append(extra, h)
+		}
+	}
+	for _, w := range want {
+		if !had[w] {
+			missing = append(missing, w)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
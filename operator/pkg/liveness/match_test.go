@@ -0,0 +1,134 @@
+package liveness
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/memory"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+// pod returns a pod that started age ago in phase
+func pod(name string, phase corev1.PodPhase, age time.Duration) corev1.Pod {
+	started := metav1.NewTime(now.Add(-age))
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     corev1.PodStatus{Phase: phase, StartTime: &started},
+	}
+}
+
+func terminating(p corev1.Pod) corev1.Pod {
+	deleted := metav1.NewTime(now)
+	p.DeletionTimestamp = &deleted
+	return p
+}
+
+func TestEvaluate(t *testing.T) {
+	declared := []string{"reply", "translate"}
+	tests := []struct {
+		name       string
+		pods       []corev1.Pod
+		heartbeats []protocol.Heartbeat
+		want       Report
+	}{
+		{
+			name:       "registered by pod",
+			pods:       []corev1.Pod{pod("writer-0", corev1.PodRunning, time.Hour)},
+			heartbeats: []protocol.Heartbeat{{AgentID: "agent-a", Pod: "writer-0", Capabilities: declared, ActiveLoops: 2}},
+			want:       Report{Running: 1, Registered: 1, ActiveLoops: 2},
+		},
+		{
+			name:       "registered by agent id",
+			pods:       []corev1.Pod{pod("writer-0", corev1.PodRunning, time.Hour)},
+			heartbeats: []protocol.Heartbeat{{AgentID: "writer-0", Capabilities: declared}},
+			want:       Report{Running: 1, Registered: 1},
+		},
+		{
+			name: "within the startup grace",
+			pods: []corev1.Pod{pod("writer-1", corev1.PodRunning, time.Minute), pod("writer-0", corev1.PodRunning, 30*time.Second)},
+			want: Report{Running: 2, Starting: []string{"writer-0", "writer-1"}},
+		},
+		{
+			name: "past the startup grace",
+			pods: []corev1.Pod{pod("writer-0", corev1.PodRunning, 3*time.Minute), pod("writer-1", corev1.PodRunning, time.Minute)},
+			want: Report{Running: 2, Unregistered: []string{"writer-0"}, Starting: []string{"writer-1"}},
+		},
+		{
+			name: "no start time",
+			pods: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "writer-0"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}}},
+			want: Report{Running: 1, Unregistered: []string{"writer-0"}},
+		},
+		{
+			name: "not running",
+			pods: []corev1.Pod{pod("writer-0", corev1.PodPending, time.Hour), pod("writer-1", corev1.PodFailed, time.Hour)},
+			want: Report{},
+		},
+		{
+			name:       "terminating pod finishing its loops",
+			pods:       []corev1.Pod{terminating(pod("writer-0", corev1.PodRunning, time.Hour))},
+			heartbeats: []protocol.Heartbeat{{AgentID: "writer-0", Capabilities: declared, ActiveLoops: 1, Draining: true}},
+			want:       Report{ActiveLoops: 1},
+		},
+		{
+			name:       "heartbeat of another pod",
+			pods:       []corev1.Pod{pod("writer-0", corev1.PodRunning, time.Hour)},
+			heartbeats: []protocol.Heartbeat{{AgentID: "writer-9", Capabilities: declared, ActiveLoops: 3}},
+			want:       Report{Running: 1, Unregistered: []string{"writer-0"}},
+		},
+		{
+			name: "capability mismatches",
+			pods: []corev1.Pod{pod("writer-1", corev1.PodRunning, time.Hour), pod("writer-0", corev1.PodRunning, time.Hour), pod("writer-2", corev1.PodRunning, time.Hour)},
+			heartbeats: []protocol.Heartbeat{
+				{AgentID: "writer-1", Capabilities: []string{"translate", "summarize", "reply"}},
+				{AgentID: "writer-0", Capabilities: []string{"reply"}},
+				{AgentID: "writer-2", Capabilities: []string{"translate", "reply"}},
+			},
+			want: Report{Running: 3, Registered: 3, Mismatches: []CapabilityMismatch{
+				{AgentID: "writer-0", Missing: []string{"translate"}},
+				{AgentID: "writer-1", Extra: []string{"summarize"}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Evaluate(tt.pods, tt.heartbeats, declared, now, DefaultStartupGrace)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEvaluateExpiredHeartbeats checks that a pod whose registration expired
+// in the backend is reported unregistered
+func TestEvaluateExpiredHeartbeats(t *testing.T) {
+	ctx := context.Background()
+	backend := memory.New(50 * time.Millisecond)
+	for _, agentID := range []string{"writer-0", "writer-1"} {
+		if err := backend.Heartbeat(ctx, &protocol.Heartbeat{AgentID: agentID, Capabilities: []string{"reply"}}); err != nil {
+			t.Fatalf("Heartbeat() error = %v", err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := backend.Heartbeat(ctx, &protocol.Heartbeat{AgentID: "writer-1", Capabilities: []string{"reply"}}); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+
+	heartbeats, err := backend.Agents(ctx)
+	if err != nil {
+		t.Fatalf("Agents() error = %v", err)
+	}
+	pods := []corev1.Pod{pod("writer-0", corev1.PodRunning, time.Hour), pod("writer-1", corev1.PodRunning, time.Hour)}
+	got := Evaluate(pods, heartbeats, []string{"reply"}, now, DefaultStartupGrace)
+	want := Report{Running: 2, Registered: 1, Unregistered: []string{"writer-0"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Evaluate() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+// Package liveness tracks which agent processes have joined bidding. The
+// operator compares the pods of an AgentInstance with the heartbeats
+// registered in the realm's coordination backend to find pods that are up
+// but never registered, and agents whose registered capabilities differ
+// from those declared on their Agent.
+package liveness
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/backends"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// Registry lists the agents registered in each realm. Backend connections
+// are opened on first use and reused until the realm's coordination
+// settings change.
+type Registry struct {
+	// Open connects to a realm's backend. Defaults to backends.Open.
+	Open func(ctx context.Context, opts backends.Options) (coordination.Backend, error)
+
+	mu       sync.Mutex
+	backends map[string]*realmBackend
+}
+
+type realmBackend struct {
+	opts    backends.Options
+	backend coordination.Backend
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		Open:     backends.Open,
+		backends: make(map[string]*realmBackend),
+	}
+}
+
+// Agents returns the agents currently registered in a realm
+func (r *Registry) Agents(ctx context.Context, realm *loopstacksv1.Realm) ([]protocol.Heartbeat, error) {
+	backend, err := r.Backend(ctx, realm)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Agents(ctx)
+}
+
+// Backend returns the connection to a realm's coordination backend. The
+// connection is dialled without holding the registry's lock, so a slow or
+// unreachable backend does not hold up other realms.
+func (r *Registry) Backend(ctx context.Context, realm *loopstacksv1.Realm) (coordination.Backend, error) {
+	key := realm.Namespace + "/" + realm.Name
+	opts := backends.ForRealm(realm)
+
+	r.mu.Lock()
+	cached, ok := r.backends[key]
+	r.mu.Unlock()
+	if ok && cached.opts == opts {
+		return cached.backend, nil
+	}
+
+	backend, err := r.Open(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	current, ok := r.backends[key]
+	if ok && current.opts == opts {
+		// Another caller connected first
+		r.mu.Unlock()
+		_ = backend.Close()
+		return current.backend, nil
+	}
+	r.backends[key] = &realmBackend{opts: opts, backend: backend}
+	r.mu.Unlock()
+
+	if ok {
+		_ = current.backend.Close()
+	}
+	return backend, nil
+}
+
+// Changed reports whether a realm's coordination settings differ from
+// those its cached connection was opened with
+func (r *Registry) Changed(realm *loopstacksv1.Realm) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cached, ok := r.backends[realm.Namespace+"/"+realm.Name]
+	return ok && cached.opts != backends.ForRealm(realm)
+}
+
+// Forget closes the connection to a realm's backend
+func (r *Registry) Forget(namespace, name string) error {
+	key := namespace + "/" + name
+
+	r.mu.Lock()
+	cached, ok := r.backends[key]
+	delete(r.backends, key)
+	r.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return cached.backend.Close()
+}
+
+// Close closes all backend connections
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	cached := r.backends
+	r.backends = make(map[string]*realmBackend)
+	r.mu.Unlock()
+
+	var errs []error
+	for _, c := range cached {
+		errs = append(errs, c.backend.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,83 @@
+// Package metrics defines the Prometheus metrics of LoopStacks. They are
+// registered with controller-runtime's registry, so the operator serves
+// them on its metrics endpoint next to the controller metrics.
+//
+// Loop metrics are observed by the engine as executions run. The state of
+// Agents, AgentInstances and Realms is read from the cache at scrape time
+// by a StateCollector.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "loopstacks"
+
+// Execution outcomes
+const (
+	OutcomeCompleted = "completed"
+	OutcomeFailed    = "failed"
+)
+
+// Selection outcomes
+const (
+	OutcomeNotEnoughBids     = "not_enough_bids"
+	OutcomeAnswered          = "answered"
+	OutcomePartiallyAnswered = "partially_answered"
+	OutcomeUnanswered        = "unanswered"
+)
+
+// Loop phases timed by PhaseDuration
+const (
+	PhaseBidding     = "bidding"
+	PhaseExecution   = "execution"
+	PhaseAggregation = "aggregation"
+)
+
+var (
+	// Executions counts loop executions by LoopStack and outcome
+	Executions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "loop_executions_total",
+		Help:      "Loop executions by LoopStack and outcome.",
+	}, []string{"namespace", "loopstack", "outcome"})
+
+	// ExecutionDuration observes how long loop executions take, including
+	// the time spent waiting for human approval
+	ExecutionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "loop_execution_duration_seconds",
+		Help:      "Duration of loop executions by LoopStack and outcome.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"namespace", "loopstack", "outcome"})
+
+	// PhaseDuration observes the bidding, execution and aggregation phases
+	// of each agent step
+	PhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "loop_phase_duration_seconds",
+		Help:      "Duration of the phases of agent steps by LoopStack and phase.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"namespace", "loopstack", "phase"})
+
+	// Bids observes the number of bids each agent step received
+	Bids = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "loop_bids",
+		Help:      "Bids received per agent step by LoopStack.",
+		Buckets:   []float64{0, 1, 2, 3, 5, 8, 13, 21},
+	}, []string{"namespace", "loopstack"})
+
+	// Selections counts the agent selections of each strategy by outcome:
+	// whether enough agents bid and how many of the selected ones answered
+	Selections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "selections_total",
+		Help:      "Agent selections by LoopStack, selection strategy and outcome.",
+	}, []string{"namespace", "loopstack", "strategy", "outcome"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(Executions, ExecutionDuration, PhaseDuration, Bids, Selections)
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+)
+
+// scrapeTimeout bounds the cache reads of a scrape
+const scrapeTimeout = 10 * time.Second
+
+var (
+	agentsDesc = prometheus.NewDesc(namespace+"_agents",
+		"Agents by phase.",
+		[]string{"namespace", "phase"}, nil)
+	desiredReplicasDesc = prometheus.NewDesc(namespace+"_agentinstance_desired_replicas",
+		"Replicas requested by the spec of an AgentInstance.",
+		[]string{"namespace", "agentinstance", "agent", "realm"}, nil)
+	readyReplicasDesc = prometheus.NewDesc(namespace+"_agentinstance_ready_replicas",
+		"Running pods of an AgentInstance that registered for bidding.",
+		[]string{"namespace", "agentinstance", "agent", "realm"}, nil)
+	realmInstancesDesc = prometheus.NewDesc(namespace+"_realm_agent_instances",
+		"AgentInstances counted against the quota of a realm.",
+		[]string{"namespace", "realm"}, nil)
+	realmQuotaDesc = prometheus.NewDesc(namespace+"_realm_max_agent_instances",
+		"AgentInstance quota of a realm, for realms with one.",
+		[]string{"namespace", "realm"}, nil)
+)
+
+// StateCollector reports the state of Agents, AgentInstances and Realms.
+// It lists them from Reader on every scrape, so Reader should be a cache.
+type StateCollector struct {
+	Reader client.Reader
+}
+
+// Describe implements prometheus.Collector
+func (c *StateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- agentsDesc
+	ch <- desiredReplicasDesc
+	ch <- readyReplicasDesc
+	ch <- realmInstancesDesc
+	ch <- realmQuotaDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *StateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	var agents loopstacksv1.AgentList
+	if err := c.Reader.List(ctx, &agents); err != nil {
+		ch <- prometheus.NewInvalidMetric(agentsDesc, err)
+	} else {
+		type key struct{ namespace, phase string }
+		counts := make(map[key]int)
+		for _, agent := range agents.Items {
+			phase := agent.Status.Phase
+			if phase == "" {
+				phase = "Pending"
+			}
+			counts[key{agent.Namespace, phase}]++
+		}
+		for k, n := range counts {
+			ch <- prometheus.MustNewConstMetric(agentsDesc, prometheus.GaugeValue, float64(n), k.namespace, k.phase)
+		}
+	}
+
+	var instances loopstacksv1.AgentInstanceList
+	if err := c.Reader.List(ctx, &instances); err != nil {
+		ch <- prometheus.NewInvalidMetric(desiredReplicasDesc, err)
+		return
+	}
+	type realmKey struct{ namespace, realm string }
+	used := make(map[realmKey]int)
+	for _, instance := range instances.Items {
+		labels := []string{instance.Namespace, instance.Name, instance.Spec.Agent, instance.Spec.Realm}
+		ch <- prometheus.MustNewConstMetric(desiredReplicasDesc, prometheus.GaugeValue, float64(instance.Spec.Replicas), labels...)
+		ch <- prometheus.MustNewConstMetric(readyReplicasDesc, prometheus.GaugeValue, float64(instance.Status.ReadyReplicas), labels...)
+		if instance.DeletionTimestamp == nil {
+			used[realmKey{instance.Namespace, instance.Spec.Realm}]++
+		}
+	}
+
+	var realms loopstacksv1.RealmList
+	if err := c.Reader.List(ctx, &realms); err != nil {
+		ch <- prometheus.NewInvalidMetric(realmInstancesDesc, err)
+		return
+	}
+	for _, realm := range realms.Items {
+		ch <- prometheus.MustNewConstMetric(realmInstancesDesc, prometheus.GaugeValue, float64(used[realmKey{realm.Namespace, realm.Name}]), realm.Namespace, realm.Name)
+		if limit := realm.Spec.Resources.MaxAgentInstances; limit > 0 {
+			ch <- prometheus.MustNewConstMetric(realmQuotaDesc, prometheus.GaugeValue, float64(limit), realm.Namespace, realm.Name)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+)
+
+func TestStateCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := loopstacksv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: "default", Name: name}
+	}
+	ready := &loopstacksv1.Agent{ObjectMeta: meta("support-agent")}
+	ready.Status.Phase = "Ready"
+	pending := &loopstacksv1.Agent{ObjectMeta: meta("billing-agent")}
+	instance := &loopstacksv1.AgentInstance{ObjectMeta: meta("support-prod")}
+	instance.Spec.Agent = "support-agent"
+	instance.Spec.Realm = "us-realm"
+	instance.Spec.Replicas = 3
+	instance.Status.ReadyReplicas = 2
+	quota := &loopstacksv1.Realm{ObjectMeta: meta("us-realm")}
+	quota.Spec.Resources.MaxAgentInstances = 5
+	unlimited := &loopstacksv1.Realm{ObjectMeta: meta("eu-realm")}
+
+	collector := &StateCollector{Reader: fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(ready, pending, instance, quota, unlimited).Build()}
+	want := `
+# HELP loopstacks_agentinstance_desired_replicas Replicas requested by the spec of an AgentInstance.
+# TYPE loopstacks_agentinstance_desired_replicas gauge
+loopstacks_agentinstance_desired_replicas{agent="support-agent",agentinstance="support-prod",namespace="default",realm="us-realm"} 3
+# HELP loopstacks_agentinstance_ready_replicas Running pods of an AgentInstance that registered for bidding.
+# TYPE loopstacks_agentinstance_ready_replicas gauge
+loopstacks_agentinstance_ready_replicas{agent="support-agent",agentinstance="support-prod",namespace="default",realm="us-realm"} 2
+# HELP loopstacks_agents Agents by phase.
+# TYPE loopstacks_agents gauge
+loopstacks_agents{namespace="default",phase="Pending"} 1
+loopstacks_agents{namespace="default",phase="Ready"} 1
+# HELP loopstacks_realm_agent_instances AgentInstances counted against the quota of a realm.
+# TYPE loopstacks_realm_agent_instances gauge
+loopstacks_realm_agent_instances{namespace="default",realm="eu-realm"} 0
+loopstacks_realm_agent_instances{namespace="default",realm="us-realm"} 1
+# HELP loopstacks_realm_max_agent_instances AgentInstance quota of a realm, for realms with one.
+# TYPE loopstacks_realm_max_agent_instances gauge
+loopstacks_realm_max_agent_instances{namespace="default",realm="us-realm"} 5
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
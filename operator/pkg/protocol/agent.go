@@ -0,0 +1,28 @@
+package protocol
+
+// Environment variables the operator sets on agent pods. Agents read them
+// to register and to connect to their realm's coordination backend.
+const (
+	EnvAgentID      = "LOOPSTACKS_AGENT_ID"
+	EnvAgent        = "LOOPSTACKS_AGENT"
+	EnvInstance     = "LOOPSTACKS_AGENT_INSTANCE"
+	EnvPod          = "LOOPSTACKS_POD_NAME"
+	EnvRevision     = "LOOPSTACKS_AGENT_REVISION"
+	EnvRealm        = "LOOPSTACKS_REALM"
+	EnvCapabilities = "LOOPSTACKS_CAPABILITIES"
+	EnvInputSchema  = "LOOPSTACKS_INPUT_SCHEMA"
+	EnvOutputSchema = "LOOPSTACKS_OUTPUT_SCHEMA"
+	EnvConfigDir    = "LOOPSTACKS_AGENT_CONFIG_DIR"
+	EnvBackend      = "LOOPSTACKS_COORDINATION_BACKEND"
+	EnvRedisURL     = "REDIS_URL"
+	EnvNATSURL      = "NATS_URL"
+	EnvNATSStream   = "LOOPSTACKS_NATS_STREAM"
+)
+
+// Layout of the config directory the operator mounts on agent pods
+const (
+	// ConfigFile holds AgentInstanceSpec.Config
+	ConfigFile = "config.json"
+	// SecretsDir holds AgentInstanceSpec.ConfigSecrets, one file each
+	SecretsDir = "secrets"
+)
@@ -0,0 +1,131 @@
+package protocol
+
+import "encoding/json"
+
+// Timestamps are milliseconds since the Unix epoch, matching the control
+// plane's Date.now().
+
+// LoopAnnouncement opens a loop for bidding
+type LoopAnnouncement struct {
+	Header
+	TraceContext
+	LoopID       string                     `json:"loopId" description:"Loop execution id"`
+	LoopStack    string                     `json:"loopstack,omitempty" description:"Name of the LoopStack being executed"`
+	Step         string                     `json:"step,omitempty" description:"Workflow step the loop was announced for"`
+	Realm        string                     `json:"realm,omitempty" description:"Realm the loop runs in"`
+	Capabilities []string                   `json:"capabilities" description:"Capabilities agents may bid with"`
+	Input        json.RawMessage            `json:"input,omitempty" description:"Loop input"`
+	Steps        map[string]json.RawMessage `json:"steps,omitempty" description:"Outputs of the steps completed before this one, by step name, since 1.5"`
+	Timestamp    int64                      `json:"timestamp,omitempty" description:"Announcement time"`
+	Deadline     int64                      `json:"deadline,omitempty" description:"Time after which bids are no longer considered"`
+}
+
+// Validate implements Message
+func (m *LoopAnnouncement) Validate() error {
+	if m.LoopID == "" {
+		return invalid("loop announcement: loopId is required")
+	}
+	if len(m.Capabilities) == 0 {
+		return invalid("loop announcement %s: capabilities are required", m.LoopID)
+	}
+	return nil
+}
+
+// Bid is an agent's offer to take part in a loop
+type Bid struct {
+	Header
+	TraceContext
+	LoopID       string   `json:"loopId,omitempty" description:"Loop execution id"`
+	AgentID      string   `json:"agentId" description:"Bidding agent"`
+	Timestamp    int64    `json:"timestamp" description:"Bid time"`
+	Confidence   float64  `json:"confidence,omitempty" description:"Agent's confidence in handling the loop, 0 to 1"`
+	Capabilities []string `json:"capabilities,omitempty" description:"Announced capabilities the agent provides"`
+}
+
+// Validate implements Message
+func (m *Bid) Validate() error {
+	if m.AgentID == "" {
+		return invalid("bid: agentId is required")
+	}
+	if m.Confidence < 0 || m.Confidence > 1 {
+		return invalid("bid from %s: confidence %v is outside [0, 1]", m.AgentID, m.Confidence)
+	}
+	return nil
+}
+
+// Selection notifies an agent that its bid was accepted
+type Selection struct {
+	Header
+	TraceContext
+	LoopID  string `json:"loopId" description:"Loop execution id"`
+	AgentID string `json:"agentId,omitempty" description:"Selected agent"`
+}
+
+// Validate implements Message
+func (m *Selection) Validate() error {
+	if m.LoopID == "" {
+		return invalid("selection: loopId is required")
+	}
+	return nil
+}
+
+// Result is an agent's output for a loop. Exactly one of Result and Error
+// is set.
+type Result struct {
+	Header
+	TraceContext
+	LoopID    string          `json:"loopId,omitempty" description:"Loop execution id"`
+	AgentID   string          `json:"agentId" description:"Agent that produced the result"`
+	Timestamp int64           `json:"timestamp" description:"Completion time"`
+	Result    json.RawMessage `json:"result,omitempty" description:"Agent output, valid against the Agent's output schema"`
+	Error     string          `json:"error,omitempty" description:"Failure reason when the agent could not produce a result"`
+}
+
+// Validate implements Message
+func (m *Result) Validate() error {
+	if m.AgentID == "" {
+		return invalid("result: agentId is required")
+	}
+	if len(m.Result) > 0 && m.Error != "" {
+		return invalid("result from %s: result and error are mutually exclusive", m.AgentID)
+	}
+	return nil
+}
+
+// Heartbeat registers an agent and keeps its registration alive
+type Heartbeat struct {
+	Header
+	AgentID       string   `json:"agentId" description:"Agent process id, usually the pod name"`
+	Agent         string   `json:"agent,omitempty" description:"Name of the Agent resource"`
+	Realm         string   `json:"realm,omitempty" description:"Realm the agent serves"`
+	AgentInstance string   `json:"agentInstance,omitempty" description:"Name of the AgentInstance that deployed the agent, since 1.1"`
+	Pod           string   `json:"pod,omitempty" description:"Name of the pod the agent runs in, since 1.1"`
+	Revision      string   `json:"revision,omitempty" description:"AgentInstance revision the agent's pod was deployed from, since 1.2"`
+	Capabilities  []string `json:"capabilities" description:"Capabilities the agent bids with"`
+	RegisteredAt  int64    `json:"registeredAt" description:"Registration time"`
+	LastHeartbeat int64    `json:"lastHeartbeat" description:"Time of this heartbeat"`
+	ActiveLoops   int32    `json:"activeLoops,omitempty" description:"Loops the agent is executing, since 1.4"`
+	Draining      bool     `json:"draining,omitempty" description:"The agent stopped bidding and is finishing its loops before it shuts down, since 1.4"`
+}
+
+// Validate implements Message
+func (m *Heartbeat) Validate() error {
+	if m.AgentID == "" {
+		return invalid("heartbeat: agentId is required")
+	}
+	if len(m.Capabilities) == 0 {
+		return invalid("heartbeat from %s: capabilities are required", m.AgentID)
+	}
+	return nil
+}
+
+// Messages lists a zero value of every message type by its schema name
+func Messages() map[string]Message {
+	return map[string]Message{
+		"LoopAnnouncement": &LoopAnnouncement{},
+		"Bid":              &Bid{},
+		"Selection":        &Selection{},
+		"Result":           &Result{},
+		"Heartbeat":        &Heartbeat{},
+	}
+}
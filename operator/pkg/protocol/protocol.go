@@ -0,0 +1,141 @@
+// Package protocol defines the wire format of the loop coordination
+// messages exchanged between the control plane, the operator and agents:
+// loop announcements, bids, selections, results and heartbeats.
+//
+// Every message carries a protocolVersion of the form "<major>.<minor>".
+// Peers on the same major version interoperate: minor versions only add
+// optional fields. A message from a newer minor version may therefore
+// contain fields this package does not know, which are ignored; unknown
+// fields in a message claiming an older or equal minor version are a
+// protocol error.
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MajorVersion changes on incompatible protocol changes
+	MajorVersion = 1
+	// MinorVersion changes when optional fields are added. 1.1 added the
+	// pod and agentInstance of heartbeats, 1.2 their revision, 1.3 the trace
+	// context of loop messages, 1.4 the active loops and draining state of
+	// heartbeats, 1.5 the previous step outputs of announcements.
+	MinorVersion = 5
+)
+
+// Version is the protocol version spoken by this package
+var Version = fmt.Sprintf("%d.%d", MajorVersion, MinorVersion)
+
+// LegacyVersion is assumed for messages without a protocolVersion, as sent
+// by peers that predate versioning
+const LegacyVersion = "1.0"
+
+var (
+	// ErrIncompatibleVersion is returned for messages of another major version
+	ErrIncompatibleVersion = errors.New("incompatible protocol version")
+	// ErrInvalidMessage is returned for messages that fail validation
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// Header is embedded in every message
+type Header struct {
+	ProtocolVersion string `json:"protocolVersion" description:"Protocol version as <major>.<minor>"`
+}
+
+func (h *Header) header() *Header {
+	return h
+}
+
+// TraceContext is the W3C trace context of the span a loop message was
+// sent from, letting the receiver continue the loop's trace
+type TraceContext struct {
+	Traceparent string `json:"traceparent,omitempty" description:"W3C traceparent of the sending span, since 1.3"`
+	Tracestate  string `json:"tracestate,omitempty" description:"W3C tracestate of the sending span, since 1.3"`
+}
+
+// Message is implemented by all coordination messages
+type Message interface {
+	header() *Header
+	// Validate checks the message's required fields
+	Validate() error
+}
+
+// ParseVersion splits a "<major>.<minor>" version
+func ParseVersion(version string) (major, minor int, err error) {
+	majorStr, minorStr, ok := strings.Cut(version, ".")
+	if !ok {
+		return 0, 0, fmt.Errorf("malformed protocol version %q", version)
+	}
+	if major, err = strconv.Atoi(majorStr); err != nil || major < 0 {
+		return 0, 0, fmt.Errorf("malformed protocol version %q", version)
+	}
+	if minor, err = strconv.Atoi(minorStr); err != nil || minor < 0 {
+		return 0, 0, fmt.Errorf("malformed protocol version %q", version)
+	}
+	return major, minor, nil
+}
+
+// Compatible reports whether a peer speaking version can be understood
+func Compatible(version string) error {
+	major, _, err := ParseVersion(version)
+	if err != nil {
+		return err
+	}
+	if major != MajorVersion {
+		return fmt.Errorf("%w: got %s, want %d.x", ErrIncompatibleVersion, version, MajorVersion)
+	}
+	return nil
+}
+
+// Encode stamps msg with the current protocol version, validates and
+// marshals it
+func Encode(msg Message) ([]byte, error) {
+	msg.header().ProtocolVersion = Version
+	if err := msg.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(msg)
+}
+
+// Decode unmarshals and validates a message. Unknown fields are rejected
+// unless the message was produced by a newer minor version of the protocol.
+func Decode(data []byte, msg Message) error {
+	var probe struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	version := probe.ProtocolVersion
+	if version == "" {
+		version = LegacyVersion
+	}
+	if err := Compatible(version); err != nil {
+		return err
+	}
+	_, minor, _ := ParseVersion(version)
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if minor <= MinorVersion {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(msg); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("%w: trailing data after message", ErrInvalidMessage)
+	}
+
+	msg.header().ProtocolVersion = version
+	return msg.Validate()
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidMessage, fmt.Sprintf(format, args...))
+}
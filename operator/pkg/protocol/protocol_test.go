@@ -0,0 +1,93 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	newer := fmt.Sprintf("%d.%d", MajorVersion, MinorVersion+1)
+	other := fmt.Sprintf("%d.0", MajorVersion+1)
+
+	tests := []struct {
+		name        string
+		data        string
+		wantVersion string
+		wantErr     error
+	}{
+		{
+			name:        "legacy message without version",
+			data:        `{"loopId":"l1","capabilities":["summarize"]}`,
+			wantVersion: LegacyVersion,
+		},
+		{
+			name:        "current version",
+			data:        `{"protocolVersion":"` + Version + `","loopId":"l1","capabilities":["summarize"]}`,
+			wantVersion: Version,
+		},
+		{
+			name:    "unknown field at our minor version",
+			data:    `{"protocolVersion":"` + Version + `","loopId":"l1","capabilities":["summarize"],"priority":3}`,
+			wantErr: ErrInvalidMessage,
+		},
+		{
+			name:    "unknown field in legacy message",
+			data:    `{"loopId":"l1","capabilities":["summarize"],"priority":3}`,
+			wantErr: ErrInvalidMessage,
+		},
+		{
+			name:        "unknown field from newer minor version",
+			data:        `{"protocolVersion":"` + newer + `","loopId":"l1","capabilities":["summarize"],"priority":3}`,
+			wantVersion: newer,
+		},
+		{
+			name:    "other major version",
+			data:    `{"protocolVersion":"` + other + `","loopId":"l1","capabilities":["summarize"]}`,
+			wantErr: ErrIncompatibleVersion,
+		},
+		{
+			name:    "failing validation",
+			data:    `{"protocolVersion":"` + Version + `","loopId":"l1"}`,
+			wantErr: ErrInvalidMessage,
+		},
+		{
+			name:    "trailing data",
+			data:    `{"loopId":"l1","capabilities":["summarize"]}{}`,
+			wantErr: ErrInvalidMessage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg LoopAnnouncement
+			err := Decode([]byte(tt.data), &msg)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if msg.ProtocolVersion != tt.wantVersion {
+				t.Errorf("ProtocolVersion = %q, want %q", msg.ProtocolVersion, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	in := &Bid{LoopID: "l1", AgentID: "a1", Timestamp: 1, Confidence: 0.5}
+	data, err := Encode(in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	var out Bid
+	if err := Decode(data, &out); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if out.ProtocolVersion != Version || out.AgentID != in.AgentID || out.Confidence != in.Confidence {
+		t.Errorf("round trip = %+v, want %+v", out, *in)
+	}
+}
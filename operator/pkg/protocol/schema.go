@@ -0,0 +1,128 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//go:generate go run ../../cmd/protocol-schema -o ../../../schemas/api/loopstacks-coordination.json
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// JSONSchema renders the JSON Schema of all coordination messages, derived
+// from the Go types in this package
+func JSONSchema() ([]byte, error) {
+	definitions := make(map[string]interface{})
+	names := make([]string, 0)
+	for name, msg := range Messages() {
+		definitions[name] = structSchema(reflect.TypeOf(msg).Elem())
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	doc := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         fmt.Sprintf("https://loopstacks.io/schemas/api/v%d/coordination.json", MajorVersion),
+		"title":       "LoopStacks Coordination Protocol Schema",
+		"description": fmt.Sprintf("Loop coordination messages, protocol version %s. Generated from operator/pkg/protocol; do not edit.", Version),
+		"type":        "object",
+		"definitions": definitions,
+		"oneOf":       refs(names),
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func refs(names []string) []interface{} {
+	out := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		out = append(out, map[string]interface{}{"$ref": "#/definitions/" + name})
+	}
+	return out
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	collectFields(t, properties, &required)
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func collectFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			collectFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := typeSchema(field.Type)
+		if description := field.Tag.Get("description"); description != "" {
+			prop["description"] = description
+		}
+		properties[name] = prop
+
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		return map[string]interface{}{}
+	}
+}
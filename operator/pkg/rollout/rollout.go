@@ -0,0 +1,115 @@
+// Package rollout defines how a new revision of an AgentInstance replaces
+// the running one. A RollingUpdate replaces pods in place. BlueGreen and
+// Canary run the new revision next to the stable one and route loops
+// between them: the AgentInstance controller moves the routing weight in
+// the AgentInstance's status, and the execution engine's Router filters
+// bids by it.
+package rollout
+
+import (
+	"fmt"
+	"time"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/duration"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+)
+
+// Strategies of AgentInstanceRollout.Strategy
+const (
+	RollingUpdate = "RollingUpdate"
+	BlueGreen     = "BlueGreen"
+	Canary        = "Canary"
+)
+
+// Phases of AgentInstanceRolloutStatus.Phase
+const (
+	// PhaseProgressing waits for the pods of the new revision
+	PhaseProgressing = "Progressing"
+	// PhasePaused waits for a BlueGreen revision to be promoted
+	PhasePaused = "Paused"
+	// PhaseAnalyzing routes Weight percent of loops to a canary
+	PhaseAnalyzing = "Analyzing"
+	// PhasePromoting routes all loops to the new revision while the stable
+	// pods are replaced
+	PhasePromoting  = "Promoting"
+	PhaseCompleted  = "Completed"
+	PhaseRolledBack = "RolledBack"
+)
+
+// PromoteAnnotation promotes the revision it is set to on an AgentInstance
+const PromoteAnnotation = "loopstacks.io/promote"
+
+// Canary defaults, matching the AgentInstance CRD
+const (
+	DefaultCanaryReplicas = 1
+	DefaultCanaryWeight   = 10
+	DefaultCanaryDuration = 10 * time.Minute
+	DefaultMinExecutions  = 10
+	DefaultMaxFailureRate = 5
+)
+
+// Routed reports whether loops are split between the stable and update
+// revisions of an AgentInstance
+func Routed(instance *loopstacksv1.AgentInstance) bool {
+	status := instance.Status.Rollout
+	switch instance.Spec.Rollout.Strategy {
+	case BlueGreen, Canary:
+		return status.StableRevision != "" && status.UpdateRevision != "" && status.StableRevision != status.UpdateRevision
+	default:
+		return false
+	}
+}
+
+// Promoted reports whether revision was promoted by annotation
+func Promoted(instance *loopstacksv1.AgentInstance, revision string) bool {
+	return instance.Annotations[PromoteAnnotation] == revision
+}
+
+// Verdict is the outcome of a canary analysis
+type Verdict int
+
+const (
+	// Continue analyzing the canary
+	Continue Verdict = iota
+	// Promote the canary
+	Promote
+	// Rollback the canary
+	Rollback
+)
+
+// Analyze judges a canary by the stats of its executions since it started
+// receiving loops at start, explaining the verdict
+func Analyze(canary loopstacksv1.AgentInstanceCanary, stats history.AgentStats, start, now time.Time) (Verdict, string, error) {
+	minExecutions := int(canary.MinExecutions)
+	if minExecutions <= 0 {
+		minExecutions = DefaultMinExecutions
+	}
+	maxFailureRate := int(canary.MaxFailureRate)
+	if maxFailureRate <= 0 {
+		maxFailureRate = DefaultMaxFailureRate
+	}
+	analysis, err := duration.ParseOrDefault(canary.Duration, DefaultCanaryDuration)
+	if err != nil {
+		return Continue, "", fmt.Errorf("invalid canary duration: %w", err)
+	}
+	maxLatency, err := duration.ParseOrDefault(canary.MaxLatency, 0)
+	if err != nil {
+		return Continue, "", fmt.Errorf("invalid canary maxLatency: %w", err)
+	}
+
+	if stats.Runs < minExecutions {
+		return Continue, fmt.Sprintf("Waiting for %d of %d canary executions", minExecutions-stats.Runs, minExecutions), nil
+	}
+	if stats.Failures*100 > stats.Runs*maxFailureRate {
+		return Rollback, fmt.Sprintf("Canary failure rate %d%% exceeds %d%% (%d of %d executions failed)",
+			stats.Failures*100/stats.Runs, maxFailureRate, stats.Failures, stats.Runs), nil
+	}
+	if maxLatency > 0 && stats.P95Latency > maxLatency {
+		return Rollback, fmt.Sprintf("Canary p95 latency %s exceeds %s", stats.P95Latency, maxLatency), nil
+	}
+	if remaining := analysis - now.Sub(start); remaining > 0 {
+		return Continue, fmt.Sprintf("Canary healthy after %d executions, promoting in %s", stats.Runs, remaining.Round(time.Second)), nil
+	}
+	return Promote, fmt.Sprintf("Canary healthy after %d executions", stats.Runs), nil
+}
@@ -0,0 +1,117 @@
+package rollout
+
+import (
+	"testing"
+	"time"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+)
+
+func TestAnalyze(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	canary := loopstacksv1.AgentInstanceCanary{
+		MinExecutions:  20,
+		MaxFailureRate: 10,
+		MaxLatency:     "2s",
+		Duration:       "10m",
+	}
+
+	tests := []struct {
+		name    string
+		canary  loopstacksv1.AgentInstanceCanary
+		stats   history.AgentStats
+		elapsed time.Duration
+		want    Verdict
+		wantErr bool
+	}{
+		{
+			name:    "below minimum executions",
+			canary:  canary,
+			stats:   history.AgentStats{Runs: 19, Failures: 19, P95Latency: time.Minute},
+			elapsed: time.Hour,
+			want:    Continue,
+		},
+		{
+			name:    "below default minimum executions",
+			stats:   history.AgentStats{Runs: DefaultMinExecutions - 1},
+			elapsed: time.Hour,
+			want:    Continue,
+		},
+		{
+			name:    "failure rate over threshold",
+			canary:  canary,
+			stats:   history.AgentStats{Runs: 20, Failures: 3, P95Latency: time.Second},
+			elapsed: time.Minute,
+			want:    Rollback,
+		},
+		{
+			name:    "failure rate at threshold",
+			canary:  canary,
+			stats:   history.AgentStats{Runs: 20, Failures: 2, P95Latency: time.Second},
+			elapsed: time.Hour,
+			want:    Promote,
+		},
+		{
+			name:    "failure rate over default threshold",
+			stats:   history.AgentStats{Runs: 100, Failures: DefaultMaxFailureRate + 1},
+			elapsed: time.Hour,
+			want:    Rollback,
+		},
+		{
+			name:    "latency over threshold",
+			canary:  canary,
+			stats:   history.AgentStats{Runs: 20, P95Latency: 3 * time.Second},
+			elapsed: time.Hour,
+			want:    Rollback,
+		},
+		{
+			name:    "latency unbounded by default",
+			stats:   history.AgentStats{Runs: DefaultMinExecutions, P95Latency: time.Hour},
+			elapsed: time.Hour,
+			want:    Promote,
+		},
+		{
+			name:    "healthy before the analysis duration",
+			canary:  canary,
+			stats:   history.AgentStats{Runs: 20, Failures: 1, P95Latency: time.Second},
+			elapsed: 5 * time.Minute,
+			want:    Continue,
+		},
+		{
+			name:    "promote",
+			canary:  canary,
+			stats:   history.AgentStats{Runs: 20, Failures: 1, P95Latency: time.Second},
+			elapsed: 10 * time.Minute,
+			want:    Promote,
+		},
+		{
+			name:    "invalid duration",
+			canary:  loopstacksv1.AgentInstanceCanary{Duration: "soon"},
+			stats:   history.AgentStats{Runs: 100},
+			want:    Continue,
+			wantErr: true,
+		},
+		{
+			name:    "invalid max latency",
+			canary:  loopstacksv1.AgentInstanceCanary{MaxLatency: "fast"},
+			stats:   history.AgentStats{Runs: 100},
+			want:    Continue,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason, err := Analyze(tt.canary, tt.stats, start, start.Add(tt.elapsed))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Analyze() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Analyze() = %v (%s), want %v", got, reason, tt.want)
+			}
+			if err == nil && reason == "" {
+				t.Error("Analyze() gave no reason")
+			}
+		})
+	}
+}
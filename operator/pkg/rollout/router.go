@@ -0,0 +1,71 @@
+package rollout
+
+import (
+	"context"
+	"math/rand/v2"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// Router routes each loop to one revision of every AgentInstance whose
+// loops are split by a rollout
+type Router struct {
+	Client client.Reader
+	// Percent returns a number in [0, 100). Defaults to a random number.
+	Percent func() int32
+}
+
+// Route drops the bids of agents whose revision the loop was not routed
+// to. agents are the registered agents of the realm by agent id, which
+// tell the AgentInstance and revision of a bid. Route returns the revision
+// chosen for each split AgentInstance that bid.
+func (r *Router) Route(ctx context.Context, namespace string, agents map[string]protocol.Heartbeat, bids []protocol.Bid) ([]protocol.Bid, map[string]string, error) {
+	var instances loopstacksv1.AgentInstanceList
+	if err := r.Client.List(ctx, &instances, client.InNamespace(namespace)); err != nil {
+		return nil, nil, err
+	}
+
+	split := make(map[string]*loopstacksv1.AgentInstance)
+	for i := range instances.Items {
+		if Routed(&instances.Items[i]) {
+			split[instances.Items[i].Name] = &instances.Items[i]
+		}
+	}
+	if len(split) == 0 {
+		return bids, nil, nil
+	}
+
+	chosen := make(map[string]string)
+	routed := make([]protocol.Bid, 0, len(bids))
+	for _, bid := range bids {
+		agent := agents[bid.AgentID]
+		instance, ok := split[agent.AgentInstance]
+		if !ok || agent.Revision == "" {
+			routed = append(routed, bid)
+			continue
+		}
+
+		revision, ok := chosen[instance.Name]
+		if !ok {
+			revision = instance.Status.Rollout.StableRevision
+			if r.percent() < instance.Status.Rollout.Weight {
+				revision = instance.Status.Rollout.UpdateRevision
+			}
+			chosen[instance.Name] = revision
+		}
+		if agent.Revision == revision {
+			routed = append(routed, bid)
+		}
+	}
+	return routed, chosen, nil
+}
+
+func (r *Router) percent() int32 {
+	if r.Percent != nil {
+		return r.Percent()
+	}
+	return rand.Int32N(100)
+}
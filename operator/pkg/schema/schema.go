@@ -0,0 +1,63 @@
+// Package schema compiles the JSON schemas embedded in LoopStacks resources
+// and validates documents against them.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Validator validates JSON documents against a compiled schema
+type Validator struct {
+	schema *jsonschema.Schema
+}
+
+// Compile compiles a JSON schema document. An empty document yields a
+// Validator that accepts everything.
+func Compile(raw []byte) (*Validator, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return &Validator{}, nil
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema document: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("schema.json", doc); err != nil {
+		return nil, fmt.Errorf("invalid schema document: %w", err)
+	}
+	sch, err := compiler.Compile("schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &Validator{schema: sch}, nil
+}
+
+// Validate validates raw JSON against the schema
+func (v *Validator) Validate(raw []byte) error {
+	if v == nil || v.schema == nil {
+		return nil
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("invalid JSON document: %w", err)
+	}
+	return v.schema.Validate(doc)
+}
+
+// ValidateValue validates a Go value by round-tripping it through JSON
+func (v *Validator) ValidateValue(value interface{}) error {
+	if v == nil || v.schema == nil {
+		return nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal document: %w", err)
+	}
+	return v.Validate(raw)
+}
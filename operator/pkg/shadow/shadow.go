@@ -0,0 +1,159 @@
+// Package shadow evaluates agents in shadow mode. The agents of an
+// AgentInstance with Shadow set run every loop they bid on next to the
+// selected agents, on the same input, but their results never reach the
+// step's output. Each result is instead checked against the Agent's output
+// schema, compared with the step's output and recorded with its
+// differences as a history.ShadowRun for review.
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/schema"
+)
+
+// Evaluator compares the results of shadow agents and records them
+type Evaluator struct {
+	Client client.Reader
+	Store  history.Store
+}
+
+// Instances returns the shadow AgentInstances of a namespace by name
+func (e *Evaluator) Instances(ctx context.Context, namespace string) (map[string]*loopstacksv1.AgentInstance, error) {
+	var instances loopstacksv1.AgentInstanceList
+	if err := e.Client.List(ctx, &instances, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	shadows := make(map[string]*loopstacksv1.AgentInstance)
+	for i := range instances.Items {
+		if instances.Items[i].Spec.Shadow {
+			shadows[instances.Items[i].Name] = &instances.Items[i]
+		}
+	}
+	return shadows, nil
+}
+
+// Compare completes a shadow run of an Agent with the step's output and the
+// results of the step's selected agents. The run agrees when its result
+// equals the output or one of the results; otherwise its differences from
+// the output are recorded. Runs of failed steps, which have no output, are
+// only validated.
+func (e *Evaluator) Compare(ctx context.Context, run *history.ShadowRun, agent string, output json.RawMessage, results []json.RawMessage) error {
+	run.Expected = output
+	if run.Error != "" {
+		return nil
+	}
+
+	var resource loopstacksv1.Agent
+	if err := e.Client.Get(ctx, types.NamespacedName{Namespace: run.Namespace, Name: agent}, &resource); err != nil {
+		return fmt.Errorf("failed to get Agent %s: %w", agent, err)
+	}
+	validator, err := schema.Compile(resource.Spec.Schema.Output.Raw)
+	if err != nil {
+		return fmt.Errorf("agent %s: %w", agent, err)
+	}
+	run.SchemaValid = validator.Validate(run.Result) == nil
+	if len(output) == 0 {
+		return nil
+	}
+
+	for _, result := range append([]json.RawMessage{output}, results...) {
+		if differences, err := Diff(result, run.Result); err == nil && len(differences) == 0 {
+			run.Agreed = true
+			return nil
+		}
+	}
+
+	differences, err := Diff(output, run.Result)
+	if err != nil {
+		return err
+	}
+	run.Diff, err = json.Marshal(differences)
+	return err
+}
+
+// Record saves shadow runs
+func (e *Evaluator) Record(ctx context.Context, runs []history.ShadowRun) error {
+	return e.Store.SaveShadowRuns(ctx, runs)
+}
+
+// Difference is a value that differs between two documents
+type Difference struct {
+	// Path is the JSON pointer of the value
+	Path     string      `json:"path"`
+	Expected interface{} `json:"expected"`
+	Actual   interface{} `json:"actual"`
+}
+
+// Diff lists the differences between two JSON documents, regardless of
+// formatting and key order. Arrays of different lengths differ as a whole.
+func Diff(expected, actual json.RawMessage) ([]Difference, error) {
+	var a, b interface{}
+	if len(expected) > 0 {
+		if err := json.Unmarshal(expected, &a); err != nil {
+			return nil, fmt.Errorf("invalid expected document: %w", err)
+		}
+	}
+	if len(actual) > 0 {
+		if err := json.Unmarshal(actual, &b); err != nil {
+			return nil, fmt.Errorf("invalid actual document: %w", err)
+		}
+	}
+
+	var differences []Difference
+	diff("", a, b, &differences)
+	return differences, nil
+}
+
+func diff(path string, expected, actual interface{}, differences *[]Difference) {
+	switch a := expected.(type) {
+	case map[string]interface{}:
+		b, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(a)+len(b))
+		for key := range a {
+			keys = append(keys, key)
+		}
+		for key := range b {
+			if _, ok := a[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			diff(path+"/"+escape(key), a[key], b[key], differences)
+		}
+		return
+	case []interface{}:
+		b, ok := actual.([]interface{})
+		if !ok || len(a) != len(b) {
+			break
+		}
+		for i := range a {
+			diff(path+"/"+strconv.Itoa(i), a[i], b[i], differences)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		*differences = append(*differences, Difference{Path: path, Expected: expected, Actual: actual})
+	}
+}
+
+// escape escapes a key for a JSON pointer
+func escape(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
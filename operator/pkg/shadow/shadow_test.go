@@ -0,0 +1,182 @@
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/history"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     []Difference
+	}{
+		{
+			name:     "key order and formatting",
+			expected: `{"reply":"hello","tags":["a","b"],"score":1}`,
+			actual:   "{\n  \"score\": 1.0,\n  \"tags\": [ \"a\", \"b\" ],\n  \"reply\": \"hello\"\n}",
+		},
+		{
+			name:     "changed value",
+			expected: `{"reply":"hello","meta":{"tone":"friendly"}}`,
+			actual:   `{"reply":"hello","meta":{"tone":"formal"}}`,
+			want:     []Difference{{Path: "/meta/tone", Expected: "friendly", Actual: "formal"}},
+		},
+		{
+			name:     "missing and extra keys",
+			expected: `{"reply":"hello","intent":"greeting"}`,
+			actual:   `{"reply":"hello","language":"en"}`,
+			want: []Difference{
+				{Path: "/intent", Expected: "greeting", Actual: nil},
+				{Path: "/language", Expected: nil, Actual: "en"},
+			},
+		},
+		{
+			name:     "array items",
+			expected: `{"tags":["a","b","c"]}`,
+			actual:   `{"tags":["a","x","c"]}`,
+			want:     []Difference{{Path: "/tags/1", Expected: "b", Actual: "x"}},
+		},
+		{
+			name:     "array length mismatch",
+			expected: `{"tags":["a","b"]}`,
+			actual:   `{"tags":["a","b","c"]}`,
+			want:     []Difference{{Path: "/tags", Expected: []interface{}{"a", "b"}, Actual: []interface{}{"a", "b", "c"}}},
+		},
+		{
+			name:     "type mismatch",
+			expected: `{"score":1}`,
+			actual:   `{"score":"1"}`,
+			want:     []Difference{{Path: "/score", Expected: float64(1), Actual: "1"}},
+		},
+		{
+			name:     "pointer escaping",
+			expected: `{"a/b":1,"c~d":{"e":true}}`,
+			actual:   `{"a/b":2,"c~d":{"e":false}}`,
+			want: []Difference{
+				{Path: "/a~1b", Expected: float64(1), Actual: float64(2)},
+				{Path: "/c~0d/e", Expected: true, Actual: false},
+			},
+		},
+		{
+			name:     "whole document",
+			expected: `"hello"`,
+			actual:   `["hello"]`,
+			want:     []Difference{{Path: "", Expected: "hello", Actual: []interface{}{"hello"}}},
+		},
+		{
+			name:     "no result",
+			expected: `{"reply":"hello"}`,
+			want:     []Difference{{Path: "", Expected: map[string]interface{}{"reply": "hello"}, Actual: nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actual json.RawMessage
+			if tt.actual != "" {
+				actual = json.RawMessage(tt.actual)
+			}
+			got, err := Diff(json.RawMessage(tt.expected), actual)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Diff(json.RawMessage(`{"reply":`), json.RawMessage(`{}`)); err == nil {
+		t.Error("Diff() of an invalid document error = nil")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := loopstacksv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	agent := &loopstacksv1.Agent{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "support-agent"}}
+	agent.Spec.Schema.Output = runtime.RawExtension{Raw: []byte(`{"type":"object","required":["reply"]}`)}
+	evaluator := &Evaluator{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(agent).Build()}
+
+	output := json.RawMessage(`{"reply":"hello","votes":3}`)
+	results := []json.RawMessage{json.RawMessage(`{"reply":"hello","votes":2}`), json.RawMessage(`{"reply":"hi"}`)}
+	tests := []struct {
+		name       string
+		run        history.ShadowRun
+		output     json.RawMessage
+		wantValid  bool
+		wantAgreed bool
+		wantDiff   string
+	}{
+		{
+			name:       "agrees with the output",
+			run:        history.ShadowRun{Result: json.RawMessage(`{ "votes": 3, "reply": "hello" }`)},
+			output:     output,
+			wantValid:  true,
+			wantAgreed: true,
+		},
+		{
+			name:       "agrees with a result that was not aggregated",
+			run:        history.ShadowRun{Result: json.RawMessage(`{"reply":"hi"}`)},
+			output:     output,
+			wantValid:  true,
+			wantAgreed: true,
+		},
+		{
+			name:      "disagrees",
+			run:       history.ShadowRun{Result: json.RawMessage(`{"reply":"bye","votes":3}`)},
+			output:    output,
+			wantValid: true,
+			wantDiff:  `[{"path":"/reply","expected":"hello","actual":"bye"}]`,
+		},
+		{
+			name:     "invalid result",
+			run:      history.ShadowRun{Result: json.RawMessage(`{"answer":"hello"}`)},
+			output:   output,
+			wantDiff: `[{"path":"/answer","expected":null,"actual":"hello"},{"path":"/reply","expected":"hello","actual":null},{"path":"/votes","expected":3,"actual":null}]`,
+		},
+		{
+			name:      "failed step",
+			run:       history.ShadowRun{Result: json.RawMessage(`{"reply":"hello"}`)},
+			wantValid: true,
+		},
+		{
+			name:   "failed shadow run",
+			run:    history.ShadowRun{Error: "model timeout"},
+			output: output,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := tt.run
+			run.Namespace = "default"
+			if err := evaluator.Compare(context.Background(), &run, "support-agent", tt.output, results); err != nil {
+				t.Fatalf("Compare() error = %v", err)
+			}
+			if string(run.Expected) != string(tt.output) {
+				t.Errorf("Expected = %s, want the step's output %s", run.Expected, tt.output)
+			}
+			if run.SchemaValid != tt.wantValid || run.Agreed != tt.wantAgreed || string(run.Diff) != tt.wantDiff {
+				t.Errorf("Compare() = valid %v, agreed %v, diff %s; want valid %v, agreed %v, diff %s",
+					run.SchemaValid, run.Agreed, run.Diff, tt.wantValid, tt.wantAgreed, tt.wantDiff)
+			}
+		})
+	}
+
+	run := history.ShadowRun{Namespace: "default", Result: json.RawMessage(`{}`)}
+	if err := evaluator.Compare(context.Background(), &run, "unknown-agent", output, nil); err == nil {
+		t.Error("Compare() with an unknown Agent error = nil")
+	}
+}
@@ -0,0 +1,155 @@
+// Package sharing resolves the capabilities realms share with each other.
+// A realm exports capabilities, to every realm or to named ones, and
+// another realm imports them; agents of the exporting realm then bid on the
+// importing realm's loops that need only imported capabilities. Both realms
+// must allow cross-realm communication.
+package sharing
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/backends"
+)
+
+// Ref resolves a realm reference, a name in namespace or namespace/name
+func Ref(namespace, ref string) types.NamespacedName {
+	if ns, name, ok := strings.Cut(ref, "/"); ok {
+		return types.NamespacedName{Namespace: ns, Name: name}
+	}
+	return types.NamespacedName{Namespace: namespace, Name: ref}
+}
+
+// Imports reports whether importer imports from the realm named exporter
+func Imports(importer *loopstacksv1.Realm, exporter types.NamespacedName) bool {
+	for _, imp := range importer.Spec.Networking.Imports {
+		if Ref(importer.Namespace, imp.Realm) == exporter {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve computes the effective imports of importer among realms
+func Resolve(importer *loopstacksv1.Realm, realms []loopstacksv1.Realm) []loopstacksv1.EffectiveImport {
+	self := types.NamespacedName{Namespace: importer.Namespace, Name: importer.Name}
+	byName := make(map[types.NamespacedName]*loopstacksv1.Realm, len(realms))
+	for i := range realms {
+		byName[types.NamespacedName{Namespace: realms[i].Namespace, Name: realms[i].Name}] = &realms[i]
+	}
+
+	var effective []loopstacksv1.EffectiveImport
+	for _, imp := range importer.Spec.Networking.Imports {
+		ref := Ref(importer.Namespace, imp.Realm)
+		result := loopstacksv1.EffectiveImport{Realm: ref.String()}
+
+		exporter, found := byName[ref]
+		switch {
+		case ref == self:
+			result.Message = "A realm cannot import from itself"
+		case !importer.Spec.Networking.AllowCrossRealmCommunication:
+			result.Message = "Cross-realm communication is disabled in this realm"
+		case !found:
+			result.Message = fmt.Sprintf("Realm %s not found", ref)
+		case !exporter.Spec.Networking.AllowCrossRealmCommunication:
+			result.Message = fmt.Sprintf("Cross-realm communication is disabled in realm %s", ref)
+		}
+		if result.Message != "" {
+			result.Denied = imp.Capabilities
+			effective = append(effective, result)
+			continue
+		}
+
+		exported := Exported(exporter, self)
+		for _, capability := range imp.Capabilities {
+			if slices.Contains(exported, capability) {
+				result.Capabilities = append(result.Capabilities, capability)
+			} else {
+				result.Denied = append(result.Denied, capability)
+			}
+		}
+		if len(result.Denied) > 0 {
+			result.Message = fmt.Sprintf("Realm %s does not export %s to this realm", ref, strings.Join(result.Denied, ", "))
+		}
+		effective = append(effective, result)
+	}
+	return effective
+}
+
+// Exported returns the capabilities exporter exports to the realm named
+// importer
+func Exported(exporter *loopstacksv1.Realm, importer types.NamespacedName) []string {
+	var capabilities []string
+	for _, export := range exporter.Spec.Networking.Exports {
+		if len(export.Realms) > 0 && !slices.ContainsFunc(export.Realms, func(ref string) bool {
+			return Ref(exporter.Namespace, ref) == importer
+		}) {
+			continue
+		}
+		for _, capability := range export.Capabilities {
+			if !slices.Contains(capabilities, capability) {
+				capabilities = append(capabilities, capability)
+			}
+		}
+	}
+	return capabilities
+}
+
+// Exporter is a realm whose agents may bid on a loop of an importing realm
+type Exporter struct {
+	Realm   *loopstacksv1.Realm
+	Backend coordination.Backend
+}
+
+// Resolver finds the realms whose agents may bid on a realm's loops
+type Resolver struct {
+	Client   client.Reader
+	Backends backends.Source
+}
+
+// Exporters returns the realms that export every one of capabilities to
+// realm, connected to their backends
+func (r *Resolver) Exporters(ctx context.Context, realm *loopstacksv1.Realm, capabilities []string) ([]Exporter, error) {
+	if len(realm.Spec.Networking.Imports) == 0 || len(capabilities) == 0 {
+		return nil, nil
+	}
+
+	var realms loopstacksv1.RealmList
+	if err := r.Client.List(ctx, &realms); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*loopstacksv1.Realm, len(realms.Items))
+	for i := range realms.Items {
+		byName[types.NamespacedName{Namespace: realms.Items[i].Namespace, Name: realms.Items[i].Name}.String()] = &realms.Items[i]
+	}
+
+	var exporters []Exporter
+	for _, imp := range Resolve(realm, realms.Items) {
+		if !covers(imp.Capabilities, capabilities) {
+			continue
+		}
+		exporter := byName[imp.Realm]
+		backend, err := r.Backends.Backend(ctx, exporter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to realm %s: %w", imp.Realm, err)
+		}
+		exporters = append(exporters, Exporter{Realm: exporter, Backend: backend})
+	}
+	return exporters, nil
+}
+
+func covers(have, want []string) bool {
+	for _, capability := range want {
+		if !slices.Contains(have, capability) {
+			return false
+		}
+	}
+	return true
+}
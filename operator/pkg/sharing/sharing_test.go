@@ -0,0 +1,132 @@
+package sharing
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+)
+
+func realm(namespace, name string, crossRealm bool, exports ...loopstacksv1.CapabilityExport) loopstacksv1.Realm {
+	r := loopstacksv1.Realm{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	r.Spec.Networking.AllowCrossRealmCommunication = crossRealm
+	r.Spec.Networking.Exports = exports
+	return r
+}
+
+func TestExported(t *testing.T) {
+	exporter := realm("default", "research", true,
+		loopstacksv1.CapabilityExport{Capabilities: []string{"summarize", "search"}},
+		loopstacksv1.CapabilityExport{Capabilities: []string{"translate", "search"}, Realms: []string{"support", "billing/invoices"}},
+		loopstacksv1.CapabilityExport{Capabilities: []string{"classify"}, Realms: []string{"legal"}},
+	)
+	tests := []struct {
+		importer types.NamespacedName
+		want     []string
+	}{
+		{importer: types.NamespacedName{Namespace: "default", Name: "support"}, want: []string{"summarize", "search", "translate"}},
+		{importer: types.NamespacedName{Namespace: "billing", Name: "invoices"}, want: []string{"summarize", "search", "translate"}},
+		{importer: types.NamespacedName{Namespace: "default", Name: "legal"}, want: []string{"summarize", "search", "classify"}},
+		{importer: types.NamespacedName{Namespace: "billing", Name: "support"}, want: []string{"summarize", "search"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.importer.String(), func(t *testing.T) {
+			if got := Exported(&exporter, tt.importer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Exported() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	private := realm("default", "private", true, loopstacksv1.CapabilityExport{Capabilities: []string{"search"}, Realms: []string{"legal"}})
+	if got := Exported(&private, types.NamespacedName{Namespace: "default", Name: "support"}); len(got) != 0 {
+		t.Errorf("Exported() to a realm not named = %v, want none", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	realms := []loopstacksv1.Realm{
+		realm("default", "research", true,
+			loopstacksv1.CapabilityExport{Capabilities: []string{"summarize"}},
+			loopstacksv1.CapabilityExport{Capabilities: []string{"translate"}, Realms: []string{"support"}},
+		),
+		realm("billing", "invoices", true, loopstacksv1.CapabilityExport{Capabilities: []string{"invoice"}, Realms: []string{"default/support"}}),
+		realm("default", "closed", false, loopstacksv1.CapabilityExport{Capabilities: []string{"summarize"}}),
+	}
+	tests := []struct {
+		name       string
+		crossRealm bool
+		imports    []loopstacksv1.CapabilityImport
+		want       []loopstacksv1.EffectiveImport
+	}{
+		{
+			name:       "wildcard and named exports",
+			crossRealm: true,
+			imports:    []loopstacksv1.CapabilityImport{{Realm: "research", Capabilities: []string{"summarize", "translate"}}},
+			want:       []loopstacksv1.EffectiveImport{{Realm: "default/research", Capabilities: []string{"summarize", "translate"}}},
+		},
+		{
+			name:       "named export in another namespace",
+			crossRealm: true,
+			imports:    []loopstacksv1.CapabilityImport{{Realm: "billing/invoices", Capabilities: []string{"invoice"}}},
+			want:       []loopstacksv1.EffectiveImport{{Realm: "billing/invoices", Capabilities: []string{"invoice"}}},
+		},
+		{
+			name:       "capability not exported",
+			crossRealm: true,
+			imports:    []loopstacksv1.CapabilityImport{{Realm: "research", Capabilities: []string{"summarize", "classify"}}},
+			want: []loopstacksv1.EffectiveImport{{
+				Realm:        "default/research",
+				Capabilities: []string{"summarize"},
+				Denied:       []string{"classify"},
+				Message:      "Realm default/research does not export classify to this realm",
+			}},
+		},
+		{
+			name:       "self import",
+			crossRealm: true,
+			imports:    []loopstacksv1.CapabilityImport{{Realm: "default/support", Capabilities: []string{"reply"}}},
+			want:       []loopstacksv1.EffectiveImport{{Realm: "default/support", Denied: []string{"reply"}, Message: "A realm cannot import from itself"}},
+		},
+		{
+			name:    "cross-realm communication disabled",
+			imports: []loopstacksv1.CapabilityImport{{Realm: "research", Capabilities: []string{"summarize"}}},
+			want: []loopstacksv1.EffectiveImport{{
+				Realm:   "default/research",
+				Denied:  []string{"summarize"},
+				Message: "Cross-realm communication is disabled in this realm",
+			}},
+		},
+		{
+			name:       "cross-realm communication disabled in the exporter",
+			crossRealm: true,
+			imports:    []loopstacksv1.CapabilityImport{{Realm: "closed", Capabilities: []string{"summarize"}}},
+			want: []loopstacksv1.EffectiveImport{{
+				Realm:   "default/closed",
+				Denied:  []string{"summarize"},
+				Message: "Cross-realm communication is disabled in realm default/closed",
+			}},
+		},
+		{
+			name:       "unknown realm",
+			crossRealm: true,
+			imports:    []loopstacksv1.CapabilityImport{{Realm: "missing", Capabilities: []string{"summarize"}}},
+			want: []loopstacksv1.EffectiveImport{{
+				Realm:   "default/missing",
+				Denied:  []string{"summarize"},
+				Message: "Realm default/missing not found",
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			importer := realm("default", "support", tt.crossRealm)
+			importer.Spec.Networking.Imports = tt.imports
+			if got := Resolve(&importer, append(realms, importer)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package tracing sets up OpenTelemetry tracing for the operator, the
+// engine and Go agents. Loop messages carry the W3C trace context of the
+// span they were sent from, so the bids and executions of agents join the
+// trace of the loop that announced them.
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+const instrumentationName = "github.com/loopstacks/loopstacks-platform/operator"
+
+// Environment variables of the OTLP exporter that enable tracing when
+// Options.Endpoint is empty
+const (
+	EnvOTLPEndpoint       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	EnvOTLPTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+)
+
+// propagator reads and writes the trace context of loop messages. It does
+// not depend on the global propagator, which embedders may not set.
+var propagator = propagation.TraceContext{}
+
+// Tracer returns the tracer of LoopStacks spans. It follows the global
+// tracer provider, installed by Setup or InMemory.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Options configures Setup
+type Options struct {
+	// ServiceName identifies the process in traces
+	ServiceName string
+	// Endpoint is the host:port of the OTLP gRPC collector. When empty, the
+	// standard OTEL_EXPORTER_OTLP_* variables configure the exporter, and
+	// spans are not exported if they do not set an endpoint either.
+	Endpoint string
+	// Insecure disables TLS to the collector
+	Insecure bool
+}
+
+// Setup installs a global tracer provider exporting spans over OTLP and
+// the W3C propagators. The returned function flushes pending spans and
+// stops the exporter.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if opts.Endpoint == "" && os.Getenv(EnvOTLPEndpoint) == "" && os.Getenv(EnvOTLPTracesEndpoint) == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporterOpts []otlptracegrpc.Option
+	if opts.Endpoint != "" {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithEndpoint(opts.Endpoint))
+	}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", opts.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// InMemory installs a global tracer provider recording every span in the
+// returned exporter as soon as it ends, for tests
+func InMemory() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	return exporter
+}
+
+// Inject writes the span context of ctx to the trace context of a message
+func Inject(ctx context.Context, tc *protocol.TraceContext) {
+	propagator.Inject(ctx, carrier{tc})
+}
+
+// Extract returns ctx with the remote span context of a message, making
+// spans started from it children of the sender's span
+func Extract(ctx context.Context, tc protocol.TraceContext) context.Context {
+	return propagator.Extract(ctx, carrier{&tc})
+}
+
+// Link links a span to the sender of a message, if it was traced
+func Link(span trace.Span, tc protocol.TraceContext) {
+	sc := trace.SpanContextFromContext(Extract(context.Background(), tc))
+	if sc.IsValid() {
+		span.AddLink(trace.Link{SpanContext: sc})
+	}
+}
+
+// End ends a span, marking it failed when err is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// carrier adapts a TraceContext to propagation.TextMapCarrier
+type carrier struct {
+	tc *protocol.TraceContext
+}
+
+func (c carrier) Get(key string) string {
+	switch key {
+	case "traceparent":
+		return c.tc.Traceparent
+	case "tracestate":
+		return c.tc.Tracestate
+	}
+	return ""
+}
+
+func (c carrier) Set(key, value string) {
+	switch key {
+	case "traceparent":
+		c.tc.Traceparent = value
+	case "tracestate":
+		c.tc.Tracestate = value
+	}
+}
+
+func (c carrier) Keys() []string {
+	return []string{"traceparent", "tracestate"}
+}
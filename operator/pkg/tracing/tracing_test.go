@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+func TestPropagation(t *testing.T) {
+	exporter := InMemory()
+	ctx, announce := Tracer().Start(context.Background(), "announce")
+	var tc protocol.TraceContext
+	Inject(ctx, &tc)
+	announce.End()
+	if tc.Traceparent == "" {
+		t.Fatal("Inject() left no traceparent")
+	}
+
+	// The agent's span joins the trace of the announcement
+	_, bid := Tracer().Start(Extract(context.Background(), tc), "bid")
+	End(bid, errors.New("no capacity"))
+
+	// A span of another trace links to it
+	_, aggregate := Tracer().Start(context.Background(), "aggregate")
+	Link(aggregate, tc)
+	Link(aggregate, protocol.TraceContext{})
+	End(aggregate, nil)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("spans = %d, want 3", len(spans))
+	}
+	parent, child, linked := spans[0], spans[1], spans[2]
+	if child.Parent.SpanID() != parent.SpanContext.SpanID() || child.SpanContext.TraceID() != parent.SpanContext.TraceID() {
+		t.Errorf("bid span parent = %v, want the announce span %v", child.Parent, parent.SpanContext)
+	}
+	if child.Status.Code != codes.Error || child.Status.Description != "no capacity" || len(child.Events) != 1 {
+		t.Errorf("failed span status = %+v with %d events, want the error recorded", child.Status, len(child.Events))
+	}
+	if linked.SpanContext.TraceID() == parent.SpanContext.TraceID() {
+		t.Error("aggregate span joined the announce trace, want a new trace")
+	}
+	if len(linked.Links) != 1 || linked.Links[0].SpanContext.SpanID() != parent.SpanContext.SpanID() {
+		t.Errorf("aggregate span links = %+v, want one to the announce span", linked.Links)
+	}
+	if linked.Status.Code != codes.Unset {
+		t.Errorf("succeeded span status = %+v, want unset", linked.Status)
+	}
+}
+
+func TestSetupWithoutEndpoint(t *testing.T) {
+	t.Setenv(EnvOTLPEndpoint, "")
+	t.Setenv(EnvOTLPTracesEndpoint, "")
+	shutdown, err := Setup(context.Background(), Options{ServiceName: "loopstacks-operator"})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Approval outcomes
+const (
+	OutcomeApproved = "approved"
+	OutcomeRejected = "rejected"
+)
+
+// ErrNoPendingApproval is returned when a decision is posted for an
+// execution step that is not waiting for one
+var ErrNoPendingApproval = errors.New("no pending approval")
+
+// ErrApprovalInterrupted is returned when an execution is cancelled while
+// paused on a humanApproval step. An ApprovalGate that keeps its requests
+// lets the execution be resumed with Runner.Paused.
+var ErrApprovalInterrupted = errors.New("interrupted while awaiting approval")
+
+// ApprovalRequest describes an execution paused on a humanApproval step
+type ApprovalRequest struct {
+	ExecutionID string    `json:"executionId"`
+	Step        string    `json:"step"`
+	Message     string    `json:"message,omitempty"`
+	Approvers   []string  `json:"approvers,omitempty"`
+	RequestedAt time.Time `json:"requestedAt"`
+	Deadline    time.Time `json:"deadline"`
+	// Completed holds the results of the steps before this one, from which
+	// the execution resumes
+	Completed []StepResult `json:"completed,omitempty"`
+}
+
+// ApprovalDecision is the outcome of a humanApproval step
+type ApprovalDecision struct {
+	Outcome   string    `json:"outcome"`
+	Approver  string    `json:"approver,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	DecidedAt time.Time `json:"decidedAt"`
+	TimedOut  bool      `json:"timedOut,omitempty"`
+}
+
+// ApprovalGate parks executions until an external decision is posted
+type ApprovalGate interface {
+	// Await registers req as pending and blocks until a decision is posted
+	// or ctx is done
+	Await(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+}
+
+type approvalKey struct {
+	executionID string
+	step        string
+}
+
+type pendingApproval struct {
+	request  ApprovalRequest
+	decision chan ApprovalDecision
+}
+
+// MemoryApprovalGate is an in-process ApprovalGate
+type MemoryApprovalGate struct {
+	mu      sync.Mutex
+	pending map[approvalKey]*pendingApproval
+}
+
+// NewMemoryApprovalGate creates an empty MemoryApprovalGate
+func NewMemoryApprovalGate() *MemoryApprovalGate {
+	return &MemoryApprovalGate{pending: make(map[approvalKey]*pendingApproval)}
+}
+
+// Await implements ApprovalGate
+func (g *MemoryApprovalGate) Await(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	key := approvalKey{executionID: req.ExecutionID, step: req.Step}
+	p := &pendingApproval{request: req, decision: make(chan ApprovalDecision, 1)}
+
+	g.mu.Lock()
+	if _, exists := g.pending[key]; exists {
+		g.mu.Unlock()
+		return ApprovalDecision{}, fmt.Errorf("approval for step %s of execution %s is already pending", req.Step, req.ExecutionID)
+	}
+	g.pending[key] = p
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.pending, key)
+		g.mu.Unlock()
+	}()
+
+	select {
+	case decision := <-p.decision:
+		return decision, nil
+	case <-ctx.Done():
+		return ApprovalDecision{}, ctx.Err()
+	}
+}
+
+// Post delivers a decision to a pending approval
+func (g *MemoryApprovalGate) Post(executionID, step string, decision ApprovalDecision) error {
+	if decision.Outcome != OutcomeApproved && decision.Outcome != OutcomeRejected {
+		return fmt.Errorf("invalid outcome %q: must be %q or %q", decision.Outcome, OutcomeApproved, OutcomeRejected)
+	}
+	if decision.DecidedAt.IsZero() {
+		decision.DecidedAt = time.Now()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.pending[approvalKey{executionID: executionID, step: step}]
+	if !ok {
+		return ErrNoPendingApproval
+	}
+	if len(p.request.Approvers) > 0 && !contains(p.request.Approvers, decision.Approver) {
+		return fmt.Errorf("%q is not an approver for step %s", decision.Approver, step)
+	}
+
+	select {
+	case p.decision <- decision:
+	default:
+		return fmt.Errorf("a decision was already posted for step %s of execution %s", step, executionID)
+	}
+	return nil
+}
+
+// Pending lists the approvals currently waiting for a decision, oldest first
+func (g *MemoryApprovalGate) Pending() []ApprovalRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	requests := make([]ApprovalRequest, 0, len(g.pending))
+	for _, p := range g.pending {
+		requests = append(requests, p.request)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].RequestedAt.Before(requests[j].RequestedAt)
+	})
+	return requests
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package workflow
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+var (
+	conditionEnvOnce sync.Once
+	conditionEnv     *cel.Env
+	conditionEnvErr  error
+)
+
+// environment returns the shared CEL environment for step conditions.
+// Conditions can reference the execution input as `input` and earlier steps
+// as `steps.<name>.status` and `steps.<name>.output`.
+func environment() (*cel.Env, error) {
+	conditionEnvOnce.Do(func() {
+		conditionEnv, conditionEnvErr = cel.NewEnv(
+			cel.Variable("input", cel.DynType),
+			cel.Variable("steps", cel.MapType(cel.StringType, cel.DynType)),
+		)
+	})
+	return conditionEnv, conditionEnvErr
+}
+
+// Condition is a compiled CEL step condition
+type Condition struct {
+	expression string
+	program    cel.Program
+}
+
+// CompileCondition parses and type-checks a CEL expression. The expression
+// must evaluate to a boolean.
+func CompileCondition(expression string) (*Condition, error) {
+	env, err := environment()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", expression, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("condition %q must evaluate to a boolean, got %s", expression, ast.OutputType())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %q: %w", expression, err)
+	}
+
+	return &Condition{expression: expression, program: program}, nil
+}
+
+// String returns the source expression
+func (c *Condition) String() string {
+	return c.expression
+}
+
+// Evaluate runs the condition against the execution input and the results
+// of the steps recorded so far
+func (c *Condition) Evaluate(input interface{}, steps map[string]interface{}) (bool, error) {
+	out, _, err := c.program.Eval(map[string]interface{}{
+		"input": input,
+		"steps": steps,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate condition %q: %w", c.expression, err)
+	}
+
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition %q evaluated to %T, expected bool", c.expression, out.Value())
+	}
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package workflow
+
+import "testing"
+
+func TestCompileCondition(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantErr    bool
+	}{
+		{name: "boolean", expression: `input.priority > 3`},
+		{name: "step status", expression: `steps.review.status == "Completed"`},
+		{name: "syntax error", expression: `input.priority >`, wantErr: true},
+		{name: "not boolean", expression: `"yes"`, wantErr: true},
+		{name: "unknown variable", expression: `output.ok`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileCondition(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CompileCondition(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConditionEvaluate(t *testing.T) {
+	input := map[string]interface{}{"priority": 5, "region": "eu"}
+	steps := map[string]interface{}{
+		"review":  map[string]interface{}{"status": StepCompleted, "output": map[string]interface{}{"approved": true}},
+		"enrich":  map[string]interface{}{"status": StepSkipped},
+		"publish": map[string]interface{}{"status": StepPending},
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+		wantErr    bool
+	}{
+		{name: "input true", expression: `input.priority > 3`, want: true},
+		{name: "input false", expression: `input.region == "us"`, want: false},
+		{name: "step status", expression: `steps.enrich.status == "Skipped"`, want: true},
+		{name: "step output", expression: `steps.review.output.approved`, want: true},
+		{name: "pending step", expression: `steps.publish.status == "Pending"`, want: true},
+		{name: "missing key", expression: `input.missing == 1`, wantErr: true},
+		{name: "dynamic non-boolean", expression: `input.region`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, err := CompileCondition(tt.expression)
+			if err != nil {
+				t.Fatalf("CompileCondition(%q) error = %v", tt.expression, err)
+			}
+			got, err := condition.Evaluate(input, steps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Evaluate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
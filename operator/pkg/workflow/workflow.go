@@ -0,0 +1,350 @@
+// Package workflow runs the steps of a LoopStack: agent steps dispatched to
+// the bidding engine, CEL conditions for branching and humanApproval steps
+// that pause an execution until a person decides.
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/duration"
+)
+
+// Step types
+const (
+	StepTypeAgent         = "agent"
+	StepTypeHumanApproval = "humanApproval"
+)
+
+// Step statuses
+const (
+	StepPending   = "Pending"
+	StepCompleted = "Completed"
+	StepSkipped   = "Skipped"
+	StepFailed    = "Failed"
+)
+
+// DefaultStepName is the name of the implicit agent step of a LoopStack that
+// does not declare any steps
+const DefaultStepName = "agents"
+
+// DefaultApprovalTimeout applies to humanApproval steps without a timeout
+const DefaultApprovalTimeout = 24 * time.Hour
+
+// Workflow is a validated, compiled LoopStack step list
+type Workflow struct {
+	steps []step
+}
+
+type step struct {
+	spec           loopstacksv1.LoopStackStep
+	condition      *Condition
+	approvalWait   time.Duration
+	defaultOutcome string
+}
+
+// Compile validates the steps of a LoopStack and compiles their conditions
+func Compile(spec *loopstacksv1.LoopStackSpec) (*Workflow, error) {
+	specs := spec.Steps
+	if len(specs) == 0 {
+		specs = []loopstacksv1.LoopStackStep{{Name: DefaultStepName, Type: StepTypeAgent}}
+	}
+
+	wf := &Workflow{}
+	seen := make(map[string]bool, len(specs))
+	for i, s := range specs {
+		if s.Name == "" {
+			return nil, fmt.Errorf("step %d: name is required", i)
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("step %s: duplicate step name", s.Name)
+		}
+		seen[s.Name] = true
+
+		compiled := step{spec: s}
+		if compiled.spec.Type == "" {
+			compiled.spec.Type = StepTypeAgent
+		}
+		if compiled.spec.Type == StepTypeAgent && len(compiled.spec.Capabilities) == 0 {
+			compiled.spec.Capabilities = spec.Capabilities
+		}
+
+		switch compiled.spec.Type {
+		case StepTypeAgent:
+			if s.HumanApproval != nil {
+				return nil, fmt.Errorf("step %s: humanApproval is only allowed on %s steps", s.Name, StepTypeHumanApproval)
+			}
+		case StepTypeHumanApproval:
+			approval := loopstacksv1.LoopStackHumanApproval{}
+			if s.HumanApproval != nil {
+				approval = *s.HumanApproval
+			}
+			wait, err := duration.ParseOrDefault(approval.Timeout, DefaultApprovalTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("step %s: %w", s.Name, err)
+			}
+			compiled.approvalWait = wait
+			switch approval.DefaultOutcome {
+			case "":
+				compiled.defaultOutcome = OutcomeRejected
+			case OutcomeApproved, OutcomeRejected:
+				compiled.defaultOutcome = approval.DefaultOutcome
+			default:
+				return nil, fmt.Errorf("step %s: invalid default outcome %q", s.Name, approval.DefaultOutcome)
+			}
+		default:
+			return nil, fmt.Errorf("step %s: unsupported step type %q", s.Name, s.Type)
+		}
+
+		if s.Condition != "" {
+			condition, err := CompileCondition(s.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("step %s: %w", s.Name, err)
+			}
+			compiled.condition = condition
+		}
+
+		wf.steps = append(wf.steps, compiled)
+	}
+
+	return wf, nil
+}
+
+// Steps returns the normalized step specs in execution order
+func (w *Workflow) Steps() []loopstacksv1.LoopStackStep {
+	steps := make([]loopstacksv1.LoopStackStep, 0, len(w.steps))
+	for _, s := range w.steps {
+		steps = append(steps, s.spec)
+	}
+	return steps
+}
+
+// StepRequest is passed to the StepExecutor for every agent step
+type StepRequest struct {
+	ExecutionID string
+	Step        loopstacksv1.LoopStackStep
+	Input       interface{}
+	Previous    []StepResult
+}
+
+// StepExecutor runs agent steps, typically by announcing a loop and
+// collecting the selected agents' results
+type StepExecutor interface {
+	ExecuteStep(ctx context.Context, req StepRequest) (interface{}, error)
+}
+
+// StepResult records the outcome of a single step
+type StepResult struct {
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	Status    string      `json:"status"`
+	Output    interface{} `json:"output,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	StartTime time.Time   `json:"startTime,omitempty"`
+	EndTime   time.Time   `json:"endTime,omitempty"`
+}
+
+// Result is the outcome of a workflow run
+type Result struct {
+	Steps  []StepResult `json:"steps"`
+	Output interface{}  `json:"output,omitempty"`
+}
+
+// Runner executes compiled workflows
+type Runner struct {
+	Executor  StepExecutor
+	Approvals ApprovalGate
+	// Paused, when set, resumes a run interrupted on this approval. Its
+	// completed steps are not run again, and the approval keeps its
+	// deadline.
+	Paused *ApprovalRequest
+}
+
+// Run executes the workflow's steps in order. Steps whose condition is false
+// are skipped; the first failing step stops the run. The returned Result is
+// populated even when an error is returned.
+func (r *Runner) Run(ctx context.Context, wf *Workflow, executionID string, input interface{}) (*Result, error) {
+	result := &Result{}
+
+	// Every step is visible to conditions from the start so expressions can
+	// test `steps.x.status` without first checking for presence.
+	vars := make(map[string]interface{}, len(wf.steps))
+	for _, s := range wf.steps {
+		vars[s.spec.Name] = map[string]interface{}{"status": StepPending}
+	}
+
+	var completed []StepResult
+	if r.Paused != nil {
+		if err := wf.resumable(r.Paused); err != nil {
+			return result, fmt.Errorf("cannot resume execution %s: %w", executionID, err)
+		}
+		completed = r.Paused.Completed
+	}
+
+	for i, s := range wf.steps {
+		if i < len(completed) {
+			result.record(vars, s, completed[i])
+			continue
+		}
+		res := StepResult{Name: s.spec.Name, Type: s.spec.Type, StartTime: time.Now()}
+
+		run := true
+		if s.condition != nil {
+			ok, err := s.condition.Evaluate(input, vars)
+			if err != nil {
+				res.Status = StepFailed
+				res.Error = err.Error()
+				res.EndTime = time.Now()
+				result.Steps = append(result.Steps, res)
+				return result, fmt.Errorf("step %s: %w", s.spec.Name, err)
+			}
+			run = ok
+		}
+
+		var err error
+		switch {
+		case !run:
+			res.Status = StepSkipped
+		case s.spec.Type == StepTypeHumanApproval:
+			res.Output, err = r.awaitApproval(ctx, s, executionID, result.Steps)
+		default:
+			res.Output, err = r.executeAgentStep(ctx, s, executionID, input, result.Steps)
+		}
+		res.EndTime = time.Now()
+
+		if err != nil {
+			res.Status = StepFailed
+			res.Error = err.Error()
+			result.Steps = append(result.Steps, res)
+			return result, fmt.Errorf("step %s: %w", s.spec.Name, err)
+		}
+		if res.Status == "" {
+			res.Status = StepCompleted
+		}
+		result.record(vars, s, res)
+	}
+
+	return result, nil
+}
+
+// record adds the result of a step that did not fail, exposing it to the
+// conditions of the next steps
+func (r *Result) record(vars map[string]interface{}, s step, res StepResult) {
+	r.Steps = append(r.Steps, res)
+	entry := map[string]interface{}{"status": res.Status}
+	if res.Output != nil {
+		entry["output"] = res.Output
+	}
+	vars[s.spec.Name] = entry
+
+	if res.Status == StepCompleted && s.spec.Type == StepTypeAgent {
+		r.Output = merge(r.Output, res.Output)
+	}
+}
+
+// resumable checks that a run of w can resume from paused: its completed
+// steps are the first steps of w, followed by the approval
+func (w *Workflow) resumable(paused *ApprovalRequest) error {
+	n := len(paused.Completed)
+	if n >= len(w.steps) {
+		return fmt.Errorf("the workflow has %d steps, %d completed", len(w.steps), n)
+	}
+	for i, res := range paused.Completed {
+		if res.Name != w.steps[i].spec.Name {
+			return fmt.Errorf("step %d is %s, not %s", i, w.steps[i].spec.Name, res.Name)
+		}
+	}
+	if s := w.steps[n]; s.spec.Name != paused.Step || s.spec.Type != StepTypeHumanApproval {
+		return fmt.Errorf("step %d is %s, not the approval %s", n, s.spec.Name, paused.Step)
+	}
+	return nil
+}
+
+func (r *Runner) executeAgentStep(ctx context.Context, s step, executionID string, input interface{}, previous []StepResult) (interface{}, error) {
+	if r.Executor == nil {
+		return nil, errors.New("no step executor configured")
+	}
+	return r.Executor.ExecuteStep(ctx, StepRequest{
+		ExecutionID: executionID,
+		Step:        s.spec,
+		Input:       input,
+		Previous:    previous,
+	})
+}
+
+func (r *Runner) awaitApproval(ctx context.Context, s step, executionID string, completed []StepResult) (interface{}, error) {
+	if r.Approvals == nil {
+		return nil, errors.New("no approval gate configured")
+	}
+
+	now := time.Now()
+	req := ApprovalRequest{
+		ExecutionID: executionID,
+		Step:        s.spec.Name,
+		RequestedAt: now,
+		Deadline:    now.Add(s.approvalWait),
+		Completed:   append([]StepResult(nil), completed...),
+	}
+	if r.Paused != nil && r.Paused.Step == s.spec.Name {
+		req.RequestedAt = r.Paused.RequestedAt
+		req.Deadline = r.Paused.Deadline
+	}
+	if s.spec.HumanApproval != nil {
+		req.Message = s.spec.HumanApproval.Message
+		req.Approvers = s.spec.HumanApproval.Approvers
+	}
+
+	waitCtx, cancel := context.WithDeadline(ctx, req.Deadline)
+	defer cancel()
+
+	decision, err := r.Approvals.Await(waitCtx, req)
+	if err != nil {
+		// Only our own deadline falls back to the default outcome; a
+		// cancelled execution is an error.
+		switch {
+		case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+			decision = ApprovalDecision{
+				Outcome:   s.defaultOutcome,
+				DecidedAt: time.Now(),
+				TimedOut:  true,
+			}
+		case ctx.Err() != nil:
+			return nil, fmt.Errorf("%w: %w", ErrApprovalInterrupted, err)
+		default:
+			return nil, err
+		}
+	}
+
+	output := map[string]interface{}{
+		"outcome":  decision.Outcome,
+		"approved": decision.Outcome == OutcomeApproved,
+		"timedOut": decision.TimedOut,
+	}
+	if decision.Approver != "" {
+		output["approver"] = decision.Approver
+	}
+	if decision.Comment != "" {
+		output["comment"] = decision.Comment
+	}
+	return output, nil
+}
+
+// merge combines step outputs the way the "merge" aggregation strategy does:
+// object outputs are merged key by key, anything else replaces the result.
+func merge(current, next interface{}) interface{} {
+	nextObj, ok := next.(map[string]interface{})
+	if !ok {
+		return next
+	}
+	currentObj, ok := current.(map[string]interface{})
+	if !ok {
+		currentObj = make(map[string]interface{}, len(nextObj))
+	}
+	for k, v := range nextObj {
+		currentObj[k] = v
+	}
+	return currentObj
+}
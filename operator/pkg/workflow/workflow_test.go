@@ -0,0 +1,246 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+)
+
+// recordingExecutor runs agent steps by returning their configured output
+// and records the order steps ran in
+type recordingExecutor struct {
+	outputs map[string]interface{}
+	fail    map[string]bool
+	ran     []string
+}
+
+func (e *recordingExecutor) ExecuteStep(ctx context.Context, req StepRequest) (interface{}, error) {
+	e.ran = append(e.ran, req.Step.Name)
+	if e.fail[req.Step.Name] {
+		return nil, errors.New("agent failed")
+	}
+	return e.outputs[req.Step.Name], nil
+}
+
+// decidingGate decides every approval immediately
+type decidingGate struct {
+	outcome string
+}
+
+func (g decidingGate) Await(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	return ApprovalDecision{Outcome: g.outcome, Approver: "alice", DecidedAt: time.Now()}, nil
+}
+
+// blockingGate never decides
+type blockingGate struct{}
+
+func (blockingGate) Await(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	<-ctx.Done()
+	return ApprovalDecision{}, ctx.Err()
+}
+
+func TestRunnerRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		steps      []loopstacksv1.LoopStackStep
+		fail       map[string]bool
+		approvals  ApprovalGate
+		wantRan    []string
+		wantStatus []string
+		wantOutput interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "implicit step",
+			wantRan:    []string{DefaultStepName},
+			wantStatus: []string{StepCompleted},
+			wantOutput: map[string]interface{}{"a": 1},
+		},
+		{
+			name: "steps run in order and outputs merge",
+			steps: []loopstacksv1.LoopStackStep{
+				{Name: "draft"},
+				{Name: "review"},
+			},
+			wantRan:    []string{"draft", "review"},
+			wantStatus: []string{StepCompleted, StepCompleted},
+			wantOutput: map[string]interface{}{"a": 1, "b": 2},
+		},
+		{
+			name: "false condition skips step",
+			steps: []loopstacksv1.LoopStackStep{
+				{Name: "draft"},
+				{Name: "review", Condition: `input.priority > 10`},
+				{Name: "publish", Condition: `steps.review.status == "Skipped"`},
+			},
+			wantRan:    []string{"draft", "publish"},
+			wantStatus: []string{StepCompleted, StepSkipped, StepCompleted},
+			wantOutput: map[string]interface{}{"a": 1, "c": 3},
+		},
+		{
+			name: "failing step stops the run",
+			steps: []loopstacksv1.LoopStackStep{
+				{Name: "draft"},
+				{Name: "review"},
+				{Name: "publish"},
+			},
+			fail:       map[string]bool{"review": true},
+			wantRan:    []string{"draft", "review"},
+			wantStatus: []string{StepCompleted, StepFailed},
+			wantOutput: map[string]interface{}{"a": 1},
+			wantErr:    true,
+		},
+		{
+			name: "failing condition stops the run",
+			steps: []loopstacksv1.LoopStackStep{
+				{Name: "draft", Condition: `input.missing > 1`},
+				{Name: "review"},
+			},
+			wantStatus: []string{StepFailed},
+			wantErr:    true,
+		},
+		{
+			name: "approval gates the next step",
+			steps: []loopstacksv1.LoopStackStep{
+				{Name: "draft"},
+				{Name: "signoff", Type: StepTypeHumanApproval},
+				{Name: "publish", Condition: `steps.signoff.output.approved`},
+			},
+			approvals:  decidingGate{outcome: OutcomeRejected},
+			wantRan:    []string{"draft"},
+			wantStatus: []string{StepCompleted, StepCompleted, StepSkipped},
+			wantOutput: map[string]interface{}{"a": 1},
+		},
+		{
+			name: "approval timeout falls back to the default outcome",
+			steps: []loopstacksv1.LoopStackStep{
+				{Name: "signoff", Type: StepTypeHumanApproval, HumanApproval: &loopstacksv1.LoopStackHumanApproval{
+					Timeout:        "10ms",
+					DefaultOutcome: OutcomeApproved,
+				}},
+				{Name: "publish", Condition: `steps.signoff.output.approved && steps.signoff.output.timedOut`},
+			},
+			approvals:  blockingGate{},
+			wantRan:    []string{"publish"},
+			wantStatus: []string{StepCompleted, StepCompleted},
+			wantOutput: map[string]interface{}{"c": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, err := Compile(&loopstacksv1.LoopStackSpec{Capabilities: []string{"write"}, Steps: tt.steps})
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			executor := &recordingExecutor{
+				outputs: map[string]interface{}{
+					DefaultStepName: map[string]interface{}{"a": 1},
+					"draft":         map[string]interface{}{"a": 1},
+					"review":        map[string]interface{}{"b": 2},
+					"publish":       map[string]interface{}{"c": 3},
+				},
+				fail: tt.fail,
+			}
+			runner := &Runner{Executor: executor, Approvals: tt.approvals}
+
+			result, err := runner.Run(context.Background(), wf, "exec-1", map[string]interface{}{"priority": 5})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(executor.ran, tt.wantRan) {
+				t.Errorf("ran %v, want %v", executor.ran, tt.wantRan)
+			}
+			var statuses []string
+			for _, s := range result.Steps {
+				statuses = append(statuses, s.Status)
+			}
+			if !reflect.DeepEqual(statuses, tt.wantStatus) {
+				t.Errorf("statuses %v, want %v", statuses, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(result.Output, tt.wantOutput) {
+				t.Errorf("output %v, want %v", result.Output, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []loopstacksv1.LoopStackStep
+	}{
+		{name: "missing name", steps: []loopstacksv1.LoopStackStep{{}}},
+		{name: "duplicate name", steps: []loopstacksv1.LoopStackStep{{Name: "a"}, {Name: "a"}}},
+		{name: "unknown type", steps: []loopstacksv1.LoopStackStep{{Name: "a", Type: "script"}}},
+		{name: "approval on agent step", steps: []loopstacksv1.LoopStackStep{{Name: "a", HumanApproval: &loopstacksv1.LoopStackHumanApproval{}}}},
+		{name: "invalid timeout", steps: []loopstacksv1.LoopStackStep{{Name: "a", Type: StepTypeHumanApproval, HumanApproval: &loopstacksv1.LoopStackHumanApproval{Timeout: "soon"}}}},
+		{name: "invalid default outcome", steps: []loopstacksv1.LoopStackStep{{Name: "a", Type: StepTypeHumanApproval, HumanApproval: &loopstacksv1.LoopStackHumanApproval{DefaultOutcome: "maybe"}}}},
+		{name: "invalid condition", steps: []loopstacksv1.LoopStackStep{{Name: "a", Condition: "input >"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile(&loopstacksv1.LoopStackSpec{Steps: tt.steps}); err == nil {
+				t.Fatal("Compile() succeeded, want error")
+			}
+		})
+	}
+}
+
+// interruptingGate cancels the run it pauses, keeping the request
+type interruptingGate struct {
+	cancel  context.CancelFunc
+	request *ApprovalRequest
+}
+
+func (g interruptingGate) Await(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+	*g.request = req
+	g.cancel()
+	<-ctx.Done()
+	return ApprovalDecision{}, ctx.Err()
+}
+
+func TestRunnerResume(t *testing.T) {
+	wf, err := Compile(&loopstacksv1.LoopStackSpec{Capabilities: []string{"write"}, Steps: []loopstacksv1.LoopStackStep{
+		{Name: "draft"},
+		{Name: "signoff", Type: StepTypeHumanApproval},
+		{Name: "publish", Condition: `steps.draft.status == "Completed" && steps.signoff.output.approved`},
+	}})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	executor := &recordingExecutor{outputs: map[string]interface{}{
+		"draft":   map[string]interface{}{"a": 1},
+		"publish": map[string]interface{}{"c": 3},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var paused ApprovalRequest
+	runner := &Runner{Executor: executor, Approvals: interruptingGate{cancel: cancel, request: &paused}}
+	if _, err := runner.Run(ctx, wf, "exec-1", nil); !errors.Is(err, ErrApprovalInterrupted) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrApprovalInterrupted)
+	}
+	if paused.Step != "signoff" || len(paused.Completed) != 1 || paused.Completed[0].Name != "draft" {
+		t.Fatalf("paused on %+v", paused)
+	}
+
+	runner = &Runner{Executor: executor, Approvals: decidingGate{outcome: OutcomeApproved}, Paused: &paused}
+	result, err := runner.Run(context.Background(), wf, "exec-1", nil)
+	if err != nil {
+		t.Fatalf("Run() resuming error = %v", err)
+	}
+	if want := []string{"draft", "publish"}; !reflect.DeepEqual(executor.ran, want) {
+		t.Errorf("ran %v, want %v", executor.ran, want)
+	}
+	if want := map[string]interface{}{"a": 1, "c": 3}; !reflect.DeepEqual(result.Output, want) {
+		t.Errorf("output %v, want %v", result.Output, want)
+	}
+
+	paused.Step = "draft"
+	if _, err := runner.Run(context.Background(), wf, "exec-1", nil); err == nil {
+		t.Error("Run() resuming from a step that is not an approval succeeded")
+	}
+}
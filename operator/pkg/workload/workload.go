@@ -0,0 +1,374 @@
+// Package workload renders the Deployments that run the agent pods of an
+// AgentInstance. Pods are rendered from the Agent's runtime, the
+// AgentInstance's resources, placement and config, and the Realm's
+// coordination backend; every distinct rendering is a revision of the
+// AgentInstance.
+package workload
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	loopstacksv2 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v2"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/coordination/backends"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/liveness"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+// Labels of agent pods and their Deployments, besides liveness.InstanceLabel
+const (
+	// RevisionLabel carries the revision a pod was rendered from
+	RevisionLabel = "loopstacks.io/agent-revision"
+	// DeploymentLabel carries the name of the pod's Deployment, which
+	// selects on it
+	DeploymentLabel = "loopstacks.io/deployment"
+	AgentLabel      = "loopstacks.io/agent"
+	RealmLabel      = "loopstacks.io/realm"
+)
+
+// ContainerName is the name of the agent container
+const ContainerName = "agent"
+
+// Strategies of AgentInstanceSpec.ConfigUpdate
+const (
+	ConfigRestart   = "Restart"
+	ConfigHotReload = "HotReload"
+)
+
+// ConfigHashAnnotation carries the hash of the config a pod was rendered
+// with under the Restart strategy, so that a config change is a new
+// revision
+const ConfigHashAnnotation = "loopstacks.io/config-hash"
+
+// SecretsHashAnnotation carries the hash of the Secrets a pod reads, so
+// that a change of their content is a new revision
+const SecretsHashAnnotation = "loopstacks.io/secrets-hash"
+
+// TerminationGracePeriodSeconds is how long an agent pod that is stopped
+// may take to finish the loops it is executing. Agents stop bidding when
+// their pod is stopped and exit once their loops are done.
+const TerminationGracePeriodSeconds int64 = 300
+
+// ConfigDir is where the config volume is mounted in agent pods
+const ConfigDir = "/etc/loopstacks/config"
+
+const configVolume = "config"
+
+// PodTemplate renders the pods of an AgentInstance, without their revision
+// and Deployment labels. secretsHash identifies the content of the Secrets
+// the pods read, empty when none rolls out a new revision.
+func PodTemplate(agent *loopstacksv1.Agent, instance *loopstacksv1.AgentInstance, realm *loopstacksv1.Realm, secretsHash string) (corev1.PodTemplateSpec, error) {
+	// Resources and placement are read in their typed, v2 form
+	var typedAgent loopstacksv2.Agent
+	if err := typedAgent.ConvertFrom(agent); err != nil {
+		return corev1.PodTemplateSpec{}, err
+	}
+	var typedInstance loopstacksv2.AgentInstance
+	if err := typedInstance.ConvertFrom(instance); err != nil {
+		return corev1.PodTemplateSpec{}, err
+	}
+	resources, err := requirements(typedAgent.Spec.Runtime.Resources, typedInstance.Spec.Resources)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, err
+	}
+
+	container := corev1.Container{
+		Name:      ContainerName,
+		Image:     agent.Spec.Runtime.Image,
+		Env:       env(agent, instance, realm),
+		EnvFrom:   append(append([]corev1.EnvFromSource{}, agent.Spec.Runtime.EnvFrom...), instance.Spec.EnvFrom...),
+		Resources: resources,
+		VolumeMounts: []corev1.VolumeMount{{
+			Name:      configVolume,
+			MountPath: ConfigDir,
+			ReadOnly:  true,
+		}},
+	}
+
+	placement := typedInstance.Spec.Placement
+	grace := TerminationGracePeriodSeconds
+	spec := corev1.PodSpec{
+		Containers:                    []corev1.Container{container},
+		TerminationGracePeriodSeconds: &grace,
+		Volumes:                       []corev1.Volume{volume(instance)},
+		NodeSelector:                  placement.NodeSelector,
+		Tolerations:                   placement.Tolerations,
+		Affinity:                      placement.Affinity,
+		TopologySpreadConstraints:     topologySpread(instance, placement.TopologySpreadConstraints),
+		PriorityClassName:             placement.PriorityClassName,
+	}
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+			liveness.InstanceLabel: instance.Name,
+			AgentLabel:             agent.Name,
+			RealmLabel:             realm.Name,
+		}},
+		Spec: spec,
+	}
+	if instance.Spec.ConfigUpdate != ConfigHotReload {
+		template.Annotations = map[string]string{ConfigHashAnnotation: configHash(instance)}
+	}
+	if secretsHash != "" {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[SecretsHashAnnotation] = secretsHash
+	}
+	return template, nil
+}
+
+// Config returns the config of an AgentInstance, an empty object when unset
+func Config(instance *loopstacksv1.AgentInstance) []byte {
+	if len(instance.Spec.Config.Raw) == 0 {
+		return []byte("{}")
+	}
+	return instance.Spec.Config.Raw
+}
+
+// ConfigMapName names the ConfigMap holding an AgentInstance's config
+func ConfigMapName(instance *loopstacksv1.AgentInstance) string {
+	return instance.Name + "-config"
+}
+
+// ConfigMap renders the ConfigMap holding an AgentInstance's config
+func ConfigMap(instance *loopstacksv1.AgentInstance) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ConfigMapName(instance),
+			Namespace: instance.Namespace,
+			Labels:    map[string]string{liveness.InstanceLabel: instance.Name},
+		},
+		Data: map[string]string{protocol.ConfigFile: string(Config(instance))},
+	}
+}
+
+// volume projects the config and config secrets into the layout read by
+// agentsdk.LoadSettings. Projected files are updated in place when they
+// change.
+func volume(instance *loopstacksv1.AgentInstance) corev1.Volume {
+	sources := []corev1.VolumeProjection{{
+		ConfigMap: &corev1.ConfigMapProjection{
+			LocalObjectReference: corev1.LocalObjectReference{Name: ConfigMapName(instance)},
+			Items:                []corev1.KeyToPath{{Key: protocol.ConfigFile, Path: protocol.ConfigFile}},
+		},
+	}}
+	for _, secret := range instance.Spec.ConfigSecrets {
+		sources = append(sources, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: secret.SecretKeyRef.LocalObjectReference,
+				Items: []corev1.KeyToPath{{
+					Key:  secret.SecretKeyRef.Key,
+					Path: protocol.SecretsDir + "/" + secret.Name,
+				}},
+				Optional: secret.SecretKeyRef.Optional,
+			},
+		})
+	}
+	return corev1.Volume{
+		Name:         configVolume,
+		VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: sources}},
+	}
+}
+
+// configHash identifies the config and the secrets mounted next to it
+func configHash(instance *loopstacksv1.AgentInstance) string {
+	hash := fnv.New32a()
+	hash.Write(Config(instance))
+	data, _ := json.Marshal(instance.Spec.ConfigSecrets)
+	hash.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hash.Sum32()))
+}
+
+// requirements merges the resource requirements of the Agent and the
+// AgentInstance. The AgentInstance's override the Agent's per resource, for
+// requests and limits separately.
+func requirements(defaults, overrides corev1.ResourceRequirements) (corev1.ResourceRequirements, error) {
+	resources := corev1.ResourceRequirements{
+		Requests: mergeResources(defaults.Requests, overrides.Requests),
+		Limits:   mergeResources(defaults.Limits, overrides.Limits),
+		Claims:   defaults.Claims,
+	}
+	if len(overrides.Claims) > 0 {
+		resources.Claims = overrides.Claims
+	}
+	for name, request := range resources.Requests {
+		if limit, ok := resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			return corev1.ResourceRequirements{}, fmt.Errorf("%s request %s exceeds its limit %s", name, request.String(), limit.String())
+		}
+	}
+	return resources, nil
+}
+
+// topologySpread defaults the label selector of constraints that have none
+// to the AgentInstance's pods
+func topologySpread(instance *loopstacksv1.AgentInstance, constraints []corev1.TopologySpreadConstraint) []corev1.TopologySpreadConstraint {
+	var result []corev1.TopologySpreadConstraint
+	for _, constraint := range constraints {
+		if constraint.LabelSelector == nil {
+			constraint.LabelSelector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{liveness.InstanceLabel: instance.Name},
+			}
+		}
+		result = append(result, constraint)
+	}
+	return result
+}
+
+func mergeResources(defaults, overrides corev1.ResourceList) corev1.ResourceList {
+	if len(defaults) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	merged := corev1.ResourceList{}
+	for _, resources := range []corev1.ResourceList{defaults, overrides} {
+		for name, quantity := range resources {
+			merged[name] = quantity.DeepCopy()
+		}
+	}
+	return merged
+}
+
+// env configures the agent SDK, see agentsdk.ConfigFromEnv
+func env(agent *loopstacksv1.Agent, instance *loopstacksv1.AgentInstance, realm *loopstacksv1.Realm) []corev1.EnvVar {
+	podName := &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}
+	vars := []corev1.EnvVar{
+		{Name: protocol.EnvAgentID, ValueFrom: podName},
+		{Name: protocol.EnvPod, ValueFrom: podName},
+		{Name: protocol.EnvRevision, ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{
+			FieldPath: fmt.Sprintf("metadata.labels['%s']", RevisionLabel),
+		}}},
+		{Name: protocol.EnvAgent, Value: agent.Name},
+		{Name: protocol.EnvInstance, Value: instance.Name},
+		{Name: protocol.EnvRealm, Value: realm.Name},
+		{Name: protocol.EnvCapabilities, Value: strings.Join(agent.Spec.Capabilities, ",")},
+		{Name: protocol.EnvInputSchema, Value: string(agent.Spec.Schema.Input.Raw)},
+		{Name: protocol.EnvOutputSchema, Value: string(agent.Spec.Schema.Output.Raw)},
+		{Name: protocol.EnvConfigDir, Value: ConfigDir},
+	}
+
+	for _, ref := range SecretRefs(agent, instance) {
+		vars = append(vars, corev1.EnvVar{Name: ref.Env, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: ref.SecretKeyRef.DeepCopy()}})
+	}
+
+	coordination := backends.ForRealm(realm)
+	for _, v := range []corev1.EnvVar{
+		{Name: protocol.EnvBackend, Value: coordination.Backend},
+		{Name: protocol.EnvRedisURL, Value: coordination.RedisURL},
+		{Name: protocol.EnvNATSURL, Value: coordination.NATSURL},
+		{Name: protocol.EnvNATSStream, Value: coordination.NATSStream},
+	} {
+		if v.Value != "" {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// SecretRefs merges the secret refs of an Agent and an AgentInstance, the
+// AgentInstance's replacing the Agent's of the same Env
+func SecretRefs(agent *loopstacksv1.Agent, instance *loopstacksv1.AgentInstance) []loopstacksv1.SecretRef {
+	refs := append([]loopstacksv1.SecretRef{}, agent.Spec.Runtime.SecretRefs...)
+	for _, override := range instance.Spec.SecretRefs {
+		replaced := false
+		for i := range refs {
+			if refs[i].Env == override.Env {
+				refs[i] = override
+				replaced = true
+			}
+		}
+		if !replaced {
+			refs = append(refs, override)
+		}
+	}
+	return refs
+}
+
+// SecretReference is a Secret, or one key of it, read by agent pods
+type SecretReference struct {
+	Name string
+	// Key is empty when every key is read
+	Key      string
+	Optional bool
+	// Mounted Secrets are updated in place under the HotReload config
+	// update strategy
+	Mounted bool
+}
+
+// SecretReferences lists the Secrets read by the pods of an AgentInstance
+func SecretReferences(agent *loopstacksv1.Agent, instance *loopstacksv1.AgentInstance) []SecretReference {
+	var references []SecretReference
+	for _, ref := range SecretRefs(agent, instance) {
+		references = append(references, SecretReference{
+			Name:     ref.SecretKeyRef.Name,
+			Key:      ref.SecretKeyRef.Key,
+			Optional: ref.SecretKeyRef.Optional != nil && *ref.SecretKeyRef.Optional,
+		})
+	}
+	for _, source := range append(append([]corev1.EnvFromSource{}, agent.Spec.Runtime.EnvFrom...), instance.Spec.EnvFrom...) {
+		if source.SecretRef != nil {
+			references = append(references, SecretReference{
+				Name:     source.SecretRef.Name,
+				Optional: source.SecretRef.Optional != nil && *source.SecretRef.Optional,
+			})
+		}
+	}
+	for _, secret := range instance.Spec.ConfigSecrets {
+		references = append(references, SecretReference{
+			Name:     secret.SecretKeyRef.Name,
+			Key:      secret.SecretKeyRef.Key,
+			Optional: secret.SecretKeyRef.Optional != nil && *secret.SecretKeyRef.Optional,
+			Mounted:  true,
+		})
+	}
+	return references
+}
+
+// Revision identifies a pod template by its hash
+func Revision(template corev1.PodTemplateSpec) string {
+	data, _ := json.Marshal(template)
+	hash := fnv.New32a()
+	hash.Write(data)
+	return rand.SafeEncodeString(fmt.Sprint(hash.Sum32()))
+}
+
+// TemplateRevision returns the revision a Deployment's pods are rendered from
+func TemplateRevision(deployment *appsv1.Deployment) string {
+	return deployment.Spec.Template.Labels[RevisionLabel]
+}
+
+// Deployment renders a Deployment of an AgentInstance. It selects its pods
+// by name, so that Deployments of several revisions run side by side.
+func Deployment(instance *loopstacksv1.AgentInstance, name, revision string, template corev1.PodTemplateSpec, replicas int32) *appsv1.Deployment {
+	selector := map[string]string{
+		liveness.InstanceLabel: instance.Name,
+		DeploymentLabel:        name,
+	}
+
+	template = *template.DeepCopy()
+	template.Labels[RevisionLabel] = revision
+	template.Labels[DeploymentLabel] = name
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+			Labels: map[string]string{
+				liveness.InstanceLabel: instance.Name,
+				RevisionLabel:          revision,
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: template,
+		},
+	}
+}
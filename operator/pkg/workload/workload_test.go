@@ -0,0 +1,283 @@
+package workload
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	loopstacksv1 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v1"
+	loopstacksv2 "github.com/loopstacks/loopstacks-platform/operator/pkg/apis/v2"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/liveness"
+	"github.com/loopstacks/loopstacks-platform/operator/pkg/protocol"
+)
+
+func secretKey(name, key string) corev1.SecretKeySelector {
+	return corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+}
+
+func resources(cpu, memory string) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	if cpu != "" {
+		list[corev1.ResourceCPU] = resource.MustParse(cpu)
+	}
+	if memory != "" {
+		list[corev1.ResourceMemory] = resource.MustParse(memory)
+	}
+	return list
+}
+
+// render renders the pods of an AgentInstance given in its typed, v2 form
+func render(t *testing.T, agent *loopstacksv2.Agent, instance *loopstacksv2.AgentInstance, secretsHash string) (corev1.PodTemplateSpec, error) {
+	t.Helper()
+	agent.ObjectMeta = metav1.ObjectMeta{Namespace: "default", Name: "support-agent"}
+	agent.Spec.Runtime.Image = "ghcr.io/loopstacks/support-agent:1.0"
+	agent.Spec.Capabilities = []string{"reply"}
+	instance.ObjectMeta = metav1.ObjectMeta{Namespace: "default", Name: "support-prod"}
+
+	var hubAgent loopstacksv1.Agent
+	if err := agent.ConvertTo(&hubAgent); err != nil {
+		t.Fatalf("ConvertTo() error = %v", err)
+	}
+	var hubInstance loopstacksv1.AgentInstance
+	if err := instance.ConvertTo(&hubInstance); err != nil {
+		t.Fatalf("ConvertTo() error = %v", err)
+	}
+	realm := &loopstacksv1.Realm{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "us-realm"}}
+	return PodTemplate(&hubAgent, &hubInstance, realm, secretsHash)
+}
+
+func envVar(container corev1.Container, name string) *corev1.EnvVar {
+	for i := range container.Env {
+		if container.Env[i].Name == name {
+			return &container.Env[i]
+		}
+	}
+	return nil
+}
+
+func TestPodTemplate(t *testing.T) {
+	optional := true
+	tests := []struct {
+		name        string
+		agent       loopstacksv2.Agent
+		instance    loopstacksv2.AgentInstance
+		secretsHash string
+		check       func(t *testing.T, template corev1.PodTemplateSpec)
+	}{
+		{
+			name: "config mount",
+			instance: loopstacksv2.AgentInstance{Spec: loopstacksv2.AgentInstanceSpec{
+				Config: runtime.RawExtension{Raw: []byte(`{"tone":"friendly"}`)},
+				ConfigSecrets: []loopstacksv2.AgentInstanceConfigSecret{
+					{Name: "openai-key", SecretKeyRef: secretKey("model-keys", "openai")},
+				},
+			}},
+			check: func(t *testing.T, template corev1.PodTemplateSpec) {
+				container := template.Spec.Containers[0]
+				wantMount := corev1.VolumeMount{Name: configVolume, MountPath: ConfigDir, ReadOnly: true}
+				if !reflect.DeepEqual(container.VolumeMounts, []corev1.VolumeMount{wantMount}) {
+					t.Errorf("volume mounts = %+v, want %+v", container.VolumeMounts, wantMount)
+				}
+				if env := envVar(container, protocol.EnvConfigDir); env == nil || env.Value != ConfigDir {
+					t.Errorf("%s = %+v, want %s", protocol.EnvConfigDir, env, ConfigDir)
+				}
+				sources := template.Spec.Volumes[0].Projected.Sources
+				if len(sources) != 2 {
+					t.Fatalf("projected sources = %+v, want the config and one secret", sources)
+				}
+				if cm := sources[0].ConfigMap; cm == nil || cm.Name != "support-prod-config" || cm.Items[0].Path != protocol.ConfigFile {
+					t.Errorf("config source = %+v, want %s of support-prod-config", sources[0], protocol.ConfigFile)
+				}
+				if secret := sources[1].Secret; secret == nil || secret.Name != "model-keys" || secret.Items[0].Key != "openai" || secret.Items[0].Path != "secrets/openai-key" {
+					t.Errorf("secret source = %+v, want openai of model-keys at secrets/openai-key", sources[1])
+				}
+			},
+		},
+		{
+			name: "restart on config change",
+			instance: loopstacksv2.AgentInstance{Spec: loopstacksv2.AgentInstanceSpec{
+				Config: runtime.RawExtension{Raw: []byte(`{"tone":"friendly"}`)},
+			}},
+			check: func(t *testing.T, template corev1.PodTemplateSpec) {
+				if template.Annotations[ConfigHashAnnotation] == "" {
+					t.Errorf("annotations = %v, want %s", template.Annotations, ConfigHashAnnotation)
+				}
+			},
+		},
+		{
+			name: "hot reload",
+			instance: loopstacksv2.AgentInstance{Spec: loopstacksv2.AgentInstanceSpec{
+				Config:       runtime.RawExtension{Raw: []byte(`{"tone":"friendly"}`)},
+				ConfigUpdate: ConfigHotReload,
+			}},
+			check: func(t *testing.T, template corev1.PodTemplateSpec) {
+				if _, ok := template.Annotations[ConfigHashAnnotation]; ok {
+					t.Errorf("annotations = %v, want no %s", template.Annotations, ConfigHashAnnotation)
+				}
+			},
+		},
+		{
+			name:        "secrets hash",
+			instance:    loopstacksv2.AgentInstance{Spec: loopstacksv2.AgentInstanceSpec{ConfigUpdate: ConfigHotReload}},
+			secretsHash: "5f4c7b",
+			check: func(t *testing.T, template corev1.PodTemplateSpec) {
+				if template.Annotations[SecretsHashAnnotation] != "5f4c7b" {
+					t.Errorf("annotations = %v, want %s 5f4c7b", template.Annotations, SecretsHashAnnotation)
+				}
+			},
+		},
+		{
+			name: "secret env",
+			agent: loopstacksv2.Agent{Spec: loopstacksv2.AgentSpec{Runtime: loopstacksv2.AgentRuntime{
+				SecretRefs: []loopstacksv2.SecretRef{
+					{Env: "OPENAI_API_KEY", SecretKeyRef: secretKey("model-keys", "openai")},
+					{Env: "SEARCH_API_KEY", SecretKeyRef: secretKey("search-keys", "token")},
+				},
+				EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "shared-env"}}}},
+			}}},
+			instance: loopstacksv2.AgentInstance{Spec: loopstacksv2.AgentInstanceSpec{
+				SecretRefs: []loopstacksv2.SecretRef{
+					{Env: "OPENAI_API_KEY", SecretKeyRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "prod-model-keys"}, Key: "openai", Optional: &optional}},
+				},
+				EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "prod-env"}}}},
+			}},
+			check: func(t *testing.T, template corev1.PodTemplateSpec) {
+				container := template.Spec.Containers[0]
+				for env, want := range map[string]string{"OPENAI_API_KEY": "prod-model-keys", "SEARCH_API_KEY": "search-keys"} {
+					v := envVar(container, env)
+					if v == nil || v.ValueFrom == nil || v.ValueFrom.SecretKeyRef == nil || v.ValueFrom.SecretKeyRef.Name != want {
+						t.Errorf("%s = %+v, want a key of %s", env, v, want)
+					}
+				}
+				if v := envVar(container, "OPENAI_API_KEY"); v != nil && (v.ValueFrom.SecretKeyRef.Optional == nil || !*v.ValueFrom.SecretKeyRef.Optional) {
+					t.Errorf("OPENAI_API_KEY = %+v, want the instance's optional key", v)
+				}
+				var envFrom []string
+				for _, source := range container.EnvFrom {
+					envFrom = append(envFrom, source.SecretRef.Name)
+				}
+				if !reflect.DeepEqual(envFrom, []string{"shared-env", "prod-env"}) {
+					t.Errorf("envFrom = %v, want the Agent's then the AgentInstance's", envFrom)
+				}
+			},
+		},
+		{
+			name: "resource requirements",
+			agent: loopstacksv2.Agent{Spec: loopstacksv2.AgentSpec{Runtime: loopstacksv2.AgentRuntime{
+				Resources: corev1.ResourceRequirements{Requests: resources("100m", "128Mi"), Limits: resources("1", "512Mi")},
+			}}},
+			instance: loopstacksv2.AgentInstance{Spec: loopstacksv2.AgentInstanceSpec{
+				Resources: corev1.ResourceRequirements{Requests: resources("500m", ""), Limits: resources("", "1Gi")},
+			}},
+			check: func(t *testing.T, template corev1.PodTemplateSpec) {
+				got := template.Spec.Containers[0].Resources
+				want := corev1.ResourceRequirements{Requests: resources("500m", "128Mi"), Limits: resources("1", "1Gi")}
+				if got.Requests.Cpu().Cmp(*want.Requests.Cpu()) != 0 || got.Requests.Memory().Cmp(*want.Requests.Memory()) != 0 ||
+					got.Limits.Cpu().Cmp(*want.Limits.Cpu()) != 0 || got.Limits.Memory().Cmp(*want.Limits.Memory()) != 0 {
+					t.Errorf("resources = %+v, want %+v", got, want)
+				}
+			},
+		},
+		{
+			name: "placement",
+			instance: loopstacksv2.AgentInstance{Spec: loopstacksv2.AgentInstanceSpec{Placement: loopstacksv2.AgentInstancePlacement{
+				NodeSelector: map[string]string{"pool": "agents"},
+				Tolerations:  []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+				Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+						{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"us-east-1a"}},
+					}}},
+				}}},
+				TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+					{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.ScheduleAnyway},
+					{MaxSkew: 2, TopologyKey: "kubernetes.io/hostname", WhenUnsatisfiable: corev1.DoNotSchedule, LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "agents"}}},
+				},
+				PriorityClassName: "agents-high",
+			}}},
+			check: func(t *testing.T, template corev1.PodTemplateSpec) {
+				spec := template.Spec
+				if spec.NodeSelector["pool"] != "agents" || spec.PriorityClassName != "agents-high" {
+					t.Errorf("node selector %v, priority class %q", spec.NodeSelector, spec.PriorityClassName)
+				}
+				if len(spec.Tolerations) != 1 || spec.Tolerations[0].Key != "gpu" || spec.Tolerations[0].Effect != corev1.TaintEffectNoSchedule {
+					t.Errorf("tolerations = %+v, want the gpu toleration", spec.Tolerations)
+				}
+				terms := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+				if len(terms) != 1 || terms[0].MatchExpressions[0].Values[0] != "us-east-1a" {
+					t.Errorf("node affinity terms = %+v, want us-east-1a", terms)
+				}
+				spread := spec.TopologySpreadConstraints
+				if len(spread) != 2 {
+					t.Fatalf("topology spread constraints = %+v, want 2", spread)
+				}
+				if !reflect.DeepEqual(spread[0].LabelSelector.MatchLabels, map[string]string{liveness.InstanceLabel: "support-prod"}) {
+					t.Errorf("default label selector = %+v, want the AgentInstance's pods", spread[0].LabelSelector)
+				}
+				if !reflect.DeepEqual(spread[1].LabelSelector.MatchLabels, map[string]string{"app": "agents"}) {
+					t.Errorf("explicit label selector = %+v, want it kept", spread[1].LabelSelector)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := render(t, &tt.agent, &tt.instance, tt.secretsHash)
+			if err != nil {
+				t.Fatalf("PodTemplate() error = %v", err)
+			}
+			if template.Labels[liveness.InstanceLabel] != "support-prod" || template.Labels[AgentLabel] != "support-agent" || template.Labels[RealmLabel] != "us-realm" {
+				t.Errorf("labels = %v", template.Labels)
+			}
+			if tt.secretsHash == "" {
+				if _, ok := template.Annotations[SecretsHashAnnotation]; ok {
+					t.Errorf("annotations = %v, want no %s", template.Annotations, SecretsHashAnnotation)
+				}
+			}
+			tt.check(t, template)
+		})
+	}
+}
+
+// TestPodTemplateRevisions checks which changes of an AgentInstance render
+// a new revision
+func TestPodTemplateRevisions(t *testing.T) {
+	revision := func(strategy loopstacksv2.ConfigUpdateStrategy, config, secretsHash string) string {
+		t.Helper()
+		template, err := render(t, &loopstacksv2.Agent{}, &loopstacksv2.AgentInstance{Spec: loopstacksv2.AgentInstanceSpec{
+			Config:       runtime.RawExtension{Raw: []byte(config)},
+			ConfigUpdate: strategy,
+		}}, secretsHash)
+		if err != nil {
+			t.Fatalf("PodTemplate() error = %v", err)
+		}
+		return Revision(template)
+	}
+
+	restart := revision(ConfigRestart, `{"tone":"friendly"}`, "")
+	if revision(ConfigRestart, `{"tone":"formal"}`, "") == restart {
+		t.Error("config change under Restart kept the revision")
+	}
+	if revision(ConfigRestart, `{"tone":"friendly"}`, "5f4c7b") == restart {
+		t.Error("secrets change under Restart kept the revision")
+	}
+	hotReload := revision(ConfigHotReload, `{"tone":"friendly"}`, "")
+	if revision(ConfigHotReload, `{"tone":"formal"}`, "") != hotReload {
+		t.Error("config change under HotReload changed the revision")
+	}
+}
+
+func TestPodTemplateRejectsRequestsOverLimits(t *testing.T) {
+	agent := &loopstacksv2.Agent{Spec: loopstacksv2.AgentSpec{Runtime: loopstacksv2.AgentRuntime{
+		Resources: corev1.ResourceRequirements{Limits: resources("", "512Mi")},
+	}}}
+	instance := &loopstacksv2.AgentInstance{Spec: loopstacksv2.AgentInstanceSpec{
+		Resources: corev1.ResourceRequirements{Requests: resources("", "1Gi")},
+	}}
+	if _, err := render(t, agent, instance, ""); err == nil {
+		t.Error("PodTemplate() with a request over its limit error = nil")
+	}
+}